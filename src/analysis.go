@@ -0,0 +1,450 @@
+package toygarble
+
+import (
+    "container/heap"
+    "fmt"
+    "slices"
+)
+
+//
+// Structural analysis of the gate graph
+//
+
+// The live range of a gate's output wire: LastUse is the index of the last
+// gate (in topological order) that consumes the wire, or -1 if nothing does.
+// A wire read as an output or by an assertion is needed until evaluation
+// ends, which LastUse marks with the gate count, one past the last gate.
+type LiveRange struct {
+    Gate        int
+    LastUse     int
+}
+
+// Build the fan-out list of every gate, i.e., the gates that consume it.
+// Returns an error if any gate refers to a nonexistent gate.
+func (circ *Circuit) consumers() ([][]int, error) {
+    fanOut := make([][]int, len(circ.Gates))
+    for i := range circ.Gates {
+        for _, in := range circ.Gates[i].InFrom {
+            if in < 0 || in >= len(circ.Gates) {
+                return nil, fmt.Errorf("gate %d has input from nonexistent gate %d: %w", i, in, ErrOutOfRange)
+            }
+            fanOut[in] = append(fanOut[in], i)
+        }
+    }
+    return fanOut, nil
+}
+
+// Count the output wires taken from each gate. Outputs usually come from
+// OUTPUT gates, but after FuseOutputs they are read straight from logic
+// gates, a use that consumers doesn't list. The circuit must be valid.
+func (circ *Circuit) outputUses() []int {
+    uses := make([]int, len(circ.Gates))
+    for i := 0; i < circ.NumOutputWires; i++ {
+        uses[circ.getOutputGate(i)]++
+    }
+    return uses
+}
+
+// Count the reads of each gate's value from outside the gate graph: as an
+// output wire, or by an assertion. Such a gate has to keep its value until
+// evaluation ends. The circuit must be valid.
+func (circ *Circuit) externalUses() []int {
+    uses := circ.outputUses()
+    for _, a := range circ.Assertions {
+        uses[a.Gate]++
+    }
+    return uses
+}
+
+// A min-heap of gate indices
+type gateHeap []int
+
+func (h gateHeap) Len() int             { return len(h) }
+func (h gateHeap) Less(i, j int) bool   { return h[i] < h[j] }
+func (h gateHeap) Swap(i, j int)        { h[i], h[j] = h[j], h[i] }
+func (h *gateHeap) Push(x any)          { *h = append(*h, x.(int)) }
+func (h *gateHeap) Pop() any {
+    old := *h
+    x := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return x
+}
+
+// Compute an order in which every gate appears after all of the gates
+// feeding it. Returns an error if the circuit contains a cycle.
+//
+// The order is deterministic: whenever several gates are ready, the one
+// with the lowest index comes first. Anything that processes gates in
+// this order (and is otherwise deterministic) produces identical output
+// for identical circuits.
+func (circ *Circuit) TopologicalOrder() ([]int, error) {
+    fanOut, err := circ.consumers()
+    if err != nil {
+        return nil, err
+    }
+
+    // Kahn's algorithm: repeatedly emit the lowest-numbered gate with no
+    // unprocessed inputs
+    inDegree := make([]int, len(circ.Gates))
+    ready := &gateHeap{}
+    for i := range circ.Gates {
+        inDegree[i] = len(circ.Gates[i].InFrom)
+        if inDegree[i] == 0 {
+            *ready = append(*ready, i)
+        }
+    }
+    heap.Init(ready)
+
+    order := make([]int, 0, len(circ.Gates))
+    for ready.Len() > 0 {
+        g := heap.Pop(ready).(int)
+        order = append(order, g)
+
+        for _, c := range fanOut[g] {
+            inDegree[c]--
+            if inDegree[c] == 0 {
+                heap.Push(ready, c)
+            }
+        }
+    }
+
+    if len(order) != len(circ.Gates) {
+        return nil, ErrCycle
+    }
+    return order, nil
+}
+
+// Group the gates into layers for parallel evaluation: each gate's inputs
+// all come from earlier layers, so the gates within a layer can be
+// computed in any order or all at once. Layer 0 holds the inputs and
+// constants, and each gate goes in the earliest layer it can. Output gates
+// that no other gate reads are left out, since they only copy their driver
+// and can be filled in after the last layer. Every other gate is placed,
+// live or not, so once RemoveDeadGates has run on a circuit without copy
+// gates there are Depth()+1 layers. Each layer is sorted by gate index.
+func (circ *Circuit) Layers() ([][]int, error) {
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    fanOut, err := circ.consumers()
+    if err != nil {
+        return nil, err
+    }
+
+    // Kahn's algorithm, a whole frontier at a time: the gates freed by one
+    // layer make up the next
+    inDegree := make([]int, len(circ.Gates))
+    skipped := 0
+    var ready []int
+    for i := range circ.Gates {
+        if circ.Gates[i].GateType == GateOUTPUT && len(fanOut[i]) == 0 {
+            skipped++
+            continue
+        }
+        inDegree[i] = len(circ.Gates[i].InFrom)
+        if inDegree[i] == 0 {
+            ready = append(ready, i)
+        }
+    }
+
+    var layers [][]int
+    placed := skipped
+    for len(ready) > 0 {
+        slices.Sort(ready)
+        layers = append(layers, ready)
+        placed += len(ready)
+
+        var next []int
+        for _, g := range ready {
+            for _, c := range fanOut[g] {
+                inDegree[c]--
+                if inDegree[c] == 0 {
+                    next = append(next, c)
+                }
+            }
+        }
+        ready = next
+    }
+
+    // Gates on or downstream of a cycle never become ready. (A skipped output
+    // can't be on a cycle since nothing reads it, but its driver can.)
+    if placed != len(circ.Gates) {
+        return nil, ErrCycle
+    }
+    return layers, nil
+}
+
+// Compute, for each gate, the last gate in topological order that consumes
+// its output. A streaming evaluator or garbler walking the same order can
+// discard a wire's value once it has processed LastUse. The result is
+// indexed by gate; returns nil if the circuit is invalid or has no
+// topological order.
+func (circ *Circuit) LiveRanges() []LiveRange {
+    if !circ.validCircuit() {
+        return nil
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil
+    }
+
+    result := make([]LiveRange, len(circ.Gates))
+    for i := range result {
+        result[i] = LiveRange{i, -1}
+    }
+
+    // Walking in order, the last consumer we see for a gate is its last use
+    for _, g := range order {
+        for _, in := range circ.Gates[g].InFrom {
+            result[in].LastUse = g
+        }
+    }
+
+    // Outputs (including those FuseOutputs moved onto logic gates) and
+    // asserted gates are read after the last gate
+    external := circ.externalUses()
+    for g := range result {
+        if external[g] > 0 {
+            result[g].LastUse = len(circ.Gates)
+        }
+    }
+
+    return result
+}
+
+// Mark every gate in the transitive fan-in of the given gates (including
+// the gates themselves)
+func (circ *Circuit) cone(roots []int) []bool {
+    inCone := make([]bool, len(circ.Gates))
+    stack := append([]int(nil), roots...)
+    for len(stack) > 0 {
+        g := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+        if inCone[g] {
+            continue
+        }
+        inCone[g] = true
+        stack = append(stack, circ.Gates[g].InFrom...)
+    }
+    return inCone
+}
+
+// List the gates in the transitive fan-in of the given gates so that each
+// comes after all of the gates feeding it. Unlike TopologicalOrder this
+// only visits the cone, so it is cheap for a small part of a big circuit.
+// Returns ErrCycle if the cone contains a cycle; the circuit must
+// otherwise be valid.
+func (circ *Circuit) coneOrder(roots []int) ([]int, error) {
+    const (
+        unvisited = iota
+        visiting
+        done
+    )
+    state := make([]byte, len(circ.Gates))
+    order := make([]int, 0)
+
+    // Depth-first, emitting a gate once all of its inputs are done. Each
+    // stack entry is a gate and how many of its inputs have been pushed.
+    type frame struct {
+        gate    int
+        next    int
+    }
+    var stack []frame
+    for _, root := range roots {
+        if state[root] != unvisited {
+            continue
+        }
+        state[root] = visiting
+        stack = append(stack, frame{root, 0})
+        for len(stack) > 0 {
+            top := &stack[len(stack)-1]
+            in := circ.Gates[top.gate].InFrom
+            if top.next == len(in) {
+                state[top.gate] = done
+                order = append(order, top.gate)
+                stack = stack[:len(stack)-1]
+                continue
+            }
+            from := in[top.next]
+            top.next++
+            switch state[from] {
+            case visiting:
+                return nil, ErrCycle
+            case unvisited:
+                state[from] = visiting
+                stack = append(stack, frame{from, 0})
+            }
+        }
+    }
+    return order, nil
+}
+
+// Find up to maxPaths distinct paths from gate from to gate to, each listed
+// as the sequence of gates from one end to the other. Paths grow
+// exponentially with reconvergent fan-out, so the search stops as soon as
+// maxPaths have been found; since it never explores a branch that can't
+// reach to, the work is bounded by maxPaths times the circuit depth.
+func (circ *Circuit) PathsBetween(from, to int, maxPaths int) ([][]int, error) {
+    if from < 0 || from >= len(circ.Gates) || to < 0 || to >= len(circ.Gates) {
+        return nil, fmt.Errorf("gate out of range (%d gates): %w", len(circ.Gates), ErrOutOfRange)
+    }
+    if maxPaths < 1 {
+        return nil, fmt.Errorf("maxPaths must be positive, got %d: %w", maxPaths, ErrOutOfRange)
+    }
+    if _, err := circ.TopologicalOrder(); err != nil {
+        return nil, err
+    }
+    fanOut, err := circ.consumers()
+    if err != nil {
+        return nil, err
+    }
+
+    // Only gates feeding into to can lie on a path
+    usable := circ.cone([]int{to})
+    if !usable[from] {
+        return [][]int{}, nil
+    }
+
+    result := make([][]int, 0)
+    path := []int{from}
+    var walk func(g int)
+    walk = func(g int) {
+        if g == to {
+            result = append(result, append([]int(nil), path...))
+            return
+        }
+        for k, next := range fanOut[g] {
+            if len(result) >= maxPaths {
+                return
+            }
+            // A gate using g twice (e.g. AND(g, g)) is listed twice in a row
+            if k > 0 && fanOut[g][k-1] == next {
+                continue
+            }
+            if usable[next] {
+                path = append(path, next)
+                walk(next)
+                path = path[:len(path)-1]
+            }
+        }
+    }
+    walk(from)
+
+    return result, nil
+}
+
+// Compute for each gate the largest total weight of the gates along any
+// path from an input to it (including itself)
+func (circ *Circuit) weightedDepths(weight func(GateType_t) int) ([]int, error) {
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, err
+    }
+
+    depth := make([]int, len(circ.Gates))
+    for _, g := range order {
+        d := 0
+        for _, from := range circ.Gates[g].InFrom {
+            d = max(d, depth[from])
+        }
+        depth[g] = d + weight(circ.Gates[g].GateType)
+    }
+    return depth, nil
+}
+
+// Gates that do no logic of their own, and so don't add to the depth
+func isWiringGate(gateType GateType_t) bool {
+    switch gateType {
+    case GateINPUT, GateOUTPUT, GateCONST, GateCOPY:
+        return true
+    }
+    return false
+}
+
+// The number of logic gates on the longest path from an input to an output.
+// Inputs, outputs, constants and copies don't count.
+func (circ *Circuit) Depth() (int, error) {
+    depth, err := circ.weightedDepths(func(gateType GateType_t) int {
+        if isWiringGate(gateType) {
+            return 0
+        }
+        return 1
+    })
+    if err != nil {
+        return 0, err
+    }
+
+    result := 0
+    for i := 0; i < circ.NumOutputWires; i++ {
+        result = max(result, depth[circ.getOutputGate(i)])
+    }
+    return result, nil
+}
+
+// A longest path from an input to an output, as the gates along it in
+// order, starting at an input (or constant) and ending at an output gate.
+// Its logic gates number Depth(), and they are where the circuit's delay
+// comes from. Ties go to the lowest-numbered output and the earliest input
+// of each gate.
+func (circ *Circuit) CriticalPath() ([]int, error) {
+    depth, err := circ.weightedDepths(func(gateType GateType_t) int {
+        if isWiringGate(gateType) {
+            return 0
+        }
+        return 1
+    })
+    if err != nil {
+        return nil, err
+    }
+    if circ.NumOutputWires == 0 {
+        return nil, nil
+    }
+
+    g := circ.getOutputGate(0)
+    for i := 1; i < circ.NumOutputWires; i++ {
+        if out := circ.getOutputGate(i); depth[out] > depth[g] {
+            g = out
+        }
+    }
+
+    // Walk back from the output through the deepest input of each gate
+    path := []int{g}
+    for len(circ.Gates[g].InFrom) > 0 {
+        from := circ.Gates[g].InFrom
+        prev := from[0]
+        for _, f := range from[1:] {
+            if depth[f] > depth[prev] {
+                prev = f
+            }
+        }
+        g = prev
+        path = append(path, g)
+    }
+    slices.Reverse(path)
+    return path, nil
+}
+
+// The number of nonlinear gates (those that aren't free under Free-XOR,
+// such as AND and OR) on the longest path from an input to an output.
+// XOR, NOT and wiring don't count. MUX, TOFFLI and MAJ gates each hide one AND,
+// and a LUT counts as one level whatever its degree.
+func (circ *Circuit) MultiplicativeDepth() (int, error) {
+    depth, err := circ.weightedDepths(func(gateType GateType_t) int {
+        if gateType == GateINPUT || gateType == GateOUTPUT || isFreeGate(gateType) {
+            return 0
+        }
+        return 1
+    })
+    if err != nil {
+        return 0, err
+    }
+
+    result := 0
+    for i := 0; i < circ.NumOutputWires; i++ {
+        result = max(result, depth[circ.getOutputGate(i)])
+    }
+    return result, nil
+}
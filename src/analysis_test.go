@@ -0,0 +1,473 @@
+package toygarble
+
+import (
+    "errors"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+func TestTopologicalOrder(t *testing.T) {
+    rng := rand.New(rand.NewSource(105))
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 5, 40, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        order, err := circ.TopologicalOrder()
+        if err != nil {
+            t.Fatal(err)
+        }
+        position := make([]int, len(circ.Gates))
+        for k, g := range order {
+            position[g] = k
+        }
+        for g := range circ.Gates {
+            for _, from := range circ.Gates[g].InFrom {
+                if position[from] >= position[g] {
+                    t.Fatalf("circuit %d: gate %d comes before its input %d", it, g, from)
+                }
+            }
+        }
+        again, _ := circ.Clone().TopologicalOrder()
+        if !slices.Equal(order, again) {
+            t.Fatalf("circuit %d: order isn't deterministic", it)
+        }
+    }
+
+    // Feed the last gate of an adder back into its first gate with inputs
+    circ := BuildAdder(2)
+    first := circ.NumInputWires + circ.NumOutputWires
+    for len(circ.Gates[first].InFrom) == 0 {
+        first++
+    }
+    circ.Gates[first].InFrom[0] = len(circ.Gates) - 1
+    if _, err := circ.TopologicalOrder(); !errors.Is(err, ErrCycle) {
+        t.Errorf("cyclic circuit: got %v, want ErrCycle", err)
+    }
+    if circ.LiveRanges() != nil {
+        t.Error("cyclic circuit has live ranges")
+    }
+}
+
+func TestLiveRanges(t *testing.T) {
+    // z = (x0 & x1) ^ x0
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    a := b.And(x[0], x[1])
+    z := b.Xor(a, x[0])
+    circ, err := b.Output("z", z).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Inputs 0 and 1, the output at 2, then the AND at 3 and the XOR at 4
+    want := []int{4, 3, len(circ.Gates), 4, 2}
+    ranges := circ.LiveRanges()
+    if len(ranges) != len(want) {
+        t.Fatalf("got %d live ranges, want %d", len(ranges), len(want))
+    }
+    for g, r := range ranges {
+        if r.Gate != g || r.LastUse != want[g] {
+            t.Errorf("gate %d: got %+v, want last use %d", g, r, want[g])
+        }
+    }
+}
+
+// Once FuseOutputs moves an output onto a logic gate, the gate's value is
+// needed after its last consumer
+func TestLiveRangesFusedOutputs(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    mid := b.And(x[0], x[1])
+    all := b.And(mid, x[2])
+    circ, err := b.Output("mid", mid).Output("all", all).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if circ.FuseOutputs() != 2 {
+        t.Fatal("outputs not fused")
+    }
+    ranges := circ.LiveRanges()
+    for i := 0; i < circ.NumOutputWires; i++ {
+        g := circ.getOutputGate(i)
+        if ranges[g].LastUse != len(circ.Gates) {
+            t.Errorf("output %d on gate %d: last use %d, want %d", i, g, ranges[g].LastUse, len(circ.Gates))
+        }
+    }
+
+    // A gate checked by an assertion is needed to the end too
+    circ = BuildAdder(2)
+    if err := circ.AddAssertion(len(circ.Gates) - 2, false); err != nil {
+        t.Fatal(err)
+    }
+    if r := circ.LiveRanges()[len(circ.Gates) - 2]; r.LastUse != len(circ.Gates) {
+        t.Errorf("asserted gate: last use %d, want %d", r.LastUse, len(circ.Gates))
+    }
+}
+
+func TestLiveRangesInvalid(t *testing.T) {
+    circ := BuildAdder(2)
+    circ.OutputGates = []int{-1, 0}
+    mustNotPanic(t, "LiveRanges", func() {
+        if ranges := circ.LiveRanges(); ranges != nil {
+            t.Errorf("got %v for an invalid circuit", ranges)
+        }
+    })
+}
+
+// An input read only by the first gate of a long chain is dead long before
+// the end
+func TestLiveRangesEarlyConsumer(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 10)
+    acc := b.And(x[0], x[1])
+    for _, w := range x[2:] {
+        acc = b.Xor(acc, w)
+    }
+    circ, err := b.Output("out", acc).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    order, _ := circ.TopologicalOrder()
+    position := make([]int, len(circ.Gates))
+    for k, g := range order {
+        position[g] = k
+    }
+    ranges := circ.LiveRanges()
+    input := circ.getInputGate(0)
+    last := ranges[input].LastUse
+    if last < 0 || last >= len(circ.Gates) || circ.Gates[last].GateType != GateAND {
+        t.Fatalf("input 0 last used by gate %d", last)
+    }
+    if position[last] - position[input] > 11 {
+        t.Errorf("input 0 lives from position %d to %d", position[input], position[last])
+    }
+}
+
+// Evaluating in topological order while discarding each value after its
+// last use gives the same outputs, and never reads a discarded value
+func TestLiveRangesStreaming(t *testing.T) {
+    rng := rand.New(rand.NewSource(5))
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 5, 40, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        order, _ := circ.TopologicalOrder()
+        ranges := circ.LiveRanges()
+        position := make([]int, len(circ.Gates) + 1)
+        for k, g := range order {
+            position[g] = k
+        }
+        position[len(circ.Gates)] = len(order)
+
+        // Free each gate's value as soon as the walk passes its last use
+        freedAt := make([][]int, len(order) + 1)
+        for g, r := range ranges {
+            if r.LastUse >= 0 {
+                freedAt[position[r.LastUse]] = append(freedAt[position[r.LastUse]], g)
+            }
+        }
+        live := make([]bool, len(circ.Gates))
+        for k, g := range order {
+            for _, from := range circ.Gates[g].InFrom {
+                if !live[from] {
+                    t.Fatalf("circuit %d: gate %d reads freed gate %d", it, g, from)
+                }
+            }
+            live[g] = true
+            for _, f := range freedAt[k] {
+                live[f] = false
+            }
+        }
+        for i := 0; i < circ.NumOutputWires; i++ {
+            if !live[circ.getOutputGate(i)] {
+                t.Fatalf("circuit %d: output %d freed before the end", it, i)
+            }
+        }
+    }
+}
+
+// Whenever several gates are ready, the lowest-numbered one comes first
+func TestTopologicalOrderTieBreak(t *testing.T) {
+    rng := rand.New(rand.NewSource(110))
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 5, 40, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        order, err := circ.TopologicalOrder()
+        if err != nil {
+            t.Fatal(err)
+        }
+        done := make([]bool, len(circ.Gates))
+        for k, g := range order {
+            for h := 0; h < g; h++ {
+                if done[h] {
+                    continue
+                }
+                ready := true
+                for _, from := range circ.Gates[h].InFrom {
+                    ready = ready && done[from]
+                }
+                if ready {
+                    t.Fatalf("circuit %d: position %d has gate %d while gate %d is ready", it, k, g, h)
+                }
+            }
+            done[g] = true
+        }
+    }
+
+    // Gates numbered against the dependency order: gate 3 reads gate 4
+    circ := &Circuit{
+        NumInputWires:  2,
+        NumOutputWires: 1,
+        NumInputVars:   1,
+        NumOutputVars:  1,
+        NumWiresIV:     []int{2},
+        NumWiresOV:     []int{1},
+        Gates: []Gate{
+            {GateType: GateINPUT},
+            {GateType: GateINPUT},
+            {GateType: GateOUTPUT, InFrom: []int{3}},
+            {GateType: GateAND, InFrom: []int{4, 1}},
+            {GateType: GateNOT, InFrom: []int{0}},
+        },
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []int{0, 1, 4, 3, 2}; !slices.Equal(order, want) {
+        t.Errorf("got order %v, want %v", order, want)
+    }
+}
+
+func TestPathsBetweenDiamond(t *testing.T) {
+    // x splits through a NOT and a COPY that meet again at an AND:
+    // gate 0 is x, 1 the output, then NOT, COPY and AND
+    b := NewBuilder()
+    x := b.Input("x", 1)
+    circ, err := b.Output("out", b.And(b.Not(x[0]), b.Copy(x[0]))).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    paths, err := circ.PathsBetween(0, 1, 10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := [][]int{{0, 2, 4, 1}, {0, 3, 4, 1}}
+    if len(paths) != len(want) || !slices.Equal(paths[0], want[0]) || !slices.Equal(paths[1], want[1]) {
+        t.Errorf("paths from x to the output: %v, want %v", paths, want)
+    }
+
+    // The cap stops the search early
+    if paths, err := circ.PathsBetween(0, 1, 1); err != nil || len(paths) != 1 {
+        t.Errorf("capped at one path: %v, %v", paths, err)
+    }
+
+    // A gate is a path to itself; the two sides of the diamond aren't
+    // connected at all
+    if paths, err := circ.PathsBetween(4, 4, 10); err != nil || len(paths) != 1 || !slices.Equal(paths[0], []int{4}) {
+        t.Errorf("from a gate to itself: %v, %v", paths, err)
+    }
+    if paths, err := circ.PathsBetween(2, 3, 10); err != nil || paths == nil || len(paths) != 0 {
+        t.Errorf("between the two sides: %v, %v", paths, err)
+    }
+
+    for _, c := range [][3]int{{-1, 1, 1}, {0, 5, 1}, {0, 1, 0}} {
+        if _, err := circ.PathsBetween(c[0], c[1], c[2]); !errors.Is(err, ErrOutOfRange) {
+            t.Errorf("PathsBetween(%d, %d, %d): %v", c[0], c[1], c[2], err)
+        }
+    }
+}
+
+// Reconvergent fan-out doubles the paths at each stage, but the search
+// still stops at the cap
+func TestPathsBetweenCapped(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 1)
+    w := x[0]
+    for i := 0; i < 30; i++ {
+        w = b.And(b.Not(w), b.Copy(w))
+    }
+    circ, err := b.Output("out", w).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    paths, err := circ.PathsBetween(0, 1, 100)
+    if err != nil || len(paths) != 100 {
+        t.Fatalf("got %d paths, %v; want 100", len(paths), err)
+    }
+    for _, p := range paths {
+        if len(p) != 2 + 2 * 30 || p[0] != 0 || p[len(p)-1] != 1 {
+            t.Fatalf("bad path %v", p)
+        }
+    }
+}
+
+// Inputs, outputs, constants and copies add nothing to the depth
+func TestDepth(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    deep := b.Not(b.And(b.Copy(x[0]), b.Xor(x[1], b.Const(true))))
+    circ, err := b.Output("out", b.Copy(x[2]), deep).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if d, err := circ.Depth(); err != nil || d != 3 {
+        t.Errorf("Depth() = %d, %v; want 3", d, err)
+    }
+
+    b = NewBuilder()
+    wiring, err := b.Output("out", b.Const(false)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if d, err := wiring.Depth(); err != nil || d != 0 {
+        t.Errorf("constant output: Depth() = %d, %v; want 0", d, err)
+    }
+
+    circ.Gates[len(circ.Gates)-1].InFrom[0] = len(circ.Gates)
+    if _, err := circ.Depth(); err == nil {
+        t.Error("Depth of an invalid circuit succeeded")
+    }
+}
+
+func TestMultiplicativeDepth(t *testing.T) {
+    xors := buildChain(t, GateXOR, 16)
+    if d, err := xors.MultiplicativeDepth(); err != nil || d != 0 {
+        t.Errorf("XOR chain: multiplicative depth %d, %v; want 0", d, err)
+    }
+    ands := buildChain(t, GateAND, 16)
+    if d, err := ands.MultiplicativeDepth(); err != nil || d != 15 {
+        t.Errorf("chain of 15 ANDs: multiplicative depth %d, %v; want 15", d, err)
+    }
+
+    // NOTs and XORs between the ANDs don't count; the deepest output wins
+    b := NewBuilder()
+    x := b.Input("x", 4)
+    mixed := b.And(b.Xor(b.Not(b.And(x[0], x[1])), x[2]), x[3])
+    circ, err := b.Output("out", b.Xor(x[0], x[1]), mixed).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if d, err := circ.MultiplicativeDepth(); err != nil || d != 2 {
+        t.Errorf("multiplicative depth %d, %v; want 2", d, err)
+    }
+
+    // A cycle is an error
+    driver := circ.Gates[circ.getOutputGate(1)].InFrom[0]
+    circ.Gates[driver].InFrom[0] = driver
+    if _, err := circ.MultiplicativeDepth(); !errors.Is(err, ErrCycle) {
+        t.Errorf("cycle: got %v", err)
+    }
+}
+
+// The longest path through a ripple-carry adder runs along the whole carry
+// chain into the top sum bit
+func TestCriticalPath(t *testing.T) {
+    const width = 8
+    b := NewBuilder()
+    x := b.Input("x", width)
+    y := b.Input("y", width)
+    sum := make([]Wire, width)
+    carry := b.Const(false)
+    for i := 0; i < width - 1; i++ {
+        sum[i], carry = b.FullAdder(x[i], y[i], carry)
+    }
+    sum[width - 1] = b.Xor(b.Xor(x[width - 1], y[width - 1]), carry)
+    circ, err := b.Output("sum", sum...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    path, err := circ.CriticalPath()
+    if err != nil {
+        t.Fatal(err)
+    }
+    depth, err := circ.Depth()
+    if err != nil {
+        t.Fatal(err)
+    }
+    logic := 0
+    for k, g := range path {
+        if !isWiringGate(circ.Gates[g].GateType) {
+            logic++
+        }
+        if k > 0 && !slices.Contains(circ.Gates[g].InFrom, path[k - 1]) {
+            t.Fatalf("gate %d on the path doesn't take input from gate %d", g, path[k - 1])
+        }
+    }
+    if logic != depth {
+        t.Errorf("path has %d logic gates, depth is %d", logic, depth)
+    }
+    if last := path[len(path) - 1]; last != circ.getOutputGate(width - 1) {
+        t.Errorf("path ends at gate %d, not the top sum bit", last)
+    }
+    for g := range circ.Gates {
+        if circ.Gates[g].GateType == GateMAJ && !slices.Contains(path, g) {
+            t.Errorf("carry gate %d is not on the path %v", g, path)
+        }
+    }
+
+    if path, err := (&Circuit{}).CriticalPath(); err != nil || path != nil {
+        t.Errorf("empty circuit: got %v (%v)", path, err)
+    }
+}
+
+// Each gate goes one layer after its latest input, and a circuit without
+// dead or copy gates has Depth()+1 layers
+func TestLayers(t *testing.T) {
+    for name, circ := range map[string]*Circuit{
+        "ripple adder":    BuildAdder(8),
+        "lookahead adder": BuildCarryLookaheadAdder(8),
+        "popcount":        BuildPopCount(13),
+    } {
+        circ.RemoveDeadGates()
+        layers, err := circ.Layers()
+        if err != nil {
+            t.Fatal(err)
+        }
+        depth, err := circ.Depth()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(layers) != depth + 1 {
+            t.Errorf("%s: %d layers at depth %d", name, len(layers), depth)
+        }
+
+        layerOf := make(map[int]int)
+        placed := 0
+        for k, layer := range layers {
+            if !slices.IsSorted(layer) {
+                t.Errorf("%s: layer %d isn't sorted", name, k)
+            }
+            for _, g := range layer {
+                layerOf[g] = k
+            }
+            placed += len(layer)
+        }
+        if placed + circ.NumOutputWires != len(circ.Gates) {
+            t.Errorf("%s: placed %d of %d gates", name, placed, len(circ.Gates))
+        }
+        for k, layer := range layers {
+            for _, g := range layer {
+                latest := -1
+                for _, in := range circ.Gates[g].InFrom {
+                    latest = max(latest, layerOf[in])
+                }
+                if latest + 1 != k {
+                    t.Fatalf("%s: gate %d is in layer %d, its inputs end by layer %d", name, g, k, latest)
+                }
+            }
+        }
+    }
+
+    cyclic := BuildAdder(2)
+    cyclic.Gates[len(cyclic.Gates) - 1].InFrom[0] = len(cyclic.Gates) - 1
+    if _, err := cyclic.Layers(); err == nil {
+        t.Error("layered a cyclic circuit")
+    }
+}
@@ -0,0 +1,185 @@
+package toygarble
+
+//
+// Builders for integer arithmetic circuits. Operands are unsigned and
+// stored least significant wire first.
+//
+
+const (
+    // Widest operand accepted by the arithmetic builders
+    MAX_ARITHMETIC_WIDTH    int = 64
+)
+
+// Ripple-carry addition of x, y and a carry in, returning the sum and the
+// carry out. Each bit costs one AND, using carry = (x AND y) XOR (t AND c)
+// where t = x XOR y (the two terms are never both set).
+func (b *Builder) add(x []Wire, y []Wire, carry Wire) ([]Wire, Wire) {
+    sum := make([]Wire, len(x))
+    for i := range x {
+        t := b.Xor(x[i], y[i])
+        sum[i] = b.Xor(t, carry)
+        carry = b.Xor(x[i], b.And(t, b.Xor(x[i], carry)))
+    }
+    return sum, carry
+}
+
+// Carry-lookahead addition of x and y, returning the sum and the carry
+// out. Generate and propagate signals for ever longer runs of bits are
+// combined as a parallel prefix (Kogge-Stone), so the carries take
+// O(log width) levels instead of width. A run can't both generate and
+// propagate, so combining needs only ANDs and XORs.
+func (b *Builder) lookaheadAdd(x []Wire, y []Wire) ([]Wire, Wire) {
+    width := len(x)
+    p := make([]Wire, width)
+    gen := make([]Wire, width)
+    prop := make([]Wire, width)
+    for i := range x {
+        p[i] = b.Xor(x[i], y[i])
+        gen[i] = b.And(x[i], y[i])
+        prop[i] = p[i]
+    }
+
+    // After the pass for distance d, gen[i] and prop[i] cover bits
+    // i-2d+1 through i (or from 0)
+    for d := 1; d < width; d *= 2 {
+        nextGen := append([]Wire(nil), gen...)
+        nextProp := append([]Wire(nil), prop...)
+        for i := d; i < width; i++ {
+            nextGen[i] = b.Xor(gen[i], b.And(prop[i], gen[i - d]))
+            if i >= 2 * d {
+                nextProp[i] = b.And(prop[i], prop[i - d])
+            }
+        }
+        gen, prop = nextGen, nextProp
+    }
+
+    sum := make([]Wire, width)
+    sum[0] = p[0]
+    for i := 1; i < width; i++ {
+        sum[i] = b.Xor(p[i], gen[i - 1])
+    }
+    return sum, gen[width - 1]
+}
+
+// Subtraction x - y, as x + NOT(y) + 1, returning the difference and
+// whether it borrowed (y > x)
+func (b *Builder) sub(x []Wire, y []Wire) ([]Wire, Wire) {
+    notY := make([]Wire, len(y))
+    for i := range y {
+        notY[i] = b.Not(y[i])
+    }
+    diff, carry := b.add(x, notY, b.Const(true))
+    return diff, b.Not(carry)
+}
+
+// Build a circuit with width-bit input variables "x" and "y" from op, or
+// nil if width is not between 1 and MAX_ARITHMETIC_WIDTH
+func buildBinaryOp(width int, output string, op func(b *Builder, x []Wire, y []Wire) []Wire) *Circuit {
+    if width < 1 || width > MAX_ARITHMETIC_WIDTH {
+        return nil
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", width)
+    y := b.Input("y", width)
+    circ, err := b.Output(output, op(b, x, y)...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Build an adder of two width-bit inputs "x" and "y", with output "sum"
+// wrapping around mod 2^width. Returns nil if width is not between 1 and
+// MAX_ARITHMETIC_WIDTH.
+func BuildAdder(width int) *Circuit {
+    return buildBinaryOp(width, "sum", func(b *Builder, x []Wire, y []Wire) []Wire {
+        sum, _ := b.add(x, y, b.Const(false))
+        return sum
+    })
+}
+
+// Like BuildAdder, but with a carry-lookahead adder, whose depth grows
+// with the log of width rather than with width itself, at the cost of
+// about 2 * width * log2(width) ANDs instead of width
+func BuildCarryLookaheadAdder(width int) *Circuit {
+    return buildBinaryOp(width, "sum", func(b *Builder, x []Wire, y []Wire) []Wire {
+        sum, _ := b.lookaheadAdd(x, y)
+        return sum
+    })
+}
+
+// Build a subtractor of two width-bit inputs "x" and "y", with output
+// "diff" = x - y wrapping around mod 2^width. Returns nil if width is not
+// between 1 and MAX_ARITHMETIC_WIDTH.
+func BuildSubtractor(width int) *Circuit {
+    return buildBinaryOp(width, "diff", func(b *Builder, x []Wire, y []Wire) []Wire {
+        diff, _ := b.sub(x, y)
+        return diff
+    })
+}
+
+// Like BuildAdder, but the sum sticks at 2^width - 1 instead of wrapping:
+// the carry out selects all ones
+func BuildSaturatingAdder(width int) *Circuit {
+    return buildBinaryOp(width, "sum", func(b *Builder, x []Wire, y []Wire) []Wire {
+        sum, carry := b.add(x, y, b.Const(false))
+        one := b.Const(true)
+        for i := range sum {
+            sum[i] = b.Mux(carry, sum[i], one)
+        }
+        return sum
+    })
+}
+
+// Like BuildSubtractor, but the difference sticks at 0 instead of wrapping:
+// the borrow selects all zeros
+func BuildSaturatingSubtractor(width int) *Circuit {
+    return buildBinaryOp(width, "diff", func(b *Builder, x []Wire, y []Wire) []Wire {
+        diff, borrow := b.sub(x, y)
+        zero := b.Const(false)
+        for i := range diff {
+            diff[i] = b.Mux(borrow, diff[i], zero)
+        }
+        return diff
+    })
+}
+
+// Build a divider of two width-bit inputs "x" and "y" by restoring
+// division, with outputs "quotient" and "remainder". Division by zero
+// gives a quotient of all ones and the dividend as the remainder, which is
+// what the algorithm produces when no trial subtraction ever borrows.
+// Returns nil if width is not between 1 and MAX_ARITHMETIC_WIDTH.
+func BuildDivMod(width int) *Circuit {
+    if width < 1 || width > MAX_ARITHMETIC_WIDTH {
+        return nil
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", width)
+    y := b.Input("y", width)
+
+    // The partial remainder is always less than y, so it fits in width
+    // bits; shifted left it needs one more, as does y to match
+    zero := b.Const(false)
+    yExt := append(append([]Wire(nil), y...), zero)
+    rem := make([]Wire, width)
+    for i := range rem {
+        rem[i] = zero
+    }
+    quotient := make([]Wire, width)
+    for i := width - 1; i >= 0; i-- {
+        shifted := append([]Wire{x[i]}, rem...)
+        diff, borrow := b.sub(shifted, yExt)
+        quotient[i] = b.Not(borrow)
+        for j := range rem {
+            rem[j] = b.Mux(borrow, diff[j], shifted[j])
+        }
+    }
+
+    circ, err := b.Output("quotient", quotient...).Output("remainder", rem...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
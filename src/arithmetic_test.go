@@ -0,0 +1,164 @@
+package toygarble
+
+import (
+    "math/bits"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+// Check a circuit with two width-bit inputs against f on every input pair
+func checkBinaryOp(t *testing.T, name string, circ *Circuit, width int, f func(x, y int64) int64) {
+    t.Helper()
+    if circ == nil {
+        t.Fatalf("%s: no circuit", name)
+    }
+    for x := int64(0); x < 1 << width; x++ {
+        for y := int64(0); y < 1 << width; y++ {
+            out, err := circ.EvaluateInts([]int64{x, y}, []int{width, width})
+            if err != nil {
+                t.Fatalf("%s: %v", name, err)
+            }
+            if want := f(x, y); out[0] != want {
+                t.Fatalf("%s(%d, %d) = %d, want %d", name, x, y, out[0], want)
+            }
+        }
+    }
+}
+
+func TestArithmeticBuilders(t *testing.T) {
+    const width = 4
+    const mask = 1 << width - 1
+    checkBinaryOp(t, "add", BuildAdder(width), width, func(x, y int64) int64 { return (x + y) & mask })
+    checkBinaryOp(t, "sub", BuildSubtractor(width), width, func(x, y int64) int64 { return (x - y) & mask })
+    checkBinaryOp(t, "saturating add", BuildSaturatingAdder(width), width, func(x, y int64) int64 { return min(x + y, mask) })
+    checkBinaryOp(t, "saturating sub", BuildSaturatingSubtractor(width), width, func(x, y int64) int64 { return max(x - y, 0) })
+
+    for _, build := range []func(int) *Circuit{BuildAdder, BuildSubtractor, BuildSaturatingAdder, BuildSaturatingSubtractor} {
+        if build(0) != nil || build(MAX_ARITHMETIC_WIDTH + 1) != nil {
+            t.Error("built an arithmetic circuit of a bad width")
+        }
+    }
+}
+
+// The lookahead adder has the same truth table as the ripple adder at small
+// widths, agrees with it at large ones, and is much shallower
+func TestCarryLookaheadAdder(t *testing.T) {
+    for width := 1; width <= 6; width++ {
+        want, err := BuildAdder(width).TruthTable()
+        if err != nil {
+            t.Fatal(err)
+        }
+        got, err := BuildCarryLookaheadAdder(width).TruthTable()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !slices.EqualFunc(got, want, slices.Equal) {
+            t.Errorf("width %d: truth tables differ", width)
+        }
+    }
+
+    add := func(in []int64) []int64 { return []int64{in[0] + in[1]} }
+    for _, width := range []int{8, 32, 64} {
+        circ := BuildCarryLookaheadAdder(width)
+        if err := circ.VerifyRelation(add, []int{width, width}, []int{width}, 200, rand.New(rand.NewSource(173))); err != nil {
+            t.Errorf("width %d: %v", width, err)
+        }
+        ripple, err := BuildAdder(width).Depth()
+        if err != nil {
+            t.Fatal(err)
+        }
+        lookahead, err := circ.Depth()
+        if err != nil {
+            t.Fatal(err)
+        }
+        // Two levels per prefix pass, plus the XORs at either end
+        if bound := 2 * bits.Len(uint(width - 1)) + 3; lookahead > bound || lookahead >= ripple {
+            t.Errorf("width %d: depth %d, ripple adder %d", width, lookahead, ripple)
+        }
+    }
+    if BuildCarryLookaheadAdder(0) != nil {
+        t.Error("built a zero-width adder")
+    }
+}
+
+// Saturation kicks in exactly one step past either end of the range
+func TestSaturatingBoundaries(t *testing.T) {
+    add := BuildSaturatingAdder(8)
+    sub := BuildSaturatingSubtractor(8)
+    cases := []struct {
+        circ    *Circuit
+        name    string
+        x, y    int64
+        want    int64
+    }{
+        {add, "254 + 1", 254, 1, 255},
+        {add, "255 + 0", 255, 0, 255},
+        {add, "max + 1", 255, 1, 255},
+        {add, "max + max", 255, 255, 255},
+        {add, "128 + 128", 128, 128, 255},
+        {sub, "1 - 1", 1, 1, 0},
+        {sub, "0 - 0", 0, 0, 0},
+        {sub, "0 - 1", 0, 1, 0},
+        {sub, "0 - max", 0, 255, 0},
+        {sub, "200 - 201", 200, 201, 0},
+        {sub, "201 - 200", 201, 200, 1},
+    }
+    for _, c := range cases {
+        out, err := c.circ.EvaluateInts([]int64{c.x, c.y}, []int{8, 8})
+        if err != nil || out[0] != c.want {
+            t.Errorf("%s = %v, %v; want %d", c.name, out, err, c.want)
+        }
+    }
+}
+
+// Division by zero gives an all-ones quotient and the dividend back
+func TestBuildDivMod(t *testing.T) {
+    for _, width := range []int{1, 3, 5} {
+        circ := BuildDivMod(width)
+        n := int64(1) << width
+        for x := int64(0); x < n; x++ {
+            for y := int64(0); y < n; y++ {
+                out, err := circ.EvaluateInts([]int64{x, y}, []int{width, width})
+                if err != nil {
+                    t.Fatal(err)
+                }
+                q, r := n - 1, x
+                if y != 0 {
+                    q, r = x / y, x % y
+                }
+                if out[0] != q || out[1] != r {
+                    t.Fatalf("width %d: %d divmod %d = %v, want [%d %d]", width, x, y, out, q, r)
+                }
+            }
+        }
+    }
+
+    circ := BuildDivMod(32)
+    if !slices.Equal(circ.OutputVarNames, []string{"quotient", "remainder"}) {
+        t.Fatalf("outputs %v", circ.OutputVarNames)
+    }
+    rng := rand.New(rand.NewSource(1))
+    eval := func(x, y uint32) (int64, int64) {
+        out, err := circ.EvaluateInts([]int64{int64(x), int64(y)}, []int{32, 32})
+        if err != nil {
+            t.Fatal(err)
+        }
+        return out[0], out[1]
+    }
+    for trial := 0; trial < 50; trial++ {
+        x := rng.Uint32()
+        y := rng.Uint32() >> rng.Intn(32)
+        if trial % 10 == 0 {
+            y = 0
+        }
+        q, r := eval(x, y)
+        wantQ, wantR := uint32(1 << 32 - 1), x
+        if y != 0 {
+            wantQ, wantR = x / y, x % y
+        }
+        if q != int64(wantQ) || r != int64(wantR) {
+            t.Errorf("%d divmod %d = %d, %d; want %d, %d", x, y, q, r, wantQ, wantR)
+        }
+    }
+}
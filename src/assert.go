@@ -0,0 +1,61 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Assertions about internal wires, for debugging
+//
+
+// A claim that a gate's output is always Expected, whatever the inputs
+type Assertion struct {
+    Gate        int     `json:"gate"`
+    Expected    bool    `json:"expected"`
+}
+
+// An assertion that didn't hold, with the input that broke it and the
+// gate's source location, if it has one
+type AssertionFailure struct {
+    Assertion
+    Input       []bool
+    Source      string
+}
+
+func (f AssertionFailure) String() string {
+    gate := fmt.Sprintf("gate %d", f.Gate)
+    if f.Source != "" {
+        gate += " (" + f.Source + ")"
+    }
+    return fmt.Sprintf("%s is %t, not %t, on input %v", gate, !f.Expected, f.Expected, f.Input)
+}
+
+// Record that gate's output must always equal expected. Assertions don't
+// affect evaluation; they are only checked by CheckAssertions.
+func (circ *Circuit) AddAssertion(gate int, expected bool) error {
+    if gate < 0 || gate >= len(circ.Gates) {
+        return fmt.Errorf("assertion on nonexistent gate %d: %w", gate, ErrOutOfRange)
+    }
+    circ.Assertions = append(circ.Assertions, Assertion{gate, expected})
+    return nil
+}
+
+// Evaluate the circuit on the given input bits and return the assertions
+// that don't hold, in the order they were added
+func (circ *Circuit) CheckAssertions(inputBits []bool) ([]AssertionFailure, error) {
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := e.Evaluate(inputBits); err != nil {
+        return nil, err
+    }
+
+    var failures []AssertionFailure
+    for _, a := range circ.Assertions {
+        if e.values[a.Gate] != a.Expected {
+            failures = append(failures, AssertionFailure{a, append([]bool(nil), inputBits...), circ.sourceLoc(a.Gate)})
+        }
+    }
+    return failures, nil
+}
@@ -0,0 +1,62 @@
+package toygarble
+
+import (
+    "errors"
+    "slices"
+    "testing"
+)
+
+// x AND NOT x is always false, while x OR y is wrongly claimed to be always
+// true: only the second assertion fails, and only when both inputs are 0
+func TestCheckAssertions(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    circ, err := b.Output("out", b.Or(x[0], x[1]), b.And(x[0], b.Not(x[0]))).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    or := circ.Gates[circ.getOutputGate(0)].InFrom[0]
+    and := circ.Gates[circ.getOutputGate(1)].InFrom[0]
+    if err := circ.AddAssertion(and, false); err != nil {
+        t.Fatal(err)
+    }
+    if err := circ.AddAssertion(or, true); err != nil {
+        t.Fatal(err)
+    }
+    if err := circ.Clone().AddAssertion(len(circ.Gates), true); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("assertion on a nonexistent gate: %v", err)
+    }
+
+    check := func(c *Circuit, name string) {
+        t.Helper()
+        for m := 0; m < 4; m++ {
+            in := []bool{m & 1 == 1, m & 2 == 2}
+            failures, err := c.CheckAssertions(in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if m != 0 {
+                if len(failures) != 0 {
+                    t.Errorf("%s, input %v: unexpected failures %v", name, in, failures)
+                }
+                continue
+            }
+            if len(failures) != 1 || !failures[0].Expected || !slices.Equal(failures[0].Input, in) {
+                t.Errorf("%s, input %v: got failures %v, want the OR assertion", name, in, failures)
+            }
+        }
+    }
+    check(circ, "built")
+
+    // Assertions are kept by serialization, and follow their gates when
+    // the circuit is simplified
+    read, _ := binaryRoundTrip(t, circ)
+    check(read, "read back")
+    read.FuseOutputs()
+    read.RemoveDeadGates()
+    check(read, "simplified")
+
+    if _, err := circ.CheckAssertions([]bool{true}); err == nil {
+        t.Error("short input accepted")
+    }
+}
@@ -0,0 +1,468 @@
+package toygarble
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+)
+
+//
+// Compact binary serialization. The format is:
+//
+//     magic "TGCB", version byte
+//     uvarint NumInputWires, NumOutputWires
+//     uvarint NumInputVars, then that many input widths
+//     uvarint NumOutputVars, then that many output widths
+//     uvarint count of input names (0 or NumInputVars), then each as
+//         a uvarint length and the bytes; likewise for output names
+//     (version 3 and up) uvarint count of input gates (0 or
+//         NumInputWires), then each as a uvarint
+//     (version 2 and up) uvarint count of output gates (0 or
+//         NumOutputWires), then each as a uvarint
+//     (version 4 and up) uvarint WireDomain
+//     (version 5 and up) uvarint number of groups, then for each its name
+//         as a uvarint length and the bytes, and uvarint Start, End and
+//         Parent + 1
+//     (version 6 and up) uvarint count of input parties (0 or
+//         NumInputVars), then each as a uvarint
+//     (version 7 and up) uvarint number of assertions, then for each its
+//         gate as a uvarint and expected value as a byte
+//     (version 8 and up) uvarint count of gate source locations (at most
+//         the number of gates), then each as a uvarint length and the bytes
+//     uvarint number of gates, then for each gate:
+//         type byte, with the top bit holding ConstVal
+//         uvarint number of inputs, then each input as a varint giving
+//             the gate's own index minus the input's index
+//         for LUT gates, the truth table packed eight entries per byte
+//
+
+const (
+    BINARY_MAGIC        string = "TGCB"
+    BINARY_VERSION      byte = 8
+
+    // Longest variable name accepted when reading
+    MAX_BINARY_NAME_LEN int = 1 << 16
+)
+
+const binaryConstFlag byte = 0x80
+
+// Write the circuit in the compact binary format
+func (circ *Circuit) WriteBinary(w io.Writer) error {
+    bw := bufio.NewWriter(w)
+    buf := make([]byte, binary.MaxVarintLen64)
+    putUvarint := func(v int) {
+        n := binary.PutUvarint(buf, uint64(v))
+        bw.Write(buf[:n])
+    }
+    putName := func(name string) {
+        putUvarint(len(name))
+        bw.WriteString(name)
+    }
+    putNames := func(names []string) {
+        putUvarint(len(names))
+        for _, name := range names {
+            putName(name)
+        }
+    }
+
+    bw.WriteString(BINARY_MAGIC)
+    bw.WriteByte(BINARY_VERSION)
+
+    putUvarint(circ.NumInputWires)
+    putUvarint(circ.NumOutputWires)
+    putUvarint(circ.NumInputVars)
+    for _, width := range circ.NumWiresIV {
+        putUvarint(width)
+    }
+    putUvarint(circ.NumOutputVars)
+    for _, width := range circ.NumWiresOV {
+        putUvarint(width)
+    }
+    putNames(circ.InputVarNames)
+    putNames(circ.OutputVarNames)
+    putUvarint(len(circ.InputGates))
+    for _, g := range circ.InputGates {
+        putUvarint(g)
+    }
+    putUvarint(len(circ.OutputGates))
+    for _, g := range circ.OutputGates {
+        putUvarint(g)
+    }
+    putUvarint(circ.WireDomain)
+    putUvarint(len(circ.Groups))
+    for _, group := range circ.Groups {
+        putName(group.Name)
+        putUvarint(group.Start)
+        putUvarint(group.End)
+        putUvarint(group.Parent + 1)
+    }
+    putUvarint(len(circ.InputParty))
+    for _, party := range circ.InputParty {
+        putUvarint(party)
+    }
+    putUvarint(len(circ.Assertions))
+    for _, a := range circ.Assertions {
+        putUvarint(a.Gate)
+        if a.Expected {
+            bw.WriteByte(1)
+        } else {
+            bw.WriteByte(0)
+        }
+    }
+    putNames(circ.SourceLoc)
+
+    putUvarint(len(circ.Gates))
+    for i := range circ.Gates {
+        gate := &circ.Gates[i]
+        typeByte := byte(gate.GateType)
+        if gate.ConstVal {
+            typeByte |= binaryConstFlag
+        }
+        bw.WriteByte(typeByte)
+
+        putUvarint(len(gate.InFrom))
+        for _, from := range gate.InFrom {
+            n := binary.PutVarint(buf, int64(i - from))
+            bw.Write(buf[:n])
+        }
+
+        if gate.GateType == GateLUT {
+            bw.Write(packBits(gate.TruthTable))
+        }
+    }
+
+    return bw.Flush()
+}
+
+// Pack bools eight to a byte, least significant bit first
+func packBits(bits []bool) []byte {
+    packed := make([]byte, (len(bits) + 7) / 8)
+    for i, b := range bits {
+        if b {
+            packed[i / 8] |= 1 << (i % 8)
+        }
+    }
+    return packed
+}
+
+// Unpack n bools from bytes packed by packBits
+func unpackBits(packed []byte, n int) []bool {
+    bits := make([]bool, n)
+    for i := range bits {
+        bits[i] = packed[i / 8] & (1 << (i % 8)) != 0
+    }
+    return bits
+}
+
+// Read a circuit in the compact binary format, checking it against
+// DefaultLimits and validating its structure
+func ReadBinary(r io.Reader) (*Circuit, error) {
+    return ReadBinaryWith(r, DefaultLimits)
+}
+
+// Like ReadBinary, but checking the circuit against the given limits
+func ReadBinaryWith(r io.Reader, limits Limits) (*Circuit, error) {
+    br := bufio.NewReader(r)
+    circ, numGates, err := readBinaryHeader(br, limits)
+    if err != nil {
+        return nil, err
+    }
+
+    // Gates are appended as they're read, so a truncated file can't make
+    // us allocate for all the gates its header declares
+    circ.Gates = make([]Gate, 0, preallocCap(numGates))
+    for i := 0; i < numGates; i++ {
+        var gate Gate
+        if err := readBinaryGate(br, i, numGates, &gate); err != nil {
+            return nil, err
+        }
+        circ.Gates = append(circ.Gates, gate)
+    }
+
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    return circ, nil
+}
+
+// A source of binary circuit data
+type binaryReader interface {
+    io.Reader
+    io.ByteReader
+}
+
+// Read everything in a binary circuit before the gates, returning the
+// circuit without its gates and the number of gates that follow. The
+// sizes given are checked against limits.
+func readBinaryHeader(br binaryReader, limits Limits) (*Circuit, int, error) {
+    header := make([]byte, len(BINARY_MAGIC) + 1)
+    if _, err := io.ReadFull(br, header); err != nil {
+        return nil, 0, fmt.Errorf("reading header: %w", err)
+    }
+    if string(header[:len(BINARY_MAGIC)]) != BINARY_MAGIC {
+        return nil, 0, fmt.Errorf("not a binary circuit file: %w", ErrMalformed)
+    }
+    version := header[len(BINARY_MAGIC)]
+    if version < 1 || version > BINARY_VERSION {
+        return nil, 0, fmt.Errorf("unsupported binary circuit version %d: %w", version, ErrMalformed)
+    }
+
+    // Read a uvarint no larger than bound
+    getUvarint := func(what string, bound int) (int, error) {
+        v, err := binary.ReadUvarint(br)
+        if err != nil {
+            return 0, fmt.Errorf("reading %s: %w", what, err)
+        }
+        if v > uint64(bound) {
+            return 0, fmt.Errorf("%s %d exceeds limit %d: %w", what, v, bound, ErrLimitExceeded)
+        }
+        return int(v), nil
+    }
+    getWidths := func(what string, total int) ([]int, error) {
+        n, err := getUvarint(what + " count", total)
+        if err != nil {
+            return nil, err
+        }
+        widths := make([]int, 0, preallocCap(n))
+        sum := 0
+        for i := 0; i < n; i++ {
+            width, err := getUvarint(what + " width", total)
+            if err != nil {
+                return nil, err
+            }
+            widths = append(widths, width)
+            sum += width
+        }
+        if sum != total {
+            return nil, fmt.Errorf("%s widths add up to %d, not %d: %w", what, sum, total, ErrMalformed)
+        }
+        return widths, nil
+    }
+    getName := func(what string) (string, error) {
+        length, err := getUvarint(what + " name length", MAX_BINARY_NAME_LEN)
+        if err != nil {
+            return "", err
+        }
+        name := make([]byte, length)
+        if _, err := io.ReadFull(br, name); err != nil {
+            return "", fmt.Errorf("reading %s name: %w", what, err)
+        }
+        return string(name), nil
+    }
+    getNames := func(what string, numVars int) ([]string, error) {
+        n, err := getUvarint(what + " name count", numVars)
+        if err != nil {
+            return nil, err
+        }
+        if n != 0 && n != numVars {
+            return nil, fmt.Errorf("%d %s names for %d variables: %w", n, what, numVars, ErrMalformed)
+        }
+        names := make([]string, 0, preallocCap(n))
+        for i := 0; i < n; i++ {
+            name, err := getName(what)
+            if err != nil {
+                return nil, err
+            }
+            names = append(names, name)
+        }
+        return names, nil
+    }
+
+    circ := &Circuit{}
+    circ.useLimits(limits)
+    var err error
+    if circ.NumInputWires, err = getUvarint("input wire count", limits.MaxInputWires); err != nil {
+        return nil, 0, err
+    }
+    if circ.NumOutputWires, err = getUvarint("output wire count", limits.MaxWires); err != nil {
+        return nil, 0, err
+    }
+    if circ.NumWiresIV, err = getWidths("input variable", circ.NumInputWires); err != nil {
+        return nil, 0, err
+    }
+    circ.NumInputVars = len(circ.NumWiresIV)
+    if circ.NumWiresOV, err = getWidths("output variable", circ.NumOutputWires); err != nil {
+        return nil, 0, err
+    }
+    circ.NumOutputVars = len(circ.NumWiresOV)
+    if circ.InputVarNames, err = getNames("input", circ.NumInputVars); err != nil {
+        return nil, 0, err
+    }
+    if circ.OutputVarNames, err = getNames("output", circ.NumOutputVars); err != nil {
+        return nil, 0, err
+    }
+    // Gate lists are checked against the gate count by validCircuit
+    getGates := func(what string, numWires int) ([]int, error) {
+        n, err := getUvarint(what + " gate count", numWires)
+        if err != nil {
+            return nil, err
+        }
+        if n == 0 {
+            return nil, nil
+        }
+        if n != numWires {
+            return nil, fmt.Errorf("%d %s gates for %d %s wires: %w", n, what, numWires, what, ErrMalformed)
+        }
+        gates := make([]int, 0, preallocCap(n))
+        for i := 0; i < n; i++ {
+            g, err := getUvarint(what + " gate", limits.MaxWires)
+            if err != nil {
+                return nil, err
+            }
+            gates = append(gates, g)
+        }
+        return gates, nil
+    }
+    if version >= 3 {
+        if circ.InputGates, err = getGates("input", circ.NumInputWires); err != nil {
+            return nil, 0, err
+        }
+    }
+    if version >= 2 {
+        if circ.OutputGates, err = getGates("output", circ.NumOutputWires); err != nil {
+            return nil, 0, err
+        }
+    }
+    if version >= 4 {
+        // Checked by validCircuit
+        if circ.WireDomain, err = getUvarint("wire domain", math.MaxInt32); err != nil {
+            return nil, 0, err
+        }
+    }
+    if version >= 5 {
+        // Ranges are checked by validCircuit
+        n, err := getUvarint("group count", limits.MaxWires)
+        if err != nil {
+            return nil, 0, err
+        }
+        for i := 0; i < n; i++ {
+            var group GateGroup
+            if group.Name, err = getName("group"); err != nil {
+                return nil, 0, err
+            }
+            if group.Start, err = getUvarint("group start", limits.MaxWires); err != nil {
+                return nil, 0, err
+            }
+            if group.End, err = getUvarint("group end", limits.MaxWires); err != nil {
+                return nil, 0, err
+            }
+            if group.Parent, err = getUvarint("group parent", n); err != nil {
+                return nil, 0, err
+            }
+            group.Parent--
+            circ.Groups = append(circ.Groups, group)
+        }
+    }
+    if version >= 6 {
+        // Party values are checked by validCircuit
+        n, err := getUvarint("input party count", circ.NumInputVars)
+        if err != nil {
+            return nil, 0, err
+        }
+        if n != 0 && n != circ.NumInputVars {
+            return nil, 0, fmt.Errorf("%d input parties for %d variables: %w", n, circ.NumInputVars, ErrMalformed)
+        }
+        for i := 0; i < n; i++ {
+            party, err := getUvarint("input party", PARTY_EVALUATOR)
+            if err != nil {
+                return nil, 0, err
+            }
+            circ.InputParty = append(circ.InputParty, party)
+        }
+    }
+    if version >= 7 {
+        // Gates are checked by validCircuit
+        n, err := getUvarint("assertion count", limits.MaxWires)
+        if err != nil {
+            return nil, 0, err
+        }
+        for i := 0; i < n; i++ {
+            var a Assertion
+            if a.Gate, err = getUvarint("assertion gate", limits.MaxWires); err != nil {
+                return nil, 0, err
+            }
+            expected, err := br.ReadByte()
+            if err != nil {
+                return nil, 0, fmt.Errorf("reading assertion %d: %w", i, err)
+            }
+            if expected > 1 {
+                return nil, 0, fmt.Errorf("assertion %d has expected value %d: %w", i, expected, ErrMalformed)
+            }
+            a.Expected = expected == 1
+            circ.Assertions = append(circ.Assertions, a)
+        }
+    }
+    if version >= 8 {
+        // The count is checked against the gates by validCircuit
+        n, err := getUvarint("source location count", limits.MaxWires)
+        if err != nil {
+            return nil, 0, err
+        }
+        for i := 0; i < n; i++ {
+            loc, err := getName("source location")
+            if err != nil {
+                return nil, 0, err
+            }
+            circ.SourceLoc = append(circ.SourceLoc, loc)
+        }
+    }
+
+    numGates, err := getUvarint("gate count", limits.MaxWires)
+    if err != nil {
+        return nil, 0, err
+    }
+    if err := limits.checkSize(numGates - circ.NumInputWires - circ.NumOutputWires, numGates, circ.NumInputWires); err != nil {
+        return nil, 0, err
+    }
+
+    return circ, numGates, nil
+}
+
+// Read gate i of numGates in a binary circuit into gate, replacing what
+// was there
+func readBinaryGate(br binaryReader, i int, numGates int, gate *Gate) error {
+    *gate = Gate{}
+    typeByte, err := br.ReadByte()
+    if err != nil {
+        return fmt.Errorf("reading gate %d: %w", i, err)
+    }
+    gate.ConstVal = typeByte & binaryConstFlag != 0
+    gate.GateType = GateType_t(typeByte &^ binaryConstFlag)
+    if int(gate.GateType) >= len(min_input_wires) {
+        return fmt.Errorf("gate %d has unknown type %d: %w", i, gate.GateType, ErrMalformed)
+    }
+
+    arity64, err := binary.ReadUvarint(br)
+    if err != nil {
+        return fmt.Errorf("reading gate %d: %w", i, err)
+    }
+    if arity64 > uint64(max_input_wires[gate.GateType]) {
+        return fmt.Errorf("gate %d has %d inputs, more than %d: %w", i, arity64, max_input_wires[gate.GateType], ErrLimitExceeded)
+    }
+    arity := int(arity64)
+    if arity > 0 {
+        gate.InFrom = make([]int, arity)
+    }
+    for j := range gate.InFrom {
+        delta, err := binary.ReadVarint(br)
+        if err != nil {
+            return fmt.Errorf("reading gate %d: %w", i, err)
+        }
+        from := int64(i) - delta
+        if from < 0 || from >= int64(numGates) {
+            return fmt.Errorf("gate %d has input from nonexistent gate %d: %w", i, from, ErrMalformed)
+        }
+        gate.InFrom[j] = int(from)
+    }
+
+    if gate.GateType == GateLUT {
+        packed := make([]byte, ((1 << arity) + 7) / 8)
+        if _, err := io.ReadFull(br, packed); err != nil {
+            return fmt.Errorf("reading gate %d: %w", i, err)
+        }
+        gate.TruthTable = unpackBits(packed, 1 << arity)
+    }
+    return nil
+}
@@ -0,0 +1,157 @@
+package toygarble
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "runtime"
+    "slices"
+    "testing"
+)
+
+// Write circ in the binary format and read it back
+func binaryRoundTrip(t *testing.T, circ *Circuit) (*Circuit, []byte) {
+    t.Helper()
+    var buf bytes.Buffer
+    if err := circ.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    data := slices.Clone(buf.Bytes())
+    read, err := ReadBinary(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return read, data
+}
+
+func TestBinaryRoundTripMultiplier(t *testing.T) {
+    circ, err := LoadBristol("../circuits/mult64.txt")
+    if err != nil {
+        t.Fatal(err)
+    }
+    read, data := binaryRoundTrip(t, circ)
+    if report, err := Diff(circ, read); err != nil || !report.Empty() {
+        t.Fatalf("round trip changed the circuit: %v, %v", report, err)
+    }
+
+    // Most inputs are a few gates back, so a gate takes a handful of bytes
+    var js bytes.Buffer
+    if err := circ.WriteGenericJSON(&js, JSON_SCHEMA_NATIVE); err != nil {
+        t.Fatal(err)
+    }
+    if len(data) * 5 > js.Len() {
+        t.Errorf("binary is %d bytes, not much smaller than %d bytes of JSON", len(data), js.Len())
+    }
+    if len(data) > 5 * len(circ.Gates) {
+        t.Errorf("binary is %d bytes for %d gates", len(data), len(circ.Gates))
+    }
+}
+
+func TestBinaryRoundTripLUT(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    table := []bool{true, false, false, true, true, true, false, true}
+    circ, err := b.Output("out", b.LUT(x, table), b.Const(true), b.Const(false)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    read, _ := binaryRoundTrip(t, circ)
+    if report, err := Diff(circ, read); err != nil || !report.Empty() {
+        t.Fatalf("round trip changed the circuit: %v, %v", report, err)
+    }
+    if !slices.Equal(read.InputVarNames, []string{"x"}) || !slices.Equal(read.OutputVarNames, []string{"out"}) {
+        t.Errorf("names %v, %v", read.InputVarNames, read.OutputVarNames)
+    }
+}
+
+func TestReadBinaryMalformed(t *testing.T) {
+    var buf bytes.Buffer
+    if err := BuildAdder(4).WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    good := buf.Bytes()
+    corrupt := func(f func(data []byte) []byte) []byte {
+        return f(slices.Clone(good))
+    }
+
+    inputs := map[string][]byte{
+        "bad magic":        corrupt(func(d []byte) []byte { d[0] = 'X'; return d }),
+        "version 0":        corrupt(func(d []byte) []byte { d[4] = 0; return d }),
+        "future version":   corrupt(func(d []byte) []byte { d[4] = BINARY_VERSION + 1; return d }),
+        // The last gate is an XOR of two nearby gates, four bytes in all
+        "bad gate type":    corrupt(func(d []byte) []byte { d[len(d)-4] = 0x7f; return d }),
+    }
+    for name, data := range inputs {
+        mustNotPanic(t, name, func() {
+            if _, err := ReadBinary(bytes.NewReader(data)); !errors.Is(err, ErrMalformed) {
+                t.Errorf("%s: got %v", name, err)
+            }
+        })
+    }
+
+    // Cut short anywhere, the file is rejected
+    for n := 0; n < len(good); n++ {
+        mustNotPanic(t, "truncated", func() {
+            if _, err := ReadBinary(bytes.NewReader(good[:n])); err == nil {
+                t.Errorf("accepted the first %d of %d bytes", n, len(good))
+            }
+        })
+    }
+}
+
+func TestBinaryRoundTripGroups(t *testing.T) {
+    circ := buildNestedAdders(t)
+    read, _ := binaryRoundTrip(t, circ)
+    if !slices.Equal(read.Groups, circ.Groups) {
+        t.Errorf("groups %+v after a round trip, want %+v", read.Groups, circ.Groups)
+    }
+}
+
+// Bytes allocated while running f
+func allocatedBytes(f func()) uint64 {
+    var before, after runtime.MemStats
+    runtime.ReadMemStats(&before)
+    f()
+    runtime.ReadMemStats(&after)
+    return after.TotalAlloc - before.TotalAlloc
+}
+
+// A version 1 binary header made of the given uvarints
+func binaryHeader(fields ...int) []byte {
+    data := append([]byte(BINARY_MAGIC), 1)
+    for _, v := range fields {
+        data = binary.AppendUvarint(data, uint64(v))
+    }
+    return data
+}
+
+// A short file declaring a huge circuit fails without allocating for it
+func TestReadBinaryHugeHeader(t *testing.T) {
+    inputs := map[string][]byte{
+        // No wires or variables, 1<<26 gates, then a single byte
+        "gate count":       append(binaryHeader(0, 0, 0, 0, 0, 0, 1 << 26), byte(GateINPUT)),
+        // 1<<26 output wires split into as many variables, then nothing
+        "output widths":    binaryHeader(0, 1 << 26, 0, 1 << 26),
+    }
+    for name, data := range inputs {
+        var err error
+        n := allocatedBytes(func() {
+            _, err = ReadBinary(bytes.NewReader(data))
+        })
+        if err == nil {
+            t.Errorf("%s: accepted a truncated file", name)
+        }
+        if n > 1 << 22 {
+            t.Errorf("%s: allocated %d bytes for a %d byte file", name, n, len(data))
+        }
+        n = allocatedBytes(func() {
+            _, err = newLazyCircuit(data)
+        })
+        if err == nil {
+            t.Errorf("%s: mapped a truncated file", name)
+        }
+        if n > 1 << 22 {
+            t.Errorf("%s: allocated %d bytes mapping a %d byte file", name, n, len(data))
+        }
+    }
+}
@@ -0,0 +1,434 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Incremental construction of circuits
+//
+
+// A handle to a wire in a circuit under construction
+type Wire int
+
+// Builds a circuit gate by gate, keeping track of the input and output
+// variable layout. Gates are referenced by Wire handles, which are turned
+// into gate indices by Build. Errors are remembered and reported by Build,
+// so calls can be made without checking each one. For example, a 4-bit
+// ripple-carry adder:
+//
+//     b := NewBuilder()
+//     x := b.Input("x", 4)
+//     y := b.Input("y", 4)
+//     sum := make([]Wire, 4)
+//     carry := b.Const(false)
+//     for i := 0; i < 4; i++ {
+//         t := b.Xor(x[i], y[i])
+//         sum[i] = b.Xor(t, carry)
+//         carry = b.Or(b.And(x[i], y[i]), b.And(t, carry))
+//     }
+//     circ, err := b.Output("sum", sum...).Build()
+//
+type Builder struct {
+    // Every wire created so far. Inputs are GateINPUT entries, and the
+    // InFrom fields of the rest refer to Wire handles.
+    nodes       []Gate
+
+    inputNames  []string
+    inputWires  [][]Wire
+    outputNames []string
+    outputWires [][]Wire
+
+    // Wire domain of the circuit, 0 for boolean
+    domain      int
+
+    // Groups of embedded gadgets, with Start and End as node indices
+    groups      []GateGroup
+
+    // Source locations of wires, allocated by the first SetSource
+    sources     map[Wire]string
+
+    err         error
+}
+
+func NewBuilder() *Builder {
+    return &Builder{}
+}
+
+// Record the first error encountered
+func (b *Builder) fail(format string, args ...any) {
+    if b.err == nil {
+        b.err = fmt.Errorf(format, args...)
+    }
+}
+
+// Check that a variable name hasn't been used yet
+func (b *Builder) checkName(kind string, name string, names []string) bool {
+    for _, n := range names {
+        if n == name {
+            b.fail("duplicate %s variable %q", kind, name)
+            return false
+        }
+    }
+    return true
+}
+
+// Add a gate on existing wires, returning its handle (or -1 on error)
+func (b *Builder) gate(gateType GateType_t, constVal bool, inputs ...Wire) Wire {
+    inFrom := make([]int, len(inputs))
+    for j, w := range inputs {
+        if w < 0 || int(w) >= len(b.nodes) {
+            b.fail("invalid wire %d used as input %d of a gate of type %v", w, j, gateType)
+            return -1
+        }
+        inFrom[j] = int(w)
+    }
+    if len(inFrom) < min_input_wires[gateType] || len(inFrom) > max_input_wires[gateType] {
+        b.fail("gate of type %v can't take %d inputs", gateType, len(inFrom))
+        return -1
+    }
+
+    b.nodes = append(b.nodes, Gate{GateType: gateType, ConstVal: constVal, InFrom: inFrom})
+    return Wire(len(b.nodes) - 1)
+}
+
+// Build a circuit whose wires carry integers mod k (see Circuit.WireDomain)
+func (b *Builder) WireDomain(k int) *Builder {
+    if k < 2 {
+        b.fail("wire domain must be at least 2, got %d", k)
+    }
+    b.domain = k
+    return b
+}
+
+// Record where the gate driving w came from, e.g. the line of a program
+// being compiled, to become its Circuit.SourceLoc entry
+func (b *Builder) SetSource(w Wire, loc string) *Builder {
+    if w < 0 || int(w) >= len(b.nodes) {
+        b.fail("invalid wire %d given a source location", w)
+        return b
+    }
+    if b.sources == nil {
+        b.sources = make(map[Wire]string)
+    }
+    b.sources[w] = loc
+    return b
+}
+
+// Add a copy of the logic of circuit sub, with its input wires driven by
+// inputs, and return the wires carrying its outputs. The copied gates are
+// recorded as a group with the given name. Groups within sub are nested
+// inside it if sub's gates are numbered in topological order, as they are
+// in circuits from Build.
+func (b *Builder) Embed(name string, sub *Circuit, inputs ...Wire) []Wire {
+    if sub == nil || !sub.validCircuit() {
+        b.fail("can't embed invalid circuit %q", name)
+        return nil
+    }
+    if sub.domain() != max(b.domain, 2) {
+        b.fail("can't embed circuit %q over domain %d", name, sub.domain())
+        return nil
+    }
+    if len(inputs) != sub.NumInputWires {
+        b.fail("circuit %q takes %d input wires, got %d", name, sub.NumInputWires, len(inputs))
+        return nil
+    }
+    for _, w := range inputs {
+        if w < 0 || int(w) >= len(b.nodes) {
+            b.fail("invalid wire %d used as input to circuit %q", w, name)
+            return nil
+        }
+    }
+    order, err := sub.TopologicalOrder()
+    if err != nil {
+        b.fail("can't embed circuit %q: %v", name, err)
+        return nil
+    }
+    for i := 0; i < sub.NumOutputWires; i++ {
+        if _, ok := sub.outputDriver(sub.getOutputGate(i)); !ok {
+            b.fail("output wire %d of circuit %q is not connected", i, name)
+            return nil
+        }
+    }
+
+    // Copy the gates in index order if that works, since it keeps groups
+    // contiguous. Output gates just pass their driver on, so it's enough
+    // for a gate's drivers to come before it.
+    driver := func(g int) int {
+        if d, ok := sub.outputDriver(g); ok {
+            return d
+        }
+        return g
+    }
+    inIndexOrder := true
+    for g := range sub.Gates {
+        for _, from := range sub.Gates[g].InFrom {
+            if sub.Gates[g].GateType != GateOUTPUT && driver(from) >= g {
+                inIndexOrder = false
+            }
+        }
+    }
+    if inIndexOrder {
+        for g := range order {
+            order[g] = g
+        }
+    }
+
+    group := len(b.groups)
+    b.groups = append(b.groups, GateGroup{name, len(b.nodes), len(b.nodes), -1})
+
+    // Map each gate of sub to the wire carrying its value, and each gate
+    // position to the number of nodes there were before it
+    wireOf := make([]Wire, len(sub.Gates))
+    for w, x := range inputs {
+        wireOf[sub.getInputGate(w)] = x
+    }
+    nodeBefore := make([]int, len(sub.Gates) + 1)
+    for _, g := range order {
+        nodeBefore[g] = len(b.nodes)
+        gate := &sub.Gates[g]
+        if gate.GateType == GateINPUT || gate.GateType == GateOUTPUT {
+            continue
+        }
+        in := make([]Wire, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            in[j] = wireOf[driver(from)]
+        }
+        wireOf[g] = b.gate(gate.GateType, gate.ConstVal, in...)
+        if wireOf[g] < 0 {
+            return nil
+        }
+        b.nodes[wireOf[g]].TruthTable = append([]bool(nil), gate.TruthTable...)
+        if loc := sub.sourceLoc(g); loc != "" {
+            b.SetSource(wireOf[g], loc)
+        }
+    }
+    nodeBefore[len(sub.Gates)] = len(b.nodes)
+    b.groups[group].End = len(b.nodes)
+
+    if inIndexOrder {
+        for _, inner := range sub.Groups {
+            parent := group
+            if inner.Parent >= 0 {
+                parent = group + 1 + inner.Parent
+            }
+            b.groups = append(b.groups, GateGroup{inner.Name, nodeBefore[inner.Start], nodeBefore[inner.End], parent})
+        }
+    }
+
+    outputs := make([]Wire, sub.NumOutputWires)
+    for i := range outputs {
+        outputs[i] = wireOf[driver(sub.getOutputGate(i))]
+    }
+    return outputs
+}
+
+// Declare a new input variable of the given width, returning its wires
+// from least to most significant
+func (b *Builder) Input(name string, width int) []Wire {
+    if width < 1 {
+        b.fail("input variable %q must have at least one wire", name)
+        return nil
+    }
+    if !b.checkName("input", name, b.inputNames) {
+        return nil
+    }
+
+    wires := make([]Wire, width)
+    for i := range wires {
+        b.nodes = append(b.nodes, Gate{GateType: GateINPUT})
+        wires[i] = Wire(len(b.nodes) - 1)
+    }
+    b.inputNames = append(b.inputNames, name)
+    b.inputWires = append(b.inputWires, wires)
+    return wires
+}
+
+func (b *Builder) Const(v bool) Wire {
+    return b.gate(GateCONST, v)
+}
+
+func (b *Builder) Not(x Wire) Wire {
+    return b.gate(GateNOT, false, x)
+}
+
+func (b *Builder) And(x Wire, y Wire) Wire {
+    return b.gate(GateAND, false, x, y)
+}
+
+func (b *Builder) Or(x Wire, y Wire) Wire {
+    return b.gate(GateOR, false, x, y)
+}
+
+func (b *Builder) Xor(x Wire, y Wire) Wire {
+    return b.gate(GateXOR, false, x, y)
+}
+
+func (b *Builder) Copy(x Wire) Wire {
+    return b.gate(GateCOPY, false, x)
+}
+
+// Returns x if sel is 0, y if sel is 1
+func (b *Builder) Mux(sel Wire, x Wire, y Wire) Wire {
+    return b.gate(GateMUX, false, sel, x, y)
+}
+
+// Returns t flipped if both c1 and c2 are 1
+func (b *Builder) Toffoli(c1 Wire, c2 Wire, t Wire) Wire {
+    return b.gate(GateTOFFLI, false, c1, c2, t)
+}
+
+// Returns 1 if at least two of x, y and z are 1
+func (b *Builder) Maj(x Wire, y Wire, z Wire) Wire {
+    return b.gate(GateMAJ, false, x, y, z)
+}
+
+// Returns the sum bit and carry out of x + y + carry
+func (b *Builder) FullAdder(x Wire, y Wire, carry Wire) (Wire, Wire) {
+    return b.Xor(b.Xor(x, y), carry), b.Maj(x, y, carry)
+}
+
+// Returns t flipped if c is 1
+func (b *Builder) CNOT(c Wire, t Wire) Wire {
+    return b.gate(GateCNOT, false, c, t)
+}
+
+// Returns x + y mod the wire domain
+func (b *Builder) AddK(x Wire, y Wire) Wire {
+    return b.gate(GateADDK, false, x, y)
+}
+
+// Returns x * y mod the wire domain
+func (b *Builder) MulK(x Wire, y Wire) Wire {
+    return b.gate(GateMULK, false, x, y)
+}
+
+// A lookup table over the given inputs, indexed as for Gate.TruthTable
+func (b *Builder) LUT(inputs []Wire, table []bool) Wire {
+    if len(inputs) < 1 || len(inputs) > MAX_LUT_INPUTS || len(table) != 1 << len(inputs) {
+        b.fail("LUT with %d inputs can't have %d table entries", len(inputs), len(table))
+        return -1
+    }
+    w := b.gate(GateLUT, false, inputs...)
+    if w >= 0 {
+        b.nodes[w].TruthTable = append([]bool(nil), table...)
+    }
+    return w
+}
+
+// Declare a new output variable driven by the given wires, from least to
+// most significant
+func (b *Builder) Output(name string, wires ...Wire) *Builder {
+    if len(wires) == 0 {
+        b.fail("output variable %q must have at least one wire", name)
+        return b
+    }
+    if !b.checkName("output", name, b.outputNames) {
+        return b
+    }
+    for _, w := range wires {
+        if w < 0 || int(w) >= len(b.nodes) {
+            b.fail("invalid wire %d used in output variable %q", w, name)
+            return b
+        }
+    }
+
+    b.outputNames = append(b.outputNames, name)
+    b.outputWires = append(b.outputWires, append([]Wire(nil), wires...))
+    return b
+}
+
+// Assemble the circuit, with input wires first (in declaration order),
+// then output wires, then logic gates in the order they were created
+func (b *Builder) Build() (*Circuit, error) {
+    if b.err != nil {
+        return nil, b.err
+    }
+    if len(b.outputWires) == 0 {
+        return nil, fmt.Errorf("circuit has no outputs")
+    }
+
+    numInputWires := 0
+    widthsIV := make([]int, len(b.inputWires))
+    for i, wires := range b.inputWires {
+        widthsIV[i] = len(wires)
+        numInputWires += len(wires)
+    }
+    numOutputWires := 0
+    widthsOV := make([]int, len(b.outputWires))
+    for i, wires := range b.outputWires {
+        widthsOV[i] = len(wires)
+        numOutputWires += len(wires)
+    }
+
+    circ := &Circuit{}
+    err := circ.initializeCircuit(numInputWires, numOutputWires, len(widthsIV), len(widthsOV), widthsIV, widthsOV)
+    if err != nil {
+        return nil, err
+    }
+    circ.InputVarNames = append([]string(nil), b.inputNames...)
+    circ.OutputVarNames = append([]string(nil), b.outputNames...)
+    circ.WireDomain = b.domain
+    circ.Reserve(len(b.nodes) - numInputWires)
+
+    // Map each handle to its gate index. Handles only ever refer to earlier
+    // handles, so creation order is already topological.
+    gateOf := make([]int, len(b.nodes))
+    next := 0
+    for _, wires := range b.inputWires {
+        for _, w := range wires {
+            gateOf[w] = circ.getInputGate(next)
+            next++
+        }
+    }
+    for w := range b.nodes {
+        node := &b.nodes[w]
+        if node.GateType == GateINPUT {
+            continue
+        }
+
+        inFrom := make([]int, len(node.InFrom))
+        for j, from := range node.InFrom {
+            inFrom[j] = gateOf[from]
+        }
+        gateOf[w] = circ.addGate(node.GateType, node.ConstVal, inFrom)
+        if gateOf[w] < 0 {
+            return nil, fmt.Errorf("could not add gate for wire %d", w)
+        }
+        circ.Gates[gateOf[w]].TruthTable = node.TruthTable
+    }
+    for w, loc := range b.sources {
+        circ.SetGateSource(gateOf[w], loc)
+    }
+
+    // Logic gates keep their creation order, so a range of nodes becomes
+    // the range of gates created from them
+    if len(b.groups) > 0 {
+        gateBefore := make([]int, len(b.nodes) + 1)
+        numGates := numInputWires + numOutputWires
+        for w := range b.nodes {
+            gateBefore[w] = numGates
+            if b.nodes[w].GateType != GateINPUT {
+                numGates++
+            }
+        }
+        gateBefore[len(b.nodes)] = numGates
+        circ.Groups = make([]GateGroup, len(b.groups))
+        for i, group := range b.groups {
+            circ.Groups[i] = GateGroup{group.Name, gateBefore[group.Start], gateBefore[group.End], group.Parent}
+        }
+    }
+
+    next = 0
+    for _, wires := range b.outputWires {
+        for _, w := range wires {
+            circ.connectOutputWire(gateOf[w], next)
+            next++
+        }
+    }
+
+    if err := circ.checkDomain(); err != nil {
+        return nil, err
+    }
+    return circ, nil
+}
@@ -0,0 +1,194 @@
+package toygarble
+
+import (
+    "fmt"
+    "slices"
+    "strings"
+    "testing"
+)
+
+// The 4-bit ripple-carry adder from the Builder documentation
+func build4BitAdder() (*Circuit, error) {
+    b := NewBuilder()
+    x := b.Input("x", 4)
+    y := b.Input("y", 4)
+    sum := make([]Wire, 4)
+    carry := b.Const(false)
+    for i := 0; i < 4; i++ {
+        t := b.Xor(x[i], y[i])
+        sum[i] = b.Xor(t, carry)
+        carry = b.Or(b.And(x[i], y[i]), b.And(t, carry))
+    }
+    return b.Output("sum", sum...).Build()
+}
+
+func ExampleBuilder() {
+    circ, err := build4BitAdder()
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    result, err := circ.EvaluateInts([]int64{9, 5}, []int{4, 4})
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    fmt.Println(circ.InputVarNames, circ.OutputVarNames, result[0])
+    // Output: [x y] [sum] 14
+}
+
+func TestBuilderAdder(t *testing.T) {
+    circ, err := build4BitAdder()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for x := int64(0); x < 16; x++ {
+        for y := int64(0); y < 16; y++ {
+            result, err := circ.EvaluateInts([]int64{x, y}, []int{4, 4})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if result[0] != (x + y) % 16 {
+                t.Errorf("%d + %d: got %d", x, y, result[0])
+            }
+        }
+    }
+}
+
+func TestBuilderErrors(t *testing.T) {
+    cases := map[string]func(b *Builder){
+        "no outputs": func(b *Builder) {
+            b.Input("x", 1)
+        },
+        "invalid wire": func(b *Builder) {
+            x := b.Input("x", 1)
+            b.Output("z", b.And(x[0], Wire(5)))
+        },
+        "negative wire": func(b *Builder) {
+            b.Output("z", Wire(-1))
+        },
+        "duplicate input": func(b *Builder) {
+            x := b.Input("x", 1)
+            b.Input("x", 1)
+            b.Output("z", x[0])
+        },
+        "duplicate output": func(b *Builder) {
+            x := b.Input("x", 1)
+            b.Output("z", x[0]).Output("z", x[0])
+        },
+        "bad LUT": func(b *Builder) {
+            x := b.Input("x", 2)
+            b.Output("z", b.LUT(x, []bool{true}))
+        },
+        "bad domain": func(b *Builder) {
+            x := b.Input("x", 1)
+            b.WireDomain(1).Output("z", x[0])
+        },
+    }
+    for name, build := range cases {
+        b := NewBuilder()
+        mustNotPanic(t, name, func() {
+            build(b)
+            if _, err := b.Build(); err == nil {
+                t.Errorf("%s: built", name)
+            }
+        })
+    }
+}
+
+// Errors name the gate type rather than its number
+func TestBuilderErrorNamesGateType(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 1)
+    _, err := b.Output("z", b.And(x[0], Wire(5))).Build()
+    if err == nil || !strings.Contains(err.Error(), "of type AND") {
+        t.Errorf("got %v, want an error naming the AND gate", err)
+    }
+}
+
+// Inputs come first in the gate array, then outputs, then logic in the
+// order it was created
+func TestBuilderLayout(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    n := b.Not(x[1])
+    y := b.Input("y", 1)
+    circ, err := b.Output("out", b.And(n, y[0]), x[0]).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []GateType_t{GateINPUT, GateINPUT, GateINPUT, GateOUTPUT, GateOUTPUT, GateNOT, GateAND}
+    if len(circ.Gates) != len(want) {
+        t.Fatalf("got %d gates, want %d", len(circ.Gates), len(want))
+    }
+    for g, gateType := range want {
+        if circ.Gates[g].GateType != gateType {
+            t.Errorf("gate %d has type %v, want %v", g, circ.Gates[g].GateType, gateType)
+        }
+    }
+    // x1 = 0 and y = 1 sets the first output
+    if ok, out := circ.EvaluateCircuit([]bool{false, false, true}); !ok || !out[0] || out[1] {
+        t.Errorf("got %v, want [true false]", out)
+    }
+}
+
+// Two 2-bit adders chained inside a circuit that is itself embedded, so
+// the groups nest two deep
+func buildNestedAdders(t *testing.T) *Circuit {
+    t.Helper()
+    add := BuildAdder(2)
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    y := b.Input("y", 2)
+    z := b.Input("z", 2)
+    s := b.Embed("add1", add, append(slices.Clone(x), y...)...)
+    s = b.Embed("add2", add, append(s, z...)...)
+    inner, err := b.Output("s", s...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    b = NewBuilder()
+    p := b.Input("p", 6)
+    out := b.Embed("sum3", inner, p...)
+    outer, err := b.Output("out", b.Not(out[0]), out[1]).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return outer
+}
+
+func TestBuilderEmbed(t *testing.T) {
+    circ := buildNestedAdders(t)
+    for v := int64(0); v < 64; v++ {
+        out, err := circ.EvaluateInts([]int64{v}, []int{6})
+        if err != nil {
+            t.Fatal(err)
+        }
+        want := (v & 3 + v >> 2 & 3 + v >> 4 & 3) & 3 ^ 1
+        if out[0] != want {
+            t.Errorf("input %06b: got %d, want %d", v, out[0], want)
+        }
+    }
+
+    if len(circ.Groups) != 3 {
+        t.Fatalf("groups %+v, want sum3 holding add1 and add2", circ.Groups)
+    }
+    top := circ.Groups[0]
+    if top.Name != "sum3" || top.Parent != -1 {
+        t.Errorf("first group is %+v, want sum3 at the top level", top)
+    }
+    for i, name := range []string{"add1", "add2"} {
+        g := circ.Groups[i + 1]
+        if g.Name != name || g.Parent != 0 || g.Start < top.Start || g.End > top.End || g.End <= g.Start {
+            t.Errorf("group %d is %+v, want %s inside sum3", i + 1, g, name)
+        }
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    b.Embed("short", BuildAdder(2), x...)
+    if _, err := b.Output("out", x[0]).Build(); err == nil {
+        t.Error("embedding with the wrong number of inputs succeeded")
+    }
+}
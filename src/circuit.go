@@ -1,8 +1,9 @@
 package toygarble
 
 import (
-    "os"
     "fmt"
+    "log/slog"
+    "slices"
 )
 
 //
@@ -12,7 +13,17 @@ import (
 type GateType_t int
 
 const (
-    MAX_INPUT_DEGREE    int = 2
+    // Largest number of inputs to a lookup-table gate
+    MAX_LUT_INPUTS      int = 8
+
+    MAX_INPUT_DEGREE    int = MAX_LUT_INPUTS
+)
+
+const (
+    // Parties supplying input variables. The garbler's inputs are sent
+    // directly; the evaluator's are obtained by oblivious transfer.
+    PARTY_GARBLER       int = 0
+    PARTY_EVALUATOR     int = 1
 )
 
 const (
@@ -24,11 +35,28 @@ const (
     GateXOR     GateType_t = 5
     GateCONST   GateType_t = 6
     GateCOPY    GateType_t = 7
+    GateMUX     GateType_t = 8
+    GateLUT     GateType_t = 9
+    GateTOFFLI  GateType_t = 10
+    GateCNOT    GateType_t = 11
+    GateADDK    GateType_t = 12
+    GateMULK    GateType_t = 13
+    GateMAJ     GateType_t = 14
 )
 
 // Max input wires for gates described above
-var min_input_wires = [...]int {0, 0, 2, 2, 1, 2, 0, 1}
-var max_input_wires = [...]int {0, 1, 2, 2, 1, 2, 0, 1}
+var min_input_wires = [...]int {0, 0, 2, 2, 1, 2, 0, 1, 3, 1, 3, 2, 2, 2, 3}
+var max_input_wires = [...]int {0, 1, 2, 2, 1, 2, 0, 1, 3, MAX_LUT_INPUTS, 3, 2, 2, 2, 3}
+
+// Printable names for the gates described above
+var gate_type_names = [...]string {"INPUT", "OUTPUT", "AND", "OR", "NOT", "XOR", "CONST", "COPY", "MUX", "LUT", "TOFFLI", "CNOT", "ADDK", "MULK", "MAJ"}
+
+func (t GateType_t) String() string {
+    if t < 0 || int(t) >= len(gate_type_names) {
+        return fmt.Sprintf("GateType_t(%d)", int(t))
+    }
+    return gate_type_names[t]
+}
 
 type Circuit struct {
     // Total number of input and output wires
@@ -42,22 +70,88 @@ type Circuit struct {
     // Number of output variables, and how they are divided into wires
     NumOutputVars    int
     NumWiresOV       []int
+
+    // Optional names for the input and output variables
+    InputVarNames   []string
+    OutputVarNames  []string
+
+    // Optionally, which party supplies each input variable in a two-party
+    // computation: PARTY_GARBLER or PARTY_EVALUATOR (see SetInputParty)
+    InputParty      []int
     
     Gates           []Gate
+
+    // The gate carrying each input wire, if they aren't the usual INPUT
+    // gates at the start of the circuit (see DeclareInput)
+    InputGates      []int
+
+    // The gate carrying each output wire, if they aren't the usual OUTPUT
+    // gates following the inputs (see FuseOutputs)
+    OutputGates     []int
+
+    // Size limits enforced while building the circuit, nil for DefaultLimits
+    Limits          *Limits
+
+    // Whether addGate rejects inputs from gates that don't exist yet, so
+    // that wiring mistakes are caught where they are made (see
+    // AddGateChecked) rather than when the circuit is validated
+    StrictBuild     bool
+
+    // Named ranges of gates, such as gadgets added with Builder.Embed
+    Groups          []GateGroup
+
+    // Invariants on internal wires, checked by CheckAssertions
+    Assertions      []Assertion
+
+    // Number of values each wire carries: 0 or 2 for ordinary boolean
+    // circuits, or k for circuits of ADDK and MULK gates working mod k
+    // (see EvaluateKary). Only boolean circuits can be garbled.
+    WireDomain      int
+
+    // Optionally, where each gate came from, such as the line of a program
+    // it was generated from, for error messages (see SetGateSource). It may
+    // be shorter than Gates; a missing or empty entry means no location.
+    SourceLoc       []string
+
+    // Where diagnostics from building and evaluating the circuit go, such
+    // as why a gate couldn't be added or evaluated. Evaluators use the
+    // circuit's. Nil discards them.
+    Logger          *slog.Logger
+}
+
+// A named, contiguous range of gates. Groups nest: a group lies entirely
+// within its parent, which comes earlier in the Groups list.
+type GateGroup struct {
+    Name        string  `json:"name"`
+
+    // The group's gates are Start up to (but not including) End
+    Start       int     `json:"start"`
+    End         int     `json:"end"`
+
+    // Index of the enclosing group, or -1 at the top level
+    Parent      int     `json:"parent"`
 }
 
 type Gate struct {
     GateType    GateType_t
     ConstVal    bool
     InFrom      []int
+
+    // For LUT gates, the output for each input combination. Entry k is the
+    // output when input j is set to bit j of k.
+    TruthTable  []bool
 }
 
 //
 // Initialize an empty circuit. Takes in the number of input and
-// output wires.
+// output wires. Returns an error if the circuit would exceed its limits.
 //
 
-func (circ *Circuit) initializeCircuit(numInputWires int, numOutputWires int, numInputVars int, numOutputVars int, numWiresPerIV []int, numWiresPerOV []int) {
+func (circ *Circuit) initializeCircuit(numInputWires int, numOutputWires int, numInputVars int, numOutputVars int, numWiresPerIV []int, numWiresPerOV []int) error {
+    if err := circ.limits().checkSize(0, numInputWires + numOutputWires, numInputWires); err != nil {
+        return err
+    }
+
     // Set the number of input and output wires
     circ.NumInputWires = numInputWires
     circ.NumOutputWires = numOutputWires
@@ -67,8 +161,13 @@ func (circ *Circuit) initializeCircuit(numInputWires int, numOutputWires int, nu
     circ.NumOutputVars = numOutputVars
     circ.NumWiresIV = numWiresPerIV
     circ.NumWiresOV = numWiresPerOV
+    circ.InputGates = nil
+    circ.OutputGates = nil
+    circ.Groups = nil
+    circ.SourceLoc = nil
     
     // Initialize the gate array with input and output wire "gates"
+    circ.Reserve(numInputWires + numOutputWires)
     for i := 0; i < numInputWires; i++ {
         circ.addGate(GateINPUT, false, nil)
     }
@@ -76,21 +175,174 @@ func (circ *Circuit) initializeCircuit(numInputWires int, numOutputWires int, nu
     for i := 0; i < numOutputWires; i++ {
         circ.addGate(GateOUTPUT, false, nil)
     }
+
+    return nil
+}
+
+// Make room for n more gates without reallocating, for use when the final
+// size of a circuit is known up front. Never reserves past the circuit's
+// wire limit.
+func (circ *Circuit) Reserve(n int) {
+    n = min(len(circ.Gates) + n, circ.limits().MaxWires)
+    if n > cap(circ.Gates) {
+        gates := make([]Gate, len(circ.Gates), n)
+        copy(gates, circ.Gates)
+        circ.Gates = gates
+    }
+}
+
+// Declare the next input variable, width wires wide, adding an INPUT gate
+// for each of its wires at the current end of the circuit. Variables must
+// be declared in order, so varIndex has to be NumInputVars; the new wires
+// follow the existing input wires, wherever their gates are. Returns the
+// new gates from least to most significant wire, or nil on error.
+func (circ *Circuit) DeclareInput(varIndex int, width int) []int {
+    if varIndex != circ.NumInputVars || width < 1 {
+        circ.logger().Error("can't declare input", "variable", varIndex, "width", width, "next", circ.NumInputVars)
+        return nil
+    }
+    if err := circ.limits().checkSize(0, len(circ.Gates) + width, circ.NumInputWires + width); err != nil {
+        circ.logger().Error("can't declare input", "err", err)
+        return nil
+    }
+
+    // Pin down the existing layout before the wire counts change under it
+    circ.pinLayout()
+
+    gates := make([]int, width)
+    for j := range gates {
+        gates[j] = circ.addGate(GateINPUT, false, nil)
+    }
+    circ.InputGates = append(circ.InputGates, gates...)
+    circ.NumInputWires += width
+    circ.NumInputVars++
+    circ.NumWiresIV = append(circ.NumWiresIV, width)
+    if len(circ.InputVarNames) != 0 {
+        circ.InputVarNames = append(circ.InputVarNames, "")
+    }
+    if len(circ.InputParty) != 0 {
+        circ.InputParty = append(circ.InputParty, PARTY_GARBLER)
+    }
+    return append([]int(nil), gates...)
+}
+
+// Record the gates carrying the input and output wires explicitly, so the
+// layout no longer depends on the wire counts
+func (circ *Circuit) pinLayout() {
+    if circ.InputGates == nil {
+        circ.InputGates = make([]int, circ.NumInputWires)
+        for w := range circ.InputGates {
+            circ.InputGates[w] = w
+        }
+    }
+    if circ.OutputGates == nil {
+        circ.OutputGates = make([]int, circ.NumOutputWires)
+        for w := range circ.OutputGates {
+            circ.OutputGates[w] = circ.NumInputWires + w
+        }
+    }
 }
 
 // Adds a new gate. Returns -1 if the gate is invalid.
 func (circ *Circuit) addGate(gateType GateType_t, constVal bool, inFrom []int) int {
     // Make sure the gate has the correct number of input wires
     if len(inFrom) < min_input_wires[gateType] || len(inFrom) > max_input_wires[gateType] {
-        fmt.Printf("ERROR ADDING GATE, type = %d, input = %d, min = %d, max = %d\n", gateType, len(inFrom), min_input_wires[gateType], max_input_wires[gateType])
+        circ.logger().Error("can't add gate", "type", gateType, "inputs", len(inFrom), "min", min_input_wires[gateType], "max", max_input_wires[gateType])
+        return -1
+    }
+    if circ.StrictBuild {
+        if err := circ.checkGateInputs(inFrom); err != nil {
+            circ.logger().Error("can't add gate", "err", err)
+            return -1
+        }
+    }
+
+    // Make sure the circuit isn't growing past its limits
+    numGates := 0
+    if gateType != GateINPUT && gateType != GateOUTPUT {
+        numGates = circ.numLogicGates() + 1
+    }
+    if err := circ.limits().checkSize(numGates, len(circ.Gates) + 1, circ.NumInputWires); err != nil {
+        circ.logger().Error("can't add gate", "err", err)
         return -1
     }
     
-    newGate := Gate{gateType, constVal, inFrom}
+    newGate := Gate{gateType, constVal, inFrom, nil}
     circ.Gates = append(circ.Gates, newGate)
     return len(circ.Gates) - 1
 }
 
+// Check that every input of a gate about to be added is an existing gate
+func (circ *Circuit) checkGateInputs(inFrom []int) error {
+    for _, in := range inFrom {
+        if in < 0 || in >= len(circ.Gates) {
+            return fmt.Errorf("input from gate %d, which doesn't exist yet (%d gates): %w", in, len(circ.Gates), ErrOutOfRange)
+        }
+    }
+    return nil
+}
+
+// Adds a new gate, as addGate does in strict mode: the gate must have the
+// right number of inputs for its type, all from existing gates. Use AddLUT
+// for lookup tables.
+func (circ *Circuit) AddGateChecked(gateType GateType_t, constVal bool, inFrom []int) (int, error) {
+    if gateType < 0 || int(gateType) >= len(min_input_wires) || gateType == GateLUT {
+        return -1, fmt.Errorf("can't add a gate of type %v: %w", gateType, ErrInvalidGate)
+    }
+    if len(inFrom) < min_input_wires[gateType] || len(inFrom) > max_input_wires[gateType] {
+        return -1, fmt.Errorf("%v gate with %d inputs: %w", gateType, len(inFrom), ErrInvalidGate)
+    }
+    if err := circ.checkGateInputs(inFrom); err != nil {
+        return -1, err
+    }
+
+    gateNum := circ.addGate(gateType, constVal, append([]int(nil), inFrom...))
+    if gateNum < 0 {
+        return -1, fmt.Errorf("could not add %v gate", gateType)
+    }
+    return gateNum, nil
+}
+
+// Adds a new lookup-table gate over the given inputs. The table must have
+// one entry per input combination, indexed as described for Gate.TruthTable.
+func (circ *Circuit) AddLUT(inputs []int, table []bool) (int, error) {
+    if len(inputs) < 1 || len(inputs) > MAX_LUT_INPUTS {
+        return -1, fmt.Errorf("LUT must have between 1 and %d inputs, got %d: %w", MAX_LUT_INPUTS, len(inputs), ErrInvalidGate)
+    }
+    if len(table) != 1 << len(inputs) {
+        return -1, fmt.Errorf("LUT with %d inputs needs %d table entries, got %d: %w", len(inputs), 1 << len(inputs), len(table), ErrInvalidGate)
+    }
+    for _, in := range inputs {
+        if in < 0 || in >= len(circ.Gates) {
+            return -1, fmt.Errorf("LUT input from nonexistent gate %d: %w", in, ErrOutOfRange)
+        }
+    }
+
+    gateNum := circ.addGate(GateLUT, false, append([]int(nil), inputs...))
+    if gateNum < 0 {
+        return -1, fmt.Errorf("could not add LUT gate")
+    }
+    circ.Gates[gateNum].TruthTable = append([]bool(nil), table...)
+    return gateNum, nil
+}
+
+// Adds a new majority gate, which outputs 1 if at least two of a, b and c
+// are 1. Returns -1 if the gate is invalid.
+func (circ *Circuit) AddMAJ(a int, b int, c int) int {
+    for _, in := range []int{a, b, c} {
+        if in < 0 || in >= len(circ.Gates) {
+            circ.logger().Error("can't add gate", "type", GateMAJ, "input", in, "err", "input from nonexistent gate")
+            return -1
+        }
+    }
+    return circ.addGate3(GateMAJ, a, b, c)
+}
+
+// Adds a new gate with three inputs
+func (circ *Circuit) addGate3(gateType GateType_t, inFrom1 int, inFrom2 int, inFrom3 int) int {
+    return circ.addGate(gateType, false, []int{inFrom1, inFrom2, inFrom3})
+}
+
 // Adds a new gate with two inputs
 func (circ *Circuit) addGate2(gateType GateType_t, inFrom1 int, inFrom2 int) int {
     gates := make([]int, 2)
@@ -102,6 +354,16 @@ func (circ *Circuit) addGate2(gateType GateType_t, inFrom1 int, inFrom2 int) int
 // Connects an gate to an output wire
 func (circ *Circuit) connectOutputWire(gateNum int, outputNum int) bool {
     //fmt.Printf("connectOutputWire(%d, %d)\n", gateNum, circ.getOutputGate(outputNum))
+    if outputNum < 0 || outputNum >= circ.NumOutputWires || gateNum < 0 || gateNum >= len(circ.Gates) {
+        return false
+    }
+    if o := circ.getOutputGate(outputNum); o < 0 || o >= len(circ.Gates) {
+        return false
+    }
+    if circ.Gates[circ.getOutputGate(outputNum)].GateType != GateOUTPUT {
+        // Fused into its driving gate, so already connected
+        return false
+    }
     if len((circ.Gates[circ.getOutputGate(outputNum)].InFrom)) == 0 {
         circ.Gates[circ.getOutputGate(outputNum)].InFrom = append(circ.Gates[circ.getOutputGate(outputNum)].InFrom, gateNum)
         return true
@@ -110,31 +372,168 @@ func (circ *Circuit) connectOutputWire(gateNum int, outputNum int) bool {
     }
 }
 
+// List the output gates driven by more than one gate, in order. The builders
+// never produce these, but direct edits to Gates can; validCircuit rejects
+// them without saying which.
+func (circ *Circuit) MultiDrivenOutputs() []int {
+    var result []int
+    for i := range circ.Gates {
+        if circ.Gates[i].GateType == GateOUTPUT && len(circ.Gates[i].InFrom) > 1 {
+            result = append(result, i)
+        }
+    }
+    return result
+}
+
 // Check the structure of a circuit to make sure it is valid, and can
 // be executed or garbled
 func (circ *Circuit) validCircuit() bool {
     // Make sure there are a correct number of gates in the circuit
-    if len(circ.Gates) < (circ.NumInputWires + circ.NumOutputWires) {
-        return false
+    if circ.OutputGates == nil {
+        if len(circ.Gates) < (circ.NumInputWires + circ.NumOutputWires) {
+            return false
+        }
+    } else {
+        if len(circ.OutputGates) != circ.NumOutputWires || len(circ.Gates) < circ.NumInputWires {
+            return false
+        }
+        for _, g := range circ.OutputGates {
+            if g < 0 || g >= len(circ.Gates) {
+                return false
+            }
+        }
+    }
+    
+    if circ.InputGates != nil {
+        // Once inputs move, outputs can't be found by position either
+        if len(circ.InputGates) != circ.NumInputWires || circ.OutputGates == nil {
+            return false
+        }
+        for _, g := range circ.InputGates {
+            if g < 0 || g >= len(circ.Gates) || circ.Gates[g].GateType != GateINPUT {
+                return false
+            }
+        }
     }
     
     // Go through each gate and make sure it is properly connected
     for i := 0; i < len(circ.Gates); i++ {
+        if circ.Gates[i].GateType < 0 || int(circ.Gates[i].GateType) >= len(min_input_wires) {
+            // Not a gate type we know
+            return false
+        }
+        for _, from := range circ.Gates[i].InFrom {
+            if from < 0 || from >= len(circ.Gates) {
+                // Connected to a gate that doesn't exist
+                return false
+            }
+        }
         if len(circ.Gates[i].InFrom) < min_input_wires[circ.Gates[i].GateType] ||
             len(circ.Gates[i].InFrom) > max_input_wires[circ.Gates[i].GateType] {
             // This gate doesn't have the right number of connected input wires
             return false
         }
+        if circ.Gates[i].GateType == GateOUTPUT && len(circ.Gates[i].InFrom) != 1 {
+            // An output gate left unconnected has no value to copy
+            return false
+        }
+
+        if circ.Gates[i].GateType == GateLUT && len(circ.Gates[i].TruthTable) != 1 << len(circ.Gates[i].InFrom) {
+            // The lookup table doesn't match the number of inputs
+            return false
+        }
+    }
+
+    // The variables must cover the wires exactly
+    if !validVarWidths(circ.NumWiresIV, circ.NumInputVars, circ.NumInputWires) ||
+        !validVarWidths(circ.NumWiresOV, circ.NumOutputVars, circ.NumOutputWires) {
+        return false
+    }
+
+    for _, a := range circ.Assertions {
+        if a.Gate < 0 || a.Gate >= len(circ.Gates) {
+            return false
+        }
+    }
+
+    if len(circ.SourceLoc) > len(circ.Gates) {
+        return false
+    }
+
+    if len(circ.InputParty) != 0 {
+        if len(circ.InputParty) != circ.NumInputVars {
+            return false
+        }
+        for _, party := range circ.InputParty {
+            if party != PARTY_GARBLER && party != PARTY_EVALUATOR {
+                return false
+            }
+        }
+    }
+
+    for i, group := range circ.Groups {
+        if group.Start < 0 || group.Start > group.End || group.End > len(circ.Gates) {
+            return false
+        }
+        if group.Parent >= i || group.Parent < -1 {
+            return false
+        }
+        if group.Parent >= 0 && (group.Start < circ.Groups[group.Parent].Start || group.End > circ.Groups[group.Parent].End) {
+            // The group spills out of its parent
+            return false
+        }
+    }
+
+    if circ.checkDomain() != nil {
+        return false
     }
             
     return true
 }
 
+// Check that numVars variables with the given widths make up numWires wires
+func validVarWidths(widths []int, numVars int, numWires int) bool {
+    if len(widths) != numVars {
+        return false
+    }
+    total := 0
+    for _, width := range widths {
+        if width < 0 {
+            return false
+        }
+        total += width
+    }
+    return total == numWires
+}
+
+// Check that every gate is of one of the allowed types, for backends that
+// only support some of them. Input and output wires are always allowed.
+func (circ *Circuit) RequireGateTypes(allowed []GateType_t) error {
+    for i := range circ.Gates {
+        gateType := circ.Gates[i].GateType
+        if gateType == GateINPUT || gateType == GateOUTPUT || slices.Contains(allowed, gateType) {
+            continue
+        }
+        return fmt.Errorf("%s has unsupported type %v: %w", circ.describeGate(i), gateType, ErrInvalidGate)
+    }
+    return nil
+}
+
 // Circuit evaluation on concrete inputs. Returns success/failure and a list of output bits.
 // Inefficient algorithm used for testing.
 func (circ *Circuit) EvaluateCircuit(inputBits []bool) (bool, []bool) {
-    // Make sure the number of input and output gates is correct
-    if len(inputBits) != circ.NumInputWires || circ.NumOutputWires < 1 {
+    // Make sure the number of input and output gates is correct, and that
+    // the wires carry bits
+    if len(inputBits) != circ.NumInputWires {
+        circ.logger().Error("wrong number of input bits", "got", len(inputBits), "want", circ.NumInputWires)
+        return false, nil
+    }
+    if circ.NumOutputWires < 1 || !circ.validCircuit() {
+        circ.logger().Error("can't evaluate invalid circuit")
+        return false, nil
+    }
+    if err := circ.requireBoolean(); err != nil {
+        circ.logger().Error("can't evaluate circuit", "err", err)
         return false, nil
     }
     
@@ -143,6 +542,12 @@ func (circ *Circuit) EvaluateCircuit(inputBits []bool) (bool, []bool) {
     calculated := make([]bool, len(circ.Gates)) // defaults to all false
     values := make([]bool, len(circ.Gates)) // defaults to all false
     result := make([]bool, circ.NumOutputWires)    // defaults to all false
+
+    // Input values indexed by gate, since input gates can be anywhere
+    gateInputs := make([]bool, len(circ.Gates))
+    for w := 0; w < circ.NumInputWires; w++ {
+        gateInputs[circ.getInputGate(w)] = inputBits[w]
+    }
     
     // For each output gate, recursively evaluate the entire circuit
     // using the scratch variables
@@ -153,10 +558,10 @@ func (circ *Circuit) EvaluateCircuit(inputBits []bool) (bool, []bool) {
         }
         
         // Evaluate the output gate to get a result, error out if it fails
-        success, resultBit := circ.evaluateGate(circ.getOutputGate(i), &visited, &calculated, &values, &inputBits)
+        success, resultBit := circ.evaluateGate(circ.getOutputGate(i), &visited, &calculated, &values, &gateInputs)
         result[i] = resultBit
         if success == false {
-            fmt.Printf("Failed\n")
+            circ.logger().Error("evaluation failed", "output", i)
             return false, nil
         }
     }
@@ -165,13 +570,16 @@ func (circ *Circuit) EvaluateCircuit(inputBits []bool) (bool, []bool) {
     return true, result
 }
         
-// Gate evaluation for concrete inputs, recursive subroutine
+// Gate evaluation for concrete inputs, recursive subroutine. The inputs
+// are indexed by gate.
 func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]bool, values *[]bool, inputs *[]bool) (bool, bool) {
 
     var success1    bool
     var success2    bool
+    var success3    bool
     var result1     bool
     var result2     bool
+    var result3     bool
 
     // If the gate has already been visited, but not calculated, we're in a loop -- return an error
     if (*visited)[gateID] == true && (*calculated)[gateID] == false {
@@ -188,19 +596,23 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
     result := false
     success := true
     
-    // If this is not an input "gate", recurse on any inputs
-    if circ.Gates[gateID].GateType != GateINPUT {
+    // If this is not an input "gate", recurse on any inputs (CONST gates have none)
+    if circ.Gates[gateID].GateType != GateINPUT && len(circ.Gates[gateID].InFrom) > 0 {
         success1, result1 = circ.evaluateGate(circ.Gates[gateID].InFrom[0], visited, calculated, values, inputs)
         
-        if len(circ.Gates[gateID].InFrom) == 2 {
+        if len(circ.Gates[gateID].InFrom) >= 2 {
             success2, result2 = circ.evaluateGate(circ.Gates[gateID].InFrom[1], visited, calculated, values, inputs)
         }
+
+        if len(circ.Gates[gateID].InFrom) >= 3 {
+            success3, result3 = circ.evaluateGate(circ.Gates[gateID].InFrom[2], visited, calculated, values, inputs)
+        }
     }
     
     switch circ.Gates[gateID].GateType {
     case GateINPUT:
         //fmt.Printf("Evaluating IN  gate %d\n", gateID)
-        result = (*inputs)[gateID] // TODO: change this in case input gates aren't 0-aligned
+        result = (*inputs)[gateID]
         
     case GateOUTPUT:
         // Output "gates" are equal to whatever (solitary) predecessor gate they're wired to,
@@ -211,7 +623,7 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
             result = result1
         } else {
             success = false
-            os.Stderr.WriteString("Error evaluating output 'gate', wrong number of input wires")
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
         }
         
         //fmt.Printf("Success\n")
@@ -221,10 +633,10 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
             result = result1
         } else {
             success = false
-            os.Stderr.WriteString("Error evaluating copy gate, there should only be one input")
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
         }
         
-    case GateAND:
+    case GateAND, GateMULK:
         // AND gates must have two inputs, which we recurse on
         if len(circ.Gates[gateID].InFrom) == 2 {
             //fmt.Printf("Evaluating AND gate %d\n", gateID)
@@ -232,30 +644,29 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
             if (success1 && success2) == true {
                 result = result1 && result2
             } else {
-                fmt.Printf("AND error\n")
                 success = false
             }
             
         } else {
             success = false
-            os.Stderr.WriteString("Error evaluating AND 'gate', wrong number of input wires")
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
         }
     
-    case GateXOR:
-        // XOR gates must have two inputs, which we recurse on
+    case GateXOR, GateADDK:
+        // XOR gates must have two inputs, which we recurse on. Over bits,
+        // addition mod k is XOR and multiplication AND.
         if len(circ.Gates[gateID].InFrom) == 2 {
             //fmt.Printf("Evaluating XOR gate %d\n", gateID)
 
             if (success1 && success2) == true {
                 result = result1 != result2
             } else {
-                fmt.Printf("XOR error\n")
                 success = false
             }
             
         } else {
             success = false
-            os.Stderr.WriteString("Error evaluating XOR 'gate', wrong number of input wires")
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
         }
         
     case GateCONST:
@@ -278,7 +689,7 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
             }
         } else {
             success = false
-            os.Stderr.WriteString("Error evaluating AND 'gate', wrong number of input wires")
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
         }
             
     case GateNOT:
@@ -291,17 +702,97 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
             }
         } else {
             success = false
-            os.Stderr.WriteString("Error evaluating NOT 'gate', wrong number of input wires")
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
+        }
+
+    case GateMUX:
+        // MUX gates take a select wire followed by the two data wires,
+        // and output the second input if select is 0, the third if it is 1
+        if len(circ.Gates[gateID].InFrom) == 3 {
+            if success1 && success2 && success3 {
+                if result1 {
+                    result = result3
+                } else {
+                    result = result2
+                }
+            } else {
+                success = false
+            }
+        } else {
+            success = false
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
+        }
+
+    case GateTOFFLI:
+        // Toffoli (CCNOT) gates take two control wires followed by a
+        // target, and flip the target if both controls are set
+        if len(circ.Gates[gateID].InFrom) == 3 {
+            if success1 && success2 && success3 {
+                result = result3 != (result1 && result2)
+            } else {
+                success = false
+            }
+        } else {
+            success = false
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
+        }
+
+    case GateMAJ:
+        // MAJ gates output 1 if at least two of their three inputs are 1
+        if len(circ.Gates[gateID].InFrom) == 3 {
+            if success1 && success2 && success3 {
+                result = (result1 && result2) || (result1 && result3) || (result2 && result3)
+            } else {
+                success = false
+            }
+        } else {
+            success = false
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
+        }
+
+    case GateCNOT:
+        // CNOT gates take a control wire and a target, and flip the
+        // target if the control is set
+        if len(circ.Gates[gateID].InFrom) == 2 {
+            if success1 && success2 {
+                result = result2 != result1
+            } else {
+                success = false
+            }
+        } else {
+            success = false
+            circ.logger().Error("wrong number of input wires", "gate", gateID, "type", circ.Gates[gateID].GateType)
+        }
+
+    case GateLUT:
+        // LUT gates look up the output in their table, using the input
+        // bits as the address. Inputs past the third haven't been visited
+        // yet, but recursing on the earlier ones again just hits the cache.
+        if len(circ.Gates[gateID].TruthTable) == 1 << len(circ.Gates[gateID].InFrom) {
+            address := 0
+            for j, from := range circ.Gates[gateID].InFrom {
+                successIn, resultIn := circ.evaluateGate(from, visited, calculated, values, inputs)
+                if successIn == false {
+                    success = false
+                }
+                if resultIn {
+                    address |= 1 << j
+                }
+            }
+            result = circ.Gates[gateID].TruthTable[address]
+        } else {
+            success = false
+            circ.logger().Error("truth table doesn't match input wires", "gate", gateID)
         }
             
         default:
-            fmt.Printf("Unknown gate type %d for %d\n", circ.Gates[gateID].GateType, gateID)
+            circ.logger().Error("unknown gate type", "gate", gateID, "type", circ.Gates[gateID].GateType)
             success = false
 
     }
     
     if success == false {
-        fmt.Printf("Error in gate %d\n", gateID)
+        circ.logger().Debug("evaluation failed through gate", "gate", gateID)
     } else {
         (*calculated)[gateID] = true
         (*values)[gateID] = result
@@ -310,37 +801,105 @@ func (circ *Circuit) evaluateGate(gateID int, visited *[]bool, calculated *[]boo
     return success, result
 }
 
+// Number of gates in the circuit, including input and output wires
+func (circ *Circuit) GateCount() int {
+    return len(circ.Gates)
+}
+
+// Read gate i: its type, constant value and (a copy of) its input gates
+func (circ *Circuit) Gate(i int) (GateType_t, bool, []int, error) {
+    if i < 0 || i >= len(circ.Gates) {
+        return 0, false, nil, fmt.Errorf("gate %d out of range (%d gates): %w", i, len(circ.Gates), ErrOutOfRange)
+    }
+    gate := &circ.Gates[i]
+    return gate.GateType, gate.ConstVal, append([]int(nil), gate.InFrom...), nil
+}
+
+// Record where gate idx came from, so errors about it can point there.
+// SourceLoc is allocated on first use, so circuits without locations
+// don't pay for them.
+func (circ *Circuit) SetGateSource(idx int, loc string) error {
+    if idx < 0 || idx >= len(circ.Gates) {
+        return fmt.Errorf("gate %d out of range (%d gates): %w", idx, len(circ.Gates), ErrOutOfRange)
+    }
+    if idx >= len(circ.SourceLoc) {
+        if loc == "" {
+            return nil
+        }
+        circ.SourceLoc = append(circ.SourceLoc, make([]string, idx + 1 - len(circ.SourceLoc))...)
+    }
+    circ.SourceLoc[idx] = loc
+    return nil
+}
+
+// The source location of gate g, or "" if it has none
+func (circ *Circuit) sourceLoc(g int) string {
+    if g < 0 || g >= len(circ.SourceLoc) {
+        return ""
+    }
+    return circ.SourceLoc[g]
+}
+
+// Name gate g for an error message, with its source location if it has one
+func (circ *Circuit) describeGate(g int) string {
+    if loc := circ.sourceLoc(g); loc != "" {
+        return fmt.Sprintf("gate %d (%s)", g, loc)
+    }
+    return fmt.Sprintf("gate %d", g)
+}
+
 // Get the gate identities corresponding to specific input wires
 func (circ *Circuit) getInputGate(inputWireNo int) int {
+    if circ.InputGates != nil {
+        return circ.InputGates[inputWireNo]
+    }
     return inputWireNo
 }
 
 // Get the gate identities corresponding to specific output wires
 func (circ *Circuit) getOutputGate(outputWireNo int) int {
+    if circ.OutputGates != nil {
+        return circ.OutputGates[outputWireNo]
+    }
     return circ.NumInputWires + outputWireNo
 }
 
+// Check that input buffers will be accepted by PadInputsToBoolArray: there
+// are no more buffers than input variables, and no buffer has more bits
+// than its variable has wires. The error says which variable is wrong and
+// by how much.
+func (circ *Circuit) CheckInputLayout(inputBufs [][]byte) error {
+    if len(inputBufs) > circ.NumInputVars {
+        return fmt.Errorf("got %d input buffers, %d more than the %d input variables: %w", len(inputBufs), len(inputBufs) - circ.NumInputVars, circ.NumInputVars, ErrWireCountMismatch)
+    }
+    if len(inputBufs) > len(circ.NumWiresIV) {
+        return fmt.Errorf("only %d of %d input variables have widths: %w", len(circ.NumWiresIV), circ.NumInputVars, ErrInvalidCircuit)
+    }
+    for i, buf := range inputBufs {
+        if len(buf) * 8 > circ.NumWiresIV[i] {
+            return fmt.Errorf("input variable %d has %d wires, but its buffer has %d bits, %d too many: %w", i, circ.NumWiresIV[i], len(buf) * 8, len(buf) * 8 - circ.NumWiresIV[i], ErrWireCountMismatch)
+        }
+    }
+    return nil
+}
+
 // Convert an array of []byte values into a boolean array
-// that's bit-aligned with the circuit inputs
+// that's bit-aligned with the circuit inputs. Returns nil if
+// CheckInputLayout rejects the buffers.
 func (circ *Circuit) PadInputsToBoolArray(inputBufs [][]byte) []bool {
     
     currentLoc := 0
     result := make([]bool, circ.NumInputWires)
     
-    // Check that the number of given buffers is less than or equal to
-    // the number of input variables
-    if (len(inputBufs) > circ.NumInputVars) {
+    // Check that there are no more buffers than input variables, and that
+    // none has more bits than its variable
+    if err := circ.CheckInputLayout(inputBufs); err != nil {
+        circ.logger().Debug("can't pad inputs", "err", err)
         return nil
     }
     
     // Go through each given input and unpack it
     for i := 0; i < len(inputBufs); i++ {
-        // First make sure the input is the right length
-        if (len(inputBufs[i]) * 8) > circ.NumWiresIV[i] {
-            // Input is too big
-            return nil
-        }
-        
         // Copy the input into the bool array
         for j := 0; j < circ.NumWiresIV[i]; j++ {
             //fmt.Printf("currentLoc = %d, i=%d, j=%d, lenInputBufs=%d\n", currentLoc, i, j, len(inputBufs[i]))
@@ -405,11 +964,8 @@ func int64toBoolArray(input int64) []bool {
     
     for i := 63; i >= 0; i-- {
         result[i] = (input & (1 << i) != 0)
-        fmt.Printf("bool=%t\n", result[i])
     }
     
-    fmt.Printf("encoding integer=%d\n", input)
-    
     return result
 }
 
@@ -0,0 +1,765 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+    "testing"
+)
+
+// Run f, failing the test rather than crashing if it panics
+func mustNotPanic(t *testing.T, name string, f func()) {
+    t.Helper()
+    defer func() {
+        if r := recover(); r != nil {
+            t.Errorf("%s panicked: %v", name, r)
+        }
+    }()
+    f()
+}
+
+// A circuit with one input wire and one output wire, where the output gate
+// is never connected to anything
+func unconnectedOutputCircuit(t *testing.T) *Circuit {
+    t.Helper()
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(1, 1, 1, 1, []int{1}, []int{1}); err != nil {
+        t.Fatal(err)
+    }
+    return circ
+}
+
+func TestUnconnectedOutputRejected(t *testing.T) {
+    circ := unconnectedOutputCircuit(t)
+    if circ.validCircuit() {
+        t.Fatal("circuit with an unconnected output is valid")
+    }
+
+    // Such a circuit can still be written out, but doesn't read back
+    var buf bytes.Buffer
+    if err := circ.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(t.TempDir(), "unconnected.bin")
+    if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ReadBinary(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrInvalidCircuit) {
+        t.Errorf("ReadBinary: got %v, want ErrInvalidCircuit", err)
+    }
+    lc, err := OpenBinaryMapped(path)
+    if err == nil {
+        _, err = lc.Evaluate([]bool{true})
+        lc.Close()
+    }
+    if err == nil {
+        t.Error("mapped circuit with an unconnected output evaluated")
+    }
+
+    in := []bool{true}
+    rng := rand.New(rand.NewSource(1))
+    checks := map[string]func() error{
+        "NewEvaluator": func() error {
+            _, err := NewEvaluator(circ)
+            return err
+        },
+        "EvaluateWithFaults": func() error {
+            _, err := circ.EvaluateWithFaults(in, nil)
+            return err
+        },
+        "FrozenCircuit.Evaluate": func() error {
+            _, err := circ.Freeze().Evaluate(in)
+            return err
+        },
+        "AvalancheScore": func() error {
+            _, err := circ.AvalancheScore(4, rng)
+            return err
+        },
+        "EvaluateTernary": func() error {
+            _, err := circ.EvaluateTernary([]Ternary{TernaryX})
+            return err
+        },
+        "SymbolicOutput": func() error {
+            _, err := circ.SymbolicOutput(0)
+            return err
+        },
+        "EvaluateCircuitPacked": func() error {
+            _, err := circ.EvaluateCircuitPacked([]byte{1}, 1)
+            return err
+        },
+        "EvaluateKary": func() error {
+            _, err := circ.EvaluateKary([]int{1})
+            return err
+        },
+        "GenerateGoSource": func() error {
+            return circ.GenerateGoSource("p", "F", &bytes.Buffer{})
+        },
+        "Compile": func() error {
+            _, err := circ.Compile()
+            return err
+        },
+    }
+    for name, check := range checks {
+        mustNotPanic(t, name, func() {
+            if err := check(); !errors.Is(err, ErrInvalidCircuit) {
+                t.Errorf("%s: got %v, want ErrInvalidCircuit", name, err)
+            }
+        })
+    }
+    mustNotPanic(t, "EvaluateCircuit", func() {
+        if ok, _ := circ.EvaluateCircuit(in); ok {
+            t.Error("EvaluateCircuit succeeded")
+        }
+    })
+    mustNotPanic(t, "ConstantOutputs", func() {
+        if outputs := circ.ConstantOutputs(); outputs != nil {
+            t.Errorf("ConstantOutputs: got %v, want nil", outputs)
+        }
+    })
+}
+
+// Circuits whose fields disagree with each other in various ways
+func corruptedCircuits() map[string]*Circuit {
+    corrupt := func(f func(*Circuit)) *Circuit {
+        circ := BuildAdder(4)
+        f(circ)
+        return circ
+    }
+    return map[string]*Circuit{
+        "input from nonexistent gate": corrupt(func(c *Circuit) { c.Gates[len(c.Gates) - 1].InFrom = []int{9999, -3} }),
+        "output on nonexistent gate":  corrupt(func(c *Circuit) { c.OutputGates = []int{99999} }),
+        "input on nonexistent gate":   corrupt(func(c *Circuit) { c.InputGates = []int{-1} }),
+        "unknown gate type":           corrupt(func(c *Circuit) { c.Gates[20].GateType = 99 }),
+        "gate missing its inputs":     corrupt(func(c *Circuit) { c.Gates[20].InFrom = nil }),
+        "unconnected output":          corrupt(func(c *Circuit) { c.Gates[c.NumInputWires].InFrom = nil }),
+        "too many output wires":       corrupt(func(c *Circuit) { c.NumOutputWires = 100 }),
+        "too many input wires":        corrupt(func(c *Circuit) { c.NumInputWires = 100 }),
+        "variable widths":             corrupt(func(c *Circuit) { c.NumWiresIV = []int{1000, 2} }),
+        "assertion on nonexistent gate": corrupt(func(c *Circuit) { c.Assertions = []Assertion{{Gate: 9999}} }),
+    }
+}
+
+func TestCorruptedCircuitsReturnErrors(t *testing.T) {
+    in := make([]bool, 8)
+    for name, circ := range corruptedCircuits() {
+        if circ.validCircuit() {
+            t.Errorf("%s: circuit is valid", name)
+            continue
+        }
+        checks := map[string]func() error{
+            "NewEvaluator": func() error {
+                _, err := NewEvaluator(circ)
+                return err
+            },
+            "Depth": func() error {
+                _, err := circ.Depth()
+                return err
+            },
+            "CriticalPath": func() error {
+                _, err := circ.CriticalPath()
+                return err
+            },
+            "MultiplicativeDepth": func() error {
+                _, err := circ.MultiplicativeDepth()
+                return err
+            },
+            "EvaluateInts": func() error {
+                _, err := circ.EvaluateInts([]int64{1, 2}, []int{4, 4})
+                return err
+            },
+            "EvaluateTernary": func() error {
+                _, err := circ.EvaluateTernary(nil)
+                return err
+            },
+            "Compile": func() error {
+                _, err := circ.Compile()
+                return err
+            },
+            "WriteGenericJSON": func() error {
+                return circ.WriteGenericJSON(&bytes.Buffer{}, JSON_SCHEMA_NATIVE)
+            },
+        }
+        for check, f := range checks {
+            mustNotPanic(t, name + ": " + check, func() {
+                if err := f(); err == nil {
+                    t.Errorf("%s: %s succeeded", name, check)
+                }
+            })
+        }
+        mustNotPanic(t, name + ": DedupGates", func() {
+            if n := circ.Clone().DedupGates(); n != -1 {
+                t.Errorf("%s: DedupGates returned %d", name, n)
+            }
+        })
+        mustNotPanic(t, name + ": EvaluateCircuit", func() {
+            if ok, _ := circ.EvaluateCircuit(in); ok {
+                t.Errorf("%s: EvaluateCircuit succeeded", name)
+            }
+        })
+        mustNotPanic(t, name + ": round trip", func() {
+            var buf bytes.Buffer
+            if err := circ.WriteBinary(&buf); err == nil {
+                if _, err := ReadBinary(&buf); err == nil {
+                    t.Errorf("%s: ReadBinary succeeded", name)
+                }
+            }
+        })
+    }
+}
+
+func TestBadIndicesReturnErrors(t *testing.T) {
+    circ := BuildAdder(4)
+    in := make([]bool, circ.NumInputWires)
+    checks := map[string]func() error{
+        "Gate(-1)": func() error {
+            _, _, _, err := circ.Gate(-1)
+            return err
+        },
+        "Gate(past end)": func() error {
+            _, _, _, err := circ.Gate(len(circ.Gates))
+            return err
+        },
+        "SetGateSource": func() error {
+            return circ.SetGateSource(-1, "x.v:1")
+        },
+        "AddAssertion": func() error {
+            return circ.Clone().AddAssertion(-5, true)
+        },
+        "PathsBetween": func() error {
+            _, err := circ.PathsBetween(-1, 9999, 3)
+            return err
+        },
+        "SymbolicOutput": func() error {
+            _, err := circ.SymbolicOutput(circ.NumOutputWires)
+            return err
+        },
+        "AlgebraicNormalForm": func() error {
+            _, err := circ.AlgebraicNormalForm(-2)
+            return err
+        },
+        "EvaluateOutputVar": func() error {
+            _, err := circ.EvaluateOutputVar(in, 99)
+            return err
+        },
+        "SetInputVarName": func() error {
+            return circ.Clone().SetInputVarName(-1, "a")
+        },
+        "SetOutputVarName": func() error {
+            return circ.Clone().SetOutputVarName(77, "b")
+        },
+        "SetInputParty": func() error {
+            return circ.Clone().SetInputParty([]int{5})
+        },
+        "RemapInputs": func() error {
+            return circ.Clone().RemapInputs([]int{0, 0})
+        },
+        "AddGateChecked": func() error {
+            _, err := circ.Clone().AddGateChecked(GateAND, false, []int{-1, 99999})
+            return err
+        },
+        "AddLUT": func() error {
+            _, err := circ.Clone().AddLUT([]int{-1}, []bool{true, false})
+            return err
+        },
+        "EvaluateWithFaults": func() error {
+            _, err := circ.EvaluateWithFaults(in, map[int]bool{-1: true})
+            return err
+        },
+        "FirstOutputDifference": func() error {
+            _, err := circ.FirstOutputDifference(in, in[:3])
+            return err
+        },
+        "EvaluateInts": func() error {
+            _, err := circ.EvaluateInts([]int64{1}, []int{4, 4})
+            return err
+        },
+        "EvaluateCircuitPacked": func() error {
+            _, err := circ.EvaluateCircuitPacked([]byte{0}, 3)
+            return err
+        },
+        "EvaluateKary": func() error {
+            _, err := circ.EvaluateKary([]int{1, 2})
+            return err
+        },
+    }
+    for name, check := range checks {
+        mustNotPanic(t, name, func() {
+            if err := check(); err == nil {
+                t.Errorf("%s succeeded", name)
+            }
+        })
+    }
+    mustNotPanic(t, "Builder", func() {
+        b := NewBuilder()
+        x := b.Input("x", 2)
+        w := b.And(x[0], Wire(9999))
+        if _, err := b.Output("o", w, Wire(-9)).Build(); err == nil {
+            t.Error("Builder accepted nonexistent wires")
+        }
+    })
+}
+
+func TestMajorityLUT(t *testing.T) {
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(3, 1, 1, 1, []int{3}, []int{1}); err != nil {
+        t.Fatal(err)
+    }
+    table := make([]bool, 8)
+    for k := range table {
+        table[k] = k & 1 + k >> 1 & 1 + k >> 2 & 1 >= 2
+    }
+    g, err := circ.AddLUT([]int{0, 1, 2}, table)
+    if err != nil {
+        t.Fatal(err)
+    }
+    circ.connectOutputWire(g, 0)
+
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f, err := circ.Compile()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for k := 0; k < 8; k++ {
+        in := []bool{k & 1 == 1, k & 2 == 2, k & 4 == 4}
+        ok, out := circ.EvaluateCircuit(in)
+        if !ok || out[0] != table[k] {
+            t.Errorf("EvaluateCircuit on %v: got %v", in, out)
+        }
+        if out, err := e.Evaluate(in); err != nil || out[0] != table[k] {
+            t.Errorf("Evaluator on %v: got %v (%v)", in, out, err)
+        }
+        if out, err := f(in); err != nil || out[0] != table[k] {
+            t.Errorf("compiled on %v: got %v (%v)", in, out, err)
+        }
+    }
+
+    // Two inputs agreeing decide the majority whatever the third is
+    out, err := circ.EvaluateTernary([]Ternary{TernaryTrue, TernaryTrue, TernaryX})
+    if err != nil || out[0] != TernaryTrue {
+        t.Errorf("ternary: got %v (%v), want true", out, err)
+    }
+}
+
+// The native gate agrees with the majority LUT above, and gives a full
+// adder its carry
+func TestMajorityGate(t *testing.T) {
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(3, 1, 1, 1, []int{3}, []int{1}); err != nil {
+        t.Fatal(err)
+    }
+    circ.connectOutputWire(circ.AddMAJ(0, 1, 2), 0)
+    if circ.AddMAJ(0, 1, 99) != -1 {
+        t.Error("AddMAJ accepted a nonexistent input")
+    }
+
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f, err := circ.Compile()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for k := 0; k < 8; k++ {
+        in := []bool{k & 1 == 1, k & 2 == 2, k & 4 == 4}
+        want := k & 1 + k >> 1 & 1 + k >> 2 & 1 >= 2
+        ok, out := circ.EvaluateCircuit(in)
+        if !ok || out[0] != want {
+            t.Errorf("EvaluateCircuit on %v: got %v", in, out)
+        }
+        if out, err := e.Evaluate(in); err != nil || out[0] != want {
+            t.Errorf("Evaluator on %v: got %v (%v)", in, out, err)
+        }
+        if out, err := f(in); err != nil || out[0] != want {
+            t.Errorf("compiled on %v: got %v (%v)", in, out, err)
+        }
+    }
+    out, err := circ.EvaluateTernary([]Ternary{TernaryX, TernaryFalse, TernaryFalse})
+    if err != nil || out[0] != TernaryFalse {
+        t.Errorf("ternary: got %v (%v), want false", out, err)
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    sum, carry := b.FullAdder(x[0], x[1], x[2])
+    adder, err := b.Output("out", sum, carry).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for k := int64(0); k < 8; k++ {
+        result, err := adder.EvaluateInts([]int64{k}, []int{3})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if want := k & 1 + k >> 1 & 1 + k >> 2 & 1; result[0] != want {
+            t.Errorf("full adder on %03b: got %d, want %d", k, result[0], want)
+        }
+    }
+    if counts := adder.Stats().GateCounts; counts[GateMAJ] != 1 || counts[GateAND] != 0 {
+        t.Errorf("full adder has gate counts %v", counts)
+    }
+}
+
+func TestAddLUTErrors(t *testing.T) {
+    circ := BuildAdder(2)
+    if _, err := circ.AddLUT([]int{0, 1}, make([]bool, 3)); err == nil {
+        t.Error("table of the wrong size accepted")
+    }
+    if _, err := circ.AddLUT(nil, []bool{true}); err == nil {
+        t.Error("LUT without inputs accepted")
+    }
+    wide := make([]int, MAX_LUT_INPUTS + 1)
+    if _, err := circ.AddLUT(wide, make([]bool, 1 << len(wide))); err == nil {
+        t.Error("LUT over the input limit accepted")
+    }
+    if !circ.validCircuit() {
+        t.Error("rejected LUTs left the circuit invalid")
+    }
+}
+
+func TestRequireGateTypes(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    circ, err := b.Output("out", b.Mux(b.Xor(x[0], x[1]), b.Not(x[1]), x[2])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Gates 0-2 are inputs, 3 the output, then XOR, NOT and MUX
+    err = circ.RequireGateTypes([]GateType_t{GateAND, GateXOR, GateNOT})
+    if !errors.Is(err, ErrInvalidGate) {
+        t.Fatalf("a MUX passed an AND/XOR/NOT whitelist: %v", err)
+    }
+    if msg := err.Error(); !strings.Contains(msg, "gate 6 ") || !strings.Contains(msg, "MUX") {
+        t.Errorf("error doesn't name the MUX at gate 6: %v", err)
+    }
+
+    // Inputs and outputs never need listing
+    if err := circ.RequireGateTypes([]GateType_t{GateXOR, GateNOT, GateMUX}); err != nil {
+        t.Errorf("complete whitelist: %v", err)
+    }
+    if err := circ.RequireGateTypes(nil); !errors.Is(err, ErrInvalidGate) {
+        t.Errorf("empty whitelist: %v", err)
+    }
+    if err := (&Circuit{}).RequireGateTypes(nil); err != nil {
+        t.Errorf("empty circuit: %v", err)
+    }
+}
+
+func TestGateReturnsCopy(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    circ, err := b.Output("out", b.And(x[0], x[1])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := circ.GateCount(); n != 4 {
+        t.Fatalf("GateCount() = %d, want 4", n)
+    }
+
+    gateType, _, inFrom, err := circ.Gate(3)
+    if err != nil || gateType != GateAND || len(inFrom) != 2 || inFrom[0] != 0 || inFrom[1] != 1 {
+        t.Fatalf("Gate(3) = %v, %v, %v", gateType, inFrom, err)
+    }
+
+    // Scribbling on the returned slice leaves the circuit alone
+    inFrom[0] = 3
+    if circ.Gates[3].InFrom[0] != 0 {
+        t.Error("Gate returned the circuit's own InFrom slice")
+    }
+    if ok, out := circ.EvaluateCircuit([]bool{true, true}); !ok || !out[0] {
+        t.Error("circuit changed after modifying Gate's result")
+    }
+
+    for _, i := range []int{-1, 4} {
+        if _, _, _, err := circ.Gate(i); !errors.Is(err, ErrOutOfRange) {
+            t.Errorf("Gate(%d): %v", i, err)
+        }
+    }
+}
+
+func TestReserve(t *testing.T) {
+    circ := BuildAdder(4)
+    n := len(circ.Gates)
+    want := append([]Gate(nil), circ.Gates...)
+    circ.Reserve(100)
+    if len(circ.Gates) != n || cap(circ.Gates) < n + 100 {
+        t.Fatalf("after Reserve(100): len %d, cap %d (was %d gates)", len(circ.Gates), cap(circ.Gates), n)
+    }
+    for i := range want {
+        if !sameGate(&want[i], &circ.Gates[i]) {
+            t.Fatalf("gate %d changed", i)
+        }
+    }
+
+    // Nothing is reserved past the wire limit
+    limited := &Circuit{Limits: &Limits{MaxGates: 10, MaxWires: 10, MaxInputWires: 10}}
+    limited.Reserve(1 << 30)
+    if cap(limited.Gates) > 10 {
+        t.Errorf("reserved %d gates under a 10-wire limit", cap(limited.Gates))
+    }
+}
+
+// Copy src gate by gate with addGate, as a builder would, optionally
+// reserving room for the logic gates first
+func rebuildGates(tb testing.TB, src *Circuit, reserve bool) *Circuit {
+    circ := &Circuit{}
+    err := circ.initializeCircuit(src.NumInputWires, src.NumOutputWires, src.NumInputVars, src.NumOutputVars, src.NumWiresIV, src.NumWiresOV)
+    if err != nil {
+        tb.Fatal(err)
+    }
+    first := src.NumInputWires + src.NumOutputWires
+    if reserve {
+        circ.Reserve(len(src.Gates) - first)
+    }
+    for i := first; i < len(src.Gates); i++ {
+        gate := &src.Gates[i]
+        if circ.addGate(gate.GateType, gate.ConstVal, gate.InFrom) < 0 {
+            tb.Fatalf("gate %d rejected", i)
+        }
+    }
+    for i := src.NumInputWires; i < first; i++ {
+        circ.Gates[i].InFrom = src.Gates[i].InFrom
+    }
+    return circ
+}
+
+// Building the 64-bit multiplier (about 17,000 gates) with and without
+// reserving its gates up front
+func BenchmarkBuildMultiplier(b *testing.B) {
+    src, err := LoadBristol("../circuits/mult64.txt")
+    if err != nil {
+        b.Fatal(err)
+    }
+    for _, reserve := range []bool{false, true} {
+        b.Run(fmt.Sprintf("reserve=%t", reserve), func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                rebuildGates(b, src, reserve)
+            }
+        })
+    }
+}
+
+// Inputs declared after a constant and interleaved with logic are still
+// evaluated from the right wires, and survive serialization
+func TestDeclareInputAfterLogic(t *testing.T) {
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(0, 2, 0, 1, nil, []int{2}); err != nil {
+        t.Fatal(err)
+    }
+    one := circ.addGate(GateCONST, true, nil)
+    x := circ.DeclareInput(0, 2)
+    and := circ.addGate2(GateAND, x[0], x[1])
+    y := circ.DeclareInput(1, 1)
+    xor := circ.addGate2(GateXOR, y[0], one)
+    if x == nil || y == nil {
+        t.Fatal("DeclareInput failed")
+    }
+    if !slices.Equal(x, []int{3, 4}) || !slices.Equal(y, []int{6}) {
+        t.Fatalf("input gates %v and %v, want [3 4] and [6]", x, y)
+    }
+    circ.connectOutputWire(and, 0)
+    circ.connectOutputWire(xor, 1)
+    if circ.NumInputWires != 3 || !slices.Equal(circ.NumWiresIV, []int{2, 1}) || !circ.validCircuit() {
+        t.Fatalf("bad layout: %d input wires in %v", circ.NumInputWires, circ.NumWiresIV)
+    }
+
+    var buf bytes.Buffer
+    if err := circ.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    read, err := ReadBinary(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    eval, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for m := 0; m < 8; m++ {
+        in := []bool{m & 1 == 1, m & 2 == 2, m & 4 == 4}
+        want := []bool{in[0] && in[1], !in[2]}
+        ok, got := circ.EvaluateCircuit(in)
+        if !ok || !slices.Equal(got, want) {
+            t.Errorf("EvaluateCircuit(%v) = %v, want %v", in, got, want)
+        }
+        if got, err := eval.Evaluate(in); err != nil || !slices.Equal(got, want) {
+            t.Errorf("Evaluator(%v) = %v, want %v", in, got, want)
+        }
+        if ok, got := read.EvaluateCircuit(in); !ok || !slices.Equal(got, want) {
+            t.Errorf("after a binary round trip, %v gives %v, want %v", in, got, want)
+        }
+    }
+
+    // Variables must be declared in order, and be at least one wire wide
+    if circ.DeclareInput(3, 1) != nil || circ.DeclareInput(2, 0) != nil {
+        t.Error("DeclareInput accepted a bad variable")
+    }
+
+    // A variable added to a named circuit is unnamed, and the circuit can
+    // still be written out
+    named := BuildAdder(2)
+    named.DeclareInput(2, 1)
+    if !slices.Equal(named.InputVarNames, []string{"x", "y", ""}) {
+        t.Errorf("names %q after declaring a third variable", named.InputVarNames)
+    }
+    buf.Reset()
+    if err := named.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ReadBinary(&buf); err != nil {
+        t.Errorf("reading back a declared variable: %v", err)
+    }
+}
+
+// A forward reference is only caught at add time in strict mode, or by
+// AddGateChecked
+func TestStrictBuild(t *testing.T) {
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(2, 1, 1, 1, []int{2}, []int{1}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := circ.AddGateChecked(GateAND, false, []int{0, 5}); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("AddGateChecked forward reference: %v", err)
+    }
+    if _, err := circ.AddGateChecked(GateAND, false, []int{0}); !errors.Is(err, ErrInvalidGate) {
+        t.Errorf("AddGateChecked with one input: %v", err)
+    }
+    if _, err := circ.AddGateChecked(GateType_t(99), false, nil); !errors.Is(err, ErrInvalidGate) {
+        t.Errorf("AddGateChecked with an unknown type: %v", err)
+    }
+    g, err := circ.AddGateChecked(GateAND, false, []int{0, 1})
+    if err != nil || g != 3 {
+        t.Fatalf("AddGateChecked: got gate %d (%v)", g, err)
+    }
+
+    lenient := circ.Clone()
+    if lenient.addGate2(GateXOR, 0, 9) < 0 {
+        t.Error("forward reference rejected without StrictBuild")
+    }
+    circ.StrictBuild = true
+    if circ.addGate2(GateXOR, 0, 9) >= 0 {
+        t.Error("forward reference accepted with StrictBuild")
+    }
+    if circ.addGate2(GateXOR, 0, g) < 0 {
+        t.Error("StrictBuild rejected an existing input")
+    }
+}
+
+// CheckInputLayout explains exactly the buffers PadInputsToBoolArray
+// rejects, naming the variable and the excess
+func TestCheckInputLayout(t *testing.T) {
+    circ := BuildAdder(8)
+    for _, bufs := range [][][]byte{{{1}, {2}}, {{1}}, nil} {
+        if err := circ.CheckInputLayout(bufs); err != nil || circ.PadInputsToBoolArray(bufs) == nil {
+            t.Errorf("%v rejected: %v", bufs, err)
+        }
+    }
+
+    for _, c := range []struct {
+        bufs    [][]byte
+        want    string
+    }{
+        {[][]byte{{1}, {2}, {3}}, "1 more than the 2 input variables"},
+        {[][]byte{{1}, {2, 3}}, "input variable 1 has 8 wires, but its buffer has 16 bits, 8 too many"},
+    } {
+        err := circ.CheckInputLayout(c.bufs)
+        if !errors.Is(err, ErrWireCountMismatch) || !strings.Contains(err.Error(), c.want) {
+            t.Errorf("%v: got %v, want %q", c.bufs, err, c.want)
+        }
+        if circ.PadInputsToBoolArray(c.bufs) != nil {
+            t.Errorf("%v accepted by PadInputsToBoolArray", c.bufs)
+        }
+    }
+}
+
+func TestMultiDrivenOutputs(t *testing.T) {
+    circ := BuildAdder(2)
+    if outputs := circ.MultiDrivenOutputs(); outputs != nil {
+        t.Errorf("built adder has multi-driven outputs %v", outputs)
+    }
+
+    // Wiring an extra driver into two outputs by hand
+    for _, w := range []int{1, 0} {
+        g := circ.getOutputGate(w)
+        circ.Gates[g].InFrom = append(circ.Gates[g].InFrom, 0)
+    }
+    want := []int{circ.getOutputGate(0), circ.getOutputGate(1)}
+    if outputs := circ.MultiDrivenOutputs(); !slices.Equal(outputs, want) {
+        t.Errorf("got %v, want %v", outputs, want)
+    }
+    if circ.validCircuit() {
+        t.Error("circuit with multi-driven outputs is valid")
+    }
+}
+
+// An annotated gate's location shows up in errors about it, and survives
+// building, serialization and compaction
+func TestGateSourceLocations(t *testing.T) {
+    const loc = "prog.dsl:7"
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    dead := b.Or(x[0], x[1])
+    and := b.And(x[0], x[1])
+    b.SetSource(and, loc).SetSource(dead, "prog.dsl:3")
+    circ, err := b.Output("out", and, b.Xor(x[0], x[1])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    g := slices.IndexFunc(circ.Gates, func(gate Gate) bool { return gate.GateType == GateAND })
+    if circ.sourceLoc(g) != loc {
+        t.Fatalf("built AND gate has location %q", circ.sourceLoc(g))
+    }
+    if plain := BuildAdder(4); plain.SourceLoc != nil {
+        t.Error("circuit without locations allocated SourceLoc")
+    }
+    if circ.Clone().SetGateSource(len(circ.Gates), loc) == nil {
+        t.Error("located a nonexistent gate")
+    }
+
+    // Evaluation over a domain the AND doesn't support
+    kary := circ.Clone()
+    kary.RemoveDeadGates()
+    kary.WireDomain = 3
+    if _, err := kary.EvaluateKary([]int{1, 2}); !errors.Is(err, ErrInvalidGate) || !strings.Contains(err.Error(), loc) {
+        t.Errorf("k-ary evaluation error %v doesn't give the location", err)
+    }
+    // A gate broken after the evaluator checked the circuit
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    broken := circ.Gates[g].GateType
+    circ.Gates[g].GateType = 99
+    _, err = e.Evaluate([]bool{true, true})
+    circ.Gates[g].GateType = broken
+    if !errors.Is(err, ErrInvalidGate) || !strings.Contains(err.Error(), loc) {
+        t.Errorf("evaluation error %v doesn't give the location", err)
+    }
+    if err := circ.RequireGateTypes([]GateType_t{GateXOR, GateOR}); err == nil || !strings.Contains(err.Error(), loc) {
+        t.Errorf("validation error %v doesn't give the location", err)
+    }
+
+    read, _ := binaryRoundTrip(t, circ)
+    if read.sourceLoc(g) != loc {
+        t.Errorf("read back location %q", read.sourceLoc(g))
+    }
+    read.RemoveDeadGates()
+    for i := range read.Gates {
+        if read.sourceLoc(i) == "prog.dsl:3" {
+            t.Error("dead gate's location kept")
+        }
+        if read.Gates[i].GateType == GateAND && read.sourceLoc(i) != loc {
+            t.Errorf("compacted AND gate has location %q", read.sourceLoc(i))
+        }
+    }
+}
@@ -0,0 +1,188 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Compilation into a flat program for fast repeated evaluation
+//
+
+// Operations of a compiled circuit. Gate types that compute the same
+// thing over bits share one, e.g. CNOT and ADDK are just XOR.
+type opCode uint8
+
+const (
+    opCopy opCode = iota
+    opConst
+    opNot
+    opAnd
+    opOr
+    opXor
+    opMux
+    opToffoli
+    opMaj
+    opLUT
+)
+
+// One step of a compiled circuit: set values[out] from the values at a, b
+// and c (or the LUT inputs)
+type compiledOp struct {
+    code    opCode
+    value   bool
+    out     int32
+    a       int32
+    b       int32
+    c       int32
+    inputs  []int32
+    table   []bool
+}
+
+// Translate a gate into its compiled operation
+func compileGate(g int, gate *Gate) (compiledOp, error) {
+    op := compiledOp{out: int32(g)}
+    for j, from := range gate.InFrom {
+        switch j {
+        case 0:
+            op.a = int32(from)
+        case 1:
+            op.b = int32(from)
+        case 2:
+            op.c = int32(from)
+        }
+    }
+
+    switch gate.GateType {
+    case GateOUTPUT, GateCOPY:
+        op.code = opCopy
+    case GateCONST:
+        op.code = opConst
+        op.value = gate.ConstVal
+    case GateNOT:
+        op.code = opNot
+    case GateAND, GateMULK:
+        op.code = opAnd
+    case GateOR:
+        op.code = opOr
+    case GateXOR, GateCNOT, GateADDK:
+        op.code = opXor
+    case GateMUX:
+        op.code = opMux
+    case GateTOFFLI:
+        op.code = opToffoli
+    case GateMAJ:
+        op.code = opMaj
+    case GateLUT:
+        op.code = opLUT
+        op.table = gate.TruthTable
+        op.inputs = make([]int32, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            op.inputs[j] = int32(from)
+        }
+    default:
+        return op, fmt.Errorf("unknown gate type %d for %d: %w", gate.GateType, g, ErrInvalidGate)
+    }
+    return op, nil
+}
+
+// Compile the circuit into a function evaluating it, which runs through
+// the gates as a flat list of operations in topological order. Each call
+// allocates only its result. Like an Evaluator, the function reuses its
+// scratch space, so it is not safe for concurrent use. Later changes to
+// the circuit don't affect it.
+//
+// The function returns an error, rather than just the output bits, so that
+// a call with the wrong number of input bits fails with
+// ErrWireCountMismatch instead of panicking.
+func (circ *Circuit) Compile() (func([]bool) ([]bool, error), error) {
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return nil, err
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, err
+    }
+
+    ops := make([]compiledOp, 0, len(order))
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        if gate.GateType == GateINPUT {
+            continue
+        }
+        op, err := compileGate(g, gate)
+        if err != nil {
+            return nil, err
+        }
+        if op.table != nil {
+            op.table = append([]bool(nil), op.table...)
+        }
+        ops = append(ops, op)
+    }
+
+    inputGates := make([]int32, circ.NumInputWires)
+    for w := range inputGates {
+        inputGates[w] = int32(circ.getInputGate(w))
+    }
+    outputGates := make([]int32, circ.NumOutputWires)
+    for i := range outputGates {
+        outputGates[i] = int32(circ.getOutputGate(i))
+    }
+    values := make([]bool, len(circ.Gates))
+
+    return func(inputBits []bool) ([]bool, error) {
+        if len(inputBits) != len(inputGates) {
+            return nil, fmt.Errorf("got %d input bits, circuit has %d input wires: %w", len(inputBits), len(inputGates), ErrWireCountMismatch)
+        }
+        for w, g := range inputGates {
+            values[g] = inputBits[w]
+        }
+
+        for k := range ops {
+            op := &ops[k]
+            var v bool
+            switch op.code {
+            case opCopy:
+                v = values[op.a]
+            case opConst:
+                v = op.value
+            case opNot:
+                v = !values[op.a]
+            case opAnd:
+                v = values[op.a] && values[op.b]
+            case opOr:
+                v = values[op.a] || values[op.b]
+            case opXor:
+                v = values[op.a] != values[op.b]
+            case opMux:
+                if values[op.a] {
+                    v = values[op.c]
+                } else {
+                    v = values[op.b]
+                }
+            case opToffoli:
+                v = values[op.c] != (values[op.a] && values[op.b])
+            case opMaj:
+                x, y, z := values[op.a], values[op.b], values[op.c]
+                v = (x && y) || (x && z) || (y && z)
+            case opLUT:
+                address := 0
+                for j, from := range op.inputs {
+                    if values[from] {
+                        address |= 1 << j
+                    }
+                }
+                v = op.table[address]
+            }
+            values[op.out] = v
+        }
+
+        result := make([]bool, len(outputGates))
+        for i, g := range outputGates {
+            result[i] = values[g]
+        }
+        return result, nil
+    }, nil
+}
@@ -0,0 +1,128 @@
+package toygarble
+
+import (
+    "errors"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+func TestCompileMatchesEvaluateCircuit(t *testing.T) {
+    rng := rand.New(rand.NewSource(5))
+    for it := 0; it < 300; it++ {
+        circ, err := randomCircuit(rng, 6, 50, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        f, err := circ.Compile()
+        if err != nil {
+            t.Fatal(err)
+        }
+        in := make([]bool, 6)
+        for i := range in {
+            in[i] = rng.Intn(2) == 1
+        }
+        _, want := circ.EvaluateCircuit(in)
+        got, err := f(in)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !slices.Equal(got, want) {
+            t.Fatalf("circuit %d on %v: got %v, want %v", it, in, got, want)
+        }
+    }
+}
+
+func TestCompileWrongInputLength(t *testing.T) {
+    f, err := BuildAdder(4).Compile()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, n := range []int{0, 7, 9} {
+        mustNotPanic(t, "compiled circuit", func() {
+            if _, err := f(make([]bool, n)); !errors.Is(err, ErrWireCountMismatch) {
+                t.Errorf("%d input bits: got %v, want ErrWireCountMismatch", n, err)
+            }
+        })
+    }
+}
+
+func loadMult64(tb testing.TB) *Circuit {
+    tb.Helper()
+    circ, err := LoadBristol("../circuits/mult64.txt")
+    if err != nil {
+        tb.Fatal(err)
+    }
+    return circ
+}
+
+func TestCompileMultiplier(t *testing.T) {
+    circ := loadMult64(t)
+    f, err := circ.Compile()
+    if err != nil {
+        t.Fatal(err)
+    }
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    rng := rand.New(rand.NewSource(163))
+    in := make([]bool, circ.NumInputWires)
+    for it := 0; it < 20; it++ {
+        for i := range in {
+            in[i] = rng.Intn(2) == 1
+        }
+        _, want := circ.EvaluateCircuit(in)
+        got, err := f(in)
+        if err != nil || !slices.Equal(got, want) {
+            t.Fatalf("compiled result differs (%v)", err)
+        }
+        if got, err := e.Evaluate(in); err != nil || !slices.Equal(got, want) {
+            t.Fatalf("Evaluator result differs (%v)", err)
+        }
+    }
+
+    // Each call allocates only its result
+    if allocs := testing.AllocsPerRun(10, func() { f(in) }); allocs != 1 {
+        t.Errorf("compiled call made %v allocations", allocs)
+    }
+}
+
+func BenchmarkMultiplier(b *testing.B) {
+    circ := loadMult64(b)
+    in := make([]bool, circ.NumInputWires)
+    for i := range in {
+        in[i] = i % 3 == 0
+    }
+    b.Run("EvaluateCircuit", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            if ok, _ := circ.EvaluateCircuit(in); !ok {
+                b.Fatal("evaluation failed")
+            }
+        }
+    })
+    b.Run("Evaluator", func(b *testing.B) {
+        e, err := NewEvaluator(circ)
+        if err != nil {
+            b.Fatal(err)
+        }
+        for i := 0; i < b.N; i++ {
+            if _, err := e.Evaluate(in); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+    b.Run("Compile", func(b *testing.B) {
+        f, err := circ.Compile()
+        if err != nil {
+            b.Fatal(err)
+        }
+        b.ReportAllocs()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+            if _, err := f(in); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+}
@@ -0,0 +1,85 @@
+package toygarble
+
+import (
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+)
+
+//
+// Batch evaluation over CSV
+//
+
+// Evaluate the circuit on each row of a CSV file, one integer column per
+// input variable, writing one row of output variables to out as unsigned
+// decimal integers. Inputs are parsed as by big.Int's SetString with base
+// 0, so they may be negative or hex (0x...), and encoded with
+// BigIntToBoolArray, so variables may be any width. Rows are processed as
+// they are read. Stops at the first bad row with an error giving its line
+// number.
+func (circ *Circuit) EvaluateCSV(in io.Reader, out io.Writer) error {
+    if !validVarWidths(circ.NumWiresIV, circ.NumInputVars, circ.NumInputWires) ||
+        !validVarWidths(circ.NumWiresOV, circ.NumOutputVars, circ.NumOutputWires) {
+        return ErrInvalidCircuit
+    }
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return err
+    }
+
+    r := csv.NewReader(in)
+    r.FieldsPerRecord = circ.NumInputVars
+    r.TrimLeadingSpace = true
+    w := csv.NewWriter(out)
+
+    inputBits := make([]bool, 0, circ.NumInputWires)
+    row := make([]string, circ.NumOutputVars)
+    for {
+        record, err := r.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            var parseErr *csv.ParseError
+            if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+                return fmt.Errorf("line %d: got %d values, circuit has %d input variables: %w", parseErr.Line, len(record), circ.NumInputVars, ErrWireCountMismatch)
+            }
+            if errors.As(err, &parseErr) {
+                return fmt.Errorf("line %d: %v: %w", parseErr.Line, parseErr.Err, ErrMalformedInput)
+            }
+            return err
+        }
+
+        inputBits = inputBits[:0]
+        for i, field := range record {
+            line, column := r.FieldPos(i)
+            v, ok := new(big.Int).SetString(field, 0)
+            if !ok {
+                return fmt.Errorf("line %d, column %d: %q is not an integer: %w", line, column, field, ErrMalformedInput)
+            }
+            bits, err := BigIntToBoolArray(v, circ.NumWiresIV[i])
+            if err != nil {
+                return fmt.Errorf("line %d, column %d: %w", line, column, err)
+            }
+            inputBits = append(inputBits, bits...)
+        }
+
+        outWires, err := e.Evaluate(inputBits)
+        if err != nil {
+            return err
+        }
+        currentWire := 0
+        for i := range row {
+            row[i] = BoolArrayToBigInt(outWires[currentWire:currentWire + circ.NumWiresOV[i]]).String()
+            currentWire += circ.NumWiresOV[i]
+        }
+        if err := w.Write(row); err != nil {
+            return err
+        }
+    }
+
+    w.Flush()
+    return w.Error()
+}
@@ -0,0 +1,46 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestEvaluateCSVAdder(t *testing.T) {
+    var out bytes.Buffer
+    if err := BuildAdder(8).EvaluateCSV(strings.NewReader("1,2\n200, 100\n0xff,-1\n"), &out); err != nil {
+        t.Fatal(err)
+    }
+    if want := "3\n44\n254\n"; out.String() != want {
+        t.Errorf("got %q, want %q", out.String(), want)
+    }
+
+    // Several output variables give several columns
+    out.Reset()
+    if err := BuildDivMod(8).EvaluateCSV(strings.NewReader("17,5\n"), &out); err != nil {
+        t.Fatal(err)
+    }
+    if want := "3,2\n"; out.String() != want {
+        t.Errorf("divmod: got %q, want %q", out.String(), want)
+    }
+}
+
+// Bad rows are reported by line, and what is wrong with them
+func TestEvaluateCSVErrors(t *testing.T) {
+    circ := BuildAdder(8)
+    for _, c := range []struct {
+        csv     string
+        line    string
+        want    error
+    }{
+        {"1,2\n3,x\n", "line 2", ErrMalformedInput},
+        {"1,2\n4,5\n3\n", "line 3", ErrWireCountMismatch},
+        {"1,256\n", "line 1", ErrOutOfRange},
+    } {
+        err := circ.EvaluateCSV(strings.NewReader(c.csv), &bytes.Buffer{})
+        if !errors.Is(err, c.want) || !strings.Contains(err.Error(), c.line) {
+            t.Errorf("%q: got %v, want %v on %s", c.csv, err, c.want, c.line)
+        }
+    }
+}
@@ -0,0 +1,147 @@
+package toygarble
+
+import (
+    "fmt"
+    "slices"
+    "strings"
+)
+
+//
+// Gate-by-gate comparison of two circuits
+//
+
+// A gate that differs between two circuits. For added gates OldType is
+// meaningless, and likewise NewType for removed gates.
+type GateChange struct {
+    Index       int
+    OldType     GateType_t
+    NewType     GateType_t
+}
+
+type DiffReport struct {
+    // Whether the input/output variable layout (or the wire domain, or which
+    // party supplies the inputs) differs
+    LayoutChanged   bool
+
+    Added           []GateChange
+    Removed         []GateChange
+    Modified        []GateChange
+}
+
+// Whether the two circuits were found identical
+func (r DiffReport) Empty() bool {
+    return !r.LayoutChanged && len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Modified) == 0
+}
+
+func (r DiffReport) String() string {
+    var sb strings.Builder
+    if r.LayoutChanged {
+        sb.WriteString("input/output layout changed\n")
+    }
+    for _, c := range r.Removed {
+        fmt.Fprintf(&sb, "- gate %d %v\n", c.Index, c.OldType)
+    }
+    for _, c := range r.Added {
+        fmt.Fprintf(&sb, "+ gate %d %v\n", c.Index, c.NewType)
+    }
+    for _, c := range r.Modified {
+        fmt.Fprintf(&sb, "~ gate %d %v -> %v\n", c.Index, c.OldType, c.NewType)
+    }
+    fmt.Fprintf(&sb, "%d removed, %d added, %d modified\n", len(r.Removed), len(r.Added), len(r.Modified))
+    return sb.String()
+}
+
+// Whether a gate's output is unchanged by reordering its inputs
+func isCommutative(gateType GateType_t) bool {
+    switch gateType {
+    case GateAND, GateOR, GateXOR, GateADDK, GateMULK, GateMAJ:
+        return true
+    }
+    return false
+}
+
+// Sort the inputs of every commutative gate (AND, OR, XOR, MAJ and their
+// k-ary counterparts) by gate index, so that e.g. AND(a, b) and AND(b, a)
+// become identical. Other gates, such as MUX, are left alone. Evaluation is
+// unchanged. Returns the number of gates whose inputs were reordered.
+func (circ *Circuit) NormalizeCommutativeInputs() int {
+    count := 0
+    for i := range circ.Gates {
+        gate := &circ.Gates[i]
+        if isCommutative(gate.GateType) && !slices.IsSorted(gate.InFrom) {
+            slices.Sort(gate.InFrom)
+            count++
+        }
+    }
+    return count
+}
+
+// A copy of the circuit in canonical form, as given by
+// NormalizeCommutativeInputs
+func (circ *Circuit) canonical() *Circuit {
+    c := circ.Clone()
+    c.NormalizeCommutativeInputs()
+    return c
+}
+
+// Whether two circuits have the same input/output layout, wire domain and
+// input parties
+func sameLayout(a, b *Circuit) bool {
+    return a.NumInputWires == b.NumInputWires && a.NumOutputWires == b.NumOutputWires &&
+        slices.Equal(a.NumWiresIV, b.NumWiresIV) && slices.Equal(a.NumWiresOV, b.NumWiresOV) &&
+        slices.Equal(a.InputGates, b.InputGates) && slices.Equal(a.OutputGates, b.OutputGates) &&
+        a.domain() == b.domain() && slices.Equal(a.PartyInputWires(PARTY_EVALUATOR), b.PartyInputWires(PARTY_EVALUATOR))
+}
+
+// Whether two circuits are structurally identical: the same layout and the
+// same gates, wired the same way, in the same order. Unlike Diff, inputs
+// of commutative gates must be in the same order too, unless both circuits
+// have been through NormalizeCommutativeInputs. Names, groups and other
+// annotations aren't compared.
+func (circ *Circuit) Equal(other *Circuit) bool {
+    if circ == nil || other == nil {
+        return circ == other
+    }
+    if !sameLayout(circ, other) || len(circ.Gates) != len(other.Gates) {
+        return false
+    }
+    for i := range circ.Gates {
+        if !sameGate(&circ.Gates[i], &other.Gates[i]) {
+            return false
+        }
+    }
+    return true
+}
+
+// Compare two circuits gate by gate, after canonicalizing both. Gates are
+// matched by index, so this is most useful for comparing a circuit against
+// the result of an in-place pass such as SimplifyConstGates.
+func Diff(a, b *Circuit) (DiffReport, error) {
+    var report DiffReport
+    if a == nil || b == nil {
+        return report, fmt.Errorf("can't diff a nil circuit")
+    }
+    a = a.canonical()
+    b = b.canonical()
+
+    report.LayoutChanged = !sameLayout(a, b)
+
+    for i := 0; i < len(a.Gates) || i < len(b.Gates); i++ {
+        switch {
+        case i >= len(b.Gates):
+            report.Removed = append(report.Removed, GateChange{i, a.Gates[i].GateType, a.Gates[i].GateType})
+        case i >= len(a.Gates):
+            report.Added = append(report.Added, GateChange{i, b.Gates[i].GateType, b.Gates[i].GateType})
+        case !sameGate(&a.Gates[i], &b.Gates[i]):
+            report.Modified = append(report.Modified, GateChange{i, a.Gates[i].GateType, b.Gates[i].GateType})
+        }
+    }
+
+    return report, nil
+}
+
+// Whether two gates are identical, including their wiring
+func sameGate(x *Gate, y *Gate) bool {
+    return x.GateType == y.GateType && x.ConstVal == y.ConstVal &&
+        slices.Equal(x.InFrom, y.InFrom) && slices.Equal(x.TruthTable, y.TruthTable)
+}
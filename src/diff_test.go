@@ -0,0 +1,137 @@
+package toygarble
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDiffFoldConstants(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    folded := b.Not(b.And(b.Const(true), b.Const(false)))
+    circ, err := b.Output("out", folded, b.Xor(x[0], x[1])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    after := circ.Clone()
+    if n := after.FoldConstants(); n != 2 {
+        t.Fatalf("FoldConstants folded %d gates, want 2", n)
+    }
+    report, err := Diff(circ, after)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The AND and the NOT (gates 6 and 7) became constants; nothing else moved
+    want := []GateChange{{6, GateAND, GateCONST}, {7, GateNOT, GateCONST}}
+    if report.LayoutChanged || len(report.Added) != 0 || len(report.Removed) != 0 || len(report.Modified) != len(want) {
+        t.Fatalf("unexpected report:\n%v", report)
+    }
+    for i, c := range want {
+        if report.Modified[i] != c {
+            t.Errorf("change %d is %+v, want %+v", i, report.Modified[i], c)
+        }
+    }
+
+    s := report.String()
+    for _, line := range []string{"~ gate 6 AND -> CONST", "~ gate 7 NOT -> CONST", "0 removed, 0 added, 2 modified"} {
+        if !strings.Contains(s, line) {
+            t.Errorf("report is missing %q:\n%s", line, s)
+        }
+    }
+}
+
+func TestDiffCommutativeInputs(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    circ, err := b.Output("out", b.And(x[0], x[1])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    swapped := circ.Clone()
+    in := swapped.Gates[len(swapped.Gates)-1].InFrom
+    in[0], in[1] = in[1], in[0]
+
+    report, err := Diff(circ, swapped)
+    if err != nil || !report.Empty() {
+        t.Errorf("AND(a, b) and AND(b, a) differ: %v, %v", report, err)
+    }
+
+    // Diff mustn't reorder its arguments' gates
+    orig := circ.Gates[len(circ.Gates)-1].InFrom
+    if in[0] != orig[1] || in[1] != orig[0] {
+        t.Error("Diff modified its argument")
+    }
+}
+
+// Swapping the inputs of commutative gates leaves circuits Equal after
+// normalizing, but a MUX's inputs keep their order
+func TestNormalizeCommutativeInputs(t *testing.T) {
+    build := func(swap bool) *Circuit {
+        b := NewBuilder()
+        x := b.Input("x", 3)
+        var and, maj Wire
+        if swap {
+            and, maj = b.And(x[1], x[0]), b.Maj(x[2], x[0], x[1])
+        } else {
+            and, maj = b.And(x[0], x[1]), b.Maj(x[0], x[1], x[2])
+        }
+        circ, err := b.Output("out", and, maj, b.Mux(x[2], x[1], x[0])).Build()
+        if err != nil {
+            t.Fatal(err)
+        }
+        return circ
+    }
+    circ, swapped := build(false), build(true)
+    if circ.Equal(swapped) {
+        t.Fatal("circuits with swapped inputs are Equal")
+    }
+    if n := swapped.NormalizeCommutativeInputs(); n != 2 {
+        t.Errorf("normalized %d gates, want 2", n)
+    }
+    circ.NormalizeCommutativeInputs()
+    if !circ.Equal(swapped) {
+        t.Error("normalized circuits aren't Equal")
+    }
+    if n := circ.NormalizeCommutativeInputs(); n != 0 {
+        t.Errorf("normalizing again reordered %d gates", n)
+    }
+
+    for i := range circ.Gates {
+        if circ.Gates[i].GateType == GateMUX {
+            if in := circ.Gates[i].InFrom; in[1] < in[2] {
+                t.Errorf("MUX inputs reordered to %v", in)
+            }
+        }
+    }
+}
+
+func TestDiffAddedAndRemoved(t *testing.T) {
+    circ := BuildAdder(4)
+    shorter := circ.Clone()
+    shorter.Gates = shorter.Gates[:len(shorter.Gates)-2]
+
+    report, err := Diff(circ, shorter)
+    if err != nil {
+        t.Fatal(err)
+    }
+    n := len(circ.Gates)
+    if len(report.Removed) != 2 || report.Removed[0].Index != n-2 || report.Removed[1].Index != n-1 || len(report.Added) != 0 {
+        t.Errorf("dropping the last two gates: %v", report)
+    }
+
+    report, err = Diff(shorter, circ)
+    if err != nil || len(report.Added) != 2 || len(report.Removed) != 0 {
+        t.Errorf("adding two gates: %v, %v", report, err)
+    }
+
+    report, err = Diff(circ, BuildAdder(5))
+    if err != nil || !report.LayoutChanged {
+        t.Errorf("4- and 5-bit adders have the same layout: %v, %v", report, err)
+    }
+
+    if _, err := Diff(circ, nil); err == nil {
+        t.Error("diffing against nil succeeded")
+    }
+}
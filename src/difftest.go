@@ -0,0 +1,344 @@
+package toygarble
+
+import (
+    "bytes"
+    "fmt"
+    "math/rand"
+    "slices"
+)
+
+//
+// Randomized differential testing of the evaluators against each other
+//
+
+const (
+    // Size of the random circuits generated by DifferentialTest
+    DIFF_TEST_MAX_INPUTS    int = 8
+    DIFF_TEST_MAX_GATES     int = 64
+    DIFF_TEST_MAX_OUTPUTS   int = 4
+)
+
+// Logic gate types generated in random circuits
+var randomGateTypes = []GateType_t{GateAND, GateOR, GateNOT, GateXOR, GateCONST, GateCOPY, GateMUX, GateLUT, GateTOFFLI, GateCNOT, GateADDK, GateMULK, GateMAJ}
+
+// A case on which the evaluators disagree, reduced to a single output wire
+// and shrunk with ShrinkCircuit to as small a circuit as still shows the
+// problem
+type DifferentialFailure struct {
+    Circuit     *Circuit
+    Input       []bool
+
+    // The output bit each evaluator produced, keyed by evaluator name
+    Results     map[string]bool
+}
+
+func (f *DifferentialFailure) Error() string {
+    return fmt.Sprintf("evaluators disagree on a circuit of %d gates with input %v: %v", len(f.Circuit.Gates), f.Input, f.Results)
+}
+
+// Generate a random, valid circuit using every logic gate type, with a
+// single input and a single output variable
+func randomCircuit(rng *rand.Rand, numInputs int, numGates int, numOutputs int) (*Circuit, error) {
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(numInputs, numOutputs, 1, 1, []int{numInputs}, []int{numOutputs}); err != nil {
+        return nil, err
+    }
+
+    // Gates usable as inputs: anything but the OUTPUT gates
+    sources := make([]int, 0, numInputs + numGates)
+    for w := 0; w < numInputs; w++ {
+        sources = append(sources, circ.getInputGate(w))
+    }
+    pick := func() int {
+        return sources[rng.Intn(len(sources))]
+    }
+
+    for k := 0; k < numGates; k++ {
+        gateType := randomGateTypes[rng.Intn(len(randomGateTypes))]
+        var g int
+        if gateType == GateLUT {
+            inputs := make([]int, 1 + rng.Intn(3))
+            for j := range inputs {
+                inputs[j] = pick()
+            }
+            table := make([]bool, 1 << len(inputs))
+            for m := range table {
+                table[m] = rng.Intn(2) == 1
+            }
+            var err error
+            if g, err = circ.AddLUT(inputs, table); err != nil {
+                return nil, err
+            }
+        } else {
+            inFrom := make([]int, min_input_wires[gateType])
+            for j := range inFrom {
+                inFrom[j] = pick()
+            }
+            constVal := gateType == GateCONST && rng.Intn(2) == 1
+            if g = circ.addGate(gateType, constVal, inFrom); g < 0 {
+                return nil, fmt.Errorf("could not add %v gate", gateType)
+            }
+        }
+        sources = append(sources, g)
+    }
+
+    for o := 0; o < numOutputs; o++ {
+        circ.connectOutputWire(pick(), o)
+    }
+    return circ, nil
+}
+
+// Evaluate the circuit with every evaluator, returning the outputs of each
+// keyed by evaluator name
+func evaluateAll(circ *Circuit, inputBits []bool) (map[string][]bool, error) {
+    results := make(map[string][]bool)
+
+    ok, out := circ.EvaluateCircuit(inputBits)
+    if !ok {
+        return nil, fmt.Errorf("recursive evaluation failed")
+    }
+    results["EvaluateCircuit"] = out
+
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+    if results["Evaluator"], err = e.Evaluate(inputBits); err != nil {
+        return nil, err
+    }
+
+    inputs := make([]Ternary, len(inputBits))
+    for i, b := range inputBits {
+        inputs[i] = ternaryOf(b)
+    }
+    ternary, err := circ.EvaluateTernary(inputs)
+    if err != nil {
+        return nil, err
+    }
+    out = make([]bool, len(ternary))
+    for i, t := range ternary {
+        if t == TernaryX {
+            return nil, fmt.Errorf("ternary evaluation left output %d unknown on definite inputs", i)
+        }
+        out[i] = t == TernaryTrue
+    }
+    results["EvaluateTernary"] = out
+
+    compiled, err := circ.Compile()
+    if err != nil {
+        return nil, err
+    }
+    if results["Compile"], err = compiled(inputBits); err != nil {
+        return nil, err
+    }
+
+    packed, err := circ.EvaluateCircuitPacked(packBits(inputBits), len(inputBits))
+    if err != nil {
+        return nil, err
+    }
+    results["EvaluateCircuitPacked"] = unpackBits(packed, circ.NumOutputWires)
+
+    // Decoded from an in-memory copy of the binary form, as a mapped file is
+    var buf bytes.Buffer
+    if err := circ.WriteBinary(&buf); err != nil {
+        return nil, err
+    }
+    lc, err := newLazyCircuit(buf.Bytes())
+    if err != nil {
+        return nil, err
+    }
+    if results["LazyCircuit"], err = lc.Evaluate(inputBits); err != nil {
+        return nil, err
+    }
+
+    return results, nil
+}
+
+// The first output wire on which the evaluators disagree, or -1
+func firstDisagreement(results map[string][]bool) int {
+    reference := results["EvaluateCircuit"]
+    for i := range reference {
+        for _, out := range results {
+            if out[i] != reference[i] {
+                return i
+            }
+        }
+    }
+    return -1
+}
+
+// Reduce a disagreement on output wire o to the cone of that output, then
+// shrink it as long as the evaluators still disagree
+func minimizeFailure(circ *Circuit, inputBits []bool, o int) error {
+    sub, err := circ.subCircuit([]int{o}, []int{1})
+    if err != nil {
+        return err
+    }
+    disagree := func(c *Circuit, input []bool) bool {
+        results, err := evaluateAll(c, input)
+        return err == nil && firstDisagreement(results) >= 0
+    }
+    sub, input := ShrinkCircuit(sub, inputBits, disagree)
+
+    failure := &DifferentialFailure{Circuit: sub, Input: input, Results: make(map[string]bool)}
+    results, err := evaluateAll(sub, input)
+    if err != nil {
+        return err
+    }
+    for name, out := range results {
+        failure.Results[name] = out[0]
+    }
+    return failure
+}
+
+//
+// Shrinking failing cases
+//
+
+// Smaller variants of the circuit with logic gate g gone: bypassed by
+// each of its inputs in turn, or replaced by a constant. Dead gates are
+// removed from each.
+func (circ *Circuit) shrinkGate(g int) []*Circuit {
+    var candidates []*Circuit
+    gate := &circ.Gates[g]
+    for j, from := range gate.InFrom {
+        if slices.Contains(gate.InFrom[:j], from) {
+            continue
+        }
+        c := circ.Clone()
+        remove := make([]bool, len(c.Gates))
+        replacement := make([]int, len(c.Gates))
+        remove[g] = true
+        replacement[g] = from
+        c.compact(remove, replacement)
+        c.RemoveDeadGates()
+        candidates = append(candidates, c)
+    }
+    for _, v := range []bool{false, true} {
+        if gate.GateType == GateCONST {
+            break
+        }
+        c := circ.Clone()
+        c.Gates[g] = Gate{GateType: GateCONST, ConstVal: v}
+        c.RemoveDeadGates()
+        candidates = append(candidates, c)
+    }
+    return candidates
+}
+
+// A copy of the circuit without input wire w, which is replaced by a
+// constant gate carrying value. A variable left without wires is dropped.
+func (circ *Circuit) withoutInputWire(w int, value bool) *Circuit {
+    c := circ.Clone()
+    c.pinLayout()
+    c.Gates[c.InputGates[w]] = Gate{GateType: GateCONST, ConstVal: value}
+    c.InputGates = slices.Delete(c.InputGates, w, w + 1)
+    c.NumInputWires--
+
+    v := 0
+    for first := 0; first + c.NumWiresIV[v] <= w; v++ {
+        first += c.NumWiresIV[v]
+    }
+    c.NumWiresIV[v]--
+    if c.NumWiresIV[v] == 0 {
+        c.NumWiresIV = slices.Delete(c.NumWiresIV, v, v + 1)
+        if len(c.InputVarNames) == c.NumInputVars {
+            c.InputVarNames = slices.Delete(c.InputVarNames, v, v + 1)
+        }
+        if len(c.InputParty) == c.NumInputVars {
+            c.InputParty = slices.Delete(c.InputParty, v, v + 1)
+        }
+        c.NumInputVars--
+    }
+    c.RemoveDeadGates()
+    return c
+}
+
+// Greedily shrink a circuit and input on which fails holds, as long as it
+// still holds: dropping all but one output, removing gates or replacing
+// them with constants, removing input wires and clearing input bits, until
+// no single step helps. Every accepted step makes the case strictly
+// smaller, so this terminates. Returns the smallest case found, which is
+// the original (copied) if nothing could be removed.
+func ShrinkCircuit(circ *Circuit, input []bool, fails func(*Circuit, []bool) bool) (*Circuit, []bool) {
+    best := circ.Clone()
+    bestInput := append([]bool(nil), input...)
+    try := func(c *Circuit, in []bool) bool {
+        if !c.validCircuit() || !fails(c, in) {
+            return false
+        }
+        best, bestInput = c, in
+        return true
+    }
+
+    for progress := true; progress; {
+        progress = false
+
+        for o := 0; o < best.NumOutputWires && best.NumOutputWires > 1; o++ {
+            if sub, err := best.subCircuit([]int{o}, []int{1}); err == nil && try(sub, bestInput) {
+                progress = true
+                break
+            }
+        }
+
+        // Later gates first, since removing them can leave earlier ones dead
+        for g := len(best.Gates) - 1; g >= 0; g-- {
+            if g >= len(best.Gates) || best.Gates[g].GateType == GateINPUT || best.Gates[g].GateType == GateOUTPUT {
+                continue
+            }
+            for _, c := range best.shrinkGate(g) {
+                if try(c, bestInput) {
+                    progress = true
+                    break
+                }
+            }
+        }
+
+        for w := best.NumInputWires - 1; w >= 0; w-- {
+            in := slices.Delete(slices.Clone(bestInput), w, w + 1)
+            if try(best.withoutInputWire(w, bestInput[w]), in) {
+                progress = true
+                continue
+            }
+            if bestInput[w] {
+                in := slices.Clone(bestInput)
+                in[w] = false
+                if try(best, in) {
+                    progress = true
+                }
+            }
+        }
+    }
+    return best, bestInput
+}
+
+// Generate iterations random circuits, evaluate each on a random input with
+// the recursive evaluator, the Evaluator, ternary evaluation, the compiled
+// function, packed evaluation and a LazyCircuit, and check that they all
+// agree. A disagreement is returned as a *DifferentialFailure
+// holding a reduced circuit and input that reproduce it; an evaluator
+// failing outright is returned as an ordinary error.
+func DifferentialTest(rng *rand.Rand, iterations int) error {
+    for it := 0; it < iterations; it++ {
+        numInputs := 1 + rng.Intn(DIFF_TEST_MAX_INPUTS)
+        numGates := 1 + rng.Intn(DIFF_TEST_MAX_GATES)
+        numOutputs := 1 + rng.Intn(DIFF_TEST_MAX_OUTPUTS)
+        circ, err := randomCircuit(rng, numInputs, numGates, numOutputs)
+        if err != nil {
+            return err
+        }
+
+        inputBits := make([]bool, numInputs)
+        for i := range inputBits {
+            inputBits[i] = rng.Intn(2) == 1
+        }
+        results, err := evaluateAll(circ, inputBits)
+        if err != nil {
+            return fmt.Errorf("iteration %d: %w", it, err)
+        }
+        if o := firstDisagreement(results); o >= 0 {
+            return minimizeFailure(circ, inputBits, o)
+        }
+    }
+    return nil
+}
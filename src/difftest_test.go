@@ -0,0 +1,128 @@
+package toygarble
+
+import (
+    "math/rand"
+    "testing"
+)
+
+func TestDifferential(t *testing.T) {
+    if err := DifferentialTest(rand.New(rand.NewSource(144)), 500); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// Every evaluator takes part in the comparison
+func TestEvaluateAllEvaluators(t *testing.T) {
+    rng := rand.New(rand.NewSource(3))
+    circ, err := randomCircuit(rng, 4, 32, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    results, err := evaluateAll(circ, []bool{true, false, true, true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, name := range []string{"EvaluateCircuit", "Evaluator", "EvaluateTernary", "Compile", "EvaluateCircuitPacked", "LazyCircuit"} {
+        if out, ok := results[name]; !ok || len(out) != 2 {
+            t.Errorf("%s: got %v", name, out)
+        }
+    }
+    if i := firstDisagreement(results); i >= 0 {
+        t.Errorf("evaluators disagree on output %d: %v", i, results)
+    }
+}
+
+func TestRandomCircuitValid(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    for it := 0; it < 100; it++ {
+        circ, err := randomCircuit(rng, 1 + rng.Intn(8), 1 + rng.Intn(64), 1 + rng.Intn(4))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !circ.validCircuit() {
+            t.Fatalf("random circuit %d is invalid", it)
+        }
+    }
+}
+
+// Shrinking against a made-up failure, any circuit whose first output is
+// true, should leave just a constant
+func TestShrinkCircuit(t *testing.T) {
+    rng := rand.New(rand.NewSource(2))
+    fails := func(c *Circuit, in []bool) bool {
+        ok, out := c.EvaluateCircuit(in)
+        return ok && len(out) > 0 && out[0]
+    }
+    for it := 0; it < 20; it++ {
+        circ, err := randomCircuit(rng, 6, 50, 1)
+        if err != nil {
+            t.Fatal(err)
+        }
+        in := make([]bool, 6)
+        for i := range in {
+            in[i] = rng.Intn(2) == 1
+        }
+        if !fails(circ, in) {
+            continue
+        }
+        small, smallIn := ShrinkCircuit(circ, in, fails)
+        if !fails(small, smallIn) {
+            t.Fatalf("circuit %d: shrunk circuit no longer fails", it)
+        }
+        if small.GateCount() > circ.GateCount() {
+            t.Errorf("circuit %d: grew from %d to %d gates", it, circ.GateCount(), small.GateCount())
+        }
+        // A constant true driving the output
+        if small.GateCount() > 2 || len(smallIn) != 0 {
+            t.Errorf("circuit %d: shrank only to %d gates and %d inputs", it, small.GateCount(), len(smallIn))
+        }
+    }
+}
+
+// A made-up bug that fires on any MUX should shrink to a reproducer whose
+// only logic gate is a MUX
+func TestShrinkCircuitToBuggyGate(t *testing.T) {
+    hasMUX := func(c *Circuit, in []bool) bool {
+        for _, gate := range c.Gates {
+            if gate.GateType == GateMUX {
+                return true
+            }
+        }
+        return false
+    }
+    rng := rand.New(rand.NewSource(7))
+    shrunk := 0
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 6, 60, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        circ.RemoveDeadGates()
+        if !hasMUX(circ, nil) {
+            continue
+        }
+        in := make([]bool, 6)
+        for i := range in {
+            in[i] = rng.Intn(2) == 1
+        }
+        small, smallIn := ShrinkCircuit(circ, in, hasMUX)
+        logic := 0
+        for _, gate := range small.Gates {
+            switch gate.GateType {
+            case GateINPUT, GateOUTPUT, GateCONST:
+            default:
+                logic++
+            }
+        }
+        if logic != 1 || !hasMUX(small, smallIn) {
+            t.Fatalf("circuit %d: shrank to %d logic gates", it, logic)
+        }
+        if !small.validCircuit() || len(smallIn) != small.NumInputWires {
+            t.Fatalf("circuit %d: shrank to an invalid circuit", it)
+        }
+        shrunk++
+    }
+    if shrunk == 0 {
+        t.Fatal("no random circuit had a MUX")
+    }
+}
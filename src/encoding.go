@@ -0,0 +1,246 @@
+package toygarble
+
+import (
+    "fmt"
+    "math/big"
+    "math/bits"
+    "math/rand"
+    "slices"
+)
+
+//
+// Integer encodings of input and output variables. Throughout, wire j of a
+// variable carries bit j of its value, so the first wire is the least
+// significant bit. This matches PadInputsToBoolArray and int64toBoolArray.
+//
+
+// Whether v can be represented in width bits, either as an unsigned value
+// or in two's complement. Only zero fits in no bits at all.
+func fitsWidth(v int64, width int) bool {
+    if width <= 0 {
+        return v == 0
+    }
+    if width >= 64 {
+        return true
+    }
+    return v >= -(int64(1) << (width - 1)) && v < int64(1) << width
+}
+
+// The fewest wires needed to hold value, either as an unsigned integer or
+// in two's complement if signed is set. Zero still needs one wire. Returns
+// -1 for a negative value in unsigned mode.
+func MinWidth(value int64, signed bool) int {
+    if !signed {
+        if value < 0 {
+            return -1
+        }
+        return max(bits.Len64(uint64(value)), 1)
+    }
+
+    // One more bit than the magnitude, for the sign
+    if value < 0 {
+        return bits.Len64(uint64(^value)) + 1
+    }
+    return bits.Len64(uint64(value)) + 1
+}
+
+// Evaluate the circuit on integer-valued input variables, returning the
+// output variables as unsigned integers. widths gives the width of each
+// input variable and must match the circuit's layout; it's there so that
+// mistakes in the caller's idea of the layout are caught rather than
+// silently evaluated. Output variables must be at most 64 bits wide.
+func (circ *Circuit) EvaluateInts(inputs []int64, widths []int) ([]int64, error) {
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    if len(inputs) != circ.NumInputVars || len(widths) != circ.NumInputVars {
+        return nil, fmt.Errorf("got %d inputs and %d widths, circuit has %d input variables: %w", len(inputs), len(widths), circ.NumInputVars, ErrWireCountMismatch)
+    }
+
+    inputBits := make([]bool, 0, circ.NumInputWires)
+    for i, v := range inputs {
+        if widths[i] != circ.NumWiresIV[i] {
+            return nil, fmt.Errorf("input variable %d has %d wires, not %d: %w", i, circ.NumWiresIV[i], widths[i], ErrWireCountMismatch)
+        }
+        if !fitsWidth(v, widths[i]) {
+            return nil, fmt.Errorf("input %d (value %d) doesn't fit in %d bits: %w", i, v, widths[i], ErrOutOfRange)
+        }
+        for j := 0; j < widths[i]; j++ {
+            inputBits = append(inputBits, j < 64 && (uint64(v) >> j) & 1 == 1)
+        }
+    }
+
+    for i := 0; i < circ.NumOutputVars; i++ {
+        if circ.NumWiresOV[i] > 64 {
+            return nil, fmt.Errorf("output variable %d has %d wires, too wide for an int64: %w", i, circ.NumWiresOV[i], ErrOutOfRange)
+        }
+    }
+
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+    outWires, err := e.Evaluate(inputBits)
+    if err != nil {
+        return nil, err
+    }
+
+    result := make([]int64, circ.NumOutputVars)
+    currentWire := 0
+    for i := range result {
+        for j := 0; j < circ.NumWiresOV[i]; j++ {
+            if outWires[currentWire] {
+                result[i] |= int64(1) << j
+            }
+            currentWire++
+        }
+    }
+    return result, nil
+}
+
+// Encode v in two's complement as width bits, least significant first.
+// Fails if v doesn't fit, i.e. isn't between -2^(width-1) and
+// 2^(width-1) - 1.
+func EncodeSigned(v int64, width int) ([]bool, error) {
+    if width < 1 || width > 64 {
+        return nil, fmt.Errorf("width %d is not between 1 and 64: %w", width, ErrOutOfRange)
+    }
+    if MinWidth(v, true) > width {
+        return nil, fmt.Errorf("value %d doesn't fit in %d signed bits: %w", v, width, ErrOutOfRange)
+    }
+    result := make([]bool, width)
+    for j := range result {
+        result[j] = (uint64(v) >> j) & 1 == 1
+    }
+    return result, nil
+}
+
+// Decode bits, least significant first, as a two's complement integer,
+// taking the last bit as the sign. Between 1 and 64 bits are accepted.
+func DecodeSigned(bits []bool) (int64, error) {
+    if len(bits) < 1 || len(bits) > 64 {
+        return 0, fmt.Errorf("can't decode %d bits as an int64: %w", len(bits), ErrOutOfRange)
+    }
+    var v int64
+    for j, b := range bits {
+        if b {
+            v |= int64(1) << j
+        }
+    }
+    if bits[len(bits) - 1] && len(bits) < 64 {
+        v -= int64(1) << len(bits)
+    }
+    return v, nil
+}
+
+// Encode v as width bits, least significant first, for operands too wide
+// for an int64. Like the int64 encodings, v may be unsigned or negative
+// (in two's complement), so it must be between -2^(width-1) and
+// 2^width - 1.
+func BigIntToBoolArray(v *big.Int, width int) ([]bool, error) {
+    if width < 1 {
+        return nil, fmt.Errorf("width %d is not positive: %w", width, ErrOutOfRange)
+    }
+    u := v
+    if v.Sign() < 0 {
+        // -v - 1 needs at most width - 1 bits, leaving one for the sign
+        if new(big.Int).Not(v).BitLen() > width - 1 {
+            return nil, fmt.Errorf("value %v doesn't fit in %d signed bits: %w", v, width, ErrOutOfRange)
+        }
+        u = new(big.Int).Lsh(big.NewInt(1), uint(width))
+        u.Add(u, v)
+    } else if v.BitLen() > width {
+        return nil, fmt.Errorf("value %v doesn't fit in %d bits: %w", v, width, ErrOutOfRange)
+    }
+
+    result := make([]bool, width)
+    for j := range result {
+        result[j] = u.Bit(j) == 1
+    }
+    return result, nil
+}
+
+// Decode bits, least significant first, as an unsigned integer of any size
+func BoolArrayToBigInt(bits []bool) *big.Int {
+    v := new(big.Int)
+    for j, b := range bits {
+        if b {
+            v.SetBit(v, j, 1)
+        }
+    }
+    return v
+}
+
+// Decode bits, least significant first, as a two's complement integer of
+// any size, taking the last bit as the sign. No bits decode as zero.
+func BoolArrayToSignedBigInt(bits []bool) *big.Int {
+    v := BoolArrayToBigInt(bits)
+    if len(bits) > 0 && bits[len(bits) - 1] {
+        v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(bits))))
+    }
+    return v
+}
+
+// Reduce v to width bits and read them back as a signed value, giving the
+// value a width-bit two's complement circuit would produce
+func wrapSigned(v int64, width int) int64 {
+    if width >= 64 {
+        return v
+    }
+    shift := 64 - width
+    return v << shift >> shift
+}
+
+// Check the circuit against a reference function on samples random inputs.
+// Each input variable gets a random signed value of its width, encoded
+// with EncodeSigned; the outputs are decoded with DecodeSigned and compared
+// with f's results, reduced to the output widths (so f may ignore
+// overflow). inputWidths and outputWidths must match the circuit's layout,
+// as in EvaluateInts. Returns an error describing the first mismatch.
+func (circ *Circuit) VerifyRelation(f func(inputs []int64) []int64, inputWidths []int, outputWidths []int, samples int, rng *rand.Rand) error {
+    if !slices.Equal(inputWidths, circ.NumWiresIV) || !slices.Equal(outputWidths, circ.NumWiresOV) {
+        return fmt.Errorf("widths %v -> %v don't match circuit variables %v -> %v: %w", inputWidths, outputWidths, circ.NumWiresIV, circ.NumWiresOV, ErrWireCountMismatch)
+    }
+    for _, width := range append(slices.Clone(inputWidths), outputWidths...) {
+        if width > 64 {
+            return fmt.Errorf("variable of %d wires is too wide for an int64: %w", width, ErrOutOfRange)
+        }
+    }
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return err
+    }
+
+    inputs := make([]int64, len(inputWidths))
+    for s := 0; s < samples; s++ {
+        inputBits := make([]bool, 0, circ.NumInputWires)
+        for i, width := range inputWidths {
+            inputs[i] = wrapSigned(int64(rng.Uint64()), width)
+            encoded, err := EncodeSigned(inputs[i], width)
+            if err != nil {
+                return err
+            }
+            inputBits = append(inputBits, encoded...)
+        }
+
+        outWires, err := e.Evaluate(inputBits)
+        if err != nil {
+            return err
+        }
+        expected := f(slices.Clone(inputs))
+        if len(expected) != len(outputWidths) {
+            return fmt.Errorf("reference gave %d outputs, circuit has %d output variables: %w", len(expected), len(outputWidths), ErrWireCountMismatch)
+        }
+        for i, width := range outputWidths {
+            got, err := DecodeSigned(outWires[:width])
+            if err != nil {
+                return err
+            }
+            outWires = outWires[width:]
+            if want := wrapSigned(expected[i], width); got != want {
+                return fmt.Errorf("inputs %v: output %d is %d, expected %d", inputs, i, got, want)
+            }
+        }
+    }
+    return nil
+}
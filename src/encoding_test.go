@@ -0,0 +1,261 @@
+package toygarble
+
+import (
+    "errors"
+    "math/big"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+func TestFitsWidth(t *testing.T) {
+    cases := []struct {
+        v       int64
+        width   int
+        fits    bool
+    }{
+        {0, 0, true},
+        {1, 0, false},
+        {-1, 0, false},
+        {1, 1, true},
+        {-1, 1, true},
+        {2, 1, false},
+        {255, 8, true},
+        {-128, 8, true},
+        {256, 8, false},
+        {-129, 8, false},
+        {-1 << 63, 64, true},
+    }
+    for _, c := range cases {
+        if got := fitsWidth(c.v, c.width); got != c.fits {
+            t.Errorf("fitsWidth(%d, %d) = %t, want %t", c.v, c.width, got, c.fits)
+        }
+    }
+}
+
+func TestEvaluateIntsAdder(t *testing.T) {
+    circ := BuildAdder(8)
+    cases := []struct {
+        x, y, sum int64
+    }{
+        {0, 0, 0},
+        {3, 4, 7},
+        {200, 100, 44},
+        // Negative inputs are taken in two's complement
+        {200, -1, 199},
+        {-128, -128, 0},
+    }
+    for _, c := range cases {
+        result, err := circ.EvaluateInts([]int64{c.x, c.y}, []int{8, 8})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if result[0] != c.sum {
+            t.Errorf("%d + %d: got %d, want %d", c.x, c.y, result[0], c.sum)
+        }
+    }
+
+    if _, err := circ.EvaluateInts([]int64{256, 1}, []int{8, 8}); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("input too wide: got %v, want ErrOutOfRange", err)
+    }
+    if _, err := circ.EvaluateInts([]int64{1, 1}, []int{8, 7}); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("wrong width: got %v, want ErrWireCountMismatch", err)
+    }
+    if _, err := circ.EvaluateInts([]int64{1}, []int{8}); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("missing input: got %v, want ErrWireCountMismatch", err)
+    }
+}
+
+func TestEvaluateIntsMultiplier(t *testing.T) {
+    circ, err := LoadBristol("../circuits/mult64.txt")
+    if err != nil {
+        t.Fatal(err)
+    }
+    rng := rand.New(rand.NewSource(3))
+    for it := 0; it < 20; it++ {
+        x, y := int64(rng.Uint64()), int64(rng.Uint64())
+        result, err := circ.EvaluateInts([]int64{x, y}, []int{64, 64})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if result[0] != x * y {
+            t.Errorf("%d * %d: got %d, want %d", x, y, result[0], x * y)
+        }
+    }
+}
+
+func TestEvaluateIntsZeroWidth(t *testing.T) {
+    circ := BuildAdder(4)
+    circ.NumInputVars = 3
+    circ.NumWiresIV = []int{4, 4, 0}
+    mustNotPanic(t, "EvaluateInts", func() {
+        if _, err := circ.EvaluateInts([]int64{1, 2, 0}, []int{4, 4, 0}); err != nil {
+            t.Errorf("empty variable holding 0: %v", err)
+        }
+        if _, err := circ.EvaluateInts([]int64{1, 2, 1}, []int{4, 4, 0}); !errors.Is(err, ErrOutOfRange) {
+            t.Errorf("empty variable holding 1: got %v, want ErrOutOfRange", err)
+        }
+    })
+}
+
+func TestEvaluateIntsInvalidCircuit(t *testing.T) {
+    circ := BuildAdder(4)
+    circ.NumInputVars = 3
+    mustNotPanic(t, "EvaluateInts", func() {
+        if _, err := circ.EvaluateInts([]int64{1, 2, 3}, []int{4, 4, 4}); !errors.Is(err, ErrInvalidCircuit) {
+            t.Errorf("got %v, want ErrInvalidCircuit", err)
+        }
+    })
+}
+
+func TestEncodeSignedRoundTrip(t *testing.T) {
+    for width := 1; width <= 64; width += 7 {
+        for _, v := range []int64{0, -1, -(1 << (width - 1)), 1 << (width - 1) - 1} {
+            bits, err := EncodeSigned(v, width)
+            if err != nil {
+                t.Fatal(err)
+            }
+            got, err := DecodeSigned(bits)
+            if err != nil || got != v {
+                t.Errorf("width %d: %d decoded as %d (%v)", width, v, got, err)
+            }
+        }
+        if width < 64 {
+            if _, err := EncodeSigned(1 << (width - 1), width); !errors.Is(err, ErrOutOfRange) {
+                t.Errorf("width %d: 2^%d encoded", width, width - 1)
+            }
+        }
+    }
+}
+
+// An adder whose carry in is stuck at 1 is caught against the plain sum
+func TestVerifyRelation(t *testing.T) {
+    add := func(in []int64) []int64 { return []int64{in[0] + in[1]} }
+    rng := rand.New(rand.NewSource(169))
+    if err := BuildAdder(16).VerifyRelation(add, []int{16, 16}, []int{16}, 200, rng); err != nil {
+        t.Error(err)
+    }
+    sub := func(in []int64) []int64 { return []int64{in[0] - in[1]} }
+    if err := BuildSubtractor(64).VerifyRelation(sub, []int{64, 64}, []int{64}, 100, rng); err != nil {
+        t.Error(err)
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", 16)
+    y := b.Input("y", 16)
+    sum := make([]Wire, 16)
+    carry := b.Const(true)
+    for i := range sum {
+        sum[i], carry = b.FullAdder(x[i], y[i], carry)
+    }
+    offByOne, err := b.Output("sum", sum...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := offByOne.VerifyRelation(add, []int{16, 16}, []int{16}, 200, rng); err == nil {
+        t.Error("off-by-one adder passed")
+    }
+    if err := BuildAdder(16).VerifyRelation(add, []int{16, 8}, []int{16}, 10, rng); err == nil {
+        t.Error("wrong input widths accepted")
+    }
+}
+
+func TestMinWidth(t *testing.T) {
+    cases := []struct {
+        v       int64
+        signed  bool
+        width   int
+    }{
+        {0, false, 1},
+        {0, true, 1},
+        {1, false, 1},
+        {1, true, 2},
+        {7, false, 3},
+        {8, false, 4},
+        {8, true, 5},
+        {1 << 62, false, 63},
+        {1<<63 - 1, false, 63},
+        {1<<63 - 1, true, 64},
+        {-1, true, 1},
+        {-2, true, 2},
+        {-8, true, 4},
+        {-9, true, 5},
+        {127, true, 8},
+        {-128, true, 8},
+        {-1 << 63, true, 64},
+        {-1, false, -1},
+    }
+    for _, c := range cases {
+        if got := MinWidth(c.v, c.signed); got != c.width {
+            t.Errorf("MinWidth(%d, %t) = %d, want %d", c.v, c.signed, got, c.width)
+        }
+    }
+}
+
+func TestBigIntRoundTrip(t *testing.T) {
+    v, _ := new(big.Int).SetString("123456789abcdef0123456789abcdef0fedcba9876543210", 16)
+    neg := new(big.Int).Neg(v)
+    minimum := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 99))
+    maximum := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 100), big.NewInt(1))
+    for _, c := range []struct {
+        v       *big.Int
+        width   int
+        signed  bool
+    }{
+        {v, 256, false},
+        {neg, 256, true},
+        {minimum, 100, true},
+        {maximum, 100, false},
+        {big.NewInt(0), 1, false},
+    } {
+        bits, err := BigIntToBoolArray(c.v, c.width)
+        if err != nil {
+            t.Fatalf("%v in %d bits: %v", c.v, c.width, err)
+        }
+        got := BoolArrayToBigInt(bits)
+        if c.signed {
+            got = BoolArrayToSignedBigInt(bits)
+        }
+        if len(bits) != c.width || got.Cmp(c.v) != 0 {
+            t.Errorf("%v in %d bits decoded as %v", c.v, c.width, got)
+        }
+    }
+
+    for _, v := range []*big.Int{new(big.Int).Sub(minimum, big.NewInt(1)), new(big.Int).Add(maximum, big.NewInt(1))} {
+        if _, err := BigIntToBoolArray(v, 100); !errors.Is(err, ErrOutOfRange) {
+            t.Errorf("%v in 100 bits: %v", v, err)
+        }
+    }
+
+    // Small values are laid out as by EncodeSigned
+    want, _ := EncodeSigned(-5, 8)
+    if got, err := BigIntToBoolArray(big.NewInt(-5), 8); err != nil || !slices.Equal(got, want) {
+        t.Errorf("-5: got %v, want %v", got, want)
+    }
+}
+
+// A 128-bit adder fed and read with big.Ints
+func TestBigIntAdder(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 128)
+    y := b.Input("y", 128)
+    sum, _ := b.add(x, y, b.Const(false))
+    circ, err := b.Output("sum", sum...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    xv, _ := new(big.Int).SetString("ffffffffffffffffffffffffffff", 16)
+    yv, _ := new(big.Int).SetString("123456789abcdef0123456789", 16)
+    xb, err := BigIntToBoolArray(xv, 128)
+    if err != nil {
+        t.Fatal(err)
+    }
+    yb, err := BigIntToBoolArray(yv, 128)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ok, out := circ.EvaluateCircuit(append(xb, yb...))
+    if want := new(big.Int).Add(xv, yv); !ok || BoolArrayToBigInt(out).Cmp(want) != 0 {
+        t.Errorf("got %v, want %v", BoolArrayToBigInt(out), want)
+    }
+}
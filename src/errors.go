@@ -0,0 +1,38 @@
+package toygarble
+
+import (
+    "errors"
+)
+
+//
+// Sentinel errors. Errors returned by the package wrap one of these where
+// it applies, so callers can tell kinds of failure apart with errors.Is.
+//
+
+var (
+    // The circuit's structure is invalid, as checked by validCircuit
+    ErrInvalidCircuit       = errors.New("invalid circuit")
+
+    // The circuit contains a cycle, so it has no evaluation order
+    ErrCycle                = errors.New("circuit contains a cycle")
+
+    // A gate has an unknown or unsupported type, or the wrong inputs for
+    // its type
+    ErrInvalidGate          = errors.New("invalid gate")
+
+    // The number of input or output values given doesn't match the
+    // circuit's layout
+    ErrWireCountMismatch    = errors.New("wire count mismatch")
+
+    // A gate, wire or variable index is out of range
+    ErrOutOfRange           = errors.New("index out of range")
+
+    // The circuit would exceed its size limits
+    ErrLimitExceeded        = errors.New("size limit exceeded")
+
+    // A serialized circuit couldn't be parsed
+    ErrMalformed            = errors.New("malformed circuit file")
+
+    // Input data, such as a CSV row of input values, couldn't be parsed
+    ErrMalformedInput       = errors.New("malformed input")
+)
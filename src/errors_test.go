@@ -0,0 +1,75 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "strings"
+    "testing"
+)
+
+// The error from a call returning a value and an error
+func second[T any](_ T, err error) error {
+    return err
+}
+
+// The error from Gate
+func fourth(_ GateType_t, _ bool, _ []int, err error) error {
+    return err
+}
+
+// Each kind of failure wraps its sentinel, and only its sentinel
+func TestSentinelErrors(t *testing.T) {
+    adder := BuildAdder(2)
+    cyclic := adder.Clone()
+    last := len(cyclic.Gates) - 1
+    cyclic.Gates[last].InFrom[0] = last
+    invalid := adder.Clone()
+    invalid.Gates[last].InFrom = nil
+    eval, err := NewEvaluator(adder)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    cases := []struct {
+        name        string
+        err         error
+        sentinel    error
+    }{
+        {"TopologicalOrder with a cycle", second(cyclic.TopologicalOrder()), ErrCycle},
+        {"Depth with a cycle", second(cyclic.Depth()), ErrCycle},
+        {"NewEvaluator on an invalid circuit", second(NewEvaluator(invalid)), ErrInvalidCircuit},
+        {"Layers on an invalid circuit", second(invalid.Layers()), ErrInvalidCircuit},
+        {"RequireGateTypes", adder.RequireGateTypes([]GateType_t{GateAND}), ErrInvalidGate},
+        {"Evaluate with one input bit", second(eval.Evaluate([]bool{true})), ErrWireCountMismatch},
+        {"CheckInputLayout with three buffers", adder.CheckInputLayout([][]byte{{0}, {0}, {0}}), ErrWireCountMismatch},
+        {"Gate(999)", fourth(adder.Gate(999)), ErrOutOfRange},
+        {"EvaluateOutputVar(1)", second(adder.EvaluateOutputVar(make([]bool, 4), 1)), ErrOutOfRange},
+        {"ParseEMP with an unknown gate", second(ParseEMP(strings.NewReader("1 3\n1 1 1\n\n2 1 0 1 2 FOO\n"))), ErrMalformed},
+        {"ParseBristol without a header", second(ParseBristol(strings.NewReader(""))), ErrMalformed},
+        {"ReadBinary with a bad magic number", second(ReadBinary(bytes.NewReader([]byte("XXXXX")))), ErrMalformed},
+        {"ParseBristolWith under a tiny limit", second(ParseBristolWith(strings.NewReader(bristolChain(5)), Limits{MaxGates: 2, MaxWires: 100, MaxInputWires: 100})), ErrLimitExceeded},
+    }
+    sentinels := []error{ErrInvalidCircuit, ErrCycle, ErrInvalidGate, ErrWireCountMismatch, ErrOutOfRange, ErrLimitExceeded, ErrMalformed, ErrMalformedInput}
+    for _, c := range cases {
+        if !errors.Is(c.err, c.sentinel) {
+            t.Errorf("%s: got %v, want %v", c.name, c.err, c.sentinel)
+            continue
+        }
+        for _, other := range sentinels {
+            if other != c.sentinel && errors.Is(c.err, other) {
+                t.Errorf("%s: %v also matches %v", c.name, c.err, other)
+            }
+        }
+    }
+
+    // Underlying I/O errors are wrapped, not flattened into the message
+    var buf bytes.Buffer
+    if err := adder.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    _, err = ReadBinary(bytes.NewReader(buf.Bytes()[:3]))
+    if !errors.Is(err, io.ErrUnexpectedEOF) {
+        t.Errorf("truncated header: got %v, want it to wrap %v", err, io.ErrUnexpectedEOF)
+    }
+}
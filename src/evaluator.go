@@ -0,0 +1,212 @@
+package toygarble
+
+import (
+    "context"
+    "fmt"
+)
+
+const (
+    // How many gates to evaluate between checks for cancellation
+    CONTEXT_CHECK_INTERVAL  int = 4096
+)
+
+//
+// Iterative evaluation for repeated use
+//
+
+// Evaluates a circuit over and over, computing the gate order once and
+// reusing its scratch space between calls. An Evaluator is not safe for
+// concurrent use; create one per goroutine.
+type Evaluator struct {
+    circ    *Circuit
+    order   []int
+    values  []bool
+}
+
+// Prepare an evaluator for the circuit, checking that it is well formed
+// and boolean
+func NewEvaluator(circ *Circuit) (*Evaluator, error) {
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return nil, err
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, err
+    }
+
+    return &Evaluator{circ, order, make([]bool, len(circ.Gates))}, nil
+}
+
+// Evaluate the circuit on the given input bits, returning the output bits
+func (e *Evaluator) Evaluate(inputBits []bool) ([]bool, error) {
+    return e.EvaluateContext(context.Background(), inputBits)
+}
+
+// Like Evaluate, but gives up with ctx.Err() if ctx is cancelled. The
+// context is checked every CONTEXT_CHECK_INTERVAL gates.
+func (e *Evaluator) EvaluateContext(ctx context.Context, inputBits []bool) ([]bool, error) {
+    return e.run(ctx, inputBits, nil)
+}
+
+// Evaluate the circuit, inverting the output of each gate marked in flips
+// once it has been computed
+func (e *Evaluator) run(ctx context.Context, inputBits []bool, flips map[int]bool) ([]bool, error) {
+    circ := e.circ
+    if len(inputBits) != circ.NumInputWires {
+        return nil, fmt.Errorf("got %d input bits, circuit has %d input wires: %w", len(inputBits), circ.NumInputWires, ErrWireCountMismatch)
+    }
+
+    for w := 0; w < circ.NumInputWires; w++ {
+        e.values[circ.getInputGate(w)] = inputBits[w]
+    }
+    for pos, g := range e.order {
+        if pos % CONTEXT_CHECK_INTERVAL == 0 {
+            select {
+            case <-ctx.Done():
+                return nil, ctx.Err()
+            default:
+            }
+        }
+
+        if circ.Gates[g].GateType != GateINPUT {
+            v, err := gateOutput(&circ.Gates[g], e.values)
+            if err != nil {
+                return nil, fmt.Errorf("%s: %w", circ.describeGate(g), err)
+            }
+            e.values[g] = v
+        }
+        if flips[g] {
+            e.values[g] = !e.values[g]
+        }
+    }
+
+    result := make([]bool, circ.NumOutputWires)
+    for i := range result {
+        result[i] = e.values[circ.getOutputGate(i)]
+    }
+    return result, nil
+}
+
+// Compute a gate's output from the values of the gates feeding it. The
+// gate's arity is assumed valid, as checked by validCircuit.
+func gateOutput(gate *Gate, values []bool) (bool, error) {
+    in := gate.InFrom
+    switch gate.GateType {
+    case GateOUTPUT, GateCOPY:
+        return values[in[0]], nil
+    case GateCONST:
+        return gate.ConstVal, nil
+    case GateAND, GateMULK:
+        return values[in[0]] && values[in[1]], nil
+    case GateOR:
+        return values[in[0]] || values[in[1]], nil
+    case GateXOR, GateADDK:
+        return values[in[0]] != values[in[1]], nil
+    case GateNOT:
+        return !values[in[0]], nil
+    case GateMUX:
+        if values[in[0]] {
+            return values[in[2]], nil
+        }
+        return values[in[1]], nil
+    case GateTOFFLI:
+        return values[in[2]] != (values[in[0]] && values[in[1]]), nil
+    case GateMAJ:
+        a, b, c := values[in[0]], values[in[1]], values[in[2]]
+        return (a && b) || (a && c) || (b && c), nil
+    case GateCNOT:
+        return values[in[1]] != values[in[0]], nil
+    case GateLUT:
+        address := 0
+        for j, from := range in {
+            if values[from] {
+                address |= 1 << j
+            }
+        }
+        return gate.TruthTable[address], nil
+    }
+    return false, fmt.Errorf("unknown gate type %d: %w", gate.GateType, ErrInvalidGate)
+}
+
+// Evaluate the circuit with some gates faulty: each gate g with flips[g]
+// set outputs the inverse of its correct value, and the error propagates to
+// everything downstream of it. Flipping an input gate inverts that input.
+func (circ *Circuit) EvaluateWithFaults(inputBits []bool, flips map[int]bool) ([]bool, error) {
+    for g := range flips {
+        if g < 0 || g >= len(circ.Gates) {
+            return nil, fmt.Errorf("fault in nonexistent gate %d: %w", g, ErrOutOfRange)
+        }
+    }
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+    return e.run(context.Background(), inputBits, flips)
+}
+
+// Evaluate the circuit once, giving up with ctx.Err() if ctx is cancelled
+// before evaluation finishes
+func (circ *Circuit) EvaluateCircuitContext(ctx context.Context, inputBits []bool) ([]bool, error) {
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+    return e.EvaluateContext(ctx, inputBits)
+}
+
+// Evaluate just output variable outputVar, skipping any gates it doesn't
+// depend on, and return it packed as for DecodeOutputVariables. Only the
+// variable's cone is ordered, so a cycle elsewhere in the circuit goes
+// unnoticed.
+func (circ *Circuit) EvaluateOutputVar(inputBits []bool, outputVar int) ([]byte, error) {
+    if outputVar < 0 || outputVar >= circ.NumOutputVars {
+        return nil, fmt.Errorf("output variable %d out of range (%d variables): %w", outputVar, circ.NumOutputVars, ErrOutOfRange)
+    }
+    if len(inputBits) != circ.NumInputWires {
+        return nil, fmt.Errorf("got %d input bits, circuit has %d input wires: %w", len(inputBits), circ.NumInputWires, ErrWireCountMismatch)
+    }
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return nil, err
+    }
+
+    // The output gates of this variable, and everything they depend on
+    firstWire := 0
+    for i := 0; i < outputVar; i++ {
+        firstWire += circ.NumWiresOV[i]
+    }
+    roots := make([]int, circ.NumWiresOV[outputVar])
+    for j := range roots {
+        roots[j] = circ.getOutputGate(firstWire + j)
+    }
+    order, err := circ.coneOrder(roots)
+    if err != nil {
+        return nil, err
+    }
+
+    values := make([]bool, len(circ.Gates))
+    for w := 0; w < circ.NumInputWires; w++ {
+        values[circ.getInputGate(w)] = inputBits[w]
+    }
+    for _, g := range order {
+        if circ.Gates[g].GateType == GateINPUT {
+            continue
+        }
+        v, err := gateOutput(&circ.Gates[g], values)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", circ.describeGate(g), err)
+        }
+        values[g] = v
+    }
+
+    outWires := make([]bool, len(roots))
+    for j, root := range roots {
+        outWires[j] = values[root]
+    }
+    return boolArrayToBytes(outWires), nil
+}
@@ -0,0 +1,248 @@
+package toygarble
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+// An Evaluator reused across calls agrees with EvaluateCircuit every time
+func TestEvaluatorReuse(t *testing.T) {
+    circ := BuildAdder(8)
+    eval, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    rng := rand.New(rand.NewSource(1))
+    for trial := 0; trial < 100; trial++ {
+        in := make([]bool, circ.NumInputWires)
+        for i := range in {
+            in[i] = rng.Intn(2) == 1
+        }
+        got, err := eval.Evaluate(in)
+        if err != nil {
+            t.Fatal(err)
+        }
+        ok, want := circ.EvaluateCircuit(in)
+        if !ok {
+            t.Fatal("EvaluateCircuit failed")
+        }
+        for i := range want {
+            if got[i] != want[i] {
+                t.Fatalf("trial %d: output %d is %t, want %t", trial, i, got[i], want[i])
+            }
+        }
+    }
+}
+
+func TestEvaluatorWrongInputLength(t *testing.T) {
+    eval, err := NewEvaluator(BuildAdder(8))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := eval.Evaluate(make([]bool, 15)); err == nil {
+        t.Error("15 input bits for a 16-input circuit were accepted")
+    }
+}
+
+func TestNewEvaluatorInvalid(t *testing.T) {
+    circ := BuildAdder(8)
+    circ.Gates[len(circ.Gates)-1].InFrom[0] = -1
+    if _, err := NewEvaluator(circ); err == nil {
+        t.Error("NewEvaluator accepted a gate reading from gate -1")
+    }
+}
+
+// A context that reports itself cancelled once Done has been polled a given
+// number of times, so cancellation lands at a known point mid-evaluation
+type cancelAfterContext struct {
+    context.Context
+    polls       int
+    cancel      context.CancelFunc
+}
+
+func newCancelAfterContext(polls int) *cancelAfterContext {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &cancelAfterContext{ctx, polls, cancel}
+}
+
+func (c *cancelAfterContext) Done() <-chan struct{} {
+    c.polls--
+    if c.polls < 0 {
+        c.cancel()
+    }
+    return c.Context.Done()
+}
+
+func TestEvaluateCircuitContextCancelled(t *testing.T) {
+    const n = 20 * CONTEXT_CHECK_INTERVAL
+    circ := buildChain(t, GateXOR, n)
+    in := make([]bool, n)
+
+    // Cancelled partway through the gate order
+    ctx := newCancelAfterContext(10)
+    out, err := circ.EvaluateCircuitContext(ctx, in)
+    if !errors.Is(err, context.Canceled) || out != nil {
+        t.Fatalf("cancelled mid-evaluation: got %v, %v", out, err)
+    }
+    if ctx.polls != -1 {
+        t.Errorf("evaluation went on polling after cancellation (%d polls left)", ctx.polls)
+    }
+
+    // Already cancelled before evaluation starts
+    cancelled, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err := circ.EvaluateCircuitContext(cancelled, in); !errors.Is(err, context.Canceled) {
+        t.Errorf("cancelled context: got %v", err)
+    }
+
+    // Never cancelled
+    in[0] = true
+    out, err = circ.EvaluateCircuitContext(context.Background(), in)
+    if err != nil || len(out) != 1 || !out[0] {
+        t.Errorf("uncancelled evaluation: got %v, %v", out, err)
+    }
+}
+
+// A circuit with ten independent 8-bit output variables, each computed
+// from its own 32 input wires
+// Flipping the carry out of the low bit of a ripple-carry adder moves the
+// sum by 2: down if that carry was set, up if it wasn't
+func TestEvaluateWithFaults(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 4)
+    y := b.Input("y", 4)
+    sum := make([]Wire, 4)
+    carry := b.Const(false)
+    for i := range sum {
+        sum[i], carry = b.FullAdder(x[i], y[i], carry)
+    }
+    circ, err := b.Output("sum", sum...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    carry0 := slices.IndexFunc(circ.Gates, func(g Gate) bool { return g.GateType == GateMAJ })
+
+    for v := 0; v < 256; v++ {
+        in := make([]bool, 8)
+        for i := range in {
+            in[i] = v >> i & 1 == 1
+        }
+        xv, yv := v & 15, v >> 4
+        _, want := circ.EvaluateCircuit(in)
+        if got, err := circ.EvaluateWithFaults(in, nil); err != nil || !slices.Equal(got, want) {
+            t.Fatalf("%d + %d without faults: got %v (%v)", xv, yv, got, err)
+        }
+        got, err := circ.EvaluateWithFaults(in, map[int]bool{carry0: true})
+        if err != nil {
+            t.Fatal(err)
+        }
+        faulty := xv + yv + 2
+        if xv & yv & 1 == 1 {
+            faulty = xv + yv - 2
+        }
+        for i := range got {
+            if got[i] != (faulty >> i & 1 == 1) {
+                t.Fatalf("%d + %d with a bad carry: got %v, want %d", xv, yv, got, faulty & 15)
+            }
+        }
+    }
+
+    in := make([]bool, 8)
+    if _, err := circ.EvaluateWithFaults(in, map[int]bool{len(circ.Gates): true}); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("fault on a nonexistent gate: %v", err)
+    }
+}
+
+func tenOutputCircuit(tb testing.TB) *Circuit {
+    tb.Helper()
+    b := NewBuilder()
+    x := b.Input("x", 10 * 32)
+    for k := 0; k < 10; k++ {
+        in := x[32 * k : 32 * (k + 1)]
+        out := make([]Wire, 8)
+        for j := range out {
+            acc := b.And(in[j], in[j + 1])
+            for i := 2; i < len(in); i++ {
+                acc = b.Xor(acc, b.And(in[(i + j) % len(in)], in[i - 1]))
+            }
+            out[j] = acc
+        }
+        b.Output(fmt.Sprintf("out%d", k), out...)
+    }
+    circ, err := b.Build()
+    if err != nil {
+        tb.Fatal(err)
+    }
+    return circ
+}
+
+func TestEvaluateOutputVar(t *testing.T) {
+    circ := tenOutputCircuit(t)
+    rng := rand.New(rand.NewSource(1))
+    for trial := 0; trial < 20; trial++ {
+        in := make([]bool, circ.NumInputWires)
+        for i := range in {
+            in[i] = rng.Intn(2) == 1
+        }
+        ok, outWires := circ.EvaluateCircuit(in)
+        if !ok {
+            t.Fatal("EvaluateCircuit failed")
+        }
+        want := circ.DecodeOutputVariables(outWires)
+        for k := 0; k < circ.NumOutputVars; k++ {
+            got, err := circ.EvaluateOutputVar(in, k)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !slices.Equal(got, want[k]) {
+                t.Fatalf("trial %d: output %d is %v, want %v", trial, k, got, want[k])
+            }
+        }
+    }
+
+    in := make([]bool, circ.NumInputWires)
+    for _, k := range []int{-1, 10} {
+        if _, err := circ.EvaluateOutputVar(in, k); !errors.Is(err, ErrOutOfRange) {
+            t.Errorf("output variable %d: got %v", k, err)
+        }
+    }
+    if _, err := circ.EvaluateOutputVar(in[1:], 0); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("short input: got %v", err)
+    }
+
+    // Loop the first output's driver back on itself; the other outputs
+    // don't depend on it
+    out := circ.getOutputGate(0)
+    driver := circ.Gates[out].InFrom[0]
+    circ.Gates[driver].InFrom[0] = out
+    if _, err := circ.EvaluateOutputVar(in, 0); !errors.Is(err, ErrCycle) {
+        t.Errorf("cycle in the cone: got %v", err)
+    }
+    if _, err := circ.EvaluateOutputVar(in, 1); err != nil {
+        t.Errorf("cycle outside the cone: got %v", err)
+    }
+}
+
+// Evaluating one of ten independent outputs against evaluating them all
+func BenchmarkEvaluateOutputVar(b *testing.B) {
+    circ := tenOutputCircuit(b)
+    in := make([]bool, circ.NumInputWires)
+    b.Run("one output", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            if _, err := circ.EvaluateOutputVar(in, 3); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+    b.Run("EvaluateCircuit", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            if ok, _ := circ.EvaluateCircuit(in); !ok {
+                b.Fatal("evaluation failed")
+            }
+        }
+    })
+}
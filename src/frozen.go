@@ -0,0 +1,75 @@
+package toygarble
+
+import (
+    "io"
+)
+
+//
+// Immutable circuits for sharing
+//
+
+// A read-only view of a circuit, safe to share between goroutines. It holds
+// its own copy of the circuit, which nothing can modify: only reading and
+// evaluating methods are offered, and Thaw gives a mutable copy for
+// anything else.
+type FrozenCircuit struct {
+    circ    *Circuit
+
+    // The evaluation order shared by every Evaluator of the circuit, or
+    // why it can't be evaluated
+    order   []int
+    err     error
+}
+
+// Freeze a copy of the circuit. Later changes to circ don't affect it.
+func (circ *Circuit) Freeze() *FrozenCircuit {
+    f := &FrozenCircuit{circ: circ.Clone()}
+    e, err := NewEvaluator(f.circ)
+    if err != nil {
+        f.err = err
+    } else {
+        f.order = e.order
+    }
+    return f
+}
+
+// A mutable copy of the circuit, for optimizing or extending it
+func (f *FrozenCircuit) Thaw() *Circuit {
+    return f.circ.Clone()
+}
+
+// Prepare an evaluator for the circuit. The gate order was worked out
+// when the circuit was frozen, so this only allocates scratch space.
+// Evaluators aren't safe for concurrent use, so create one per goroutine.
+func (f *FrozenCircuit) NewEvaluator() (*Evaluator, error) {
+    if f.err != nil {
+        return nil, f.err
+    }
+    return &Evaluator{f.circ, f.order, make([]bool, len(f.circ.Gates))}, nil
+}
+
+// Evaluate the circuit once on the given input bits
+func (f *FrozenCircuit) Evaluate(inputBits []bool) ([]bool, error) {
+    e, err := f.NewEvaluator()
+    if err != nil {
+        return nil, err
+    }
+    return e.Evaluate(inputBits)
+}
+
+func (f *FrozenCircuit) NumInputWires() int {
+    return f.circ.NumInputWires
+}
+
+func (f *FrozenCircuit) NumOutputWires() int {
+    return f.circ.NumOutputWires
+}
+
+func (f *FrozenCircuit) Stats() Stats {
+    return f.circ.Stats()
+}
+
+// Write the circuit in the compact binary format
+func (f *FrozenCircuit) WriteBinary(w io.Writer) error {
+    return f.circ.WriteBinary(w)
+}
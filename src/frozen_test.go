@@ -0,0 +1,81 @@
+package toygarble
+
+import (
+    "reflect"
+    "sync"
+    "testing"
+)
+
+// Frozen circuits offer no way to modify them: the mutating methods of
+// Circuit simply aren't there
+func TestFrozenCircuitHasNoMutators(t *testing.T) {
+    frozen := reflect.TypeOf(&FrozenCircuit{})
+    for _, name := range []string{"AddGateChecked", "AddLUT", "AddMAJ", "DeclareInput", "FoldConstants", "Optimize", "RemoveDeadGates", "SetInputParty"} {
+        if _, ok := reflect.TypeOf(&Circuit{}).MethodByName(name); !ok {
+            t.Fatalf("Circuit has no method %s", name)
+        }
+        if _, ok := frozen.MethodByName(name); ok {
+            t.Errorf("FrozenCircuit has a %s method", name)
+        }
+    }
+}
+
+// Changing the original or a thawed copy leaves the frozen circuit alone,
+// and goroutines can evaluate it at once
+func TestFrozenCircuitShared(t *testing.T) {
+    circ := BuildAdder(8)
+    frozen := circ.Freeze()
+    for i := range circ.Gates {
+        if circ.Gates[i].GateType == GateXOR {
+            circ.Gates[i].GateType = GateOR
+        }
+    }
+    thawed := frozen.Thaw()
+    thawed.addGate(GateAND, false, []int{0, 1})
+    thawed.FoldConstants()
+    if frozen.NumInputWires() != 16 || frozen.NumOutputWires() != 8 || frozen.Stats().NumWires != len(BuildAdder(8).Gates) {
+        t.Fatal("frozen circuit changed")
+    }
+
+    var wg sync.WaitGroup
+    for k := int64(0); k < 8; k++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            e, err := frozen.NewEvaluator()
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            for v := int64(0); v < 256; v++ {
+                in := make([]bool, 16)
+                for i := 0; i < 8; i++ {
+                    in[i] = v >> i & 1 == 1
+                    in[8 + i] = k >> i & 1 == 1
+                }
+                out, err := e.Evaluate(in)
+                if err != nil {
+                    t.Error(err)
+                    return
+                }
+                if sum := boolArrayToInt64(out); sum != (v + k) & 255 {
+                    t.Errorf("%d + %d = %d", v, k, sum)
+                    return
+                }
+            }
+        }()
+    }
+    wg.Wait()
+}
+
+func TestFreezeInvalid(t *testing.T) {
+    circ := BuildAdder(2)
+    circ.Gates[len(circ.Gates) - 1].InFrom[0] = len(circ.Gates) - 1
+    frozen := circ.Freeze()
+    if _, err := frozen.Evaluate(make([]bool, 4)); err == nil {
+        t.Error("evaluated a cyclic frozen circuit")
+    }
+    if _, err := frozen.NewEvaluator(); err == nil {
+        t.Error("made an evaluator for a cyclic frozen circuit")
+    }
+}
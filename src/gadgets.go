@@ -0,0 +1,312 @@
+package toygarble
+
+import (
+    "math/bits"
+)
+
+//
+// Builders for commonly used gadget circuits
+//
+
+const (
+    // Widest address accepted by the decoder and ROM builders
+    MAX_ADDRESS_WIDTH   int = 16
+
+    // Widest input accepted by the bit-counting builders
+    MAX_COUNT_WIDTH     int = 1 << 16
+)
+
+// Decode an address into one-hot lines: line k is set iff the address is k.
+// Each extra address bit splits every existing line in two with an AND.
+func (b *Builder) decoder(addr []Wire) []Wire {
+    lines := []Wire{b.Not(addr[0]), addr[0]}
+    for j := 1; j < len(addr); j++ {
+        notBit := b.Not(addr[j])
+        next := make([]Wire, 2 * len(lines))
+        for k, line := range lines {
+            next[k] = b.And(line, notBit)
+            next[k + len(lines)] = b.And(line, addr[j])
+        }
+        lines = next
+    }
+    return lines
+}
+
+// Build a decoder taking an addrWidth-bit input variable "addr" and
+// producing a 2^addrWidth-bit output variable "lines", of which exactly the
+// addressed line is set. Returns nil if addrWidth is not between 1 and
+// MAX_ADDRESS_WIDTH.
+func BuildDecoder(addrWidth int) *Circuit {
+    if addrWidth < 1 || addrWidth > MAX_ADDRESS_WIDTH {
+        return nil
+    }
+
+    b := NewBuilder()
+    addr := b.Input("addr", addrWidth)
+    circ, err := b.Output("lines", b.decoder(addr)...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Build a read-only memory holding the given words, which must all have the
+// same nonzero width. The circuit takes an "addr" input variable of
+// ceil(log2(len(contents))) bits (at least one) and outputs the addressed
+// word as "word", or all zeros for an address past the end of the table.
+// Each output bit is the OR of the decoder lines of the words with that bit
+// set. Returns nil for an empty or ragged table.
+func BuildROM(contents [][]bool) *Circuit {
+    if len(contents) == 0 || len(contents[0]) == 0 {
+        return nil
+    }
+    width := len(contents[0])
+    for _, word := range contents {
+        if len(word) != width {
+            return nil
+        }
+    }
+
+    addrWidth := 1
+    for 1 << addrWidth < len(contents) {
+        addrWidth++
+    }
+    if addrWidth > MAX_ADDRESS_WIDTH {
+        return nil
+    }
+
+    b := NewBuilder()
+    lines := b.decoder(b.Input("addr", addrWidth))
+
+    word := make([]Wire, width)
+    for j := range word {
+        word[j] = -1
+        for k := range contents {
+            if !contents[k][j] {
+                continue
+            }
+            if word[j] < 0 {
+                word[j] = lines[k]
+            } else {
+                word[j] = b.Or(word[j], lines[k])
+            }
+        }
+        if word[j] < 0 {
+            word[j] = b.Const(false)
+        }
+    }
+
+    circ, err := b.Output("word", word...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Build one step of a Fibonacci linear-feedback shift register over a
+// width-bit input variable "state": the output "next" is the state shifted
+// down one bit, with the XOR of the tapped state bits shifted in at the
+// top. In software, next = state >> 1 | parity(state & tapMask) << (width - 1).
+// Returns nil if width is not between 1 and MAX_ARITHMETIC_WIDTH or the
+// taps are empty, repeated or out of range.
+func BuildLFSR(width int, taps []int) *Circuit {
+    if width < 1 || width > MAX_ARITHMETIC_WIDTH || len(taps) == 0 {
+        return nil
+    }
+    tapped := make([]bool, width)
+    for _, t := range taps {
+        if t < 0 || t >= width || tapped[t] {
+            return nil
+        }
+        tapped[t] = true
+    }
+
+    b := NewBuilder()
+    state := b.Input("state", width)
+    feedback := state[taps[0]]
+    for _, t := range taps[1:] {
+        feedback = b.Xor(feedback, state[t])
+    }
+    next := append(append([]Wire(nil), state[1:]...), feedback)
+
+    circ, err := b.Output("next", next...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Build one bit of a CRC computation, most significant bit first, over a
+// width-bit input variable "crc" and a one-bit message input "bit". The
+// output "next" is the CRC shifted up one bit, XORed with the polynomial
+// (given without its x^width term) if the bit shifted out differs from the
+// message bit. Returns nil if width is not between 1 and
+// MAX_ARITHMETIC_WIDTH or the polynomial doesn't fit in width bits.
+func BuildCRCStep(width int, polynomial uint64) *Circuit {
+    if width < 1 || width > MAX_ARITHMETIC_WIDTH || (width < 64 && polynomial >> width != 0) {
+        return nil
+    }
+
+    b := NewBuilder()
+    crc := b.Input("crc", width)
+    bit := b.Input("bit", 1)
+    feedback := b.Xor(crc[width - 1], bit[0])
+
+    next := make([]Wire, width)
+    for i := range next {
+        tapped := polynomial & (1 << i) != 0
+        switch {
+        case i == 0 && tapped:
+            next[i] = feedback
+        case i == 0:
+            next[i] = b.Const(false)
+        case tapped:
+            next[i] = b.Xor(crc[i - 1], feedback)
+        default:
+            next[i] = crc[i - 1]
+        }
+    }
+
+    circ, err := b.Output("next", next...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Count the set wires, returning the count in bits.Len(len(x)) wires. The
+// wires are added up as a tree of ripple-carry adders, with the odd wire
+// out at each level going in as a carry, so n wires cost about n ANDs.
+func (b *Builder) popCount(x []Wire) []Wire {
+    if len(x) == 1 {
+        return []Wire{x[0]}
+    }
+
+    half := len(x) / 2
+    var carry Wire
+    if len(x) % 2 == 1 {
+        carry = x[len(x) - 1]
+    } else {
+        carry = b.Const(false)
+    }
+    sum, carryOut := b.add(b.popCount(x[:half]), b.popCount(x[half:2 * half]), carry)
+    return append(sum, carryOut)[:bits.Len(uint(len(x)))]
+}
+
+// Build a circuit counting the set bits of a width-bit input variable "x",
+// with output "count" of bits.Len(width) bits. Returns nil if width is not
+// between 1 and MAX_COUNT_WIDTH.
+func BuildPopCount(width int) *Circuit {
+    if width < 1 || width > MAX_COUNT_WIDTH {
+        return nil
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", width)
+    circ, err := b.Output("count", b.popCount(x)...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// The number of positions where x and y differ, as popCount gives it
+func (b *Builder) hammingDistance(x []Wire, y []Wire) []Wire {
+    diff := make([]Wire, len(x))
+    for i := range diff {
+        diff[i] = b.Xor(x[i], y[i])
+    }
+    return b.popCount(diff)
+}
+
+// Build a circuit computing the Hamming distance between two width-bit
+// inputs "x" and "y": the number of bits where they differ, as the output
+// "distance" of bits.Len(width) bits. Returns nil if width is not between
+// 1 and MAX_COUNT_WIDTH.
+func BuildHammingDistance(width int) *Circuit {
+    if width < 1 || width > MAX_COUNT_WIDTH {
+        return nil
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", width)
+    y := b.Input("y", width)
+    circ, err := b.Output("distance", b.hammingDistance(x, y)...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Whether the unsigned number on x is at most the constant k, which must fit
+// in len(x) bits. Working up from the least significant bit, x is at most k
+// so far if its bit is below k's, or equal with the bits below at most k,
+// which takes one AND per bit.
+func (b *Builder) atMost(x []Wire, k uint64) Wire {
+    // Negative until some bit is compared, since an empty x is at most k
+    le := Wire(-1)
+    for i, bit := range x {
+        switch {
+        case k & (1 << i) != 0 && le < 0:
+            // Anything is at most a 1 bit
+        case k & (1 << i) != 0:
+            le = b.Not(b.And(bit, b.Not(le)))
+        case le < 0:
+            le = b.Not(bit)
+        default:
+            le = b.And(b.Not(bit), le)
+        }
+    }
+    if le < 0 {
+        return b.Const(true)
+    }
+    return le
+}
+
+// Build a circuit on two width-bit inputs "x" and "y" whose one-bit output
+// "match" is set iff their Hamming distance is at most threshold, as for
+// fuzzy matching of biometric codes. Returns nil if width is not between 1
+// and MAX_COUNT_WIDTH or threshold is not between 0 and width.
+func BuildThreshold(width int, threshold int) *Circuit {
+    if width < 1 || width > MAX_COUNT_WIDTH || threshold < 0 || threshold > width {
+        return nil
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", width)
+    y := b.Input("y", width)
+    match := b.atMost(b.hammingDistance(x, y), uint64(threshold))
+    circ, err := b.Output("match", match).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
+
+// Build a substitution box from a table of 256 bytes, such as the AES
+// S-box, mapping the 8-bit input variable "in" to the 8-bit output "out" =
+// table[in]. Each output bit is one 8-input LUT gate, so the circuit is
+// tiny but needs a backend that handles LUTs (or LowerPreservingXOR to
+// expand them). Returns nil unless the table has exactly 256 entries.
+func BuildSBox(table []byte) *Circuit {
+    if len(table) != 256 {
+        return nil
+    }
+
+    b := NewBuilder()
+    in := b.Input("in", 8)
+    out := make([]Wire, 8)
+    for i := range out {
+        column := make([]bool, len(table))
+        for k, v := range table {
+            column[k] = v & (1 << i) != 0
+        }
+        out[i] = b.LUT(in, column)
+    }
+
+    circ, err := b.Output("out", out...).Build()
+    if err != nil {
+        return nil
+    }
+    return circ
+}
@@ -0,0 +1,288 @@
+package toygarble
+
+import (
+    "math/bits"
+    "math/rand"
+    "testing"
+)
+
+func TestBuildDecoder(t *testing.T) {
+    for width := 1; width <= 6; width++ {
+        circ := BuildDecoder(width)
+        if circ == nil {
+            t.Fatalf("no decoder for width %d", width)
+        }
+        if circ.NumWiresOV[0] != 1 << width {
+            t.Fatalf("width %d: %d lines", width, circ.NumWiresOV[0])
+        }
+        for addr := 0; addr < 1 << width; addr++ {
+            in := make([]bool, width)
+            for j := range in {
+                in[j] = addr >> j & 1 == 1
+            }
+            ok, lines := circ.EvaluateCircuit(in)
+            if !ok {
+                t.Fatalf("width %d: evaluation failed", width)
+            }
+            for k, line := range lines {
+                if line != (k == addr) {
+                    t.Fatalf("width %d, address %d: line %d is %t", width, addr, k, line)
+                }
+            }
+        }
+    }
+
+    for _, width := range []int{0, -1, MAX_ADDRESS_WIDTH + 1} {
+        if BuildDecoder(width) != nil {
+            t.Errorf("built a decoder of width %d", width)
+        }
+    }
+}
+
+// Five three-bit words need a three-bit address; the last three addresses
+// are past the end and read as zero
+func TestBuildROM(t *testing.T) {
+    words := []int64{5, 0, 7, 3, 1}
+    contents := make([][]bool, len(words))
+    for k, v := range words {
+        contents[k] = []bool{v & 1 == 1, v & 2 == 2, v & 4 == 4}
+    }
+    circ := BuildROM(contents)
+    if circ == nil {
+        t.Fatal("no ROM built")
+    }
+    if circ.NumWiresIV[0] != 3 || circ.NumWiresOV[0] != 3 {
+        t.Fatalf("layout %v -> %v, want [3] -> [3]", circ.NumWiresIV, circ.NumWiresOV)
+    }
+    for addr := int64(0); addr < 8; addr++ {
+        out, err := circ.EvaluateInts([]int64{addr}, []int{3})
+        if err != nil {
+            t.Fatal(err)
+        }
+        want := int64(0)
+        if addr < int64(len(words)) {
+            want = words[addr]
+        }
+        if out[0] != want {
+            t.Errorf("address %d holds %d, want %d", addr, out[0], want)
+        }
+    }
+
+    // A one-word table still takes a one-bit address
+    single := BuildROM([][]bool{{true, false}})
+    if single == nil || single.NumWiresIV[0] != 1 {
+        t.Fatal("bad one-word ROM")
+    }
+    if out, err := single.EvaluateInts([]int64{0}, []int{1}); err != nil || out[0] != 1 {
+        t.Errorf("one-word ROM reads %v, %v", out, err)
+    }
+
+    for name, contents := range map[string][][]bool{
+        "empty":        nil,
+        "zero width":   {{}},
+        "ragged":       {{true}, {true, false}},
+    } {
+        if BuildROM(contents) != nil {
+            t.Errorf("built a ROM from a %s table", name)
+        }
+    }
+}
+
+// Fifty steps of a 16-bit LFSR, against the software version
+func TestBuildLFSR(t *testing.T) {
+    const width = 16
+    taps := []int{0, 2, 3, 5}
+    var mask uint64
+    for _, tap := range taps {
+        mask |= 1 << tap
+    }
+    circ := BuildLFSR(width, taps)
+    if circ == nil {
+        t.Fatal("no circuit")
+    }
+    if circ.NonFreeGateCount() != 0 {
+        t.Errorf("LFSR has %d non-free gates", circ.NonFreeGateCount())
+    }
+    state := uint64(0xACE1)
+    for step := 0; step < 50; step++ {
+        out, err := circ.EvaluateInts([]int64{int64(state)}, []int{width})
+        if err != nil {
+            t.Fatal(err)
+        }
+        state = state >> 1 | uint64(bits.OnesCount64(state & mask) & 1) << (width - 1)
+        if uint64(out[0]) != state {
+            t.Fatalf("step %d: got %#x, want %#x", step, out[0], state)
+        }
+    }
+
+    for _, taps := range [][]int{nil, {1, 1}, {4}, {-1}} {
+        if BuildLFSR(4, taps) != nil {
+            t.Errorf("built an LFSR with taps %v", taps)
+        }
+    }
+}
+
+// CRC-8 with polynomial x^8 + x^2 + x + 1 of "123456789" is 0xF4
+func TestBuildCRCStep(t *testing.T) {
+    circ := BuildCRCStep(8, 0x07)
+    if circ == nil {
+        t.Fatal("no circuit")
+    }
+    crc := int64(0)
+    for _, c := range []byte("123456789") {
+        for i := 7; i >= 0; i-- {
+            out, err := circ.EvaluateInts([]int64{crc, int64(c >> i & 1)}, []int{8, 1})
+            if err != nil {
+                t.Fatal(err)
+            }
+            crc = out[0]
+        }
+    }
+    if crc != 0xF4 {
+        t.Errorf("got CRC %#x, want 0xf4", crc)
+    }
+
+    if BuildCRCStep(64, 0x42F0E1EBA9EA3693) == nil || BuildCRCStep(1, 1) == nil {
+        t.Error("rejected a valid polynomial")
+    }
+    if BuildCRCStep(8, 0x100) != nil || BuildCRCStep(0, 0) != nil {
+        t.Error("built a CRC with a bad width or polynomial")
+    }
+}
+
+func TestBuildHammingDistance(t *testing.T) {
+    rng := rand.New(rand.NewSource(179))
+    for _, width := range []int{1, 2, 3, 5, 8, 13, 32, 63, 64} {
+        hamming := BuildHammingDistance(width)
+        popCount := BuildPopCount(width)
+        if hamming == nil || popCount == nil {
+            t.Fatalf("width %d: no circuit", width)
+        }
+        if hamming.NumOutputWires != bits.Len(uint(width)) || popCount.NumOutputWires != bits.Len(uint(width)) {
+            t.Fatalf("width %d: %d output wires", width, hamming.NumOutputWires)
+        }
+        mask := ^uint64(0) >> (64 - width)
+        for k := 0; k < 100; k++ {
+            x, y := rng.Uint64() & mask, rng.Uint64() & mask
+            switch k {
+            case 0:
+                y = x
+            case 1:
+                y = ^x & mask
+            }
+            in := make([]bool, 2 * width)
+            for i := 0; i < width; i++ {
+                in[i] = x >> i & 1 == 1
+                in[width + i] = y >> i & 1 == 1
+            }
+            _, out := hamming.EvaluateCircuit(in)
+            if got, err := DecodeSigned(append(out, false)); err != nil || int(got) != bits.OnesCount64(x ^ y) {
+                t.Fatalf("width %d: distance from %#x to %#x is %d (%v)", width, x, y, got, err)
+            }
+            _, out = popCount.EvaluateCircuit(in[:width])
+            if got, err := DecodeSigned(append(out, false)); err != nil || int(got) != bits.OnesCount64(x) {
+                t.Fatalf("width %d: population count of %#x is %d (%v)", width, x, got, err)
+            }
+        }
+    }
+    if BuildHammingDistance(0) != nil || BuildPopCount(MAX_COUNT_WIDTH + 1) != nil {
+        t.Error("built a counter of a bad width")
+    }
+}
+
+// Inputs exactly threshold bits apart match, and one bit further don't
+func TestBuildThreshold(t *testing.T) {
+    rng := rand.New(rand.NewSource(180))
+    for _, width := range []int{1, 3, 8, 16} {
+        for threshold := 0; threshold <= width; threshold++ {
+            circ := BuildThreshold(width, threshold)
+            if circ == nil {
+                t.Fatalf("width %d, threshold %d: no circuit", width, threshold)
+            }
+            for _, distance := range []int{0, threshold, threshold + 1, width} {
+                if distance > width {
+                    continue
+                }
+                x := rng.Int63n(1 << width)
+                y := x
+                for _, bit := range rng.Perm(width)[:distance] {
+                    y ^= 1 << bit
+                }
+                out, err := circ.EvaluateInts([]int64{x, y}, []int{width, width})
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if want := distance <= threshold; (out[0] == 1) != want {
+                    t.Errorf("width %d, threshold %d: distance %d gave %d", width, threshold, distance, out[0])
+                }
+            }
+        }
+    }
+    if BuildThreshold(4, 5) != nil || BuildThreshold(4, -1) != nil || BuildThreshold(0, 0) != nil {
+        t.Error("built a threshold circuit with bad parameters")
+    }
+}
+
+// The AES S-box: the inverse in GF(2^8), followed by an affine map
+func aesSBox() []byte {
+    mul := func(a, b byte) byte {
+        var p byte
+        for ; b != 0; b >>= 1 {
+            if b & 1 == 1 {
+                p ^= a
+            }
+            carry := a & 0x80
+            a <<= 1
+            if carry != 0 {
+                a ^= 0x1b
+            }
+        }
+        return p
+    }
+    table := make([]byte, 256)
+    for x := range table {
+        var inv byte
+        for y := 1; y < 256 && x != 0; y++ {
+            if mul(byte(x), byte(y)) == 1 {
+                inv = byte(y)
+                break
+            }
+        }
+        s := inv
+        for i := 1; i <= 4; i++ {
+            s ^= inv << i | inv >> (8 - i)
+        }
+        table[x] = s ^ 0x63
+    }
+    return table
+}
+
+// Every input reproduces the table, before and after lowering the LUTs
+func TestBuildSBox(t *testing.T) {
+    table := aesSBox()
+    if table[0x00] != 0x63 || table[0x53] != 0xed {
+        t.Fatalf("bad reference S-box: %#x %#x", table[0x00], table[0x53])
+    }
+    circ := BuildSBox(table)
+    if circ == nil {
+        t.Fatal("no circuit")
+    }
+    lowered := circ.Clone()
+    if err := lowered.LowerPreservingXOR(); err != nil {
+        t.Fatal(err)
+    }
+    for name, c := range map[string]*Circuit{"LUT": circ, "lowered": lowered} {
+        for v := int64(0); v < 256; v++ {
+            out, err := c.EvaluateInts([]int64{v}, []int{8})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if byte(out[0]) != table[v] {
+                t.Fatalf("%s: S(%#x) = %#x, want %#x", name, v, out[0], table[v])
+            }
+        }
+    }
+    if BuildSBox(table[:255]) != nil || BuildSBox(nil) != nil {
+        t.Error("built an S-box from a short table")
+    }
+}
@@ -0,0 +1,3 @@
+module toygarble
+
+go 1.22
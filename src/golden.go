@@ -0,0 +1,111 @@
+package toygarble
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+)
+
+//
+// Golden files recording a circuit's behavior. Each line holds an input
+// and the output it produced, as strings of 0s and 1s in wire order:
+//
+//     0110 -> 101
+//
+// Blank lines and lines starting with # are ignored.
+//
+
+// Write bits as a string of 0s and 1s
+func bitString(bits []bool) string {
+    s := make([]byte, len(bits))
+    for i, b := range bits {
+        s[i] = '0'
+        if b {
+            s[i] = '1'
+        }
+    }
+    return string(s)
+}
+
+// Parse a string of 0s and 1s
+func parseBits(s string) ([]bool, error) {
+    bits := make([]bool, len(s))
+    for i := range s {
+        switch s[i] {
+        case '0':
+        case '1':
+            bits[i] = true
+        default:
+            return nil, fmt.Errorf("bad bit %q: %w", s[i], ErrMalformed)
+        }
+    }
+    return bits, nil
+}
+
+// Evaluate the circuit on each of the inputs and write the results as a
+// golden file, for CheckGolden to compare against later
+func (circ *Circuit) RecordGolden(inputs [][]bool, w io.Writer) error {
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return err
+    }
+
+    bw := bufio.NewWriter(w)
+    fmt.Fprintf(bw, "# %d input wires -> %d output wires\n", circ.NumInputWires, circ.NumOutputWires)
+    for i, in := range inputs {
+        out, err := e.Evaluate(in)
+        if err != nil {
+            return fmt.Errorf("input %d: %w", i, err)
+        }
+        fmt.Fprintf(bw, "%s -> %s\n", bitString(in), bitString(out))
+    }
+    return bw.Flush()
+}
+
+// Re-evaluate the circuit on every input in a golden file, returning an
+// error describing the first output that differs from the recorded one
+func (circ *Circuit) CheckGolden(r io.Reader) error {
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return err
+    }
+
+    scanner := bufio.NewScanner(r)
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        inField, outField, ok := strings.Cut(line, "->")
+        if !ok {
+            return fmt.Errorf("golden line %d: missing \"->\": %w", lineNo, ErrMalformed)
+        }
+        in, err := parseBits(strings.TrimSpace(inField))
+        if err != nil {
+            return fmt.Errorf("golden line %d: %w", lineNo, err)
+        }
+        want, err := parseBits(strings.TrimSpace(outField))
+        if err != nil {
+            return fmt.Errorf("golden line %d: %w", lineNo, err)
+        }
+        if len(want) != circ.NumOutputWires {
+            return fmt.Errorf("golden line %d has %d output bits, circuit has %d output wires: %w", lineNo, len(want), circ.NumOutputWires, ErrWireCountMismatch)
+        }
+
+        got, err := e.Evaluate(in)
+        if err != nil {
+            return fmt.Errorf("golden line %d: %w", lineNo, err)
+        }
+        for i := range got {
+            if got[i] != want[i] {
+                return fmt.Errorf("golden line %d: input %s gave %s, expected %s (first difference at output wire %d)",
+                    lineNo, bitString(in), bitString(got), bitString(want), i)
+            }
+        }
+    }
+    return scanner.Err()
+}
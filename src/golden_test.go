@@ -0,0 +1,56 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+)
+
+// A golden file recorded from an adder passes against it, and fails once
+// one of its XORs is turned into an OR
+func TestGolden(t *testing.T) {
+    circ := BuildAdder(3)
+    var inputs [][]bool
+    for m := 0; m < 64; m++ {
+        in := make([]bool, 6)
+        for i := range in {
+            in[i] = m >> i & 1 == 1
+        }
+        inputs = append(inputs, in)
+    }
+    var buf bytes.Buffer
+    if err := circ.RecordGolden(inputs, &buf); err != nil {
+        t.Fatal(err)
+    }
+    golden := buf.String()
+    if n := strings.Count(golden, "->"); n != 1 + len(inputs) {
+        t.Errorf("golden file has %d arrows, want a header and %d lines", n, len(inputs))
+    }
+    if err := circ.CheckGolden(strings.NewReader(golden)); err != nil {
+        t.Fatal(err)
+    }
+
+    broken := circ.Clone()
+    for i := range broken.Gates {
+        if broken.Gates[i].GateType == GateXOR {
+            broken.Gates[i].GateType = GateOR
+            break
+        }
+    }
+    if err := broken.CheckGolden(strings.NewReader(golden)); err == nil {
+        t.Error("golden check passed after changing a gate")
+    }
+
+    for _, bad := range []string{"000000 -> 100\n", "000000 000\n", "00x000 -> 000\n", "0000 -> 000\n"} {
+        if err := circ.CheckGolden(strings.NewReader(bad)); err == nil {
+            t.Errorf("golden line %q accepted", bad)
+        }
+    }
+    if err := circ.CheckGolden(strings.NewReader("000000 -> 00\n")); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("short output: %v", err)
+    }
+    if err := circ.RecordGolden([][]bool{{true}}, &buf); err == nil {
+        t.Error("recorded a short input")
+    }
+}
@@ -0,0 +1,123 @@
+package toygarble
+
+import (
+    "bytes"
+    "fmt"
+    "go/format"
+    "go/token"
+    "io"
+    "strings"
+)
+
+//
+// Generation of Go source code implementing a circuit
+//
+
+// Write a Go source file for package pkg with one function, funcName,
+// computing the circuit as straight-line boolean expressions. It takes the
+// input bits as a []bool and returns the output bits, like EvaluateCircuit,
+// or an error if given the wrong number of inputs. Only gates some output
+// depends on are included. The code imports nothing but fmt and is
+// gofmt-clean.
+func (circ *Circuit) GenerateGoSource(pkg string, funcName string, w io.Writer) error {
+    if !token.IsIdentifier(pkg) || !token.IsIdentifier(funcName) {
+        return fmt.Errorf("package %q and function %q must be Go identifiers", pkg, funcName)
+    }
+    if !circ.validCircuit() {
+        return ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return err
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return err
+    }
+
+    roots := make([]int, circ.NumOutputWires)
+    for i := range roots {
+        roots[i] = circ.getOutputGate(i)
+    }
+    live := circ.cone(roots)
+
+    // How each gate's value is referred to
+    ref := make([]string, len(circ.Gates))
+    for g := range ref {
+        ref[g] = fmt.Sprintf("v%d", g)
+    }
+    for i := 0; i < circ.NumInputWires; i++ {
+        ref[circ.getInputGate(i)] = fmt.Sprintf("in[%d]", i)
+    }
+
+    var body bytes.Buffer
+    usesBit := false
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        if !live[g] || gate.GateType == GateINPUT {
+            continue
+        }
+        in := make([]string, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            in[j] = ref[from]
+        }
+
+        var expr string
+        switch gate.GateType {
+        case GateOUTPUT, GateCOPY:
+            expr = in[0]
+        case GateCONST:
+            expr = fmt.Sprintf("%t", gate.ConstVal)
+        case GateNOT:
+            expr = "!" + in[0]
+        case GateAND, GateMULK:
+            expr = fmt.Sprintf("%s && %s", in[0], in[1])
+        case GateOR:
+            expr = fmt.Sprintf("%s || %s", in[0], in[1])
+        case GateXOR, GateCNOT, GateADDK:
+            expr = fmt.Sprintf("%s != %s", in[0], in[1])
+        case GateMUX:
+            expr = fmt.Sprintf("(%s && %s) || (!%s && %s)", in[0], in[2], in[0], in[1])
+        case GateTOFFLI:
+            expr = fmt.Sprintf("%s != (%s && %s)", in[2], in[0], in[1])
+        case GateMAJ:
+            expr = fmt.Sprintf("(%s && %s) || (%s && %s) || (%s && %s)", in[0], in[1], in[0], in[2], in[1], in[2])
+        case GateLUT:
+            usesBit = true
+            table := make([]string, len(gate.TruthTable))
+            for k, b := range gate.TruthTable {
+                table[k] = fmt.Sprintf("%t", b)
+            }
+            address := make([]string, len(in))
+            for j := range in {
+                address[j] = fmt.Sprintf("%sBit(%s)<<%d", funcName, in[j], j)
+            }
+            expr = fmt.Sprintf("[...]bool{%s}[%s]", strings.Join(table, ", "), strings.Join(address, " | "))
+        default:
+            return fmt.Errorf("unknown gate type %d for %d: %w", gate.GateType, g, ErrInvalidGate)
+        }
+        fmt.Fprintf(&body, "%s := %s\n", ref[g], expr)
+    }
+
+    outputs := make([]string, circ.NumOutputWires)
+    for i, root := range roots {
+        outputs[i] = ref[root]
+    }
+
+    var src bytes.Buffer
+    fmt.Fprintf(&src, "// Code generated by toygarble. DO NOT EDIT.\n\npackage %s\n\nimport \"fmt\"\n\n", pkg)
+    fmt.Fprintf(&src, "// %s evaluates a circuit with %d input and %d output bits.\n", funcName, circ.NumInputWires, circ.NumOutputWires)
+    fmt.Fprintf(&src, "func %s(in []bool) ([]bool, error) {\n", funcName)
+    fmt.Fprintf(&src, "if len(in) != %d {\nreturn nil, fmt.Errorf(\"%s: got %%d input bits, want %d\", len(in))\n}\n", circ.NumInputWires, funcName, circ.NumInputWires)
+    src.Write(body.Bytes())
+    fmt.Fprintf(&src, "return []bool{%s}, nil\n}\n", strings.Join(outputs, ", "))
+    if usesBit {
+        fmt.Fprintf(&src, "\nfunc %sBit(b bool) int {\nif b {\nreturn 1\n}\nreturn 0\n}\n", funcName)
+    }
+
+    formatted, err := format.Source(src.Bytes())
+    if err != nil {
+        return fmt.Errorf("formatting generated code: %w", err)
+    }
+    _, err = w.Write(formatted)
+    return err
+}
@@ -0,0 +1,68 @@
+package toygarble
+
+import (
+    "bytes"
+    "fmt"
+    "math/rand"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// Build the generated source for a batch of random circuits into a program
+// in a temporary directory, and check that it prints what EvaluateCircuit
+// computes
+func TestGenerateGoSourceCompiles(t *testing.T) {
+    if _, err := exec.LookPath("go"); err != nil {
+        t.Skip("no go command")
+    }
+    rng := rand.New(rand.NewSource(9))
+    dir := t.TempDir()
+
+    var main, want strings.Builder
+    main.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+    for it := 0; it < 20; it++ {
+        circ, err := randomCircuit(rng, 5, 40, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        name := fmt.Sprintf("F%d", it)
+        var src bytes.Buffer
+        if err := circ.GenerateGoSource("main", name, &src); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(filepath.Join(dir, name + ".go"), src.Bytes(), 0644); err != nil {
+            t.Fatal(err)
+        }
+        for m := 0; m < 32; m++ {
+            in := make([]bool, 5)
+            for i := range in {
+                in[i] = m >> i & 1 == 1
+            }
+            _, out := circ.EvaluateCircuit(in)
+            fmt.Fprintln(&want, out, nil)
+            fmt.Fprintf(&main, "fmt.Println(%s(%#v))\n", name, in)
+        }
+    }
+    // The wrong number of inputs is an error, not a panic
+    main.WriteString("_, err := F0(nil)\nfmt.Println(err)\n}\n")
+    fmt.Fprintln(&want, "F0: got 0 input bits, want 5")
+
+    if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(main.String()), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module gen\n\ngo 1.22\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    cmd := exec.Command("go", "run", ".")
+    cmd.Dir = dir
+    out, err := cmd.CombinedOutput()
+    if err != nil {
+        t.Fatalf("%v\n%s", err, out)
+    }
+    if string(out) != want.String() {
+        t.Errorf("generated code disagrees with EvaluateCircuit\ngot:\n%s\nwant:\n%s", out, want.String())
+    }
+}
@@ -0,0 +1,125 @@
+package toygarble
+
+import (
+    "bufio"
+    "fmt"
+    "html"
+    "io"
+    "sort"
+    "strings"
+)
+
+//
+// Export of circuits as browsable HTML
+//
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Circuit</title>
+<style>
+body { font-family: monospace; }
+ul { list-style: none; padding-left: 1.5em; }
+summary { cursor: pointer; font-weight: bold; }
+:target { background: #ff8; }
+.wire { color: #07a; }
+</style>
+</head>
+<body>
+`
+
+const htmlFooter = `</body>
+</html>
+`
+
+// Describe gate g in one line of HTML, with links to the gates feeding it
+func (circ *Circuit) htmlGate(g int, inputWire map[int]int, outputWires map[int][]int) string {
+    gate := &circ.Gates[g]
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "%d %v", g, gate.GateType)
+
+    switch gate.GateType {
+    case GateINPUT:
+        if w, ok := inputWire[g]; ok {
+            fmt.Fprintf(&sb, ` <span class="wire">input wire %d</span>`, w)
+        }
+    case GateCONST:
+        fmt.Fprintf(&sb, " %t", gate.ConstVal)
+    }
+
+    if len(gate.InFrom) > 0 {
+        links := make([]string, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            links[j] = fmt.Sprintf(`<a href="#g%d">%d</a>`, from, from)
+        }
+        fmt.Fprintf(&sb, "(%s)", strings.Join(links, ", "))
+    }
+    if gate.GateType == GateLUT {
+        fmt.Fprintf(&sb, " table %s", bitString(gate.TruthTable))
+    }
+
+    for _, w := range outputWires[g] {
+        fmt.Fprintf(&sb, ` <span class="wire">output wire %d</span>`, w)
+    }
+    return sb.String()
+}
+
+// Write the circuit as a self-contained HTML page listing every gate, with
+// links from each gate to the gates feeding it. Groups (see Builder.Embed)
+// are shown as collapsible sections, closed to begin with.
+func (circ *Circuit) WriteHTML(w io.Writer) error {
+    if !circ.validCircuit() {
+        return ErrInvalidCircuit
+    }
+
+    inputWire := make(map[int]int)
+    for i := 0; i < circ.NumInputWires; i++ {
+        inputWire[circ.getInputGate(i)] = i
+    }
+    outputWires := make(map[int][]int)
+    for i := 0; i < circ.NumOutputWires; i++ {
+        g := circ.getOutputGate(i)
+        outputWires[g] = append(outputWires[g], i)
+    }
+
+    // The child groups of each group (and of the top level, at index 0),
+    // in order of their first gate
+    children := make([][]int, len(circ.Groups) + 1)
+    for i, group := range circ.Groups {
+        children[group.Parent + 1] = append(children[group.Parent + 1], i)
+    }
+    for _, c := range children {
+        sort.SliceStable(c, func(a, b int) bool { return circ.Groups[c[a]].Start < circ.Groups[c[b]].Start })
+    }
+
+    bw := bufio.NewWriter(w)
+    bw.WriteString(htmlHeader)
+    fmt.Fprintf(bw, "<h1>Circuit</h1>\n<p>%d gates, %d input wires, %d output wires</p>\n",
+        len(circ.Gates), circ.NumInputWires, circ.NumOutputWires)
+
+    // List gates start up to end, with the given child groups nested
+    var list func(start int, end int, groups []int)
+    list = func(start int, end int, groups []int) {
+        bw.WriteString("<ul>\n")
+        g := start
+        for _, i := range groups {
+            group := circ.Groups[i]
+            for ; g < group.Start; g++ {
+                fmt.Fprintf(bw, "<li id=\"g%d\">%s</li>\n", g, circ.htmlGate(g, inputWire, outputWires))
+            }
+            fmt.Fprintf(bw, "<li><details><summary>%s (%d gates)</summary>\n", html.EscapeString(group.Name), group.End - group.Start)
+            list(group.Start, group.End, children[i + 1])
+            bw.WriteString("</details></li>\n")
+            g = max(g, group.End)
+        }
+        for ; g < end; g++ {
+            fmt.Fprintf(bw, "<li id=\"g%d\">%s</li>\n", g, circ.htmlGate(g, inputWire, outputWires))
+        }
+        bw.WriteString("</ul>\n")
+    }
+    list(0, len(circ.Gates), children[0])
+
+    bw.WriteString(htmlFooter)
+    return bw.Flush()
+}
@@ -0,0 +1,59 @@
+package toygarble
+
+import (
+    "bytes"
+    "encoding/xml"
+    "io"
+    "strings"
+    "testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+    circ := buildNestedAdders(t)
+    var buf bytes.Buffer
+    if err := circ.WriteHTML(&buf); err != nil {
+        t.Fatal(err)
+    }
+    page := buf.String()
+    if !strings.HasPrefix(page, "<!DOCTYPE html>") {
+        t.Fatalf("page starts %q", page[:min(len(page), 40)])
+    }
+
+    // Every element is closed and nested properly
+    dec := xml.NewDecoder(strings.NewReader(strings.TrimPrefix(page, "<!DOCTYPE html>")))
+    dec.Strict = false
+    dec.AutoClose = xml.HTMLAutoClose
+    dec.Entity = xml.HTMLEntity
+    depth := 0
+    for {
+        tok, err := dec.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            t.Fatalf("malformed HTML: %v", err)
+        }
+        switch tok.(type) {
+        case xml.StartElement:
+            depth++
+        case xml.EndElement:
+            depth--
+        }
+    }
+    if depth != 0 {
+        t.Errorf("%d elements left open", depth)
+    }
+
+    // One list entry per gate, and a collapsible section per group
+    if n := strings.Count(page, "<li id=\"g"); n != len(circ.Gates) {
+        t.Errorf("%d gates listed, want %d", n, len(circ.Gates))
+    }
+    if n := strings.Count(page, "<details>"); n != len(circ.Groups) {
+        t.Errorf("%d collapsible sections, want %d", n, len(circ.Groups))
+    }
+    for _, name := range []string{"sum3", "add1", "add2"} {
+        if !strings.Contains(page, "<summary>" + name + " (") {
+            t.Errorf("no section for group %s", name)
+        }
+    }
+}
@@ -0,0 +1,564 @@
+package toygarble
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+)
+
+//
+// JSON export and import, in the package's own schema or that of other
+// tools
+//
+
+const (
+    // The package's own schema, holding everything in the binary format
+    JSON_SCHEMA_NATIVE  string = "native"
+
+    // The netlist format of Yosys's write_json, as a single module using
+    // its internal gate cells ($_AND_, $_OR_, $_XOR_, $_NOT_, $_MUX_ and
+    // $_BUF_). Only circuits built from gates those can express are
+    // supported; wire numbers are not preserved.
+    JSON_SCHEMA_YOSYS   string = "yosys"
+)
+
+// Write the circuit as JSON in the given schema (JSON_SCHEMA_NATIVE or
+// JSON_SCHEMA_YOSYS)
+func (circ *Circuit) WriteGenericJSON(w io.Writer, schema string) error {
+    if !circ.validCircuit() {
+        return ErrInvalidCircuit
+    }
+
+    var doc any
+    var err error
+    switch schema {
+    case JSON_SCHEMA_NATIVE:
+        doc = circ.toNativeJSON()
+    case JSON_SCHEMA_YOSYS:
+        doc, err = circ.toYosysJSON()
+    default:
+        return fmt.Errorf("unknown JSON schema %q", schema)
+    }
+    if err != nil {
+        return err
+    }
+
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(doc)
+}
+
+// Read a circuit written as JSON in the given schema, checking it against
+// DefaultLimits and validating its structure
+func ReadGenericJSON(r io.Reader, schema string) (*Circuit, error) {
+    return ReadGenericJSONWith(r, schema, DefaultLimits)
+}
+
+// Like ReadGenericJSON, but checking the circuit against the given limits
+func ReadGenericJSONWith(r io.Reader, schema string, limits Limits) (*Circuit, error) {
+    var circ *Circuit
+    var err error
+    switch schema {
+    case JSON_SCHEMA_NATIVE:
+        var doc nativeJSON
+        if err := json.NewDecoder(r).Decode(&doc); err != nil {
+            return nil, fmt.Errorf("%v: %w", err, ErrMalformed)
+        }
+        circ, err = doc.circuit(limits)
+    case JSON_SCHEMA_YOSYS:
+        var doc yosysJSON
+        if err := json.NewDecoder(r).Decode(&doc); err != nil {
+            return nil, fmt.Errorf("%v: %w", err, ErrMalformed)
+        }
+        circ, err = doc.circuit(limits)
+    default:
+        return nil, fmt.Errorf("unknown JSON schema %q", schema)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if err := limits.Check(circ); err != nil {
+        return nil, err
+    }
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    return circ, nil
+}
+
+// Look up a gate type by its printable name
+func gateTypeByName(name string) (GateType_t, bool) {
+    for t, n := range gate_type_names {
+        if n == name {
+            return GateType_t(t), true
+        }
+    }
+    return 0, false
+}
+
+//
+// Native schema
+//
+
+type nativeJSONVariable struct {
+    Name        string          `json:"name,omitempty"`
+    Width       int             `json:"width"`
+}
+
+type nativeJSONGate struct {
+    Type        string          `json:"type"`
+    In          []int           `json:"in,omitempty"`
+    Value       bool            `json:"value,omitempty"`
+
+    // LUT truth table, as a string of 0s and 1s
+    Table       string          `json:"table,omitempty"`
+
+    // Where the gate came from, if known (see SetGateSource)
+    Source      string          `json:"source,omitempty"`
+}
+
+type nativeJSON struct {
+    Inputs      []nativeJSONVariable    `json:"inputs"`
+    Outputs     []nativeJSONVariable    `json:"outputs"`
+    InputParty  []int                   `json:"input_party,omitempty"`
+    InputGates  []int                   `json:"input_gates,omitempty"`
+    OutputGates []int                   `json:"output_gates,omitempty"`
+    WireDomain  int                     `json:"wire_domain,omitempty"`
+    Groups      []GateGroup             `json:"groups,omitempty"`
+    Assertions  []Assertion             `json:"assertions,omitempty"`
+    Gates       []nativeJSONGate        `json:"gates"`
+}
+
+// Describe variables by width, with their names if they have them
+func nativeJSONVariables(widths []int, names []string) []nativeJSONVariable {
+    vars := make([]nativeJSONVariable, len(widths))
+    for i, width := range widths {
+        vars[i].Width = width
+        if len(names) == len(widths) {
+            vars[i].Name = names[i]
+        }
+    }
+    return vars
+}
+
+func (circ *Circuit) toNativeJSON() *nativeJSON {
+    doc := &nativeJSON{
+        Inputs:         nativeJSONVariables(circ.NumWiresIV, circ.InputVarNames),
+        Outputs:        nativeJSONVariables(circ.NumWiresOV, circ.OutputVarNames),
+        InputParty:     circ.InputParty,
+        InputGates:     circ.InputGates,
+        OutputGates:    circ.OutputGates,
+        WireDomain:     circ.WireDomain,
+        Groups:         circ.Groups,
+        Assertions:     circ.Assertions,
+        Gates:          make([]nativeJSONGate, len(circ.Gates)),
+    }
+    for i := range circ.Gates {
+        gate := &circ.Gates[i]
+        doc.Gates[i] = nativeJSONGate{Type: gate.GateType.String(), In: gate.InFrom, Value: gate.ConstVal, Source: circ.sourceLoc(i)}
+        if gate.GateType == GateLUT {
+            doc.Gates[i].Table = bitString(gate.TruthTable)
+        }
+    }
+    return doc
+}
+
+// Split variables into their widths and names, leaving the names nil if
+// none are given
+func nativeJSONLayout(vars []nativeJSONVariable) (int, []int, []string) {
+    total := 0
+    widths := make([]int, len(vars))
+    names := make([]string, len(vars))
+    named := false
+    for i, v := range vars {
+        total += v.Width
+        widths[i] = v.Width
+        names[i] = v.Name
+        named = named || v.Name != ""
+    }
+    if !named {
+        names = nil
+    }
+    return total, widths, names
+}
+
+func (doc *nativeJSON) circuit(limits Limits) (*Circuit, error) {
+    circ := &Circuit{
+        InputParty:     doc.InputParty,
+        InputGates:     doc.InputGates,
+        OutputGates:    doc.OutputGates,
+        WireDomain:     doc.WireDomain,
+        Groups:         doc.Groups,
+        Assertions:     doc.Assertions,
+        Gates:          make([]Gate, len(doc.Gates)),
+    }
+    circ.useLimits(limits)
+    circ.NumInputWires, circ.NumWiresIV, circ.InputVarNames = nativeJSONLayout(doc.Inputs)
+    circ.NumOutputWires, circ.NumWiresOV, circ.OutputVarNames = nativeJSONLayout(doc.Outputs)
+    circ.NumInputVars = len(circ.NumWiresIV)
+    circ.NumOutputVars = len(circ.NumWiresOV)
+    for _, width := range append(circ.NumWiresIV, circ.NumWiresOV...) {
+        if width < 1 {
+            return nil, fmt.Errorf("variable of width %d: %w", width, ErrMalformed)
+        }
+    }
+
+    for i, g := range doc.Gates {
+        gateType, ok := gateTypeByName(g.Type)
+        if !ok {
+            return nil, fmt.Errorf("gate %d has unknown type %q: %w", i, g.Type, ErrMalformed)
+        }
+        for _, from := range g.In {
+            if from < 0 || from >= len(doc.Gates) {
+                return nil, fmt.Errorf("gate %d has input from nonexistent gate %d: %w", i, from, ErrMalformed)
+            }
+        }
+        circ.Gates[i] = Gate{GateType: gateType, ConstVal: g.Value, InFrom: g.In}
+        if gateType == GateLUT {
+            table, err := parseBits(g.Table)
+            if err != nil {
+                return nil, fmt.Errorf("gate %d: %w", i, err)
+            }
+            circ.Gates[i].TruthTable = table
+        }
+        if g.Source != "" {
+            circ.SetGateSource(i, g.Source)
+        }
+    }
+    return circ, nil
+}
+
+//
+// Yosys schema
+//
+
+type yosysJSONPort struct {
+    Direction   string          `json:"direction"`
+    Bits        []any           `json:"bits"`
+}
+
+type yosysJSONCell struct {
+    Type            string              `json:"type"`
+    PortDirections  map[string]string   `json:"port_directions,omitempty"`
+    Connections     map[string][]any    `json:"connections"`
+}
+
+type yosysJSONModule struct {
+    // Ports in declaration order, which map decoding would lose
+    Ports       orderedJSONObject[yosysJSONPort]    `json:"ports"`
+    Cells       map[string]yosysJSONCell            `json:"cells"`
+}
+
+type yosysJSON struct {
+    Creator     string                      `json:"creator,omitempty"`
+    Modules     map[string]yosysJSONModule  `json:"modules"`
+}
+
+// A JSON object whose key order matters
+type orderedJSONObject[T any] struct {
+    Keys        []string
+    Values      map[string]T
+}
+
+func (o orderedJSONObject[T]) MarshalJSON() ([]byte, error) {
+    var buf bytes.Buffer
+    buf.WriteByte('{')
+    for i, key := range o.Keys {
+        if i > 0 {
+            buf.WriteByte(',')
+        }
+        k, err := json.Marshal(key)
+        if err != nil {
+            return nil, err
+        }
+        v, err := json.Marshal(o.Values[key])
+        if err != nil {
+            return nil, err
+        }
+        buf.Write(k)
+        buf.WriteByte(':')
+        buf.Write(v)
+    }
+    buf.WriteByte('}')
+    return buf.Bytes(), nil
+}
+
+func (o *orderedJSONObject[T]) UnmarshalJSON(data []byte) error {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+        return fmt.Errorf("expected a JSON object")
+    }
+    o.Keys = nil
+    o.Values = make(map[string]T)
+    for dec.More() {
+        tok, err := dec.Token()
+        if err != nil {
+            return err
+        }
+        key := tok.(string)
+        var v T
+        if err := dec.Decode(&v); err != nil {
+            return err
+        }
+        if _, ok := o.Values[key]; !ok {
+            o.Keys = append(o.Keys, key)
+        }
+        o.Values[key] = v
+    }
+    _, err := dec.Token()
+    return err
+}
+
+// Yosys cell types for the gates that have one, with the ports their
+// inputs connect to
+var yosysCells = map[GateType_t]struct {
+    cell    string
+    ports   []string
+}{
+    GateCOPY:   {"$_BUF_", []string{"A"}},
+    GateNOT:    {"$_NOT_", []string{"A"}},
+    GateAND:    {"$_AND_", []string{"A", "B"}},
+    GateOR:     {"$_OR_", []string{"A", "B"}},
+    GateXOR:    {"$_XOR_", []string{"A", "B"}},
+    GateMUX:    {"$_MUX_", []string{"S", "A", "B"}},
+}
+
+// Port names for the variables, taken from their names or numbered with
+// the given prefix
+func yosysPortNames(names []string, numVars int, prefix string) []string {
+    ports := make([]string, numVars)
+    for v := range ports {
+        if len(names) == numVars && names[v] != "" {
+            ports[v] = names[v]
+        } else {
+            ports[v] = fmt.Sprintf("%s%d", prefix, v)
+        }
+    }
+    return ports
+}
+
+func (circ *Circuit) toYosysJSON() (*yosysJSON, error) {
+    if err := circ.requireBoolean(); err != nil {
+        return nil, err
+    }
+
+    // Yosys numbers signals from 2, with 0 and 1 written as strings.
+    // OUTPUT gates are just the signal they pass on.
+    bit := func(g int) any {
+        if driver, ok := circ.outputDriver(g); ok {
+            g = driver
+        }
+        if circ.Gates[g].GateType == GateCONST {
+            if circ.Gates[g].ConstVal {
+                return "1"
+            }
+            return "0"
+        }
+        return g + 2
+    }
+
+    module := yosysJSONModule{
+        Ports:  orderedJSONObject[yosysJSONPort]{Values: make(map[string]yosysJSONPort)},
+        Cells:  make(map[string]yosysJSONCell),
+    }
+    addPorts := func(names []string, widths []int, direction string, gate func(int) int) error {
+        w := 0
+        for v, name := range names {
+            if _, ok := module.Ports.Values[name]; ok {
+                return fmt.Errorf("port name %q used twice", name)
+            }
+            port := yosysJSONPort{Direction: direction}
+            for j := 0; j < widths[v]; j++ {
+                port.Bits = append(port.Bits, bit(gate(w)))
+                w++
+            }
+            module.Ports.Keys = append(module.Ports.Keys, name)
+            module.Ports.Values[name] = port
+        }
+        return nil
+    }
+    if err := addPorts(yosysPortNames(circ.InputVarNames, circ.NumInputVars, "in"), circ.NumWiresIV, "input", circ.getInputGate); err != nil {
+        return nil, err
+    }
+    if err := addPorts(yosysPortNames(circ.OutputVarNames, circ.NumOutputVars, "out"), circ.NumWiresOV, "output", circ.getOutputGate); err != nil {
+        return nil, err
+    }
+
+    for g := range circ.Gates {
+        gate := &circ.Gates[g]
+        switch gate.GateType {
+        case GateINPUT, GateOUTPUT, GateCONST:
+            continue
+        }
+        gateType := gate.GateType
+        switch gateType {
+        case GateCNOT, GateADDK:
+            gateType = GateXOR
+        case GateMULK:
+            gateType = GateAND
+        }
+        yc, ok := yosysCells[gateType]
+        if !ok {
+            return nil, fmt.Errorf("gate %d is a %v gate, which has no Yosys cell: %w", g, gate.GateType, ErrInvalidGate)
+        }
+
+        cell := yosysJSONCell{Type: yc.cell, PortDirections: map[string]string{"Y": "output"}, Connections: map[string][]any{"Y": {g + 2}}}
+        for j, port := range yc.ports {
+            cell.PortDirections[port] = "input"
+            cell.Connections[port] = []any{bit(gate.InFrom[j])}
+        }
+        module.Cells[fmt.Sprintf("$g%d", g)] = cell
+    }
+
+    return &yosysJSON{Creator: "toygarble", Modules: map[string]yosysJSONModule{"circuit": module}}, nil
+}
+
+func (doc *yosysJSON) circuit(limits Limits) (*Circuit, error) {
+    if len(doc.Modules) != 1 {
+        return nil, fmt.Errorf("expected one module, found %d: %w", len(doc.Modules), ErrMalformed)
+    }
+    var module yosysJSONModule
+    for _, m := range doc.Modules {
+        module = m
+    }
+
+    // The gate types of the cells, and the cell driving each signal
+    cellTypes := make(map[string]GateType_t)
+    for gateType, yc := range yosysCells {
+        cellTypes[yc.cell] = gateType
+    }
+    driver := make(map[int]string)
+    for name, cell := range module.Cells {
+        if _, ok := cellTypes[cell.Type]; !ok {
+            return nil, fmt.Errorf("cell %s has unsupported type %s: %w", name, cell.Type, ErrInvalidGate)
+        }
+        y := cell.Connections["Y"]
+        if len(y) != 1 {
+            return nil, fmt.Errorf("cell %s has %d output bits: %w", name, len(y), ErrMalformed)
+        }
+        s, ok := y[0].(float64)
+        if !ok {
+            return nil, fmt.Errorf("cell %s drives a constant: %w", name, ErrMalformed)
+        }
+        if _, ok := driver[int(s)]; ok {
+            return nil, fmt.Errorf("signal %d has more than one driver: %w", int(s), ErrMalformed)
+        }
+        driver[int(s)] = name
+    }
+
+    var inNames, outNames []string
+    var inWidths, outWidths []int
+    numInputs, numOutputs := 0, 0
+    for _, name := range module.Ports.Keys {
+        port := module.Ports.Values[name]
+        switch port.Direction {
+        case "input":
+            inNames = append(inNames, name)
+            inWidths = append(inWidths, len(port.Bits))
+            numInputs += len(port.Bits)
+        case "output":
+            outNames = append(outNames, name)
+            outWidths = append(outWidths, len(port.Bits))
+            numOutputs += len(port.Bits)
+        default:
+            return nil, fmt.Errorf("port %s has unsupported direction %q: %w", name, port.Direction, ErrMalformed)
+        }
+        if len(port.Bits) == 0 {
+            return nil, fmt.Errorf("port %s has no bits: %w", name, ErrMalformed)
+        }
+    }
+
+    circ := &Circuit{}
+    circ.useLimits(limits)
+    if err := circ.initializeCircuit(numInputs, numOutputs, len(inNames), len(outNames), inWidths, outWidths); err != nil {
+        return nil, err
+    }
+    circ.InputVarNames = inNames
+    circ.OutputVarNames = outNames
+
+    gateOf := make(map[int]int)
+    w := 0
+    for _, name := range inNames {
+        for _, b := range module.Ports.Values[name].Bits {
+            s, ok := b.(float64)
+            if !ok {
+                return nil, fmt.Errorf("input port %s has a constant bit: %w", name, ErrMalformed)
+            }
+            if _, ok := gateOf[int(s)]; ok {
+                return nil, fmt.Errorf("signal %d is used by two input wires: %w", int(s), ErrMalformed)
+            }
+            gateOf[int(s)] = circ.getInputGate(w)
+            w++
+        }
+    }
+
+    // Find or create the gate for a signal, adding the cells it depends on
+    // first
+    constGate := map[bool]int{}
+    visiting := make(map[int]bool)
+    var gateFor func(b any) (int, error)
+    gateFor = func(b any) (int, error) {
+        if s, ok := b.(string); ok {
+            if s != "0" && s != "1" {
+                return -1, fmt.Errorf("unsupported signal value %q: %w", s, ErrMalformed)
+            }
+            v := s == "1"
+            if _, ok := constGate[v]; !ok {
+                constGate[v] = circ.addGate(GateCONST, v, nil)
+            }
+            return constGate[v], nil
+        }
+        f, ok := b.(float64)
+        if !ok {
+            return -1, fmt.Errorf("bad signal %v: %w", b, ErrMalformed)
+        }
+        s := int(f)
+        if g, ok := gateOf[s]; ok {
+            return g, nil
+        }
+        name, ok := driver[s]
+        if !ok {
+            return -1, fmt.Errorf("signal %d has no driver: %w", s, ErrMalformed)
+        }
+        if visiting[s] {
+            return -1, fmt.Errorf("signal %d depends on itself: %w", s, ErrCycle)
+        }
+        visiting[s] = true
+
+        cell := module.Cells[name]
+        gateType := cellTypes[cell.Type]
+        inFrom := make([]int, 0, 3)
+        for _, port := range yosysCells[gateType].ports {
+            bits := cell.Connections[port]
+            if len(bits) != 1 {
+                return -1, fmt.Errorf("cell %s port %s has %d bits: %w", name, port, len(bits), ErrMalformed)
+            }
+            g, err := gateFor(bits[0])
+            if err != nil {
+                return -1, err
+            }
+            inFrom = append(inFrom, g)
+        }
+        g := circ.addGate(gateType, false, inFrom)
+        if g < 0 {
+            return -1, fmt.Errorf("could not add gate for cell %s", name)
+        }
+        gateOf[s] = g
+        return g, nil
+    }
+
+    o := 0
+    for _, name := range outNames {
+        for _, b := range module.Ports.Values[name].Bits {
+            g, err := gateFor(b)
+            if err != nil {
+                return nil, err
+            }
+            circ.connectOutputWire(g, o)
+            o++
+        }
+    }
+    return circ, nil
+}
@@ -0,0 +1,95 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "math/rand"
+    "slices"
+    "strings"
+    "testing"
+)
+
+func jsonRoundTrip(t *testing.T, circ *Circuit, schema string) *Circuit {
+    t.Helper()
+    var buf bytes.Buffer
+    if err := circ.WriteGenericJSON(&buf, schema); err != nil {
+        t.Fatal(err)
+    }
+    read, err := ReadGenericJSON(&buf, schema)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return read
+}
+
+func TestJSONNativeRoundTrip(t *testing.T) {
+    circ := BuildSaturatingAdder(4)
+    if err := circ.SetInputParty([]int{PARTY_GARBLER, PARTY_EVALUATOR}); err != nil {
+        t.Fatal(err)
+    }
+    if !jsonRoundTrip(t, circ, JSON_SCHEMA_NATIVE).Equal(circ) {
+        t.Error("saturating adder changed")
+    }
+
+    rng := rand.New(rand.NewSource(168))
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 5, 30, 3)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !jsonRoundTrip(t, circ, JSON_SCHEMA_NATIVE).Equal(circ) {
+            t.Fatalf("random circuit %d changed", it)
+        }
+    }
+}
+
+// A Yosys netlist loses the gate layout but keeps the ports and what the
+// circuit computes
+func TestJSONYosysRoundTrip(t *testing.T) {
+    circ := BuildSaturatingAdder(4)
+    read := jsonRoundTrip(t, circ, JSON_SCHEMA_YOSYS)
+    if !slices.Equal(read.InputVarNames, circ.InputVarNames) || !slices.Equal(read.OutputVarNames, circ.OutputVarNames) {
+        t.Errorf("ports %v -> %v became %v -> %v", circ.InputVarNames, circ.OutputVarNames, read.InputVarNames, read.OutputVarNames)
+    }
+    for m := 0; m < 256; m++ {
+        in := make([]bool, 8)
+        for i := range in {
+            in[i] = m >> i & 1 == 1
+        }
+        _, want := circ.EvaluateCircuit(in)
+        if ok, got := read.EvaluateCircuit(in); !ok || !slices.Equal(got, want) {
+            t.Fatalf("input %08b: got %v, want %v", m, got, want)
+        }
+    }
+
+    var buf bytes.Buffer
+    if err := circ.WriteGenericJSON(&buf, JSON_SCHEMA_YOSYS); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(buf.String(), `"$_AND_"`) {
+        t.Error("no $_AND_ cells in the netlist")
+    }
+}
+
+func TestJSONErrors(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    maj, err := b.Output("out", b.Maj(x[0], x[1], x[2])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := maj.WriteGenericJSON(&bytes.Buffer{}, JSON_SCHEMA_YOSYS); !errors.Is(err, ErrInvalidGate) {
+        t.Errorf("MAJ in a Yosys netlist: %v", err)
+    }
+    if err := maj.WriteGenericJSON(&bytes.Buffer{}, "scapi"); err == nil {
+        t.Error("unknown schema accepted for writing")
+    }
+    if _, err := ReadGenericJSON(strings.NewReader("{}"), "scapi"); err == nil {
+        t.Error("unknown schema accepted for reading")
+    }
+    for _, schema := range []string{JSON_SCHEMA_NATIVE, JSON_SCHEMA_YOSYS} {
+        if _, err := ReadGenericJSON(strings.NewReader("{"), schema); err == nil {
+            t.Errorf("%s: truncated JSON accepted", schema)
+        }
+    }
+}
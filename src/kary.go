@@ -0,0 +1,132 @@
+package toygarble
+
+import (
+    "fmt"
+    "slices"
+)
+
+//
+// Circuits whose wires carry integers mod k rather than bits
+//
+
+// Gate types allowed when the wire domain is larger than 2. Over the
+// boolean domain ADDK and MULK are just XOR and AND.
+var karyGateTypes = []GateType_t{GateINPUT, GateOUTPUT, GateCONST, GateCOPY, GateADDK, GateMULK}
+
+// The number of values a wire can carry: WireDomain, or 2 if unset
+func (circ *Circuit) domain() int {
+    if circ.WireDomain == 0 {
+        return 2
+    }
+    return circ.WireDomain
+}
+
+// Check the wire domain, and that every gate makes sense over it
+func (circ *Circuit) checkDomain() error {
+    k := circ.domain()
+    if k < 2 {
+        return fmt.Errorf("wire domain must be at least 2, got %d: %w", k, ErrInvalidCircuit)
+    }
+    if k > 2 {
+        for i := range circ.Gates {
+            gateType := circ.Gates[i].GateType
+            if !slices.Contains(karyGateTypes, gateType) {
+                return fmt.Errorf("%s of type %v isn't supported over domain %d: %w", circ.describeGate(i), gateType, k, ErrInvalidGate)
+            }
+        }
+    }
+    return nil
+}
+
+// Fail unless the wires carry bits, for everything that only handles those
+// (the boolean evaluators, lowering and garbling)
+func (circ *Circuit) requireBoolean() error {
+    if k := circ.domain(); k != 2 {
+        return fmt.Errorf("circuit is over domain %d, not boolean", k)
+    }
+    return nil
+}
+
+// Evaluate the circuit on inputs in [0, k), where k is the wire domain,
+// returning the output values. CONST gates give 0 or 1 according to
+// ConstVal. Works for the boolean domain too, with bits as 0 and 1.
+func (circ *Circuit) EvaluateKary(inputs []int) ([]int, error) {
+    k := circ.domain()
+    if len(inputs) != circ.NumInputWires {
+        return nil, fmt.Errorf("got %d inputs, circuit has %d input wires: %w", len(inputs), circ.NumInputWires, ErrWireCountMismatch)
+    }
+    // Checked first to say which gate doesn't fit the domain
+    if err := circ.checkDomain(); err != nil {
+        return nil, err
+    }
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, err
+    }
+
+    for w, v := range inputs {
+        if v < 0 || v >= k {
+            return nil, fmt.Errorf("input %d has value %d outside domain %d: %w", w, v, k, ErrOutOfRange)
+        }
+    }
+
+    // Boolean circuits can use every gate type, so hand them to the
+    // boolean evaluator
+    if k == 2 {
+        inputBits := make([]bool, len(inputs))
+        for w, v := range inputs {
+            inputBits[w] = v == 1
+        }
+        e, err := NewEvaluator(circ)
+        if err != nil {
+            return nil, err
+        }
+        outputBits, err := e.Evaluate(inputBits)
+        if err != nil {
+            return nil, err
+        }
+        result := make([]int, len(outputBits))
+        for i, b := range outputBits {
+            if b {
+                result[i] = 1
+            }
+        }
+        return result, nil
+    }
+
+    values := make([]int, len(circ.Gates))
+    for w, v := range inputs {
+        values[circ.getInputGate(w)] = v
+    }
+
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        in := gate.InFrom
+        switch gate.GateType {
+        case GateINPUT:
+            // Already set above
+        case GateOUTPUT, GateCOPY:
+            values[g] = values[in[0]]
+        case GateCONST:
+            values[g] = 0
+            if gate.ConstVal {
+                values[g] = 1
+            }
+        case GateADDK:
+            values[g] = (values[in[0]] + values[in[1]]) % k
+        case GateMULK:
+            values[g] = (values[in[0]] * values[in[1]]) % k
+        default:
+            return nil, fmt.Errorf("%s of type %v isn't supported over domain %d: %w", circ.describeGate(g), gate.GateType, k, ErrInvalidGate)
+        }
+    }
+
+    result := make([]int, circ.NumOutputWires)
+    for i := range result {
+        result[i] = values[circ.getOutputGate(i)]
+    }
+    return result, nil
+}
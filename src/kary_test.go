@@ -0,0 +1,53 @@
+package toygarble
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestMod3Adder(t *testing.T) {
+    // out = x + y + z mod 3
+    b := NewBuilder().WireDomain(3)
+    x := b.Input("x", 1)
+    y := b.Input("y", 1)
+    z := b.Input("z", 1)
+    circ, err := b.Output("sum", b.AddK(b.AddK(x[0], y[0]), z[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for a := 0; a < 3; a++ {
+        for c := 0; c < 3; c++ {
+            for d := 0; d < 3; d++ {
+                out, err := circ.EvaluateKary([]int{a, c, d})
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if want := (a + c + d) % 3; out[0] != want {
+                    t.Errorf("%d + %d + %d: got %d, want %d", a, c, d, out[0], want)
+                }
+            }
+        }
+    }
+
+    if _, err := circ.EvaluateKary([]int{3, 0, 0}); err == nil {
+        t.Error("value outside the domain accepted")
+    }
+    if _, err := circ.Compile(); err == nil {
+        t.Error("mod-3 circuit compiled as boolean")
+    }
+}
+
+func TestEvaluateKaryBoolean(t *testing.T) {
+    circ := BuildAdder(2)
+    // 3 + 2 = 1 mod 4, least significant wire first
+    out, err := circ.EvaluateKary([]int{1, 1, 0, 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if out[0] != 1 || out[1] != 0 {
+        t.Errorf("got %v, want [1 0]", out)
+    }
+    if _, err := circ.EvaluateKary([]int{1, 1}); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("short input: got %v, want ErrWireCountMismatch", err)
+    }
+}
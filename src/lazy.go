@@ -0,0 +1,229 @@
+package toygarble
+
+import (
+    "bytes"
+    "fmt"
+)
+
+//
+// Binary circuits read on demand, for circuits too large to hold in memory
+//
+
+const (
+    // Gates between the decoding offsets a LazyCircuit keeps, so finding a
+    // gate decodes at most this many
+    LAZY_INDEX_STRIDE   int = 64
+)
+
+// A circuit in the binary format whose gates are decoded only when they are
+// needed, straight from a memory-mapped file. Apart from the mapping it
+// keeps just the header and one offset per LAZY_INDEX_STRIDE gates.
+type LazyCircuit struct {
+    // Everything but the gates: wire counts, variables, layout and so on.
+    // Header.Gates is empty.
+    Header      *Circuit
+    NumGates    int
+
+    data        []byte
+
+    // Offset in data of gates 0, LAZY_INDEX_STRIDE, 2 * LAZY_INDEX_STRIDE...
+    index       []int
+    unmap       func() error
+}
+
+// Map a file written by WriteBinary into memory and index its gates,
+// checking each as ReadBinary would. Close the circuit when done with it.
+func OpenBinaryMapped(path string) (*LazyCircuit, error) {
+    data, unmap, err := mapFile(path)
+    if err != nil {
+        return nil, err
+    }
+    lc, err := newLazyCircuit(data)
+    if err != nil {
+        unmap()
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    lc.unmap = unmap
+    return lc, nil
+}
+
+func newLazyCircuit(data []byte) (*LazyCircuit, error) {
+    r := bytes.NewReader(data)
+    header, numGates, err := readBinaryHeader(r, DefaultLimits)
+    if err != nil {
+        return nil, err
+    }
+    // Each gate takes at least a type byte and an input count
+    if numGates > r.Len() / 2 {
+        return nil, fmt.Errorf("%d gates declared in %d bytes: %w", numGates, r.Len(), ErrMalformed)
+    }
+    if err := header.checkLayout(numGates); err != nil {
+        return nil, err
+    }
+    if err := header.requireBoolean(); err != nil {
+        return nil, err
+    }
+
+    isInput := newPackedBits(numGates)
+    for w := 0; w < header.NumInputWires; w++ {
+        isInput.set(header.getInputGate(w), true)
+    }
+
+    lc := &LazyCircuit{Header: header, NumGates: numGates, data: data}
+    var gate Gate
+    for i := 0; i < numGates; i++ {
+        if i % LAZY_INDEX_STRIDE == 0 {
+            lc.index = append(lc.index, len(data) - r.Len())
+        }
+        if err := readBinaryGate(r, i, numGates, &gate); err != nil {
+            return nil, err
+        }
+        if len(gate.InFrom) < min_input_wires[gate.GateType] || (gate.GateType == GateOUTPUT && len(gate.InFrom) != 1) {
+            return nil, fmt.Errorf("gate %d has %d inputs: %w", i, len(gate.InFrom), ErrInvalidGate)
+        }
+        if isInput.get(i) != (gate.GateType == GateINPUT) {
+            return nil, fmt.Errorf("gate %d of type %v doesn't match the input layout: %w", i, gate.GateType, ErrInvalidCircuit)
+        }
+    }
+    return lc, nil
+}
+
+// Check the parts of validCircuit that don't need the gates, for a
+// circuit with numGates gates
+func (circ *Circuit) checkLayout(numGates int) error {
+    needed := circ.NumInputWires
+    if circ.OutputGates == nil {
+        needed += circ.NumOutputWires
+    }
+    if numGates < needed {
+        return fmt.Errorf("%d gates, too few for %d input and %d output wires: %w", numGates, circ.NumInputWires, circ.NumOutputWires, ErrInvalidCircuit)
+    }
+    if circ.InputGates != nil && circ.OutputGates == nil {
+        // Once inputs move, outputs can't be found by position either
+        return ErrInvalidCircuit
+    }
+    for _, gates := range [][]int{circ.InputGates, circ.OutputGates} {
+        for _, g := range gates {
+            if g >= numGates {
+                return fmt.Errorf("input or output on nonexistent gate %d: %w", g, ErrInvalidCircuit)
+            }
+        }
+    }
+    return nil
+}
+
+// A reader positioned at gate i, which must be a multiple of
+// LAZY_INDEX_STRIDE
+func (lc *LazyCircuit) reader(i int) (*bytes.Reader, error) {
+    if lc.data == nil {
+        return nil, fmt.Errorf("circuit is closed: %w", ErrInvalidCircuit)
+    }
+    if i >= lc.NumGates {
+        return bytes.NewReader(nil), nil
+    }
+    return bytes.NewReader(lc.data[lc.index[i / LAZY_INDEX_STRIDE]:]), nil
+}
+
+// Decode gate i
+func (lc *LazyCircuit) Gate(i int) (Gate, error) {
+    var gate Gate
+    if i < 0 || i >= lc.NumGates {
+        return gate, fmt.Errorf("gate %d out of range (%d gates): %w", i, lc.NumGates, ErrOutOfRange)
+    }
+    first := i / LAZY_INDEX_STRIDE * LAZY_INDEX_STRIDE
+    r, err := lc.reader(first)
+    if err != nil {
+        return gate, err
+    }
+    for g := first; g <= i; g++ {
+        if err := readBinaryGate(r, g, lc.NumGates, &gate); err != nil {
+            return Gate{}, err
+        }
+    }
+    return gate, nil
+}
+
+// Evaluate the circuit on the given input bits, decoding the gates one at
+// a time in order and keeping their values packed, so the whole circuit is
+// never in memory. Every gate must come after the gates it uses, as in
+// circuits from Build or the netlist parsers, except that OUTPUT gates may
+// come before their drivers.
+func (lc *LazyCircuit) Evaluate(inputBits []bool) ([]bool, error) {
+    r, err := lc.reader(0)
+    if err != nil {
+        return nil, err
+    }
+    header := lc.Header
+    if len(inputBits) != header.NumInputWires {
+        return nil, fmt.Errorf("got %d input bits, circuit has %d input wires: %w", len(inputBits), header.NumInputWires, ErrWireCountMismatch)
+    }
+
+    values := newPackedBits(lc.NumGates)
+    done := newPackedBits(lc.NumGates)
+    for w, v := range inputBits {
+        g := header.getInputGate(w)
+        values.set(g, v)
+        done.set(g, true)
+    }
+
+    // OUTPUT gates whose driver comes later, as pairs of gate and driver
+    var deferred [][2]int
+    var gate Gate
+    for i := 0; i < lc.NumGates; i++ {
+        if err := readBinaryGate(r, i, lc.NumGates, &gate); err != nil {
+            return nil, err
+        }
+        if gate.GateType == GateINPUT {
+            continue
+        }
+        if gate.GateType == GateOUTPUT && !done.get(gate.InFrom[0]) {
+            deferred = append(deferred, [2]int{i, gate.InFrom[0]})
+            continue
+        }
+        for _, from := range gate.InFrom {
+            if !done.get(from) {
+                return nil, fmt.Errorf("gate %d uses gate %d before it is computed: %w", i, from, ErrCycle)
+            }
+        }
+        v, err := packedGateOutput(&gate, values)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", lc.Header.describeGate(i), err)
+        }
+        values.set(i, v)
+        done.set(i, true)
+    }
+
+    // Deferred outputs may be chained through one another
+    for len(deferred) > 0 {
+        var waiting [][2]int
+        for _, d := range deferred {
+            if done.get(d[1]) {
+                values.set(d[0], values.get(d[1]))
+                done.set(d[0], true)
+            } else {
+                waiting = append(waiting, d)
+            }
+        }
+        if len(waiting) == len(deferred) {
+            return nil, fmt.Errorf("output gate %d never gets a value: %w", waiting[0][0], ErrCycle)
+        }
+        deferred = waiting
+    }
+
+    result := make([]bool, header.NumOutputWires)
+    for i := range result {
+        result[i] = values.get(header.getOutputGate(i))
+    }
+    return result, nil
+}
+
+// Release the file mapping. Gate and Evaluate fail afterwards.
+func (lc *LazyCircuit) Close() error {
+    lc.data, lc.index = nil, nil
+    if lc.unmap == nil {
+        return nil
+    }
+    unmap := lc.unmap
+    lc.unmap = nil
+    return unmap()
+}
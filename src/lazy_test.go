@@ -0,0 +1,105 @@
+package toygarble
+
+import (
+    "errors"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "slices"
+    "testing"
+)
+
+func openMapped(t *testing.T, circ *Circuit) *LazyCircuit {
+    t.Helper()
+    file := filepath.Join(t.TempDir(), "circuit" + REGISTRY_FILE_EXT)
+    if err := writeBinaryFile(file, circ); err != nil {
+        t.Fatal(err)
+    }
+    lc, err := OpenBinaryMapped(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { lc.Close() })
+    return lc
+}
+
+// A mapped circuit has the same gates as the one in memory and evaluates
+// identically, including when OUTPUT gates come before their drivers
+func TestMappedMatchesInMemory(t *testing.T) {
+    mult, err := LoadBristol("../circuits/mult64.txt")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fused := BuildDivMod(16)
+    fused.FuseOutputs()
+    rng := rand.New(rand.NewSource(178))
+    random, err := randomCircuit(rng, 8, 200, 5)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for name, circ := range map[string]*Circuit{"mult64": mult, "fused divmod": fused, "random": random} {
+        lc := openMapped(t, circ)
+        if lc.NumGates != len(circ.Gates) {
+            t.Fatalf("%s: %d gates mapped, want %d", name, lc.NumGates, len(circ.Gates))
+        }
+        for i := range circ.Gates {
+            gate, err := lc.Gate(i)
+            if err != nil {
+                t.Fatal(err)
+            }
+            want := circ.Gates[i]
+            if gate.GateType != want.GateType || gate.ConstVal != want.ConstVal || !slices.Equal(gate.InFrom, want.InFrom) {
+                t.Fatalf("%s: gate %d is %+v, want %+v", name, i, gate, want)
+            }
+        }
+        for k := 0; k < 10; k++ {
+            in := make([]bool, circ.NumInputWires)
+            for i := range in {
+                in[i] = rng.Intn(2) == 1
+            }
+            _, want := circ.EvaluateCircuit(in)
+            got, err := lc.Evaluate(in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !slices.Equal(got, want) {
+                t.Fatalf("%s: mapped evaluation differs", name)
+            }
+        }
+    }
+}
+
+func TestMappedErrors(t *testing.T) {
+    lc := openMapped(t, BuildAdder(4))
+    if _, err := lc.Gate(-1); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("gate -1: %v", err)
+    }
+    if _, err := lc.Gate(lc.NumGates); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("gate past the end: %v", err)
+    }
+    if _, err := lc.Evaluate(make([]bool, 3)); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("short input: %v", err)
+    }
+    lc.Close()
+    if _, err := lc.Evaluate(make([]bool, 8)); err == nil {
+        t.Error("evaluated a closed circuit")
+    }
+    if _, err := lc.Gate(0); err == nil {
+        t.Error("read a gate from a closed circuit")
+    }
+
+    dir := t.TempDir()
+    for name, data := range map[string][]byte{"empty": nil, "truncated": []byte("TGCB\x07\x01"), "text": []byte("1 2\n")} {
+        file := filepath.Join(dir, name)
+        if err := os.WriteFile(file, data, 0644); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := OpenBinaryMapped(file); err == nil {
+            t.Errorf("%s file opened", name)
+        }
+    }
+    if _, err := OpenBinaryMapped(filepath.Join(dir, "missing")); err == nil {
+        t.Error("missing file opened")
+    }
+}
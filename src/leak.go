@@ -0,0 +1,101 @@
+package toygarble
+
+//
+// Linting outputs that would reveal private inputs
+//
+
+// An output wire flagged by OutputLeakAnalysis. PrivateInputs lists the
+// input wires it depends on, all private; CopyOf is the input wire it
+// carries unchanged (or negated), or -1 if it computes something more.
+type LeakReport struct {
+    OutputWire      int
+    OutputVar       int
+    PrivateInputs   []int
+    CopyOf          int
+}
+
+// Find the output wires that give away private inputs, for checking a
+// circuit before garbling it. An output is flagged if it depends on some
+// input wire and every input wire it depends on belongs to one of the
+// given private input variables, so revealing it tells the other party
+// something about those inputs and nothing else; the worst case, an output
+// that just copies a private input wire, is marked with CopyOf. Outputs
+// that are constant or mix in other inputs aren't flagged. Dependence is
+// structural, so an output that only appears to depend on an input (e.g.
+// x XOR x) still counts. Returns nil if the circuit isn't well formed or a
+// variable index is out of range.
+func (circ *Circuit) OutputLeakAnalysis(privateInputVars []int) []LeakReport {
+    if !circ.validCircuit() ||
+        !validVarWidths(circ.NumWiresIV, circ.NumInputVars, circ.NumInputWires) {
+        return nil
+    }
+
+    // Which input wire each input gate carries, and which are private
+    private := make([]bool, circ.NumInputWires)
+    firstWire := make([]int, circ.NumInputVars + 1)
+    for v, width := range circ.NumWiresIV {
+        firstWire[v + 1] = firstWire[v] + width
+    }
+    for _, v := range privateInputVars {
+        if v < 0 || v >= circ.NumInputVars {
+            return nil
+        }
+        for w := firstWire[v]; w < firstWire[v + 1]; w++ {
+            private[w] = true
+        }
+    }
+    inputWire := make(map[int]int, circ.NumInputWires)
+    for w := 0; w < circ.NumInputWires; w++ {
+        inputWire[circ.getInputGate(w)] = w
+    }
+
+    // The variable of each output wire, if the widths add up
+    outputVar := make([]int, circ.NumOutputWires)
+    for i := range outputVar {
+        outputVar[i] = -1
+    }
+    if validVarWidths(circ.NumWiresOV, circ.NumOutputVars, circ.NumOutputWires) {
+        i := 0
+        for v, width := range circ.NumWiresOV {
+            for j := 0; j < width; j++ {
+                outputVar[i] = v
+                i++
+            }
+        }
+    }
+
+    var reports []LeakReport
+    for i := 0; i < circ.NumOutputWires; i++ {
+        out := circ.getOutputGate(i)
+        inCone := circ.cone([]int{out})
+
+        var inputs []int
+        leaks := true
+        for w := 0; w < circ.NumInputWires; w++ {
+            if inCone[circ.getInputGate(w)] {
+                inputs = append(inputs, w)
+                leaks = leaks && private[w]
+            }
+        }
+        if !leaks || len(inputs) == 0 {
+            continue
+        }
+
+        // Follow the wiring and NOTs back to see if the output is a copy
+        copyOf := -1
+        g := out
+        for {
+            gateType := circ.Gates[g].GateType
+            if gateType != GateOUTPUT && gateType != GateCOPY && gateType != GateNOT {
+                break
+            }
+            g = circ.Gates[g].InFrom[0]
+        }
+        if w, ok := inputWire[g]; ok {
+            copyOf = w
+        }
+
+        reports = append(reports, LeakReport{i, outputVar[i], inputs, copyOf})
+    }
+    return reports
+}
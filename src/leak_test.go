@@ -0,0 +1,40 @@
+package toygarble
+
+import (
+    "slices"
+    "testing"
+)
+
+// With x private, the copy of x[1], the negation of x[0] and their AND all
+// reveal x; the AND with y and the constant don't
+func TestOutputLeakAnalysis(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    y := b.Input("y", 2)
+    circ, err := b.Output("out", x[1], b.Not(x[0]), b.And(x[0], x[1]), b.And(x[0], y[0]), b.Const(true)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    reports := circ.OutputLeakAnalysis([]int{0})
+    want := []LeakReport{
+        {OutputWire: 0, PrivateInputs: []int{1}, CopyOf: 1},
+        {OutputWire: 1, PrivateInputs: []int{0}, CopyOf: 0},
+        {OutputWire: 2, PrivateInputs: []int{0, 1}, CopyOf: -1},
+    }
+    if !slices.EqualFunc(reports, want, func(a, b LeakReport) bool {
+        return a.OutputWire == b.OutputWire && a.OutputVar == b.OutputVar && a.CopyOf == b.CopyOf && slices.Equal(a.PrivateInputs, b.PrivateInputs)
+    }) {
+        t.Errorf("got %+v, want %+v", reports, want)
+    }
+
+    if reports := circ.OutputLeakAnalysis([]int{1}); len(reports) != 0 {
+        t.Errorf("y private: got %+v", reports)
+    }
+    // Everything but the constant depends only on private inputs
+    if reports := circ.OutputLeakAnalysis([]int{0, 1}); len(reports) != 4 {
+        t.Errorf("all private: got %d reports", len(reports))
+    }
+    if circ.OutputLeakAnalysis([]int{5}) != nil {
+        t.Error("analysed a nonexistent variable")
+    }
+}
@@ -0,0 +1,89 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Size limits for circuits built from untrusted descriptions
+//
+
+// Upper bounds on the size of a circuit. Every gate drives exactly one wire,
+// so MaxWires bounds the total length of the gate array (including input and
+// output wires), while MaxGates bounds only the logic gates within it.
+type Limits struct {
+    MaxGates        int
+    MaxWires        int
+    MaxInputWires   int
+}
+
+// The limits used for any circuit that doesn't set its own. These are far
+// larger than any of the reference circuits. They bound the size of a
+// circuit that is actually decoded; a header declaring sizes within them
+// isn't trusted for allocation, as decoders grow their slices as the data
+// arrives (see MAX_PREALLOC).
+var DefaultLimits = Limits {
+    MaxGates:       1 << 26,
+    MaxWires:       1 << 27,
+    MaxInputWires:  1 << 20,
+}
+
+// Most elements a decoder allocates room for up front from a count in a
+// header. Past this, slices grow as the elements are actually read, so a
+// short input declaring a huge circuit fails before it costs much memory.
+const MAX_PREALLOC int = 1 << 12
+
+// Initial capacity for a slice of n elements declared by untrusted input
+func preallocCap(n int) int {
+    return min(n, MAX_PREALLOC)
+}
+
+// Check a proposed circuit size against the limits. Decoders should call this
+// on the sizes declared in a header before reading what follows.
+func (l Limits) checkSize(numGates int, numWires int, numInputWires int) error {
+    if numGates < 0 || numWires < 0 || numInputWires < 0 {
+        return fmt.Errorf("negative circuit size: %w", ErrLimitExceeded)
+    }
+    if numGates > l.MaxGates {
+        return fmt.Errorf("circuit has %d gates, limit is %d: %w", numGates, l.MaxGates, ErrLimitExceeded)
+    }
+    if numWires > l.MaxWires {
+        return fmt.Errorf("circuit has %d wires, limit is %d: %w", numWires, l.MaxWires, ErrLimitExceeded)
+    }
+    if numInputWires > l.MaxInputWires {
+        return fmt.Errorf("circuit has %d input wires, limit is %d: %w", numInputWires, l.MaxInputWires, ErrLimitExceeded)
+    }
+    return nil
+}
+
+// Check an existing circuit against the limits
+func (l Limits) Check(circ *Circuit) error {
+    return l.checkSize(circ.numLogicGates(), len(circ.Gates), circ.NumInputWires)
+}
+
+// The limits in effect for this circuit
+func (circ *Circuit) limits() Limits {
+    if circ.Limits != nil {
+        return *circ.Limits
+    }
+    return DefaultLimits
+}
+
+// Build the circuit under the given limits, as a decoder does when asked
+// for limits other than the defaults. The circuit keeps them, so it can't
+// grow past them later either; Limits stays nil for the defaults.
+func (circ *Circuit) useLimits(limits Limits) {
+    if limits != DefaultLimits {
+        circ.Limits = &limits
+    }
+}
+
+// Number of gates that aren't input or output wires. Once outputs have
+// been fused or inputs declared, any OUTPUT gates not carrying an output
+// are counted too.
+func (circ *Circuit) numLogicGates() int {
+    if circ.OutputGates != nil {
+        return len(circ.Gates) - circ.NumInputWires
+    }
+    return len(circ.Gates) - circ.NumInputWires - circ.NumOutputWires
+}
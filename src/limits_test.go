@@ -0,0 +1,135 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// A Bristol Fashion netlist ANDing n+1 input bits together with a chain
+// of n gates
+func bristolChain(n int) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "%d %d\n1 %d\n1 1\n\n", n, 2 * n + 1, n + 1)
+    acc := 0
+    for k := 0; k < n; k++ {
+        fmt.Fprintf(&b, "2 1 %d %d %d AND\n", acc, k + 1, n + 1 + k)
+        acc = n + 1 + k
+    }
+    return b.String()
+}
+
+// The same chain in EMP's format, with the inputs split between the parties
+func empChain(n int) string {
+    return strings.Replace(bristolChain(n), fmt.Sprintf("1 %d\n1 1\n", n + 1), fmt.Sprintf("%d 0 1\n", n + 1), 1)
+}
+
+func TestParsersRejectJustOverLimit(t *testing.T) {
+    const n = 20
+    circ, err := ParseBristol(strings.NewReader(bristolChain(n)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var binary, native bytes.Buffer
+    if err := circ.WriteBinary(&binary); err != nil {
+        t.Fatal(err)
+    }
+    if err := circ.WriteGenericJSON(&native, JSON_SCHEMA_NATIVE); err != nil {
+        t.Fatal(err)
+    }
+
+    parsers := map[string]func(Limits) (*Circuit, error){
+        "ParseBristolWith": func(l Limits) (*Circuit, error) {
+            return ParseBristolWith(strings.NewReader(bristolChain(n)), l)
+        },
+        "ParseEMPWith": func(l Limits) (*Circuit, error) {
+            return ParseEMPWith(strings.NewReader(empChain(n)), l)
+        },
+        "ReadBinaryWith": func(l Limits) (*Circuit, error) {
+            return ReadBinaryWith(bytes.NewReader(binary.Bytes()), l)
+        },
+        "ReadGenericJSONWith": func(l Limits) (*Circuit, error) {
+            return ReadGenericJSONWith(bytes.NewReader(native.Bytes()), JSON_SCHEMA_NATIVE, l)
+        },
+    }
+    // The chain has n logic gates, 2n+2 gates in all and n+1 input wires
+    exact := Limits{MaxGates: n, MaxWires: 2 * n + 2, MaxInputWires: n + 1}
+    over := map[string]Limits{
+        "gates":        {MaxGates: n - 1, MaxWires: 2 * n + 2, MaxInputWires: n + 1},
+        "wires":        {MaxGates: n, MaxWires: 2 * n + 1, MaxInputWires: n + 1},
+        "input wires":  {MaxGates: n, MaxWires: 2 * n + 2, MaxInputWires: n},
+    }
+    for name, parse := range parsers {
+        got, err := parse(exact)
+        if err != nil {
+            t.Errorf("%s at the limit: %v", name, err)
+        } else if got.Limits == nil || *got.Limits != exact {
+            t.Errorf("%s: circuit has limits %v, want %v", name, got.Limits, exact)
+        }
+        for what, limits := range over {
+            if _, err := parse(limits); !errors.Is(err, ErrLimitExceeded) {
+                t.Errorf("%s one over the limit on %s: got %v, want ErrLimitExceeded", name, what, err)
+            }
+        }
+    }
+
+    // The defaults apply when none are given, and aren't stored
+    if circ.Limits != nil {
+        t.Errorf("circuit parsed with the defaults has limits %v", *circ.Limits)
+    }
+}
+
+// A header declaring the largest circuit the default limits allow, with
+// nothing after it, is rejected without allocating for those sizes
+func TestDecodersBoundAllocation(t *testing.T) {
+    l := DefaultLimits
+    netlist := fmt.Sprintf("%d %d\n", l.MaxGates, l.MaxWires)
+    decoders := map[string]func() (*Circuit, error){
+        "ReadBinary": func() (*Circuit, error) {
+            return ReadBinary(bytes.NewReader(binaryHeader(0, 0, 0, 0, 0, 0, l.MaxGates)))
+        },
+        "ParseEMP": func() (*Circuit, error) {
+            return ParseEMP(strings.NewReader(netlist + "0 0 1\n"))
+        },
+        "ParseBristol": func() (*Circuit, error) {
+            return ParseBristol(strings.NewReader(netlist + "1 1\n1 1\n"))
+        },
+    }
+    for name, decode := range decoders {
+        var err error
+        n := allocatedBytes(func() {
+            _, err = decode()
+        })
+        if err == nil {
+            t.Errorf("%s: decoded an empty circuit body", name)
+        } else if errors.Is(err, ErrLimitExceeded) {
+            t.Errorf("%s: sizes at the limits rejected: %v", name, err)
+        }
+        if n > 1 << 22 {
+            t.Errorf("%s: allocated %d bytes", name, n)
+        }
+    }
+}
+
+func TestAddGatePastLimit(t *testing.T) {
+    limits := Limits{MaxGates: 2, MaxWires: 10, MaxInputWires: 2}
+    circ := &Circuit{Limits: &limits}
+    if err := circ.initializeCircuit(2, 1, 1, 1, []int{2}, []int{1}); err != nil {
+        t.Fatal(err)
+    }
+    a := circ.addGate2(GateAND, 0, 1)
+    b := circ.addGate2(GateXOR, a, 1)
+    if a < 0 || b < 0 {
+        t.Fatal("gates within the limit rejected")
+    }
+    if c := circ.addGate2(GateOR, a, b); c >= 0 {
+        t.Error("third logic gate accepted under a limit of 2")
+    }
+
+    tooMany := Limits{MaxGates: 10, MaxWires: 10, MaxInputWires: 2}
+    if err := (&Circuit{Limits: &tooMany}).initializeCircuit(3, 1, 1, 1, []int{3}, []int{1}); !errors.Is(err, ErrLimitExceeded) {
+        t.Errorf("3 input wires under a limit of 2: got %v, want ErrLimitExceeded", err)
+    }
+}
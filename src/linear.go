@@ -0,0 +1,76 @@
+package toygarble
+
+//
+// Linear (XOR-only) parts of circuits
+//
+
+// Gates that compute an affine function of their inputs over GF(2)
+func isLinearGate(gateType GateType_t) bool {
+    switch gateType {
+    case GateINPUT, GateOUTPUT, GateCOPY, GateCONST, GateNOT, GateXOR, GateCNOT, GateADDK:
+        return true
+    }
+    return false
+}
+
+// Express an output wire as an affine function of the input wires over
+// GF(2), if everything it depends on is XORs, NOTs, copies and constants.
+// The result's first word is the constant term, 0 or 1, and the rest are a
+// bitmask of the input wires XORed in, 64 to a word, least significant
+// first; so a parity output is all of its inputs with constant 0. Returns
+// false if the output's cone contains a nonlinear gate (even one whose
+// effect cancels out), or if the circuit or output wire is invalid.
+func (circ *Circuit) ExtractLinearSystem(outputWire int) ([]uint64, bool) {
+    if outputWire < 0 || outputWire >= circ.NumOutputWires || !circ.validCircuit() {
+        return nil, false
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, false
+    }
+
+    out := circ.getOutputGate(outputWire)
+    inCone := circ.cone([]int{out})
+    inputWire := make(map[int]int, circ.NumInputWires)
+    for w := 0; w < circ.NumInputWires; w++ {
+        inputWire[circ.getInputGate(w)] = w
+    }
+
+    // Each gate in the cone as the same kind of constant-and-mask vector
+    words := 1 + (circ.NumInputWires + 63) / 64
+    forms := make(map[int][]uint64)
+    for _, g := range order {
+        if !inCone[g] {
+            continue
+        }
+        gate := &circ.Gates[g]
+        if !isLinearGate(gate.GateType) {
+            return nil, false
+        }
+
+        form := make([]uint64, words)
+        switch gate.GateType {
+        case GateINPUT:
+            w, ok := inputWire[g]
+            if !ok {
+                return nil, false
+            }
+            form[1 + w / 64] = 1 << (w % 64)
+        case GateCONST:
+            if gate.ConstVal {
+                form[0] = 1
+            }
+        default:
+            for _, from := range gate.InFrom {
+                for k, word := range forms[from] {
+                    form[k] ^= word
+                }
+            }
+            if gate.GateType == GateNOT {
+                form[0] ^= 1
+            }
+        }
+        forms[g] = form
+    }
+    return forms[out], true
+}
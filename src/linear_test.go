@@ -0,0 +1,48 @@
+package toygarble
+
+import (
+    "slices"
+    "testing"
+)
+
+// Parity over 70 wires spans two mask words; an AND isn't linear even
+// with XORs around it
+func TestExtractLinearSystem(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 70)
+    parity := x[0]
+    for _, w := range x[1:] {
+        parity = b.Xor(parity, w)
+    }
+    circ, err := b.Output("out",
+        b.Not(parity),
+        b.Xor(b.And(x[0], x[1]), x[2]),
+        b.Xor(x[3], x[3]),
+        b.Const(true),
+        b.Copy(x[69]),
+    ).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for _, c := range []struct {
+        output  int
+        want    []uint64
+    }{
+        {0, []uint64{1, ^uint64(0), 1 << 6 - 1}},
+        {2, []uint64{0, 0, 0}},
+        {3, []uint64{1, 0, 0}},
+        {4, []uint64{0, 0, 1 << 5}},
+    } {
+        got, ok := circ.ExtractLinearSystem(c.output)
+        if !ok || !slices.Equal(got, c.want) {
+            t.Errorf("output %d: got %#x (%t), want %#x", c.output, got, ok, c.want)
+        }
+    }
+    if _, ok := circ.ExtractLinearSystem(1); ok {
+        t.Error("AND output is linear")
+    }
+    if _, ok := circ.ExtractLinearSystem(5); ok {
+        t.Error("nonexistent output is linear")
+    }
+}
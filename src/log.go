@@ -0,0 +1,29 @@
+package toygarble
+
+import (
+    "context"
+    "log/slog"
+)
+
+//
+// Diagnostic logging
+//
+
+// A slog handler that drops everything, for circuits without a Logger
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler     { return h }
+func (h discardHandler) WithGroup(string) slog.Handler          { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// The logger for the circuit's diagnostics: its Logger, or one that
+// discards everything
+func (circ *Circuit) logger() *slog.Logger {
+    if circ.Logger != nil {
+        return circ.Logger
+    }
+    return discardLogger
+}
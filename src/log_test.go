@@ -0,0 +1,63 @@
+package toygarble
+
+import (
+    "bytes"
+    "io"
+    "log/slog"
+    "os"
+    "strings"
+    "testing"
+)
+
+// Make a gate, evaluation and input declaration fail
+func provokeDiagnostics(circ *Circuit) {
+    circ.EvaluateCircuit([]bool{true})
+    circ.addGate(GateAND, false, []int{1})
+    circ.DeclareInput(circ.NumInputVars + 5, 1)
+    broken := circ.Clone()
+    broken.Gates[len(broken.Gates) - 1].GateType = 99
+    broken.EvaluateCircuit(make([]bool, circ.NumInputWires))
+}
+
+// Run f with stdout and stderr redirected, returning what it wrote
+func captureOutput(t *testing.T, f func()) string {
+    t.Helper()
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout, stderr := os.Stdout, os.Stderr
+    os.Stdout, os.Stderr = w, w
+    defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+    done := make(chan []byte)
+    go func() {
+        data, _ := io.ReadAll(r)
+        done <- data
+    }()
+    f()
+    w.Close()
+    return string(<-done)
+}
+
+func TestNilLoggerIsSilent(t *testing.T) {
+    circ := BuildAdder(4)
+    if out := captureOutput(t, func() { provokeDiagnostics(circ) }); out != "" {
+        t.Errorf("wrote %q without a logger", out)
+    }
+}
+
+func TestLoggerRecordsFailures(t *testing.T) {
+    var buf bytes.Buffer
+    circ := BuildAdder(4)
+    circ.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+    out := captureOutput(t, func() { provokeDiagnostics(circ) })
+    if out != "" {
+        t.Errorf("wrote %q around the logger", out)
+    }
+    for _, msg := range []string{"wrong number of input bits", "can't add gate", "can't declare input", "can't evaluate invalid circuit", "level=ERROR"} {
+        if !strings.Contains(buf.String(), msg) {
+            t.Errorf("log is missing %q:\n%s", msg, buf.String())
+        }
+    }
+}
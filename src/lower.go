@@ -0,0 +1,205 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Lowering of rich gate types to AND/XOR/NOT
+//
+
+// Overwrite gate g in place, so that its consumers see the new logic
+func (circ *Circuit) setGate(g int, gateType GateType_t, constVal bool, inFrom []int) {
+    circ.Gates[g] = Gate{gateType, constVal, inFrom, nil}
+}
+
+// Append a helper gate, turning addGate's failure into an error
+func (circ *Circuit) addHelperGate(gateType GateType_t, inFrom ...int) (int, error) {
+    g := circ.addGate(gateType, false, inFrom)
+    if g < 0 {
+        return -1, fmt.Errorf("could not add %v gate", gateType)
+    }
+    return g, nil
+}
+
+// Rewrite every OR, MUX, TOFFLI, CNOT, MAJ, ADDK, MULK and LUT gate using
+// only AND, XOR and NOT, choosing
+// identities that keep the number of AND gates low since XOR and NOT are
+// free to garble:
+//
+//     a OR b          = (a XOR b) XOR (a AND b)
+//     MUX(s, a, b)    = a XOR (s AND (a XOR b))
+//     TOFFLI(a, b, t) = t XOR (a AND b)
+//     CNOT(a, t)      = t XOR a
+//     MAJ(a, b, c)    = a XOR ((a XOR b) AND (a XOR c))
+//
+// ADDK and MULK, over bits, are just XOR and AND,
+// and LUTs are expanded into their algebraic normal form (an XOR of ANDs of
+// inputs). Existing XOR gates are left alone. Helper gates are appended to
+// the circuit and the lowered gate keeps its index.
+func (circ *Circuit) LowerPreservingXOR() error {
+    if !circ.validCircuit() {
+        return ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return err
+    }
+
+    numGates := len(circ.Gates)
+    for g := 0; g < numGates; g++ {
+        in := circ.Gates[g].InFrom
+        switch circ.Gates[g].GateType {
+        case GateINPUT, GateOUTPUT, GateCONST, GateCOPY, GateAND, GateXOR, GateNOT:
+            // Already in the target gate set
+
+        case GateOR:
+            t, err := circ.addHelperGate(GateXOR, in[0], in[1])
+            if err != nil {
+                return err
+            }
+            u, err := circ.addHelperGate(GateAND, in[0], in[1])
+            if err != nil {
+                return err
+            }
+            circ.setGate(g, GateXOR, false, []int{t, u})
+
+        case GateMUX:
+            t, err := circ.addHelperGate(GateXOR, in[1], in[2])
+            if err != nil {
+                return err
+            }
+            u, err := circ.addHelperGate(GateAND, in[0], t)
+            if err != nil {
+                return err
+            }
+            circ.setGate(g, GateXOR, false, []int{in[1], u})
+
+        case GateTOFFLI:
+            u, err := circ.addHelperGate(GateAND, in[0], in[1])
+            if err != nil {
+                return err
+            }
+            circ.setGate(g, GateXOR, false, []int{in[2], u})
+
+        case GateCNOT:
+            circ.setGate(g, GateXOR, false, []int{in[1], in[0]})
+
+        case GateMAJ:
+            // MAJ(a, b, c) = a XOR ((a XOR b) AND (a XOR c))
+            t, err := circ.addHelperGate(GateXOR, in[0], in[1])
+            if err != nil {
+                return err
+            }
+            u, err := circ.addHelperGate(GateXOR, in[0], in[2])
+            if err != nil {
+                return err
+            }
+            v, err := circ.addHelperGate(GateAND, t, u)
+            if err != nil {
+                return err
+            }
+            circ.setGate(g, GateXOR, false, []int{in[0], v})
+
+        case GateADDK:
+            circ.setGate(g, GateXOR, false, in)
+
+        case GateMULK:
+            circ.setGate(g, GateAND, false, in)
+
+        case GateLUT:
+            if err := circ.lowerLUT(g); err != nil {
+                return err
+            }
+
+        default:
+            return fmt.Errorf("can't lower %s of type %v: %w", circ.describeGate(g), circ.Gates[g].GateType, ErrInvalidGate)
+        }
+    }
+    return nil
+}
+
+// Compute the algebraic normal form of a truth table in place by the
+// Moebius transform: afterwards, entry m is the coefficient of the
+// monomial containing exactly the variables in the bitmask m.
+func moebiusTransform(table []bool) {
+    for bit := 1; bit < len(table); bit <<= 1 {
+        for m := range table {
+            if m & bit != 0 {
+                table[m] = table[m] != table[m ^ bit]
+            }
+        }
+    }
+}
+
+// Replace LUT gate g with the XOR of the monomials of its ANF
+func (circ *Circuit) lowerLUT(g int) error {
+    in := circ.Gates[g].InFrom
+    anf := append([]bool(nil), circ.Gates[g].TruthTable...)
+    if len(anf) != 1 << len(in) {
+        return fmt.Errorf("LUT %s has a truth table of the wrong size: %w", circ.describeGate(g), ErrInvalidGate)
+    }
+    moebiusTransform(anf)
+
+    // Products are built incrementally and shared, so each monomial costs
+    // at most one extra AND gate
+    products := make(map[int]int)
+    var product func(m int) (int, error)
+    product = func(m int) (int, error) {
+        if p, ok := products[m]; ok {
+            return p, nil
+        }
+        top := 0
+        for m >> (top + 1) != 0 {
+            top++
+        }
+        rest := m &^ (1 << top)
+        if rest == 0 {
+            return in[top], nil
+        }
+        p, err := product(rest)
+        if err != nil {
+            return -1, err
+        }
+        p, err = circ.addHelperGate(GateAND, p, in[top])
+        if err != nil {
+            return -1, err
+        }
+        products[m] = p
+        return p, nil
+    }
+
+    terms := make([]int, 0)
+    for m := 1; m < len(anf); m++ {
+        if anf[m] {
+            p, err := product(m)
+            if err != nil {
+                return err
+            }
+            terms = append(terms, p)
+        }
+    }
+
+    // XOR the terms together, with the constant term as a final NOT
+    if len(terms) == 0 {
+        circ.setGate(g, GateCONST, anf[0], nil)
+        return nil
+    }
+    acc := terms[0]
+    for k := 1; k < len(terms); k++ {
+        if k == len(terms) - 1 && !anf[0] {
+            circ.setGate(g, GateXOR, false, []int{acc, terms[k]})
+            return nil
+        }
+        x, err := circ.addHelperGate(GateXOR, acc, terms[k])
+        if err != nil {
+            return err
+        }
+        acc = x
+    }
+    if anf[0] {
+        circ.setGate(g, GateNOT, false, []int{acc})
+    } else {
+        circ.setGate(g, GateCOPY, false, []int{acc})
+    }
+    return nil
+}
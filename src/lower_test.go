@@ -0,0 +1,109 @@
+package toygarble
+
+import (
+    "math/rand"
+    "testing"
+)
+
+// The AND gates a textbook sum-of-products lowering spends on each gate,
+// where OR(a, b) = NOT(AND(NOT a, NOT b)) also costs an AND
+func naiveANDCount(circ *Circuit) int {
+    count := 0
+    for i := range circ.Gates {
+        gate := &circ.Gates[i]
+        switch gate.GateType {
+        case GateAND, GateOR, GateTOFFLI:
+            count++
+        case GateMUX:
+            // (s AND b) OR (NOT s AND a)
+            count += 3
+        case GateMAJ:
+            // (a AND b) OR (a AND c) OR (b AND c)
+            count += 5
+        case GateLUT:
+            // An OR of one AND-product per true row
+            minterms := 0
+            for _, v := range gate.TruthTable {
+                if v {
+                    minterms++
+                }
+            }
+            if minterms > 0 {
+                count += minterms * (len(gate.InFrom) - 1) + minterms - 1
+            }
+        }
+    }
+    return count
+}
+
+func TestLowerPreservingXOR(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    for trial := 0; trial < 50; trial++ {
+        table := make([]bool, 8)
+        for i := range table {
+            table[i] = rng.Intn(2) == 1
+        }
+
+        b := NewBuilder()
+        x := b.Input("x", 4)
+        outs := []Wire{
+            b.Or(x[0], x[1]),
+            b.Mux(x[2], x[0], x[3]),
+            b.Maj(x[0], x[1], x[2]),
+            b.Toffoli(x[1], x[2], x[3]),
+            b.Xor(x[0], x[3]),
+            b.LUT([]Wire{x[1], x[2], x[3]}, table),
+        }
+        circ, err := b.Output("out", outs...).Build()
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        lowered := circ.Clone()
+        if err := lowered.LowerPreservingXOR(); err != nil {
+            t.Fatal(err)
+        }
+        if err := lowered.RequireGateTypes([]GateType_t{GateAND, GateXOR, GateNOT, GateCONST, GateCOPY}); err != nil {
+            t.Fatal(err)
+        }
+        checkSameFunction(t, circ, lowered, 4)
+
+        // The XOR is untouched, and the lowering never costs more ANDs
+        // than the naive one
+        for i := range circ.Gates {
+            if circ.Gates[i].GateType == GateXOR && lowered.Gates[i].GateType != GateXOR {
+                t.Fatalf("XOR gate %d became %v", i, lowered.Gates[i].GateType)
+            }
+        }
+        if got, naive := lowered.NonFreeGateCount(), naiveANDCount(circ); got >= naive {
+            t.Errorf("table %v: %d ANDs after lowering, naive lowering needs %d", table, got, naive)
+        }
+    }
+}
+
+// OR, MUX, MAJ and TOFFLI each come down to a single AND
+func TestLowerPreservingXORANDCount(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    outs := []Wire{b.Or(x[0], x[1]), b.Mux(x[2], x[0], x[1]), b.Maj(x[0], x[1], x[2]), b.Toffoli(x[0], x[1], x[2])}
+    circ, err := b.Output("out", outs...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    lowered := circ.Clone()
+    if err := lowered.LowerPreservingXOR(); err != nil {
+        t.Fatal(err)
+    }
+    checkSameFunction(t, circ, lowered, 3)
+    if got, naive := lowered.NonFreeGateCount(), naiveANDCount(circ); got != 4 || naive != 10 {
+        t.Errorf("%d ANDs after lowering, want 4 (naive lowering: %d, want 10)", got, naive)
+    }
+}
+
+func TestLowerPreservingXORInvalid(t *testing.T) {
+    circ := BuildAdder(4)
+    circ.Gates[len(circ.Gates)-1].InFrom[0] = len(circ.Gates)
+    if err := circ.LowerPreservingXOR(); err == nil {
+        t.Error("lowered an invalid circuit")
+    }
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package toygarble
+
+import (
+    "os"
+)
+
+// Read a whole file into memory, where there's no mmap to map it with
+func mapFile(path string) ([]byte, func() error, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    return data, func() error { return nil }, nil
+}
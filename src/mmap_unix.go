@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package toygarble
+
+import (
+    "fmt"
+    "os"
+    "syscall"
+)
+
+// Map a file into memory read-only, returning its contents and a function
+// to unmap them
+func mapFile(path string) ([]byte, func() error, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer f.Close()
+
+    info, err := f.Stat()
+    if err != nil {
+        return nil, nil, err
+    }
+    size := info.Size()
+    if size == 0 {
+        // Nothing to map, and mmap rejects empty mappings
+        return nil, func() error { return nil }, nil
+    }
+    if int64(int(size)) != size {
+        return nil, nil, fmt.Errorf("%s is too large to map: %w", path, ErrLimitExceeded)
+    }
+
+    data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+    if err != nil {
+        return nil, nil, fmt.Errorf("mapping %s: %w", path, err)
+    }
+    return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,368 @@
+package toygarble
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+)
+
+//
+// Parsing of wire-numbered netlist formats. In these formats the input
+// wires come first and the output wires are the last ones in the circuit;
+// every gate assigns one new wire from wires assigned earlier.
+//
+
+// A gate in a netlist: wire out = gateType(in...)
+type netGate struct {
+    gateType    GateType_t
+    constVal    bool
+    in          []int
+    out         int
+}
+
+// Build a circuit from a netlist with numWires wires. The input wires are
+// split into variables by widthsIV, and the last wires by widthsOV. The
+// circuit is built under limits.
+func buildFromNetlist(limits Limits, numWires int, widthsIV []int, widthsOV []int, gates []netGate) (*Circuit, error) {
+    numInputWires := 0
+    for _, w := range widthsIV {
+        numInputWires += w
+    }
+    numOutputWires := 0
+    for _, w := range widthsOV {
+        numOutputWires += w
+    }
+    if numInputWires > numWires || numOutputWires > numWires {
+        return nil, fmt.Errorf("circuit has %d wires, too few for %d inputs and %d outputs: %w", numWires, numInputWires, numOutputWires, ErrMalformed)
+    }
+    // Every wire is an input or the output of a gate, so the wires declared
+    // can't outnumber those, and the wire map below stays proportional to
+    // the input actually read
+    if numWires > numInputWires + len(gates) {
+        return nil, fmt.Errorf("circuit has %d wires, more than its %d inputs and %d gates assign: %w", numWires, numInputWires, len(gates), ErrMalformed)
+    }
+
+    circ := &Circuit{}
+    circ.useLimits(limits)
+    err := circ.initializeCircuit(numInputWires, numOutputWires, len(widthsIV), len(widthsOV), widthsIV, widthsOV)
+    if err != nil {
+        return nil, err
+    }
+
+    circ.Reserve(len(gates))
+
+    // Map each wire to the gate driving it, -1 until it is assigned
+    gateOf := make([]int, numWires)
+    for w := range gateOf {
+        gateOf[w] = -1
+    }
+    for w := 0; w < numInputWires; w++ {
+        gateOf[w] = circ.getInputGate(w)
+    }
+
+    for k, ng := range gates {
+        inFrom := make([]int, len(ng.in))
+        for j, w := range ng.in {
+            if w < 0 || w >= numWires || gateOf[w] < 0 {
+                return nil, fmt.Errorf("gate %d reads unassigned wire %d: %w", k, w, ErrMalformed)
+            }
+            inFrom[j] = gateOf[w]
+        }
+        if ng.out < 0 || ng.out >= numWires {
+            return nil, fmt.Errorf("gate %d writes nonexistent wire %d: %w", k, ng.out, ErrMalformed)
+        }
+        if gateOf[ng.out] >= 0 {
+            return nil, fmt.Errorf("gate %d writes wire %d, which is already assigned: %w", k, ng.out, ErrMalformed)
+        }
+
+        gateOf[ng.out] = circ.addGate(ng.gateType, ng.constVal, inFrom)
+        if gateOf[ng.out] < 0 {
+            return nil, fmt.Errorf("could not add gate %d", k)
+        }
+    }
+
+    for i := 0; i < numOutputWires; i++ {
+        w := numWires - numOutputWires + i
+        if gateOf[w] < 0 {
+            return nil, fmt.Errorf("output wire %d is never assigned: %w", w, ErrMalformed)
+        }
+        circ.connectOutputWire(gateOf[w], i)
+    }
+
+    return circ, nil
+}
+
+// Reads a netlist one line of whitespace-separated fields at a time,
+// skipping blank lines and tracking line numbers for error messages
+type netlistReader struct {
+    scanner     *bufio.Scanner
+    line        int
+}
+
+func newNetlistReader(r io.Reader) *netlistReader {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 0, 64 * 1024), 1024 * 1024)
+    return &netlistReader{scanner, 0}
+}
+
+// The fields of the next non-blank line, or nil at the end of the input
+func (nr *netlistReader) next() ([]string, error) {
+    for nr.scanner.Scan() {
+        nr.line++
+        fields := strings.Fields(nr.scanner.Text())
+        if len(fields) > 0 {
+            return fields, nil
+        }
+    }
+    return nil, nr.scanner.Err()
+}
+
+// The next line as a list of exactly n (if n >= 0) non-negative integers
+func (nr *netlistReader) nextInts(n int) ([]int, error) {
+    fields, err := nr.next()
+    if err != nil {
+        return nil, err
+    }
+    if fields == nil {
+        return nil, fmt.Errorf("unexpected end of input after line %d: %w", nr.line, ErrMalformed)
+    }
+    if n >= 0 && len(fields) != n {
+        return nil, fmt.Errorf("line %d: expected %d numbers, got %d: %w", nr.line, n, len(fields), ErrMalformed)
+    }
+    return nr.parseInts(fields)
+}
+
+func (nr *netlistReader) parseInts(fields []string) ([]int, error) {
+    result := make([]int, len(fields))
+    for i, f := range fields {
+        v, err := strconv.Atoi(f)
+        if err != nil || v < 0 {
+            return nil, fmt.Errorf("line %d: bad number %q: %w", nr.line, f, ErrMalformed)
+        }
+        result[i] = v
+    }
+    return result, nil
+}
+
+// Parse a gate line of the form "nin nout in... out... OP", returning the
+// input and output wires and the operation name
+func (nr *netlistReader) parseGateLine(fields []string) ([]int, []int, string, error) {
+    if len(fields) < 3 {
+        return nil, nil, "", fmt.Errorf("line %d: malformed gate: %w", nr.line, ErrMalformed)
+    }
+    counts, err := nr.parseInts(fields[:2])
+    if err != nil {
+        return nil, nil, "", err
+    }
+    if len(fields) != counts[0] + counts[1] + 3 {
+        return nil, nil, "", fmt.Errorf("line %d: gate has %d inputs and %d outputs but %d wires: %w", nr.line, counts[0], counts[1], len(fields) - 3, ErrMalformed)
+    }
+    wires, err := nr.parseInts(fields[2:len(fields)-1])
+    if err != nil {
+        return nil, nil, "", err
+    }
+    return wires[:counts[0]], wires[counts[0]:], fields[len(fields)-1], nil
+}
+
+// Read the gate lines following a netlist header up to the end of the
+// input, which must hold exactly numGates gates. Each one's operation and
+// input wires are turned into a gate type, constant and input wires by op.
+func (nr *netlistReader) readGates(numGates int, op func(name string, in []int) (GateType_t, bool, []int, error)) ([]netGate, error) {
+    // Grown as gates are read, so a short input can't make us allocate
+    // for every gate its header declares
+    gates := make([]netGate, 0, preallocCap(numGates))
+    for {
+        fields, err := nr.next()
+        if err != nil {
+            return nil, err
+        }
+        if fields == nil {
+            break
+        }
+        if len(gates) == numGates {
+            return nil, fmt.Errorf("line %d: more gates than the %d declared: %w", nr.line, numGates, ErrMalformed)
+        }
+
+        in, out, name, err := nr.parseGateLine(fields)
+        if err != nil {
+            return nil, err
+        }
+        if len(out) != 1 {
+            return nil, fmt.Errorf("line %d: gates must have exactly one output: %w", nr.line, ErrMalformed)
+        }
+
+        gateType, constVal, in, err := op(name, in)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", nr.line, err)
+        }
+        gates = append(gates, netGate{gateType, constVal, in, out[0]})
+    }
+    if len(gates) != numGates {
+        return nil, fmt.Errorf("found %d gates, header declares %d: %w", len(gates), numGates, ErrMalformed)
+    }
+    return gates, nil
+}
+
+// Check a gate's input count for the gate type
+func checkNetlistArity(name string, gateType GateType_t, in []int) error {
+    if len(in) != min_input_wires[gateType] {
+        return fmt.Errorf("%s gate with %d inputs: %w", name, len(in), ErrMalformed)
+    }
+    return nil
+}
+
+// Parse a circuit in the netlist format used by EMP-toolkit (the original
+// "Bristol Format"). The header gives the gate and wire counts, then the
+// input widths of the two parties and the output width. The inputs become
+// two input variables, one per party (either may be empty), and the outputs
+// a single output variable.
+//
+// Only the AND, XOR and INV gates EMP itself evaluates are supported; EMP
+// extensions outside its BristolFormat reader, such as multi-output gates,
+// are rejected. The circuit is checked against DefaultLimits.
+func ParseEMP(r io.Reader) (*Circuit, error) {
+    return ParseEMPWith(r, DefaultLimits)
+}
+
+// Like ParseEMP, but checking the circuit against the given limits
+func ParseEMPWith(r io.Reader, limits Limits) (*Circuit, error) {
+    nr := newNetlistReader(r)
+
+    header, err := nr.nextInts(2)
+    if err != nil {
+        return nil, err
+    }
+    numGates, numWires := header[0], header[1]
+
+    widths, err := nr.nextInts(3)
+    if err != nil {
+        return nil, err
+    }
+
+    // Check the declared sizes before allocating anything from them
+    numInputWires := widths[0] + widths[1]
+    err = limits.checkSize(numGates, max(numWires, numInputWires + widths[2] + numGates), numInputWires)
+    if err != nil {
+        return nil, err
+    }
+
+    gates, err := nr.readGates(numGates, func(name string, in []int) (GateType_t, bool, []int, error) {
+        var gateType GateType_t
+        switch name {
+        case "AND":
+            gateType = GateAND
+        case "XOR":
+            gateType = GateXOR
+        case "INV":
+            gateType = GateNOT
+        default:
+            return 0, false, nil, fmt.Errorf("unsupported gate %q: %w", name, ErrMalformed)
+        }
+        return gateType, false, in, checkNetlistArity(name, gateType, in)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return buildFromNetlist(limits, numWires, []int{widths[0], widths[1]}, []int{widths[2]}, gates)
+}
+
+// Read a header line giving a count n followed by n widths
+func (nr *netlistReader) nextWidths() ([]int, error) {
+    fields, err := nr.nextInts(-1)
+    if err != nil {
+        return nil, err
+    }
+    if len(fields) == 0 || len(fields) != fields[0] + 1 {
+        return nil, fmt.Errorf("line %d: expected a count followed by that many widths: %w", nr.line, ErrMalformed)
+    }
+    return fields[1:], nil
+}
+
+// Parse a circuit in the "Bristol Fashion" netlist format, as used by
+// SCALE-MAMBA and the circuits distributed with this package. The header
+// gives the gate and wire counts, then the number of input variables and
+// their widths, then likewise for the outputs, so the variable layout is
+// kept.
+//
+// Supported gates are AND, XOR, INV (or NOT), EQ, which sets a wire to the
+// constant given in place of its input, and EQW, which copies a wire.
+// Multi-output gates such as MAND are rejected. The circuit is checked
+// against DefaultLimits.
+func ParseBristol(r io.Reader) (*Circuit, error) {
+    return ParseBristolWith(r, DefaultLimits)
+}
+
+// Like ParseBristol, but checking the circuit against the given limits
+func ParseBristolWith(r io.Reader, limits Limits) (*Circuit, error) {
+    nr := newNetlistReader(r)
+
+    header, err := nr.nextInts(2)
+    if err != nil {
+        return nil, err
+    }
+    numGates, numWires := header[0], header[1]
+
+    widthsIV, err := nr.nextWidths()
+    if err != nil {
+        return nil, err
+    }
+    widthsOV, err := nr.nextWidths()
+    if err != nil {
+        return nil, err
+    }
+
+    // Check the declared sizes before allocating anything from them
+    numInputWires, numOutputWires := 0, 0
+    for _, w := range widthsIV {
+        numInputWires += w
+    }
+    for _, w := range widthsOV {
+        numOutputWires += w
+    }
+    err = limits.checkSize(numGates, max(numWires, numInputWires + numOutputWires + numGates), numInputWires)
+    if err != nil {
+        return nil, err
+    }
+
+    gates, err := nr.readGates(numGates, func(name string, in []int) (GateType_t, bool, []int, error) {
+        var gateType GateType_t
+        switch name {
+        case "AND":
+            gateType = GateAND
+        case "XOR":
+            gateType = GateXOR
+        case "INV", "NOT":
+            gateType = GateNOT
+        case "EQW":
+            gateType = GateCOPY
+        case "EQ":
+            if len(in) != 1 || in[0] > 1 {
+                return 0, false, nil, fmt.Errorf("EQ gate must have a single 0 or 1 input: %w", ErrMalformed)
+            }
+            return GateCONST, in[0] == 1, nil, nil
+        default:
+            return 0, false, nil, fmt.Errorf("unsupported gate %q: %w", name, ErrMalformed)
+        }
+        return gateType, false, in, checkNetlistArity(name, gateType, in)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return buildFromNetlist(limits, numWires, widthsIV, widthsOV, gates)
+}
+
+// Parse the Bristol Fashion circuit in the named file, such as one of those
+// in the circuits directory (e.g. aes_128.txt or sha256.txt)
+func LoadBristol(path string) (*Circuit, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    return ParseBristol(bufio.NewReader(f))
+}
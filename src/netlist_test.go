@@ -0,0 +1,210 @@
+package toygarble
+
+import (
+    "bytes"
+    "crypto/aes"
+    "errors"
+    "slices"
+    "strings"
+    "testing"
+)
+
+// The wires of a 128-bit Bristol Fashion variable holding block, which is
+// read as a big-endian integer with its least significant bit first
+func aesBlockBits(block []byte) []bool {
+    bits := make([]bool, 128)
+    for i := range bits {
+        bits[i] = (block[15 - i / 8] >> (i % 8)) & 1 == 1
+    }
+    return bits
+}
+
+func loadAES128(tb testing.TB) *Circuit {
+    tb.Helper()
+    circ, err := LoadBristol("../circuits/aes_128.txt")
+    if err != nil {
+        tb.Fatal(err)
+    }
+    return circ
+}
+
+func TestBristolAES128(t *testing.T) {
+    circ := loadAES128(t)
+    if !slices.Equal(circ.NumWiresIV, []int{128, 128}) || !slices.Equal(circ.NumWiresOV, []int{128}) {
+        t.Fatalf("variable layout %v -> %v", circ.NumWiresIV, circ.NumWiresOV)
+    }
+
+    key := make([]byte, 16)
+    plaintext := make([]byte, 16)
+    for i := range key {
+        key[i] = byte(i * 7 + 1)
+        plaintext[i] = byte(i * 13 + 5)
+    }
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := make([]byte, 16)
+    block.Encrypt(want, plaintext)
+
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        t.Fatal(err)
+    }
+    out, err := e.Evaluate(append(aesBlockBits(key), aesBlockBits(plaintext)...))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(boolArrayToBytes(out), boolArrayToBytes(aesBlockBits(want))) {
+        t.Errorf("ciphertext doesn't match crypto/aes")
+    }
+}
+
+func TestBristolAdder64(t *testing.T) {
+    circ, err := LoadBristol("../circuits/adder64.txt")
+    if err != nil {
+        t.Fatal(err)
+    }
+    out, err := circ.EvaluateInts([]int64{123456789, 987654321}, []int{64, 64})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if out[0] != 123456789 + 987654321 {
+        t.Errorf("got %d", out[0])
+    }
+}
+
+func TestParseBristolMalformed(t *testing.T) {
+    inputs := map[string]string{
+        "missing header":        "",
+        "bad gate":              "1 3\n2 1 1\n1 1\n2 1 0 1 2 NAND\n",
+        "wire out of range":     "1 3\n2 1 1\n1 1\n2 1 0 9 2 AND\n",
+        "wrong arity":           "1 3\n2 1 1\n1 1\n1 1 0 2 AND\n",
+        "too few gates":         "2 4\n2 1 1\n1 1\n2 1 0 1 2 AND\n",
+        "widths don't match":    "1 3\n2 1 1\n2 1\n2 1 0 1 2 AND\n",
+    }
+    for name, input := range inputs {
+        mustNotPanic(t, name, func() {
+            if _, err := ParseBristol(bytes.NewReader([]byte(input))); err == nil {
+                t.Errorf("%s: parsed", name)
+            }
+        })
+    }
+    circ, err := ParseBristol(bytes.NewReader([]byte("1 3\n2 1 1\n1 1\n2 1 0 1 2 AND\n")))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ok, out := circ.EvaluateCircuit([]bool{true, true}); !ok || !out[0] {
+        t.Errorf("AND of 1 and 1 gave %v", out)
+    }
+}
+
+// Like TestParseEMPHugeHeader, for Bristol Fashion headers
+func TestParseBristolHugeHeader(t *testing.T) {
+    inputs := map[string]string{
+        "gate count":    "67108864 134217727\n1 1\n1 1\n",
+        "wire count":    "1 134217727\n1 1\n1 1\n1 1 0 1 INV\n",
+    }
+    for name, input := range inputs {
+        var err error
+        n := allocatedBytes(func() {
+            _, err = ParseBristol(strings.NewReader(input))
+        })
+        if !errors.Is(err, ErrMalformed) {
+            t.Errorf("%s: got %v", name, err)
+        }
+        if n > 1 << 22 {
+            t.Errorf("%s: allocated %d bytes for a %d byte input", name, n, len(input))
+        }
+    }
+}
+
+// A full adder in EMP's format: party 1 supplies a (wire 0), party 2 b and
+// the carry in (wires 1 and 2); the outputs are the sum, the carry out and
+// the inverted sum
+const empFullAdder = `6 9
+1 2 3
+
+2 1 0 1 3 XOR
+2 1 0 1 4 AND
+2 1 3 2 5 AND
+2 1 3 2 6 XOR
+2 1 4 5 7 XOR
+1 1 6 8 INV
+`
+
+func TestParseEMPFullAdder(t *testing.T) {
+    circ, err := ParseEMP(strings.NewReader(empFullAdder))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !slices.Equal(circ.NumWiresIV, []int{1, 2}) || !slices.Equal(circ.NumWiresOV, []int{3}) {
+        t.Fatalf("layout %v -> %v, want [1 2] -> [3]", circ.NumWiresIV, circ.NumWiresOV)
+    }
+    for m := 0; m < 8; m++ {
+        in := []bool{m & 1 == 1, m & 2 == 2, m & 4 == 4}
+        ok, out := circ.EvaluateCircuit(in)
+        total := m & 1 + m >> 1 & 1 + m >> 2 & 1
+        sum := total & 1 == 1
+        if !ok || out[0] != sum || out[1] != (total >= 2) || out[2] == sum {
+            t.Errorf("inputs %v: got %v", in, out)
+        }
+    }
+}
+
+func TestParseEMPMalformed(t *testing.T) {
+    inputs := map[string]string{
+        "missing widths":        "1 3\n",
+        "Bristol Fashion gate":  "1 3\n1 1 1\n\n2 1 0 1 2 EQW\n",
+        "multi-output gate":     "1 4\n1 1 2\n\n2 2 0 1 2 3 MAND\n",
+        "wrong arity":           "1 3\n1 1 1\n\n1 1 0 2 AND\n",
+        "wire out of range":     "1 3\n1 1 1\n\n2 1 0 7 2 AND\n",
+        "too few gates":         "2 4\n1 1 1\n\n2 1 0 1 2 AND\n",
+    }
+    for name, input := range inputs {
+        mustNotPanic(t, name, func() {
+            if _, err := ParseEMP(strings.NewReader(input)); !errors.Is(err, ErrMalformed) {
+                t.Errorf("%s: got %v", name, err)
+            }
+        })
+    }
+}
+
+// A header declaring a huge circuit, with little or nothing after it, fails
+// without allocating for the declared size
+func TestParseEMPHugeHeader(t *testing.T) {
+    inputs := map[string]string{
+        "gate count":    "67108864 134217727\n0 0 1\n",
+        "wire count":    "1 134217727\n1 0 1\n\n1 1 0 1 INV\n",
+    }
+    for name, input := range inputs {
+        var err error
+        n := allocatedBytes(func() {
+            _, err = ParseEMP(strings.NewReader(input))
+        })
+        if !errors.Is(err, ErrMalformed) {
+            t.Errorf("%s: got %v", name, err)
+        }
+        if n > 1 << 22 {
+            t.Errorf("%s: allocated %d bytes for a %d byte input", name, n, len(input))
+        }
+    }
+}
+
+func BenchmarkEvaluateAES(b *testing.B) {
+    circ := loadAES128(b)
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        b.Fatal(err)
+    }
+    in := make([]bool, circ.NumInputWires)
+    for i := range in {
+        in[i] = i % 3 == 0
+    }
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if _, err := e.Evaluate(in); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
@@ -0,0 +1,478 @@
+package toygarble
+
+import (
+    "fmt"
+    "slices"
+)
+
+//
+// Optimization passes. Passes rewrite gates in place, leaving any gates
+// that become unused where they are for RemoveDeadGates to clean up.
+//
+
+// Apply the identities AND(x, 1) = x, AND(x, 0) = 0, OR(x, 0) = x,
+// OR(x, 1) = 1, XOR(x, 0) = x and XOR(x, 1) = NOT(x) to every gate with
+// exactly one constant input. Gates reducing to x are turned into copies
+// and their consumers are wired straight to x. Returns the number of gates
+// simplified, or -1 if the circuit has a cycle.
+func (circ *Circuit) SimplifyConstGates() int {
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return -1
+    }
+
+    // Gates that have been replaced by a copy of another gate
+    alias := make(map[int]int)
+    count := 0
+
+    for _, g := range order {
+        gate := &circ.Gates[g]
+
+        // Pick up anything simplified upstream
+        for j, from := range gate.InFrom {
+            if a, ok := alias[from]; ok {
+                gate.InFrom[j] = a
+            }
+        }
+
+        if (gate.GateType != GateAND && gate.GateType != GateOR && gate.GateType != GateXOR) || len(gate.InFrom) != 2 {
+            continue
+        }
+
+        const0 := circ.Gates[gate.InFrom[0]].GateType == GateCONST
+        const1 := circ.Gates[gate.InFrom[1]].GateType == GateCONST
+        if const0 == const1 {
+            continue
+        }
+
+        x := gate.InFrom[0]
+        c := circ.Gates[gate.InFrom[1]].ConstVal
+        if const0 {
+            x = gate.InFrom[1]
+            c = circ.Gates[gate.InFrom[0]].ConstVal
+        }
+
+        switch {
+        case gate.GateType == GateAND && !c, gate.GateType == GateOR && c:
+            // The constant dominates
+            gate.GateType = GateCONST
+            gate.ConstVal = c
+            gate.InFrom = nil
+        case gate.GateType == GateXOR && c:
+            gate.GateType = GateNOT
+            gate.InFrom = []int{x}
+        default:
+            // The constant is the identity, so this is just x
+            gate.GateType = GateCOPY
+            gate.InFrom = []int{x}
+            alias[g] = x
+        }
+        count++
+    }
+
+    return count
+}
+
+// Rebuild every maximal tree of gateType gates (an associative operation)
+// as a balanced binary tree. A gate belongs to its consumer's tree if it
+// has the same type and that consumer is its only one; the others, along
+// with gates read as outputs or by assertions, are the roots of trees. The
+// rebuilt trees reuse the same gate indices, combining the leaves pairwise
+// in their original order. Returns the number of gates rewritten, or -1 if
+// the circuit is malformed.
+func (circ *Circuit) rebalance(gateType GateType_t) int {
+    if !circ.validCircuit() {
+        return -1
+    }
+    fanOut, err := circ.consumers()
+    if err != nil {
+        return -1
+    }
+    if _, err := circ.TopologicalOrder(); err != nil {
+        return -1
+    }
+
+    // A gate whose value is read from outside the gate graph has to keep it
+    external := circ.externalUses()
+
+    // Whether gate g is absorbed into the tree of its consumer
+    absorbed := func(g int) bool {
+        return circ.Gates[g].GateType == gateType && len(fanOut[g]) == 1 && external[g] == 0 &&
+            circ.Gates[fanOut[g][0]].GateType == gateType
+    }
+
+    count := 0
+    for root := range circ.Gates {
+        if circ.Gates[root].GateType != gateType || len(circ.Gates[root].InFrom) != 2 || absorbed(root) {
+            continue
+        }
+
+        // Collect the tree's leaves (left to right) and internal gates,
+        // along with its current height
+        leaves := make([]int, 0)
+        internal := make([]int, 0)
+        var collect func(g int) int
+        collect = func(g int) int {
+            height := 0
+            for _, from := range circ.Gates[g].InFrom {
+                if absorbed(from) {
+                    internal = append(internal, from)
+                    height = max(height, collect(from))
+                } else {
+                    leaves = append(leaves, from)
+                }
+            }
+            return height + 1
+        }
+        height := collect(root)
+
+        best := 0
+        for 1 << best < len(leaves) {
+            best++
+        }
+        if height <= best {
+            continue
+        }
+
+        // Combine adjacent pairs level by level, writing the last
+        // combination into the root so its consumers are unaffected
+        level := leaves
+        for len(level) > 1 {
+            next := make([]int, 0, (len(level) + 1) / 2)
+            for k := 0; k + 1 < len(level); k += 2 {
+                g := root
+                if len(level) > 2 {
+                    g = internal[0]
+                    internal = internal[1:]
+                }
+                circ.setGate(g, gateType, false, []int{level[k], level[k + 1]})
+                next = append(next, g)
+            }
+            if len(level) % 2 == 1 {
+                next = append(next, level[len(level) - 1])
+            }
+            level = next
+        }
+        count += len(leaves) - 1
+    }
+
+    return count
+}
+
+// Rebuild chains and other unbalanced trees of XOR gates as balanced trees,
+// reducing the circuit's depth without changing its function or gate count.
+// For example a linear chain computing the parity of 16 wires, with depth
+// 15, becomes a tree of depth 4. Returns the number of gates rewritten, or
+// -1 if the circuit is malformed.
+func (circ *Circuit) BalanceXORTrees() int {
+    return circ.rebalance(GateXOR)
+}
+
+// Gate types computing an associative operation, which rebalance can
+// regroup freely
+var associativeGateTypes = []GateType_t{GateAND, GateOR, GateXOR, GateADDK, GateMULK}
+
+// Like BalanceXORTrees, but for every associative gate type, so that e.g. a
+// wide AND built as a left-leaning chain of 15 gates goes from depth 15 to
+// 4. Trees of each type are balanced separately. Returns the number of
+// gates rewritten, or -1 if the circuit is malformed.
+func (circ *Circuit) RebalanceAssociative() int {
+    count := 0
+    for _, gateType := range associativeGateTypes {
+        n := circ.rebalance(gateType)
+        if n < 0 {
+            return -1
+        }
+        count += n
+    }
+    return count
+}
+
+// Replace every logic gate whose inputs are all constants with a constant
+// gate of the value it computes. Returns the number of gates folded, or -1
+// if the circuit is malformed or not boolean.
+func (circ *Circuit) FoldConstants() int {
+    if !circ.validCircuit() || circ.requireBoolean() != nil {
+        return -1
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return -1
+    }
+
+    values := make([]bool, len(circ.Gates))
+    count := 0
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        if gate.GateType == GateCONST {
+            values[g] = gate.ConstVal
+        }
+        if gate.GateType == GateINPUT || gate.GateType == GateOUTPUT || len(gate.InFrom) == 0 {
+            continue
+        }
+
+        allConst := true
+        for _, from := range gate.InFrom {
+            if circ.Gates[from].GateType != GateCONST {
+                allConst = false
+                break
+            }
+        }
+        if !allConst {
+            continue
+        }
+
+        v, err := gateOutput(gate, values)
+        if err != nil {
+            return -1
+        }
+        circ.setGate(g, GateCONST, v, nil)
+        values[g] = v
+        count++
+    }
+    return count
+}
+
+// Turn every NOT(NOT(x)) into a copy of x, wiring its consumers straight to
+// x. Returns the number of gates simplified, or -1 if the circuit has a
+// cycle.
+func (circ *Circuit) SimplifyNots() int {
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return -1
+    }
+
+    alias := make(map[int]int)
+    count := 0
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        for j, from := range gate.InFrom {
+            if a, ok := alias[from]; ok {
+                gate.InFrom[j] = a
+            }
+        }
+
+        if gate.GateType != GateNOT || len(gate.InFrom) != 1 {
+            continue
+        }
+        inner := &circ.Gates[gate.InFrom[0]]
+        if inner.GateType != GateNOT || len(inner.InFrom) != 1 {
+            continue
+        }
+        x := inner.InFrom[0]
+        circ.setGate(g, GateCOPY, false, []int{x})
+        alias[g] = x
+        count++
+    }
+    return count
+}
+
+// Merge structurally identical gates: gates of the same type on the same
+// inputs (in any order, for commutative gates), with the same constant or
+// table. Copies are looked through, so COPY(x) counts as x. Consumers of a
+// duplicate are rewired to the first such gate in topological order, and
+// the duplicate is left unused. Returns the number of duplicates whose
+// consumers were moved, or -1 if the circuit is invalid or has a cycle.
+func (circ *Circuit) DedupGates() int {
+    if !circ.validCircuit() {
+        return -1
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return -1
+    }
+
+    rep := make([]int, len(circ.Gates))
+    for g := range rep {
+        rep[g] = g
+    }
+    moved := make([]bool, len(circ.Gates))
+    seen := make(map[string]int)
+
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        for j, from := range gate.InFrom {
+            if rep[from] != from {
+                gate.InFrom[j] = rep[from]
+                moved[from] = true
+            }
+        }
+
+        switch gate.GateType {
+        case GateINPUT, GateOUTPUT:
+            continue
+        case GateCOPY:
+            rep[g] = gate.InFrom[0]
+            continue
+        }
+
+        // Ordered as NormalizeCommutativeInputs would
+        inFrom := gate.InFrom
+        if isCommutative(gate.GateType) {
+            inFrom = slices.Clone(inFrom)
+            slices.Sort(inFrom)
+        }
+        key := fmt.Sprint(gate.GateType, gate.ConstVal, inFrom, gate.TruthTable)
+        if first, ok := seen[key]; ok {
+            rep[g] = first
+        } else {
+            seen[key] = g
+        }
+    }
+
+    // Outputs fused into a duplicate now need the representative
+    for i := range circ.OutputGates {
+        if g := circ.OutputGates[i]; rep[g] != g && circ.Gates[g].GateType != GateCOPY {
+            circ.OutputGates[i] = rep[g]
+            moved[g] = true
+        }
+    }
+
+    count := 0
+    for g := range moved {
+        if moved[g] && circ.Gates[g].GateType != GateCOPY {
+            count++
+        }
+    }
+    return count
+}
+
+// Delete every gate that no output depends on, renumbering the rest. Input
+// gates are always kept, so the input layout is unchanged. Returns the
+// number of gates removed, or -1 if the circuit is malformed.
+func (circ *Circuit) RemoveDeadGates() int {
+    if !circ.validCircuit() {
+        return -1
+    }
+    if _, err := circ.consumers(); err != nil {
+        return -1
+    }
+
+    roots := make([]int, circ.NumOutputWires)
+    for i := range roots {
+        roots[i] = circ.getOutputGate(i)
+    }
+    live := circ.cone(roots)
+
+    remove := make([]bool, len(circ.Gates))
+    count := 0
+    for g := range circ.Gates {
+        if !live[g] && circ.Gates[g].GateType != GateINPUT {
+            remove[g] = true
+            count++
+        }
+    }
+    if count > 0 {
+        circ.compact(remove, nil)
+    }
+    return count
+}
+
+//
+// Running passes to a fixpoint
+//
+
+const (
+    // Default cap on the number of rounds Optimize runs
+    OPTIMIZE_MAX_ITERATIONS int = 100
+)
+
+// Which passes Optimize runs, and for how many rounds at most (0 for
+// OPTIMIZE_MAX_ITERATIONS)
+type OptimizeOptions struct {
+    FoldConstants       bool
+    SimplifyConstGates  bool
+    SimplifyNots        bool
+    DedupGates          bool
+    RemoveDeadGates     bool
+
+    MaxIterations       int
+}
+
+// Every pass enabled
+var DefaultOptimizeOptions = OptimizeOptions{
+    FoldConstants:      true,
+    SimplifyConstGates: true,
+    SimplifyNots:       true,
+    DedupGates:         true,
+    RemoveDeadGates:    true,
+}
+
+type OptimizeReport struct {
+    // Total gates changed by each pass, keyed by the pass's method name.
+    // RemoveDeadGates counts gates deleted, the others gates rewritten.
+    Changes     map[string]int
+
+    // Rounds run, including the final one that changed nothing
+    Iterations  int
+
+    // Whether a round changed nothing before the iteration cap was reached
+    // (false too if a pass found the circuit malformed)
+    Converged   bool
+}
+
+// An optimization pass, such as (*Circuit).SimplifyConstGates: it rewrites
+// the circuit in place and returns the number of gates it changed, or -1
+// if the circuit is malformed
+type OptimizePass func(circ *Circuit) int
+
+// A pass Optimize can run
+type optimizePass struct {
+    name        string
+    enabled     func(opts OptimizeOptions) bool
+    run         OptimizePass
+}
+
+// The passes in the order Optimize runs them. Dead gates go last so each
+// round cleans up after the rest.
+var optimizePasses = []optimizePass{
+    {"FoldConstants", func(o OptimizeOptions) bool { return o.FoldConstants }, (*Circuit).FoldConstants},
+    {"SimplifyConstGates", func(o OptimizeOptions) bool { return o.SimplifyConstGates }, (*Circuit).SimplifyConstGates},
+    {"SimplifyNots", func(o OptimizeOptions) bool { return o.SimplifyNots }, (*Circuit).SimplifyNots},
+    {"DedupGates", func(o OptimizeOptions) bool { return o.DedupGates }, (*Circuit).DedupGates},
+    {"RemoveDeadGates", func(o OptimizeOptions) bool { return o.RemoveDeadGates }, (*Circuit).RemoveDeadGates},
+}
+
+// Run the enabled passes in rounds until a round changes nothing, or the
+// iteration cap is reached. The circuit is modified in place and its gates
+// renumbered if RemoveDeadGates is enabled.
+func (circ *Circuit) Optimize(opts OptimizeOptions) OptimizeReport {
+    maxIterations := opts.MaxIterations
+    if maxIterations <= 0 {
+        maxIterations = OPTIMIZE_MAX_ITERATIONS
+    }
+
+    report := OptimizeReport{Changes: make(map[string]int)}
+    for report.Iterations < maxIterations {
+        report.Iterations++
+        changed := false
+        for _, pass := range optimizePasses {
+            if !pass.enabled(opts) {
+                continue
+            }
+            n := pass.run(circ)
+            if n < 0 {
+                return report
+            }
+            report.Changes[pass.name] += n
+            changed = changed || n > 0
+        }
+        if !changed {
+            report.Converged = true
+            break
+        }
+    }
+    return report
+}
+
+// Measure what the given passes would do to the circuit without changing
+// it: run each of them once, in order, on a clone, and return the stats
+// before and after, e.g. to compare before.GateCounts[GateAND] with
+// after.GateCounts[GateAND]
+func (circ *Circuit) OptimizationImpact(passes []OptimizePass) (before, after Stats) {
+    clone := circ.Clone()
+    for _, pass := range passes {
+        pass(clone)
+    }
+    return circ.Stats(), clone.Stats()
+}
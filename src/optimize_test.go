@@ -0,0 +1,358 @@
+package toygarble
+
+import (
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+// Check that two circuits with n input wires agree on every input
+func checkSameFunction(t *testing.T, a, b *Circuit, n int) {
+    t.Helper()
+    for m := 0; m < 1 << n; m++ {
+        in := make([]bool, n)
+        for i := range in {
+            in[i] = m >> i & 1 == 1
+        }
+        okA, outA := a.EvaluateCircuit(in)
+        okB, outB := b.EvaluateCircuit(in)
+        if !okA || !okB || !slices.Equal(outA, outB) {
+            t.Fatalf("circuits disagree on %v: %v vs %v", in, outA, outB)
+        }
+    }
+}
+
+// A left-leaning chain of gateType gates combining n input wires
+func buildChain(t *testing.T, gateType GateType_t, n int) *Circuit {
+    t.Helper()
+    b := NewBuilder()
+    x := b.Input("x", n)
+    acc := x[0]
+    for _, w := range x[1:] {
+        switch gateType {
+        case GateAND:
+            acc = b.And(acc, w)
+        case GateXOR:
+            acc = b.Xor(acc, w)
+        }
+    }
+    circ, err := b.Output("out", acc).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return circ
+}
+
+func TestRebalanceAssociativeAndChain(t *testing.T) {
+    circ := buildChain(t, GateAND, 16)
+    if d, _ := circ.Depth(); d != 15 {
+        t.Fatalf("chain has depth %d, want 15", d)
+    }
+    balanced := circ.Clone()
+    if n := balanced.RebalanceAssociative(); n != 15 {
+        t.Errorf("rewrote %d gates, want 15", n)
+    }
+    if d, _ := balanced.Depth(); d != 4 {
+        t.Errorf("balanced depth %d, want 4", d)
+    }
+    if balanced.GateCount() != circ.GateCount() {
+        t.Errorf("gate count changed from %d to %d", circ.GateCount(), balanced.GateCount())
+    }
+    checkSameFunction(t, circ, balanced, 16)
+}
+
+// After FuseOutputs an output can be read from the middle of a chain,
+// which must then survive rebalancing
+func TestRebalanceKeepsFusedOutputs(t *testing.T) {
+    for _, gateType := range []GateType_t{GateAND, GateXOR} {
+        b := NewBuilder()
+        x := b.Input("x", 4)
+        op := b.And
+        if gateType == GateXOR {
+            op = b.Xor
+        }
+        mid := op(x[0], x[1])
+        all := op(op(mid, x[2]), x[3])
+        circ, err := b.Output("mid", mid).Output("all", all).Build()
+        if err != nil {
+            t.Fatal(err)
+        }
+        fused := circ.Clone()
+        if n := fused.FuseOutputs(); n != 2 {
+            t.Fatalf("fused %d outputs, want 2", n)
+        }
+        if fused.RebalanceAssociative() < 0 {
+            t.Fatal("rebalancing failed")
+        }
+        checkSameFunction(t, circ, fused, 4)
+    }
+}
+
+// A linear parity chain over n wires becomes a tree of depth ceil(log2 n)
+func TestBalanceXORTreesChain(t *testing.T) {
+    for n := 2; n <= 17; n++ {
+        circ := buildChain(t, GateXOR, n)
+        balanced := circ.Clone()
+        if k := balanced.BalanceXORTrees(); k < 0 {
+            t.Fatalf("%d inputs: balancing failed", n)
+        }
+        want := 0
+        for 1 << want < n {
+            want++
+        }
+        if d, _ := balanced.Depth(); d != want {
+            t.Errorf("%d inputs: balanced depth %d, want %d", n, d, want)
+        }
+        if balanced.GateCount() != circ.GateCount() {
+            t.Errorf("%d inputs: gate count changed from %d to %d", n, circ.GateCount(), balanced.GateCount())
+        }
+        if n <= 12 {
+            checkSameFunction(t, circ, balanced, n)
+        }
+    }
+
+    circ := buildChain(t, GateXOR, 16)
+    if n := circ.BalanceXORTrees(); n != 15 {
+        t.Errorf("rewrote %d gates of a 16-input chain, want 15", n)
+    }
+}
+
+// A gate read by two others is the root of its own tree, so it isn't
+// duplicated or lost
+func TestBalanceXORTreesSharedGate(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 6)
+    shared := b.Xor(b.Xor(x[0], x[1]), x[2])
+    left := b.Xor(b.Xor(shared, x[3]), x[4])
+    right := b.Xor(shared, x[5])
+    circ, err := b.Output("out", left, right).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    balanced := circ.Clone()
+    if balanced.BalanceXORTrees() < 0 {
+        t.Fatal("balancing failed")
+    }
+    checkSameFunction(t, circ, balanced, 6)
+    if balanced.GateCount() != circ.GateCount() {
+        t.Errorf("gate count changed from %d to %d", circ.GateCount(), balanced.GateCount())
+    }
+}
+
+func TestSimplifyConstGates(t *testing.T) {
+    cases := []struct {
+        name        string
+        gateType    GateType_t
+        c           bool
+        // What the output gate reads afterwards
+        want        GateType_t
+    }{
+        {"AND(x, 1) = x", GateAND, true, GateINPUT},
+        {"AND(x, 0) = 0", GateAND, false, GateCONST},
+        {"OR(x, 0) = x", GateOR, false, GateINPUT},
+        {"OR(x, 1) = 1", GateOR, true, GateCONST},
+        {"XOR(x, 0) = x", GateXOR, false, GateINPUT},
+        {"XOR(x, 1) = NOT(x)", GateXOR, true, GateNOT},
+    }
+    for _, c := range cases {
+        for _, constFirst := range []bool{false, true} {
+            circ := &Circuit{}
+            if err := circ.initializeCircuit(1, 1, 1, 1, []int{1}, []int{1}); err != nil {
+                t.Fatal(err)
+            }
+            k := circ.addGate(GateCONST, c.c, nil)
+            g := circ.addGate2(c.gateType, 0, k)
+            if constFirst {
+                circ.Gates[g].InFrom = []int{k, 0}
+            }
+            circ.connectOutputWire(g, 0)
+            original := circ.Clone()
+
+            if n := circ.SimplifyConstGates(); n != 1 {
+                t.Errorf("%s: simplified %d gates, want 1", c.name, n)
+            }
+            driver := circ.Gates[circ.getOutputGate(0)].InFrom[0]
+            if got := circ.Gates[driver].GateType; got != c.want {
+                t.Errorf("%s: output reads a %v gate, want %v", c.name, got, c.want)
+            }
+            checkSameFunction(t, original, circ, 1)
+        }
+    }
+}
+
+// Simplifications cascade: a gate left with a constant input by an
+// upstream rewrite is simplified in the same pass
+func TestSimplifyConstGatesCascade(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    zero := b.Const(false)
+    a := b.And(zero, x[1])
+    circ, err := b.Output("out", b.Or(b.And(a, x[0]), b.Xor(x[1], zero))).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    simplified := circ.Clone()
+    if n := simplified.SimplifyConstGates(); n != 4 {
+        t.Errorf("simplified %d gates, want 4", n)
+    }
+    checkSameFunction(t, circ, simplified, 2)
+    simplified.RemoveDeadGates()
+    if n := simplified.Stats().NumGates; n > 1 {
+        t.Errorf("%d logic gates left, want at most 1", n)
+    }
+}
+
+// One opportunity for each pass: a double NOT, an AND of two constants,
+// an OR with the constant it folds to, and the same AND twice
+func optimizableCircuit(t *testing.T) *Circuit {
+    t.Helper()
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    n := b.Not(b.Not(x[0]))
+    c := b.And(b.Const(true), b.Const(false))
+    o := b.Xor(b.Xor(n, b.And(x[0], x[1])), b.Or(b.And(x[1], x[0]), c))
+    circ, err := b.Output("out", o).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return circ
+}
+
+func TestOptimize(t *testing.T) {
+    circ := optimizableCircuit(t)
+    optimized := circ.Clone()
+    report := optimized.Optimize(DefaultOptimizeOptions)
+    if !report.Converged {
+        t.Fatalf("didn't converge: %+v", report)
+    }
+    for _, pass := range optimizePasses {
+        if report.Changes[pass.name] == 0 {
+            t.Errorf("%s changed nothing: %+v", pass.name, report)
+        }
+    }
+    if optimized.GateCount() >= circ.GateCount() {
+        t.Errorf("%d gates after optimizing, %d before", optimized.GateCount(), circ.GateCount())
+    }
+    checkSameFunction(t, circ, optimized, 2)
+
+    // Optimizing again finds nothing to do
+    again := optimized.Optimize(DefaultOptimizeOptions)
+    if !again.Converged || again.Iterations != 1 {
+        t.Errorf("second run: %+v", again)
+    }
+    for name, n := range again.Changes {
+        if n != 0 {
+            t.Errorf("second run: %s changed %d gates", name, n)
+        }
+    }
+}
+
+func TestOptimizeIterationCap(t *testing.T) {
+    circ := optimizableCircuit(t)
+    opts := DefaultOptimizeOptions
+    opts.MaxIterations = 1
+    report := circ.Optimize(opts)
+    if report.Converged || report.Iterations != 1 {
+        t.Errorf("capped at one round: %+v", report)
+    }
+
+    // Disabled passes don't run
+    circ = optimizableCircuit(t)
+    report = circ.Optimize(OptimizeOptions{SimplifyNots: true})
+    if !report.Converged || report.Changes["SimplifyNots"] != 1 || report.Changes["FoldConstants"] != 0 {
+        t.Errorf("only SimplifyNots enabled: %+v", report)
+    }
+}
+
+// Optimizing never changes what a circuit computes, nor makes it bigger
+func TestOptimizeRandomCircuits(t *testing.T) {
+    rng := rand.New(rand.NewSource(5))
+    for trial := 0; trial < 300; trial++ {
+        numInputs := 1 + rng.Intn(6)
+        circ, err := randomCircuit(rng, numInputs, 1 + rng.Intn(60), 1 + rng.Intn(4))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if trial % 3 == 0 {
+            circ.FuseOutputs()
+        }
+        optimized := circ.Clone()
+        report := optimized.Optimize(DefaultOptimizeOptions)
+        if !report.Converged || !optimized.validCircuit() {
+            t.Fatalf("trial %d: %+v", trial, report)
+        }
+        if optimized.GateCount() > circ.GateCount() {
+            t.Fatalf("trial %d: %d gates grew to %d", trial, circ.GateCount(), optimized.GateCount())
+        }
+        checkSameFunction(t, circ, optimized, numInputs)
+    }
+}
+
+func TestSimplifyNots(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 1)
+    circ, err := b.Output("out", b.Not(b.Not(b.Not(b.Not(x[0]))))).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    simplified := circ.Clone()
+    if n := simplified.SimplifyNots(); n != 2 {
+        t.Errorf("simplified %d gates, want 2", n)
+    }
+    checkSameFunction(t, circ, simplified, 1)
+    simplified.RemoveDeadGates()
+    if n := simplified.Stats().GateCounts[GateNOT]; n != 0 {
+        t.Errorf("%d NOT gates left", n)
+    }
+}
+
+// AND(a, b) and AND(b, a) are one gate, and so are gates reading through
+// a copy; the MUX, whose inputs can't be reordered, stays
+func TestDedupGates(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    and1 := b.And(x[0], x[1])
+    and2 := b.And(x[1], b.Copy(x[0]))
+    mux1 := b.Mux(x[2], x[0], x[1])
+    mux2 := b.Mux(x[2], x[1], x[0])
+    circ, err := b.Output("out", and1, and2, mux1, mux2).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    deduped := circ.Clone()
+    if n := deduped.DedupGates(); n != 1 {
+        t.Errorf("merged %d gates, want 1", n)
+    }
+    checkSameFunction(t, circ, deduped, 3)
+    deduped.RemoveDeadGates()
+    counts := deduped.Stats().GateCounts
+    if counts[GateAND] != 1 || counts[GateMUX] != 2 {
+        t.Errorf("%d ANDs and %d MUXes left, want 1 and 2", counts[GateAND], counts[GateMUX])
+    }
+}
+
+// AND with a constant 1 goes away, and the original circuit is untouched
+func TestOptimizationImpact(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    circ, err := b.Output("out", b.And(x[0], b.Const(true)), b.And(x[0], x[1])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    orig := circ.Clone()
+
+    before, after := circ.OptimizationImpact([]OptimizePass{(*Circuit).SimplifyConstGates, (*Circuit).RemoveDeadGates})
+    if before.GateCounts[GateAND] != 2 || after.GateCounts[GateAND] != 1 {
+        t.Errorf("AND count went from %d to %d, want 2 to 1", before.GateCounts[GateAND], after.GateCounts[GateAND])
+    }
+    if before.GateCounts[GateCONST] != 1 || after.GateCounts[GateCONST] != 0 {
+        t.Errorf("constants went from %d to %d, want 1 to 0", before.GateCounts[GateCONST], after.GateCounts[GateCONST])
+    }
+    if !circ.Equal(orig) {
+        t.Error("OptimizationImpact modified the circuit")
+    }
+
+    if before, after := circ.OptimizationImpact(nil); before.NumGates != after.NumGates {
+        t.Errorf("no passes changed %d gates to %d", before.NumGates, after.NumGates)
+    }
+}
@@ -0,0 +1,142 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Evaluation on packed bits
+//
+
+// A set of bits indexed by gate, eight to a byte
+type packedBits []byte
+
+func newPackedBits(n int) packedBits {
+    return make(packedBits, (n + 7) / 8)
+}
+
+func (p packedBits) get(i int) bool {
+    return p[i >> 3] & (1 << (i & 7)) != 0
+}
+
+func (p packedBits) set(i int, v bool) {
+    if v {
+        p[i >> 3] |= 1 << (i & 7)
+    } else {
+        p[i >> 3] &^= 1 << (i & 7)
+    }
+}
+
+// Evaluate the circuit on numBits input bits packed eight to a byte, least
+// significant bit first (wire i is bit i % 8 of byte i / 8, as packBits
+// lays them out), returning the output bits packed the same way. Gate
+// values are kept packed too, so on a wide circuit this uses about a third
+// of the memory EvaluateCircuit does at much the same speed. Only gates
+// some output depends on are evaluated.
+func (circ *Circuit) EvaluateCircuitPacked(input []byte, numBits int) ([]byte, error) {
+    if numBits != circ.NumInputWires || len(input) < (numBits + 7) / 8 {
+        return nil, fmt.Errorf("got %d input bits in %d bytes, circuit has %d input wires: %w", numBits, len(input), circ.NumInputWires, ErrWireCountMismatch)
+    }
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return nil, err
+    }
+
+    values := newPackedBits(len(circ.Gates))
+    done := newPackedBits(len(circ.Gates))
+    for w := 0; w < numBits; w++ {
+        g := circ.getInputGate(w)
+        values.set(g, input[w / 8] & (1 << (w % 8)) != 0)
+        done.set(g, true)
+    }
+
+    // Depth-first from each output, keeping for each gate on the path the
+    // next of its inputs to look at. A gate that is visited but not done is
+    // on the path, so reaching it again means a cycle.
+    type frame struct {
+        gate    int
+        next    int
+    }
+    visited := newPackedBits(len(circ.Gates))
+    var path []frame
+    for i := 0; i < circ.NumOutputWires; i++ {
+        root := circ.getOutputGate(i)
+        if done.get(root) {
+            continue
+        }
+        visited.set(root, true)
+        path = append(path, frame{gate: root})
+        for len(path) > 0 {
+            top := &path[len(path) - 1]
+            gate := &circ.Gates[top.gate]
+            if top.next < len(gate.InFrom) {
+                from := gate.InFrom[top.next]
+                top.next++
+                if done.get(from) {
+                    continue
+                }
+                if visited.get(from) {
+                    return nil, ErrCycle
+                }
+                visited.set(from, true)
+                path = append(path, frame{gate: from})
+                continue
+            }
+
+            v, err := packedGateOutput(gate, values)
+            if err != nil {
+                return nil, fmt.Errorf("%s: %w", circ.describeGate(top.gate), err)
+            }
+            values.set(top.gate, v)
+            done.set(top.gate, true)
+            path = path[:len(path) - 1]
+        }
+    }
+
+    result := newPackedBits(circ.NumOutputWires)
+    for i := 0; i < circ.NumOutputWires; i++ {
+        result.set(i, values.get(circ.getOutputGate(i)))
+    }
+    return result, nil
+}
+
+// Compute a gate's output from the packed values of the gates feeding it,
+// as gateOutput does
+func packedGateOutput(gate *Gate, values packedBits) (bool, error) {
+    in := gate.InFrom
+    switch gate.GateType {
+    case GateOUTPUT, GateCOPY:
+        return values.get(in[0]), nil
+    case GateCONST:
+        return gate.ConstVal, nil
+    case GateAND, GateMULK:
+        return values.get(in[0]) && values.get(in[1]), nil
+    case GateOR:
+        return values.get(in[0]) || values.get(in[1]), nil
+    case GateXOR, GateADDK, GateCNOT:
+        return values.get(in[0]) != values.get(in[1]), nil
+    case GateNOT:
+        return !values.get(in[0]), nil
+    case GateMUX:
+        if values.get(in[0]) {
+            return values.get(in[2]), nil
+        }
+        return values.get(in[1]), nil
+    case GateTOFFLI:
+        return values.get(in[2]) != (values.get(in[0]) && values.get(in[1])), nil
+    case GateMAJ:
+        a, b, c := values.get(in[0]), values.get(in[1]), values.get(in[2])
+        return (a && b) || (a && c) || (b && c), nil
+    case GateLUT:
+        address := 0
+        for j, from := range in {
+            if values.get(from) {
+                address |= 1 << j
+            }
+        }
+        return gate.TruthTable[address], nil
+    }
+    return false, fmt.Errorf("unknown gate type %d: %w", gate.GateType, ErrInvalidGate)
+}
@@ -0,0 +1,66 @@
+package toygarble
+
+import (
+    "errors"
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+func TestEvaluateCircuitPacked(t *testing.T) {
+    rng := rand.New(rand.NewSource(171))
+    circuits := []*Circuit{BuildDivMod(16), BuildAdder(3)}
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 1 + rng.Intn(12), 40, 1 + rng.Intn(12))
+        if err != nil {
+            t.Fatal(err)
+        }
+        circuits = append(circuits, circ)
+    }
+    for c, circ := range circuits {
+        for k := 0; k < 10; k++ {
+            in := make([]bool, circ.NumInputWires)
+            for i := range in {
+                in[i] = rng.Intn(2) == 1
+            }
+            _, want := circ.EvaluateCircuit(in)
+            got, err := circ.EvaluateCircuitPacked(packBits(in), len(in))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(got) != (len(want) + 7) / 8 || !slices.Equal(unpackBits(got, len(want)), want) {
+                t.Fatalf("circuit %d: got %08b, want %v", c, got, want)
+            }
+        }
+    }
+
+    circ := BuildAdder(4)
+    if _, err := circ.EvaluateCircuitPacked([]byte{1}, 3); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("wrong bit count: %v", err)
+    }
+    if _, err := circ.EvaluateCircuitPacked(nil, 8); err == nil {
+        t.Error("missing input bytes accepted")
+    }
+}
+
+func BenchmarkEvaluateCircuitPacked(b *testing.B) {
+    circ := BuildDivMod(32)
+    b.Run("packed", func(b *testing.B) {
+        in := make([]byte, (circ.NumInputWires + 7) / 8)
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            if _, err := circ.EvaluateCircuitPacked(in, circ.NumInputWires); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+    b.Run("EvaluateCircuit", func(b *testing.B) {
+        in := make([]bool, circ.NumInputWires)
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            if ok, _ := circ.EvaluateCircuit(in); !ok {
+                b.Fatal("evaluation failed")
+            }
+        }
+    })
+}
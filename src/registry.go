@@ -0,0 +1,168 @@
+package toygarble
+
+import (
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "slices"
+    "strings"
+    "sync"
+)
+
+//
+// Registry of named circuits
+//
+
+const (
+    // Extension of the binary circuit files read and written by a Registry
+    REGISTRY_FILE_EXT   string = ".tgcb"
+)
+
+// Standard circuits available by name from every new Registry, built the
+// first time they are looked up
+var standardCircuits = map[string]func(width int) *Circuit{
+    "adder":                 BuildAdder,
+    "subtractor":            BuildSubtractor,
+    "saturating_adder":      BuildSaturatingAdder,
+    "saturating_subtractor": BuildSaturatingSubtractor,
+    "divmod":                BuildDivMod,
+}
+
+// Operand widths of the standard circuits, so e.g. "adder32" is
+// BuildAdder(32)
+var standardWidths = []int{8, 16, 32, 64}
+
+// A set of circuits looked up by name, such as a library of standard
+// gadgets. Circuits are shared, not copied, so Clone one before modifying
+// it. A Registry is safe for concurrent use.
+type Registry struct {
+    mu          sync.Mutex
+    circuits    map[string]*Circuit
+
+    // Circuits not yet built
+    builders    map[string]func() *Circuit
+}
+
+// Create a registry holding the standard arithmetic circuits, named by the
+// builder and operand width (e.g. "adder32" or "divmod64")
+func NewRegistry() *Registry {
+    r := &Registry{circuits: make(map[string]*Circuit), builders: make(map[string]func() *Circuit)}
+    for name, build := range standardCircuits {
+        for _, width := range standardWidths {
+            build, width := build, width
+            r.builders[fmt.Sprintf("%s%d", name, width)] = func() *Circuit { return build(width) }
+        }
+    }
+    return r
+}
+
+// Add a circuit under the given name, replacing any circuit already there
+func (r *Registry) Register(name string, circ *Circuit) error {
+    if name == "" {
+        return fmt.Errorf("empty circuit name")
+    }
+    if circ == nil || !circ.validCircuit() {
+        return fmt.Errorf("circuit %q: %w", name, ErrInvalidCircuit)
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.circuits[name] = circ
+    delete(r.builders, name)
+    return nil
+}
+
+// Find the circuit registered under name
+func (r *Registry) Lookup(name string) (*Circuit, bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if circ, ok := r.circuits[name]; ok {
+        return circ, true
+    }
+    build, ok := r.builders[name]
+    if !ok {
+        return nil, false
+    }
+    circ := build()
+    if circ == nil {
+        return nil, false
+    }
+    r.circuits[name] = circ
+    delete(r.builders, name)
+    return circ, true
+}
+
+// The names of all registered circuits, sorted
+func (r *Registry) Names() []string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    names := make([]string, 0, len(r.circuits) + len(r.builders))
+    for name := range r.circuits {
+        names = append(names, name)
+    }
+    for name := range r.builders {
+        names = append(names, name)
+    }
+    slices.Sort(names)
+    return names
+}
+
+// Register every binary circuit file (ending in REGISTRY_FILE_EXT) in fsys,
+// searching subdirectories too. Each is named by its path without the
+// extension, e.g. "arith/adder32" for arith/adder32.tgcb. This works with
+// os.DirFS as well as embedded files.
+func (r *Registry) LoadRegistry(fsys fs.FS) error {
+    return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || path.Ext(p) != REGISTRY_FILE_EXT {
+            return nil
+        }
+
+        f, err := fsys.Open(p)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        circ, err := ReadBinary(f)
+        if err != nil {
+            return fmt.Errorf("%s: %w", p, err)
+        }
+        return r.Register(strings.TrimSuffix(p, REGISTRY_FILE_EXT), circ)
+    })
+}
+
+// Write every registered circuit to dir in the binary format, laid out as
+// LoadRegistry expects. Standard circuits are built if they haven't been.
+func (r *Registry) Save(dir string) error {
+    for _, name := range r.Names() {
+        circ, ok := r.Lookup(name)
+        if !ok {
+            continue
+        }
+        file := filepath.Join(dir, filepath.FromSlash(name) + REGISTRY_FILE_EXT)
+        if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+            return err
+        }
+        if err := writeBinaryFile(file, circ); err != nil {
+            return fmt.Errorf("%s: %w", name, err)
+        }
+    }
+    return nil
+}
+
+// Write a circuit to the named file in the binary format
+func writeBinaryFile(file string, circ *Circuit) error {
+    f, err := os.Create(file)
+    if err != nil {
+        return err
+    }
+    if err := circ.WriteBinary(f); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
@@ -0,0 +1,84 @@
+package toygarble
+
+import (
+    "bytes"
+    "os"
+    "testing"
+    "testing/fstest"
+)
+
+func TestRegistryStandardCircuits(t *testing.T) {
+    r := NewRegistry()
+    adder, ok := r.Lookup("adder32")
+    if !ok || adder.NumInputWires != 64 || adder.NumOutputWires != 32 {
+        t.Fatal("adder32 missing or the wrong shape")
+    }
+    // Built once and then shared
+    if again, _ := r.Lookup("adder32"); again != adder {
+        t.Error("adder32 built twice")
+    }
+    if _, ok := r.Lookup("adder33"); ok {
+        t.Error("found a width that isn't registered")
+    }
+    if len(r.Names()) != len(standardCircuits) * len(standardWidths) {
+        t.Errorf("%d names in a new registry", len(r.Names()))
+    }
+
+    if r.Register("", BuildAdder(1)) == nil || r.Register("bad", &Circuit{NumInputWires: 3}) == nil {
+        t.Error("registered a bad entry")
+    }
+}
+
+// A registered circuit saved to disk and loaded by a fresh registry comes
+// back unchanged, under its path-style name
+func TestRegistryRoundTrip(t *testing.T) {
+    r := NewRegistry()
+    circ, err := build4BitAdder()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := r.Register("mine/adder4", circ); err != nil {
+        t.Fatal(err)
+    }
+    dir := t.TempDir()
+    if err := r.Save(dir); err != nil {
+        t.Fatal(err)
+    }
+
+    loaded := NewRegistry()
+    if err := loaded.LoadRegistry(os.DirFS(dir)); err != nil {
+        t.Fatal(err)
+    }
+    read, ok := loaded.Lookup("mine/adder4")
+    if !ok {
+        t.Fatalf("mine/adder4 not among %v", loaded.Names())
+    }
+    if report, err := Diff(circ, read); err != nil || !report.Empty() {
+        t.Errorf("loaded circuit differs: %v (%v)", report, err)
+    }
+    if _, ok := loaded.Lookup("divmod64"); !ok {
+        t.Error("saved divmod64 not loaded")
+    }
+
+    // Embedded files work the same way, and files without the extension
+    // are ignored
+    var buf bytes.Buffer
+    if err := circ.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    fsys := fstest.MapFS{
+        "gadgets/adder4" + REGISTRY_FILE_EXT:   {Data: buf.Bytes()},
+        "README":                               {Data: []byte("not a circuit")},
+    }
+    embedded := NewRegistry()
+    if err := embedded.LoadRegistry(fsys); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := embedded.Lookup("gadgets/adder4"); !ok {
+        t.Errorf("gadgets/adder4 not among %v", embedded.Names())
+    }
+    fsys["broken" + REGISTRY_FILE_EXT] = &fstest.MapFile{Data: []byte("TGCB")}
+    if err := NewRegistry().LoadRegistry(fsys); err == nil {
+        t.Error("loaded a truncated circuit file")
+    }
+}
@@ -0,0 +1,57 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Conversion to reversible gates
+//
+
+// Convert the circuit into one built only from the reversible TOFFLI, CNOT
+// and NOT gates. Other gates are first lowered to AND, XOR and NOT, then
+//
+//     a AND b     = TOFFLI(a, b, 0)
+//     a XOR b     = CNOT(a, b)
+//     COPY(a)     = CNOT(a, 0)
+//
+// where each 0 is a fresh ancilla wire, a CONST gate of its own. Constants
+// already in the circuit are kept as prepared ancillas. Intermediate
+// results are not uncomputed, so the ancillas are left holding garbage.
+// The original circuit is not modified.
+func (circ *Circuit) ToReversible() (*Circuit, error) {
+    rev := circ.Clone()
+    if err := rev.LowerPreservingXOR(); err != nil {
+        return nil, err
+    }
+
+    numGates := len(rev.Gates)
+    for g := 0; g < numGates; g++ {
+        in := rev.Gates[g].InFrom
+        switch rev.Gates[g].GateType {
+        case GateINPUT, GateOUTPUT, GateCONST, GateNOT:
+            // Already reversible, or a wire
+
+        case GateAND:
+            z, err := rev.addHelperGate(GateCONST)
+            if err != nil {
+                return nil, err
+            }
+            rev.setGate(g, GateTOFFLI, false, []int{in[0], in[1], z})
+
+        case GateXOR:
+            rev.setGate(g, GateCNOT, false, []int{in[0], in[1]})
+
+        case GateCOPY:
+            z, err := rev.addHelperGate(GateCONST)
+            if err != nil {
+                return nil, err
+            }
+            rev.setGate(g, GateCNOT, false, []int{in[0], z})
+
+        default:
+            return nil, fmt.Errorf("can't make %s of type %v reversible: %w", rev.describeGate(g), rev.Gates[g].GateType, ErrInvalidGate)
+        }
+    }
+    return rev, nil
+}
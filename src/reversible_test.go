@@ -0,0 +1,64 @@
+package toygarble
+
+import (
+    "slices"
+    "testing"
+)
+
+func TestToffoliTruthTable(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    circ, err := b.Output("out", b.Toffoli(x[0], x[1], x[2]), b.CNOT(x[0], x[2])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    table, err := circ.TruthTable()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for m, row := range table {
+        c1, c2, target := m & 1 == 1, m & 2 == 2, m & 4 == 4
+        want := []bool{target != (c1 && c2), target != c1}
+        if !slices.Equal(row, want) {
+            t.Errorf("inputs %03b: got %v, want %v", m, row, want)
+        }
+    }
+}
+
+// A two-bit adder with carry out, converted to Toffoli, CNOT and NOT gates
+func TestToReversibleAdder(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    y := b.Input("y", 2)
+    s0 := b.Xor(x[0], y[0])
+    c0 := b.And(x[0], y[0])
+    t1 := b.Xor(x[1], y[1])
+    s1 := b.Xor(t1, c0)
+    c1 := b.Or(b.And(x[1], y[1]), b.And(t1, c0))
+    circ, err := b.Output("sum", s0, s1, c1).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    numGates := len(circ.Gates)
+
+    rev, err := circ.ToReversible()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(circ.Gates) != numGates {
+        t.Error("ToReversible modified the original circuit")
+    }
+    if err := rev.RequireGateTypes([]GateType_t{GateTOFFLI, GateCNOT, GateNOT, GateCONST}); err != nil {
+        t.Fatal(err)
+    }
+    for m := int64(0); m < 16; m++ {
+        xv, yv := m & 3, m >> 2
+        out, err := rev.EvaluateInts([]int64{xv, yv}, []int{2, 2})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if out[0] != xv + yv {
+            t.Errorf("%d + %d = %d", xv, yv, out[0])
+        }
+    }
+}
@@ -0,0 +1,96 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Self-test of gate semantics
+//
+
+// A gate to test, and the function it should compute
+type selfTestCase struct {
+    gateType    GateType_t
+    arity       int
+    constVal    bool
+    table       []bool
+    expected    func(in []bool) bool
+}
+
+var majorityTable = []bool{false, false, false, true, false, true, true, true}
+
+var selfTestCases = []selfTestCase{
+    {GateAND, 2, false, nil, func(in []bool) bool { return in[0] && in[1] }},
+    {GateOR, 2, false, nil, func(in []bool) bool { return in[0] || in[1] }},
+    {GateXOR, 2, false, nil, func(in []bool) bool { return in[0] != in[1] }},
+    {GateNOT, 1, false, nil, func(in []bool) bool { return !in[0] }},
+    {GateCOPY, 1, false, nil, func(in []bool) bool { return in[0] }},
+    {GateCONST, 0, false, nil, func(in []bool) bool { return false }},
+    {GateCONST, 0, true, nil, func(in []bool) bool { return true }},
+    {GateMUX, 3, false, nil, func(in []bool) bool {
+        if in[0] {
+            return in[2]
+        }
+        return in[1]
+    }},
+    {GateTOFFLI, 3, false, nil, func(in []bool) bool { return in[2] != (in[0] && in[1]) }},
+    {GateCNOT, 2, false, nil, func(in []bool) bool { return in[1] != in[0] }},
+    {GateADDK, 2, false, nil, func(in []bool) bool { return in[0] != in[1] }},
+    {GateMULK, 2, false, nil, func(in []bool) bool { return in[0] && in[1] }},
+    {GateMAJ, 3, false, nil, func(in []bool) bool {
+        return (in[0] && in[1]) || (in[0] && in[2]) || (in[1] && in[2])
+    }},
+    {GateLUT, 3, false, majorityTable, func(in []bool) bool {
+        return (in[0] && in[1]) || (in[0] && in[2]) || (in[1] && in[2])
+    }},
+}
+
+// Check that every gate type evaluates to its expected truth table, using
+// both the recursive evaluator and the Evaluator. Returns an error naming
+// the first gate type and input that give the wrong answer.
+func SelfTest() error {
+    for _, tc := range selfTestCases {
+        circ := &Circuit{}
+        numVars := 0
+        if tc.arity > 0 {
+            numVars = 1
+        }
+        if err := circ.initializeCircuit(tc.arity, 1, numVars, 1, []int{tc.arity}[:numVars], []int{1}); err != nil {
+            return err
+        }
+
+        inFrom := make([]int, tc.arity)
+        for j := range inFrom {
+            inFrom[j] = circ.getInputGate(j)
+        }
+        g := circ.addGate(tc.gateType, tc.constVal, inFrom)
+        if g < 0 {
+            return fmt.Errorf("self-test: could not build %v gate", tc.gateType)
+        }
+        circ.Gates[g].TruthTable = tc.table
+        circ.connectOutputWire(g, 0)
+
+        e, err := NewEvaluator(circ)
+        if err != nil {
+            return fmt.Errorf("self-test: %v gate: %w", tc.gateType, err)
+        }
+
+        for m := 0; m < 1 << tc.arity; m++ {
+            in := make([]bool, tc.arity)
+            for j := range in {
+                in[j] = (m >> j) & 1 == 1
+            }
+            want := tc.expected(in)
+
+            ok, got := circ.EvaluateCircuit(in)
+            if !ok || got[0] != want {
+                return fmt.Errorf("self-test: %v gate gives the wrong output for input %v in EvaluateCircuit", tc.gateType, in)
+            }
+            gotIter, err := e.Evaluate(in)
+            if err != nil || gotIter[0] != want {
+                return fmt.Errorf("self-test: %v gate gives the wrong output for input %v in Evaluator", tc.gateType, in)
+            }
+        }
+    }
+    return nil
+}
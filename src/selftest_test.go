@@ -0,0 +1,38 @@
+package toygarble
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestSelfTest(t *testing.T) {
+    if err := SelfTest(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// Every gate type that validCircuit accepts has a self-test case
+func TestSelfTestCoversGateTypes(t *testing.T) {
+    covered := make(map[GateType_t]bool)
+    for _, tc := range selfTestCases {
+        covered[tc.gateType] = true
+    }
+    for gateType := GateType_t(0); int(gateType) < len(gate_type_names); gateType++ {
+        if gateType != GateINPUT && gateType != GateOUTPUT && !covered[gateType] {
+            t.Errorf("no self-test case for %v gates", gateType)
+        }
+    }
+}
+
+// A wrong expectation shows up as an error naming the gate type
+func TestSelfTestDetectsMismatch(t *testing.T) {
+    saved := selfTestCases
+    defer func() { selfTestCases = saved }()
+    selfTestCases = []selfTestCase{
+        {GateAND, 2, false, nil, func(in []bool) bool { return in[0] || in[1] }},
+    }
+    err := SelfTest()
+    if err == nil || !strings.Contains(err.Error(), "AND gate") {
+        t.Errorf("AND checked against OR: got %v", err)
+    }
+}
@@ -0,0 +1,116 @@
+package toygarble
+
+import (
+    "fmt"
+    "math/rand"
+)
+
+//
+// Statistical measures of how inputs affect outputs
+//
+
+// Estimate the avalanche effect of the circuit: for each of samples random
+// inputs, flip every input wire in turn and measure the fraction of output
+// wires that change. Returns the average of that fraction over all flips.
+// An identity circuit on n wires scores 1/n; a good cipher approaches 0.5.
+func (circ *Circuit) AvalancheScore(samples int, rng *rand.Rand) (float64, error) {
+    if samples < 1 {
+        return 0, fmt.Errorf("samples must be positive, got %d", samples)
+    }
+    if circ.NumInputWires == 0 || circ.NumOutputWires == 0 {
+        return 0, fmt.Errorf("circuit needs at least one input and one output wire: %w", ErrWireCountMismatch)
+    }
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return 0, err
+    }
+
+    inputBits := make([]bool, circ.NumInputWires)
+    changed := 0
+    for s := 0; s < samples; s++ {
+        for i := range inputBits {
+            inputBits[i] = rng.Intn(2) == 1
+        }
+        base, err := e.Evaluate(inputBits)
+        if err != nil {
+            return 0, err
+        }
+
+        for i := range inputBits {
+            inputBits[i] = !inputBits[i]
+            flipped, err := e.Evaluate(inputBits)
+            inputBits[i] = !inputBits[i]
+            if err != nil {
+                return 0, err
+            }
+            for o := range base {
+                if base[o] != flipped[o] {
+                    changed++
+                }
+            }
+        }
+    }
+
+    total := samples * circ.NumInputWires * circ.NumOutputWires
+    return float64(changed) / float64(total), nil
+}
+
+// Estimate the bias of each output wire: the fraction of samples random
+// inputs for which it is 1. A constant output scores 0 or 1; a good
+// cipher's outputs should all be near 0.5.
+func (circ *Circuit) OutputBias(samples int, rng *rand.Rand) ([]float64, error) {
+    if samples < 1 {
+        return nil, fmt.Errorf("samples must be positive, got %d", samples)
+    }
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+
+    inputBits := make([]bool, circ.NumInputWires)
+    ones := make([]int, circ.NumOutputWires)
+    for s := 0; s < samples; s++ {
+        for i := range inputBits {
+            inputBits[i] = rng.Intn(2) == 1
+        }
+        out, err := e.Evaluate(inputBits)
+        if err != nil {
+            return nil, err
+        }
+        for o, b := range out {
+            if b {
+                ones[o]++
+            }
+        }
+    }
+
+    bias := make([]float64, circ.NumOutputWires)
+    for o := range bias {
+        bias[o] = float64(ones[o]) / float64(samples)
+    }
+    return bias, nil
+}
+
+// Evaluate the circuit on inputs a and b and return the index of the first
+// output wire on which they differ, or -1 if all outputs agree
+func (circ *Circuit) FirstOutputDifference(a, b []bool) (int, error) {
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return -1, err
+    }
+    outA, err := e.Evaluate(a)
+    if err != nil {
+        return -1, err
+    }
+    outB, err := e.Evaluate(b)
+    if err != nil {
+        return -1, err
+    }
+
+    for i := range outA {
+        if outA[i] != outB[i] {
+            return i, nil
+        }
+    }
+    return -1, nil
+}
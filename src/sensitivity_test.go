@@ -0,0 +1,105 @@
+package toygarble
+
+import (
+    "math"
+    "math/rand"
+    "testing"
+)
+
+func TestAvalancheScore(t *testing.T) {
+    // Each input flips exactly its own output, one of eight
+    b := NewBuilder()
+    x := b.Input("x", 8)
+    identity, err := b.Output("y", x...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    score, err := identity.AvalancheScore(50, rand.New(rand.NewSource(1)))
+    if err != nil || score != 1.0 / 8 {
+        t.Errorf("identity on 8 wires scores %v, %v; want 0.125", score, err)
+    }
+
+    // AES mixes every key and plaintext bit into about half the ciphertext
+    aes := loadAES128(t)
+    score, err = aes.AvalancheScore(4, rand.New(rand.NewSource(1)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if math.Abs(score - 0.5) > 0.02 {
+        t.Errorf("AES-128 scores %v, want about 0.5", score)
+    }
+
+    if _, err := identity.AvalancheScore(0, rand.New(rand.NewSource(1))); err == nil {
+        t.Error("zero samples accepted")
+    }
+}
+
+// An 8-bit comparator with outputs x < y and x == y
+// A constant output is never set, while the parity of the inputs is set
+// about half the time
+func TestOutputBias(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 5)
+    parity := x[0]
+    for _, w := range x[1:] {
+        parity = b.Xor(parity, w)
+    }
+    circ, err := b.Output("out", b.Const(false), parity, b.Const(true)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    bias, err := circ.OutputBias(4000, rand.New(rand.NewSource(161)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(bias) != 3 || bias[0] != 0 || bias[2] != 1 || math.Abs(bias[1] - 0.5) > 0.05 {
+        t.Errorf("got biases %v, want [0 ~0.5 1]", bias)
+    }
+    if _, err := circ.OutputBias(0, rand.New(rand.NewSource(1))); err == nil {
+        t.Error("zero samples accepted")
+    }
+}
+
+func buildComparator(t *testing.T) *Circuit {
+    t.Helper()
+    b := NewBuilder()
+    x := b.Input("x", 8)
+    y := b.Input("y", 8)
+    diff, borrow := b.sub(x, y)
+    nonzero := diff[0]
+    for _, w := range diff[1:] {
+        nonzero = b.Or(nonzero, w)
+    }
+    circ, err := b.Output("lt", borrow).Output("eq", b.Not(nonzero)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return circ
+}
+
+func TestFirstOutputDifference(t *testing.T) {
+    circ := buildComparator(t)
+    inputs := func(x, y byte) []bool {
+        return circ.PadInputsToBoolArray([][]byte{{x}, {y}})
+    }
+    cases := []struct {
+        a, b    [2]byte
+        want    int
+    }{
+        {[2]byte{4, 5}, [2]byte{5, 5}, 0},      // lt flips
+        {[2]byte{5, 5}, [2]byte{6, 5}, 1},      // only eq flips
+        {[2]byte{4, 5}, [2]byte{6, 5}, 0},      // both flip; lt comes first
+        {[2]byte{6, 5}, [2]byte{255, 5}, -1},   // both above the boundary
+        {[2]byte{0, 1}, [2]byte{0, 1}, -1},
+    }
+    for _, c := range cases {
+        got, err := circ.FirstOutputDifference(inputs(c.a[0], c.a[1]), inputs(c.b[0], c.b[1]))
+        if err != nil || got != c.want {
+            t.Errorf("%v vs %v: got %d, %v; want %d", c.a, c.b, got, err, c.want)
+        }
+    }
+
+    if _, err := circ.FirstOutputDifference(inputs(1, 2), inputs(1, 2)[1:]); err == nil {
+        t.Error("accepted a short input")
+    }
+}
@@ -0,0 +1,155 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Sequential circuits, evaluated by unrolling into combinational ones
+//
+
+// Logic with state fed back from one cycle to the next, like registers in
+// hardware. Each cycle runs Step once; output variable StateOutputs[k] of
+// one cycle becomes input variable StateInputs[k] of the next, so the two
+// must have the same width. The other variables are fresh inputs and
+// outputs of every cycle.
+type SequentialCircuit struct {
+    Step            *Circuit
+    StateInputs     []int
+    StateOutputs    []int
+}
+
+// The name of variable i, or prefix and i if the variables are unnamed
+func varName(names []string, count int, i int, prefix string) string {
+    if len(names) == count {
+        return names[i]
+    }
+    return fmt.Sprintf("%s%d", prefix, i)
+}
+
+// Check that the state variables exist, are used once each, and match up
+func (seq *SequentialCircuit) check() error {
+    step := seq.Step
+    if step == nil || !step.validCircuit() {
+        return ErrInvalidCircuit
+    }
+    if len(seq.StateInputs) != len(seq.StateOutputs) {
+        return fmt.Errorf("%d state inputs but %d state outputs: %w", len(seq.StateInputs), len(seq.StateOutputs), ErrWireCountMismatch)
+    }
+    usedIn := make([]bool, step.NumInputVars)
+    usedOut := make([]bool, step.NumOutputVars)
+    for k := range seq.StateInputs {
+        in, out := seq.StateInputs[k], seq.StateOutputs[k]
+        if in < 0 || in >= step.NumInputVars || usedIn[in] {
+            return fmt.Errorf("state input variable %d missing or repeated: %w", in, ErrOutOfRange)
+        }
+        if out < 0 || out >= step.NumOutputVars || usedOut[out] {
+            return fmt.Errorf("state output variable %d missing or repeated: %w", out, ErrOutOfRange)
+        }
+        if step.NumWiresIV[in] != step.NumWiresOV[out] {
+            return fmt.Errorf("state output variable %d has %d wires, input variable %d has %d: %w", out, step.NumWiresOV[out], in, step.NumWiresIV[in], ErrWireCountMismatch)
+        }
+        usedIn[in], usedOut[out] = true, true
+    }
+    return nil
+}
+
+// Unroll a sequential circuit into a combinational one running cycles
+// cycles of it, with the state threaded from each copy of the step to the
+// next. The inputs are the initial state variables, named as in the step,
+// then the other input variables of each cycle in turn, named with the
+// cycle number, e.g. "key_0", "key_1". The outputs are the other output
+// variables of each cycle, named the same way, then the final state under
+// the step's names for the state outputs. Input parties carry over.
+func Unroll(seq *SequentialCircuit, cycles int) (*Circuit, error) {
+    if seq == nil {
+        return nil, ErrInvalidCircuit
+    }
+    if err := seq.check(); err != nil {
+        return nil, err
+    }
+    if cycles < 1 {
+        return nil, fmt.Errorf("can't unroll %d cycles: %w", cycles, ErrOutOfRange)
+    }
+    step := seq.Step
+
+    stateOf := make([]int, step.NumInputVars)
+    for v := range stateOf {
+        stateOf[v] = -1
+    }
+    for k, v := range seq.StateInputs {
+        stateOf[v] = k
+    }
+    isStateOutput := make([]bool, step.NumOutputVars)
+    for _, v := range seq.StateOutputs {
+        isStateOutput[v] = true
+    }
+
+    b := NewBuilder()
+    if step.WireDomain != 0 {
+        b.WireDomain(step.WireDomain)
+    }
+    var parties []int
+    partyOf := func(v int) int {
+        if len(step.InputParty) == 0 {
+            return PARTY_GARBLER
+        }
+        return step.InputParty[v]
+    }
+
+    state := make([][]Wire, len(seq.StateInputs))
+    for k, v := range seq.StateInputs {
+        state[k] = b.Input(varName(step.InputVarNames, step.NumInputVars, v, "in"), step.NumWiresIV[v])
+        parties = append(parties, partyOf(v))
+    }
+    fresh := make([][][]Wire, cycles)
+    for c := range fresh {
+        fresh[c] = make([][]Wire, step.NumInputVars)
+        for v, width := range step.NumWiresIV {
+            if stateOf[v] < 0 {
+                fresh[c][v] = b.Input(fmt.Sprintf("%s_%d", varName(step.InputVarNames, step.NumInputVars, v, "in"), c), width)
+                parties = append(parties, partyOf(v))
+            }
+        }
+    }
+
+    for c := 0; c < cycles; c++ {
+        var inputs []Wire
+        for v := range step.NumWiresIV {
+            if k := stateOf[v]; k >= 0 {
+                inputs = append(inputs, state[k]...)
+            } else {
+                inputs = append(inputs, fresh[c][v]...)
+            }
+        }
+        outputs := b.Embed(fmt.Sprintf("cycle%d", c), step, inputs...)
+        if outputs == nil {
+            break
+        }
+
+        byVar := make([][]Wire, step.NumOutputVars)
+        for v, width := range step.NumWiresOV {
+            byVar[v], outputs = outputs[:width], outputs[width:]
+            if !isStateOutput[v] {
+                b.Output(fmt.Sprintf("%s_%d", varName(step.OutputVarNames, step.NumOutputVars, v, "out"), c), byVar[v]...)
+            }
+        }
+        for k, v := range seq.StateOutputs {
+            state[k] = byVar[v]
+        }
+    }
+    for k, v := range seq.StateOutputs {
+        b.Output(varName(step.OutputVarNames, step.NumOutputVars, v, "out"), state[k]...)
+    }
+
+    circ, err := b.Build()
+    if err != nil {
+        return nil, err
+    }
+    if len(step.InputParty) != 0 {
+        if err := circ.SetInputParty(parties); err != nil {
+            return nil, err
+        }
+    }
+    return circ, nil
+}
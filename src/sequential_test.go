@@ -0,0 +1,90 @@
+package toygarble
+
+import (
+    "slices"
+    "testing"
+)
+
+// Unrolling an LFSR step ten times gives the state after ten steps
+func TestUnrollLFSR(t *testing.T) {
+    step := BuildLFSR(8, []int{0, 2, 3, 4})
+    circ, err := Unroll(&SequentialCircuit{Step: step, StateInputs: []int{0}, StateOutputs: []int{0}}, 10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for start := int64(1); start < 256; start += 17 {
+        state := start
+        for k := 0; k < 10; k++ {
+            out, err := step.EvaluateInts([]int64{state}, []int{8})
+            if err != nil {
+                t.Fatal(err)
+            }
+            state = out[0]
+        }
+        got, err := circ.EvaluateInts([]int64{start}, []int{8})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got[0] != state {
+            t.Errorf("from %#x: got %#x, want %#x", start, got[0], state)
+        }
+    }
+}
+
+// A CRC step takes a fresh message bit each cycle, which the unrolled
+// circuit takes as one input variable per cycle, keeping its party
+func TestUnrollCRC(t *testing.T) {
+    step := BuildCRCStep(8, 0x07)
+    if err := step.SetInputParty([]int{PARTY_GARBLER, PARTY_EVALUATOR}); err != nil {
+        t.Fatal(err)
+    }
+    circ, err := Unroll(&SequentialCircuit{Step: step, StateInputs: []int{0}, StateOutputs: []int{0}}, 8)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if circ.NumInputVars != 9 || circ.NumOutputVars != 1 {
+        t.Fatalf("unrolled circuit has %d inputs and %d outputs", circ.NumInputVars, circ.NumOutputVars)
+    }
+    if circ.InputParty[0] != PARTY_GARBLER || slices.ContainsFunc(circ.InputParty[1:], func(p int) bool { return p != PARTY_EVALUATOR }) {
+        t.Errorf("input parties %v", circ.InputParty)
+    }
+
+    const msg = '1'
+    in := []int64{0}
+    widths := []int{8}
+    crc := int64(0)
+    for i := 7; i >= 0; i-- {
+        bit := int64(msg >> i & 1)
+        in = append(in, bit)
+        widths = append(widths, 1)
+        out, err := step.EvaluateInts([]int64{crc, bit}, []int{8, 1})
+        if err != nil {
+            t.Fatal(err)
+        }
+        crc = out[0]
+    }
+    got, err := circ.EvaluateInts(in, widths)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got[0] != crc {
+        t.Errorf("got CRC %#x, want %#x", got[0], crc)
+    }
+}
+
+func TestUnrollErrors(t *testing.T) {
+    step := BuildCRCStep(8, 0x07)
+    for name, seq := range map[string]*SequentialCircuit{
+        "state widths differ":  {Step: step, StateInputs: []int{1}, StateOutputs: []int{0}},
+        "unpaired state":       {Step: step, StateInputs: []int{0, 1}, StateOutputs: []int{0}},
+        "nonexistent variable": {Step: step, StateInputs: []int{2}, StateOutputs: []int{0}},
+        "no step":              {StateInputs: []int{0}, StateOutputs: []int{0}},
+    } {
+        if _, err := Unroll(seq, 2); err == nil {
+            t.Errorf("%s: unrolled", name)
+        }
+    }
+    if _, err := Unroll(&SequentialCircuit{Step: step, StateInputs: []int{0}, StateOutputs: []int{0}}, 0); err == nil {
+        t.Error("unrolled zero cycles")
+    }
+}
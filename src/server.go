@@ -0,0 +1,106 @@
+package toygarble
+
+import (
+    "fmt"
+    "net"
+    "net/rpc"
+    "sync"
+)
+
+//
+// Remote evaluation over net/rpc
+//
+
+// Input variables packed as for PadInputsToBoolArray
+type EvalRequest struct {
+    Inputs      [][]byte
+}
+
+// Output variables as returned by DecodeOutputVariables
+type EvalResponse struct {
+    Outputs     [][]byte
+}
+
+// The RPC service evaluating a fixed circuit
+type EvalService struct {
+    mu          sync.Mutex
+    circ        *Circuit
+    eval        *Evaluator
+}
+
+func (s *EvalService) Evaluate(req EvalRequest, resp *EvalResponse) error {
+    inputBits := s.circ.PadInputsToBoolArray(req.Inputs)
+    if inputBits == nil {
+        return fmt.Errorf("input buffers don't fit the circuit's input variables")
+    }
+
+    // The evaluator's scratch space is shared between connections
+    s.mu.Lock()
+    outWires, err := s.eval.Evaluate(inputBits)
+    s.mu.Unlock()
+    if err != nil {
+        return err
+    }
+
+    resp.Outputs = s.circ.DecodeOutputVariables(outWires)
+    return nil
+}
+
+// Serve evaluation requests for circ on connections from l. Blocks until
+// the listener fails (e.g., is closed) and returns its error.
+func ServeEval(l net.Listener, circ *Circuit) error {
+    eval, err := NewEvaluator(circ)
+    if err != nil {
+        return err
+    }
+
+    srv := rpc.NewServer()
+    if err := srv.RegisterName("Eval", &EvalService{circ: circ, eval: eval}); err != nil {
+        return err
+    }
+
+    for {
+        conn, err := l.Accept()
+        if err != nil {
+            return err
+        }
+        go srv.ServeConn(conn)
+    }
+}
+
+// Listen on the TCP address addr and serve evaluation requests for circ.
+// Like ServeEval, this only returns on error.
+func StartEvalServer(addr string, circ *Circuit) error {
+    l, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    defer l.Close()
+    return ServeEval(l, circ)
+}
+
+// A connection to an evaluation server
+type EvalClient struct {
+    client      *rpc.Client
+}
+
+func DialEvalServer(addr string) (*EvalClient, error) {
+    client, err := rpc.Dial("tcp", addr)
+    if err != nil {
+        return nil, err
+    }
+    return &EvalClient{client}, nil
+}
+
+// Evaluate the server's circuit on the given input variables
+func (c *EvalClient) Evaluate(inputBufs [][]byte) ([][]byte, error) {
+    var resp EvalResponse
+    if err := c.client.Call("Eval.Evaluate", EvalRequest{inputBufs}, &resp); err != nil {
+        return nil, err
+    }
+    return resp.Outputs, nil
+}
+
+func (c *EvalClient) Close() error {
+    return c.client.Close()
+}
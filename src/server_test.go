@@ -0,0 +1,108 @@
+package toygarble
+
+import (
+    "net"
+    "sync"
+    "testing"
+)
+
+// Start a server for circ on a loopback listener and dial it
+func startLoopbackServer(t *testing.T, circ *Circuit) *EvalClient {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    go ServeEval(l, circ)
+    t.Cleanup(func() { l.Close() })
+
+    client, err := DialEvalServer(l.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { client.Close() })
+    return client
+}
+
+func TestEvalServerLoopback(t *testing.T) {
+    client := startLoopbackServer(t, BuildAdder(8))
+    cases := []struct {
+        x, y, sum byte
+    }{
+        {0, 0, 0},
+        {3, 4, 7},
+        {200, 100, 44},
+        {255, 1, 0},
+    }
+    for _, c := range cases {
+        out, err := client.Evaluate([][]byte{{c.x}, {c.y}})
+        if err != nil {
+            t.Fatalf("%d + %d: %v", c.x, c.y, err)
+        }
+        if len(out) != 1 || len(out[0]) != 1 || out[0][0] != c.sum {
+            t.Errorf("%d + %d = %v, want %d", c.x, c.y, out, c.sum)
+        }
+    }
+}
+
+// Clients on separate connections share the server's evaluator
+func TestEvalServerConcurrentClients(t *testing.T) {
+    circ := BuildAdder(8)
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer l.Close()
+    go ServeEval(l, circ)
+
+    var wg sync.WaitGroup
+    for c := 0; c < 4; c++ {
+        wg.Add(1)
+        go func(c int) {
+            defer wg.Done()
+            client, err := DialEvalServer(l.Addr().String())
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            defer client.Close()
+            for x := 0; x < 64; x++ {
+                out, err := client.Evaluate([][]byte{{byte(x)}, {byte(c)}})
+                if err != nil {
+                    t.Error(err)
+                    return
+                }
+                if out[0][0] != byte(x+c) {
+                    t.Errorf("client %d: %d + %d = %d", c, x, c, out[0][0])
+                    return
+                }
+            }
+        }(c)
+    }
+    wg.Wait()
+}
+
+func TestEvalServerBadInput(t *testing.T) {
+    client := startLoopbackServer(t, BuildAdder(8))
+    if _, err := client.Evaluate([][]byte{{1, 2}, {3}}); err == nil {
+        t.Error("an oversized input buffer was accepted")
+    }
+
+    // The connection stays usable after a rejected request
+    out, err := client.Evaluate([][]byte{{1}, {2}})
+    if err != nil || out[0][0] != 3 {
+        t.Errorf("1 + 2 = %v, %v after a bad request", out, err)
+    }
+}
+
+func TestServeEvalInvalidCircuit(t *testing.T) {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer l.Close()
+    circ := BuildAdder(8)
+    circ.Gates[len(circ.Gates)-1].InFrom[0] = len(circ.Gates)
+    if err := ServeEval(l, circ); err == nil {
+        t.Error("ServeEval accepted an invalid circuit")
+    }
+}
@@ -0,0 +1,128 @@
+package toygarble
+
+import (
+    "unsafe"
+)
+
+const (
+    // Size of a garbled wire label (128 bits), used for estimates
+    LABEL_SIZE_BYTES    int = 16
+)
+
+//
+// Gate counts and related statistics
+//
+
+type Stats struct {
+    // Total number of gates (including input and output wires), and the
+    // number of those that are logic gates
+    NumWires        int
+    NumGates        int
+
+    NumInputWires   int
+    NumOutputWires  int
+
+    // Histogram of gate types, including input and output wires
+    GateCounts      map[GateType_t]int
+}
+
+// Count the gates in the circuit by type
+func (circ *Circuit) Stats() Stats {
+    stats := Stats{
+        NumWires:       len(circ.Gates),
+        NumInputWires:  circ.NumInputWires,
+        NumOutputWires: circ.NumOutputWires,
+        GateCounts:     make(map[GateType_t]int),
+    }
+
+    for i := range circ.Gates {
+        stats.GateCounts[circ.Gates[i].GateType]++
+        if circ.Gates[i].GateType != GateINPUT && circ.Gates[i].GateType != GateOUTPUT {
+            stats.NumGates++
+        }
+    }
+    return stats
+}
+
+// Gates that cost nothing to garble under Free-XOR: XOR, CNOT and NOT (an
+// XOR with the global offset), plus wiring that needs no table at all
+func isFreeGate(gateType GateType_t) bool {
+    switch gateType {
+    case GateXOR, GateCNOT, GateADDK, GateNOT, GateCOPY, GateCONST:
+        return true
+    }
+    return false
+}
+
+// Number of logic gates that need a garbled table under Free-XOR
+func (circ *Circuit) NonFreeGateCount() int {
+    stats := circ.Stats()
+    count := 0
+    for gateType, n := range stats.GateCounts {
+        if gateType != GateINPUT && gateType != GateOUTPUT && !isFreeGate(gateType) {
+            count += n
+        }
+    }
+    return count
+}
+
+// Fraction of logic gates that are free under Free-XOR, or 0 if the
+// circuit has no logic gates
+func (circ *Circuit) FreeGateRatio() float64 {
+    stats := circ.Stats()
+    if stats.NumGates == 0 {
+        return 0
+    }
+    return float64(stats.NumGates - circ.NonFreeGateCount()) / float64(stats.NumGates)
+}
+
+// Number of AND gates left after LowerPreservingXOR, which under Free-XOR
+// and half-gates is the number of gates needing ciphertexts. The circuit
+// itself is not modified.
+func (circ *Circuit) EstimateGarbledANDs() (int, error) {
+    lowered := circ.Clone()
+    if err := lowered.LowerPreservingXOR(); err != nil {
+        return 0, err
+    }
+    return lowered.Stats().GateCounts[GateAND], nil
+}
+
+// Approximate memory needed to work with a circuit, in bytes
+type MemoryEstimate struct {
+    // The Gates slice, including each gate's input list and truth table
+    GatesBytes          int
+
+    // Scratch space for one EvaluateCircuit call
+    EvaluationBytes     int
+
+    // Both labels of every wire, plus one table row per input combination
+    // of every non-free gate (as in textbook point-and-permute garbling
+    // with Free-XOR)
+    GarblingBytes       int
+}
+
+// Estimate how much memory the circuit takes to store, evaluate and garble
+func (circ *Circuit) EstimateMemory() MemoryEstimate {
+    var estimate MemoryEstimate
+    numWires := len(circ.Gates)
+
+    estimate.GatesBytes = numWires * int(unsafe.Sizeof(Gate{}))
+    for i := range circ.Gates {
+        estimate.GatesBytes += len(circ.Gates[i].InFrom) * int(unsafe.Sizeof(int(0)))
+        estimate.GatesBytes += len(circ.Gates[i].TruthTable)
+    }
+
+    // EvaluateCircuit keeps visited, calculated and value flags per gate,
+    // plus the input values indexed by gate
+    estimate.EvaluationBytes = 4 * numWires + circ.NumOutputWires
+
+    estimate.GarblingBytes = 2 * numWires * LABEL_SIZE_BYTES
+    for i := range circ.Gates {
+        gateType := circ.Gates[i].GateType
+        if gateType != GateINPUT && gateType != GateOUTPUT && !isFreeGate(gateType) {
+            estimate.GarblingBytes += (1 << len(circ.Gates[i].InFrom)) * LABEL_SIZE_BYTES
+        }
+    }
+
+    return estimate
+}
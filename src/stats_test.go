@@ -0,0 +1,137 @@
+package toygarble
+
+import (
+    "math"
+    "testing"
+)
+
+func TestFreeGateRatio(t *testing.T) {
+    xors := buildChain(t, GateXOR, 8)
+    if n := xors.NonFreeGateCount(); n != 0 {
+        t.Errorf("all-XOR circuit has %d non-free gates", n)
+    }
+    if r := xors.FreeGateRatio(); r != 1 {
+        t.Errorf("all-XOR circuit has ratio %v, want 1", r)
+    }
+
+    ands := buildChain(t, GateAND, 8)
+    if n := ands.NonFreeGateCount(); n != 7 {
+        t.Errorf("all-AND circuit has %d non-free gates, want 7", n)
+    }
+    if r := ands.FreeGateRatio(); r != 0 {
+        t.Errorf("all-AND circuit has ratio %v, want 0", r)
+    }
+
+    b := NewBuilder()
+    x := b.Input("x", 4)
+    mixed, err := b.Output("out", b.Xor(b.And(x[0], x[1]), b.Xor(x[2], x[3]))).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if r := mixed.FreeGateRatio(); math.Abs(r - 2.0 / 3) > 1e-9 {
+        t.Errorf("mixed circuit has ratio %v, want 2/3", r)
+    }
+
+    if r := (&Circuit{}).FreeGateRatio(); r != 0 {
+        t.Errorf("empty circuit has ratio %v", r)
+    }
+}
+
+func TestStats(t *testing.T) {
+    circ := buildChain(t, GateAND, 5)
+    stats := circ.Stats()
+    if stats.NumWires != len(circ.Gates) || stats.NumGates != 4 {
+        t.Errorf("got %d wires and %d gates, want %d and 4", stats.NumWires, stats.NumGates, len(circ.Gates))
+    }
+    if stats.GateCounts[GateINPUT] != 5 || stats.GateCounts[GateOUTPUT] != 1 || stats.GateCounts[GateAND] != 4 {
+        t.Errorf("gate counts %v", stats.GateCounts)
+    }
+}
+
+// In a chain every added input brings the same gates, so each part of the
+// estimate grows by the same amount each time the chain gets longer
+func TestEstimateMemoryLinear(t *testing.T) {
+    for _, gateType := range []GateType_t{GateAND, GateXOR} {
+        var estimates []MemoryEstimate
+        for _, n := range []int{100, 200, 300, 400} {
+            estimates = append(estimates, buildChain(t, gateType, n).EstimateMemory())
+        }
+        for i := 2; i < len(estimates); i++ {
+            prev, cur := estimates[i-1], estimates[i]
+            step := MemoryEstimate{
+                cur.GatesBytes - prev.GatesBytes,
+                cur.EvaluationBytes - prev.EvaluationBytes,
+                cur.GarblingBytes - prev.GarblingBytes,
+            }
+            first := MemoryEstimate{
+                prev.GatesBytes - estimates[i-2].GatesBytes,
+                prev.EvaluationBytes - estimates[i-2].EvaluationBytes,
+                prev.GarblingBytes - estimates[i-2].GarblingBytes,
+            }
+            if step != first {
+                t.Errorf("%v chain: estimate grows by %+v, then by %+v", gateType, first, step)
+            }
+        }
+
+        // 100 more inputs is 200 more gates, each with two labels
+        step := estimates[1].GarblingBytes - estimates[0].GarblingBytes
+        want := 200 * 2 * LABEL_SIZE_BYTES
+        if gateType == GateAND {
+            // plus a four-row table for each of the 100 ANDs
+            want += 100 * 4 * LABEL_SIZE_BYTES
+        }
+        if step != want {
+            t.Errorf("%v chain: garbling estimate grows by %d per 100 inputs, want %d", gateType, step, want)
+        }
+    }
+}
+
+func TestEstimateGarbledANDs(t *testing.T) {
+    // The ripple-carry adder spends one AND per bit, and saturation one
+    // more per bit for its MUX
+    circ := BuildSaturatingAdder(4)
+    before := circ.Clone()
+    if n, err := circ.EstimateGarbledANDs(); err != nil || n != 8 {
+        t.Errorf("4-bit saturating adder: %d garbled ANDs, %v; want 8", n, err)
+    }
+    if report, err := Diff(before, circ); err != nil || !report.Empty() {
+        t.Errorf("EstimateGarbledANDs modified the circuit: %v", report)
+    }
+
+    // OR and MUX cost one each, XOR and NOT nothing, and a 3-input LUT
+    // for majority (x0 x1 + x0 x2 + x1 x2) three
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    maj := b.LUT(x, []bool{false, false, false, true, false, true, true, true})
+    outs := []Wire{b.Or(x[0], x[1]), b.Mux(x[0], x[1], x[2]), b.Not(b.Xor(x[1], x[2])), maj}
+    circ, err := b.Output("out", outs...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n, err := circ.EstimateGarbledANDs(); err != nil || n != 5 {
+        t.Errorf("%d garbled ANDs, %v; want 5", n, err)
+    }
+}
+
+// The evaluation estimate matches what EvaluateCircuit really allocates, up
+// to the allocator rounding each slice up to its size class
+func TestEstimateMemoryEvaluation(t *testing.T) {
+    circuits := map[string]*Circuit{
+        "AND chain":    buildChain(t, GateAND, 300),
+        "multiplier":   loadMult64(t),
+    }
+    for name, circ := range circuits {
+        in := make([]bool, circ.NumInputWires)
+        var ok bool
+        got := int(allocatedBytes(func() {
+            ok, _ = circ.EvaluateCircuit(in)
+        }))
+        if !ok {
+            t.Fatalf("%s: evaluation failed", name)
+        }
+        want := circ.EstimateMemory().EvaluationBytes
+        if got < want || got > want + want / 8 + 1024 {
+            t.Errorf("%s: evaluation allocated %d bytes, estimate is %d", name, got, want)
+        }
+    }
+}
@@ -0,0 +1,296 @@
+package toygarble
+
+import (
+    "fmt"
+    "strings"
+)
+
+//
+// Symbolic evaluation into boolean formulas
+//
+
+const (
+    // Largest formula, in operators and variables, SymbolicOutput builds
+    // before giving up. Formulas are trees, so a gate used many times is
+    // written out in full each time.
+    SYMBOLIC_MAX_SIZE   int = 4096
+)
+
+type symOp int
+
+const (
+    symFalse    symOp = iota
+    symTrue
+    symVar
+    symNot
+    symAnd
+    symOr
+    symXor
+)
+
+var symOpNames = [...]string{symAnd: " AND ", symOr: " OR ", symXor: " XOR "}
+
+// A node of a boolean formula. Nodes are built only through the sym*
+// functions, which keep them simplified, and are never modified.
+type symExpr struct {
+    op      symOp
+    name    string
+    args    []*symExpr
+
+    // Number of operators and variables
+    size    int
+
+    // The formula as printed, which also serves to compare formulas
+    text    string
+}
+
+var symConst = [2]*symExpr{{op: symFalse, size: 1, text: "0"}, {op: symTrue, size: 1, text: "1"}}
+
+func symVariable(name string) *symExpr {
+    return &symExpr{op: symVar, name: name, size: 1, text: name}
+}
+
+func (e *symExpr) isConst() bool {
+    return e.op == symFalse || e.op == symTrue
+}
+
+// The formula as an operand of another operator, parenthesized unless it
+// is a single term
+func (e *symExpr) operand() string {
+    if e.op == symAnd || e.op == symOr || e.op == symXor {
+        return "(" + e.text + ")"
+    }
+    return e.text
+}
+
+func symNotOf(x *symExpr) *symExpr {
+    switch x.op {
+    case symFalse:
+        return symConst[1]
+    case symTrue:
+        return symConst[0]
+    case symNot:
+        return x.args[0]
+    }
+    return &symExpr{op: symNot, args: []*symExpr{x}, size: x.size + 1, text: "NOT " + x.operand()}
+}
+
+// Join simplified arguments into one node of an associative operator
+func symJoin(op symOp, args []*symExpr) *symExpr {
+    if len(args) == 1 {
+        return args[0]
+    }
+    e := &symExpr{op: op, args: args, size: 1}
+    operands := make([]string, len(args))
+    for i, a := range args {
+        e.size += a.size
+        operands[i] = a.operand()
+    }
+    e.text = strings.Join(operands, symOpNames[op])
+    return e
+}
+
+// Flatten nested uses of an associative operator into one argument list
+func symFlatten(op symOp, xs []*symExpr) []*symExpr {
+    var flat []*symExpr
+    for _, x := range xs {
+        if x.op == op {
+            flat = append(flat, x.args...)
+        } else {
+            flat = append(flat, x)
+        }
+    }
+    return flat
+}
+
+// AND (or, with dominant true, OR) of the arguments, dropping identities
+// and repeats, and spotting x combined with NOT x
+func symAndOr(op symOp, xs []*symExpr) *symExpr {
+    dominant, identity := symConst[0], symConst[1]
+    if op == symOr {
+        dominant, identity = symConst[1], symConst[0]
+    }
+
+    seen := make(map[string]bool)
+    var args []*symExpr
+    for _, x := range symFlatten(op, xs) {
+        if x == dominant || x.op == dominant.op {
+            return dominant
+        }
+        if x.isConst() || seen[x.text] {
+            continue
+        }
+        if seen[symNotOf(x).text] {
+            return dominant
+        }
+        seen[x.text] = true
+        args = append(args, x)
+    }
+    if len(args) == 0 {
+        return identity
+    }
+    return symJoin(op, args)
+}
+
+// XOR of the arguments, folding constants and cancelling pairs
+func symXorOf(xs []*symExpr) *symExpr {
+    parity := false
+    count := make(map[string]int)
+    var distinct []*symExpr
+    for _, x := range symFlatten(symXor, xs) {
+        if x.isConst() {
+            parity = parity != (x.op == symTrue)
+            continue
+        }
+        if x.op == symNot {
+            parity = !parity
+            x = x.args[0]
+        }
+        if count[x.text] == 0 {
+            distinct = append(distinct, x)
+        }
+        count[x.text]++
+    }
+
+    var args []*symExpr
+    for _, x := range distinct {
+        if count[x.text] % 2 == 1 {
+            args = append(args, x)
+        }
+    }
+    if len(args) == 0 {
+        return symConst[boolIndex(parity)]
+    }
+    e := symJoin(symXor, args)
+    if parity {
+        e = symNotOf(e)
+    }
+    return e
+}
+
+func boolIndex(b bool) int {
+    if b {
+        return 1
+    }
+    return 0
+}
+
+// The name of each input wire in formulas: its variable's name, indexed by
+// bit if the variable is wider than one wire, or "in" and the wire number
+// for unnamed variables
+func (circ *Circuit) inputWireNames() []string {
+    names := make([]string, 0, circ.NumInputWires)
+    for v, width := range circ.NumWiresIV {
+        for j := 0; j < width; j++ {
+            switch {
+            case len(circ.InputVarNames) != circ.NumInputVars:
+                names = append(names, fmt.Sprintf("in%d", len(names)))
+            case width == 1:
+                names = append(names, circ.InputVarNames[v])
+            default:
+                names = append(names, fmt.Sprintf("%s[%d]", circ.InputVarNames[v], j))
+            }
+        }
+    }
+    return names
+}
+
+// Derive a boolean formula for an output wire, such as "(a AND b) XOR c",
+// by evaluating the circuit on symbols for its inputs (named as their
+// variables, with a bit index for wider ones). Constants are folded and
+// repeated or complementary terms simplified, but the result is not
+// minimal, and shared subformulas are written out wherever they are used.
+// Gives up with ErrLimitExceeded once the formula would have more than
+// SYMBOLIC_MAX_SIZE terms, so this is only for small circuits.
+func (circ *Circuit) SymbolicOutput(outputWire int) (string, error) {
+    if outputWire < 0 || outputWire >= circ.NumOutputWires {
+        return "", fmt.Errorf("output wire %d out of range: %w", outputWire, ErrOutOfRange)
+    }
+    if !circ.validCircuit() {
+        return "", ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return "", err
+    }
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return "", err
+    }
+
+    root := circ.getOutputGate(outputWire)
+    inCone := circ.cone([]int{root})
+    values := make([]*symExpr, len(circ.Gates))
+    for i, name := range circ.inputWireNames() {
+        values[circ.getInputGate(i)] = symVariable(name)
+    }
+
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        if !inCone[g] || gate.GateType == GateINPUT {
+            continue
+        }
+        in := make([]*symExpr, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            in[j] = values[from]
+        }
+
+        var e *symExpr
+        switch gate.GateType {
+        case GateOUTPUT, GateCOPY:
+            e = in[0]
+        case GateCONST:
+            e = symConst[boolIndex(gate.ConstVal)]
+        case GateNOT:
+            e = symNotOf(in[0])
+        case GateAND, GateMULK:
+            e = symAndOr(symAnd, in)
+        case GateOR:
+            e = symAndOr(symOr, in)
+        case GateXOR, GateCNOT, GateADDK:
+            e = symXorOf(in)
+        case GateMUX:
+            if in[1].text == in[2].text {
+                e = in[1]
+            } else {
+                e = symAndOr(symOr, []*symExpr{
+                    symAndOr(symAnd, []*symExpr{symNotOf(in[0]), in[1]}),
+                    symAndOr(symAnd, []*symExpr{in[0], in[2]}),
+                })
+            }
+        case GateTOFFLI:
+            e = symXorOf([]*symExpr{in[2], symAndOr(symAnd, in[:2])})
+        case GateMAJ:
+            e = symAndOr(symOr, []*symExpr{
+                symAndOr(symAnd, []*symExpr{in[0], in[1]}),
+                symAndOr(symAnd, []*symExpr{in[0], in[2]}),
+                symAndOr(symAnd, []*symExpr{in[1], in[2]}),
+            })
+        case GateLUT:
+            // Sum of products over the rows that output 1
+            var rows []*symExpr
+            for k, out := range gate.TruthTable {
+                if !out {
+                    continue
+                }
+                literals := make([]*symExpr, len(in))
+                for j := range in {
+                    literals[j] = in[j]
+                    if k & (1 << j) == 0 {
+                        literals[j] = symNotOf(in[j])
+                    }
+                }
+                rows = append(rows, symAndOr(symAnd, literals))
+            }
+            e = symAndOr(symOr, rows)
+        default:
+            return "", fmt.Errorf("unknown gate type %d for %d: %w", gate.GateType, g, ErrInvalidGate)
+        }
+
+        if e.size > SYMBOLIC_MAX_SIZE {
+            return "", fmt.Errorf("formula for gate %d has %d terms, more than %d: %w", g, e.size, SYMBOLIC_MAX_SIZE, ErrLimitExceeded)
+        }
+        values[g] = e
+    }
+
+    return values[root].text, nil
+}
@@ -0,0 +1,52 @@
+package toygarble
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestSymbolicOutput(t *testing.T) {
+    b := NewBuilder()
+    a := b.Input("a", 1)[0]
+    y := b.Input("b", 1)[0]
+    cin := b.Input("cin", 1)[0]
+    sum, carry := b.FullAdder(a, y, cin)
+    circ, err := b.Output("out",
+        sum,
+        carry,
+        b.Xor(a, a),
+        b.Or(a, b.Not(a)),
+        b.Mux(a, y, cin),
+        b.Not(b.Not(b.And(a, b.And(y, a)))),
+    ).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i, want := range []string{
+        "a XOR b XOR cin",
+        "(a AND b) OR (a AND cin) OR (b AND cin)",
+        "0",
+        "1",
+        "(NOT a AND b) OR (a AND cin)",
+        "a AND b",
+    } {
+        got, err := circ.SymbolicOutput(i)
+        if err != nil || got != want {
+            t.Errorf("output %d: got %q (%v), want %q", i, got, err, want)
+        }
+    }
+    if _, err := circ.SymbolicOutput(6); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("nonexistent output: %v", err)
+    }
+
+    // Bits of wider variables are indexed
+    if got, err := BuildAdder(2).SymbolicOutput(0); err != nil || got != "x[0] XOR y[0]" {
+        t.Errorf("adder's low bit: got %q (%v)", got, err)
+    }
+}
+
+func TestSymbolicOutputTooLarge(t *testing.T) {
+    if _, err := BuildDivMod(16).SymbolicOutput(31); !errors.Is(err, ErrLimitExceeded) {
+        t.Errorf("got %v, want ErrLimitExceeded", err)
+    }
+}
@@ -0,0 +1,225 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Synthesis of small circuits directly from Go functions
+//
+
+const (
+    // Largest input width we're willing to enumerate. Synthesis evaluates
+    // the function on every one of the 2^numInputs inputs, so the cost
+    // (and the size of the resulting circuit) is exponential in this value.
+    MAX_SYNTH_INPUTS    int = 12
+)
+
+// Evaluate f on every possible input and return the table of outputs,
+// indexed by the input assignment (bit i of the index is input wire i).
+func tabulateFunction(numInputs int, f func([]bool) []bool, numOutputs int) ([][]bool, error) {
+    if numInputs < 1 || numInputs > MAX_SYNTH_INPUTS {
+        return nil, fmt.Errorf("numInputs must be between 1 and %d, got %d", MAX_SYNTH_INPUTS, numInputs)
+    }
+    if numOutputs < 1 {
+        return nil, fmt.Errorf("numOutputs must be at least 1, got %d", numOutputs)
+    }
+
+    table := make([][]bool, 1 << numInputs)
+    for m := range table {
+        in := make([]bool, numInputs)
+        for i := 0; i < numInputs; i++ {
+            in[i] = (m >> i) & 1 == 1
+        }
+
+        out := f(in)
+        if len(out) != numOutputs {
+            return nil, fmt.Errorf("function returned %d outputs on input %d, expected %d", len(out), m, numOutputs)
+        }
+        table[m] = out
+    }
+
+    return table, nil
+}
+
+// Build a circuit implementing f as a sum of products over its minterms.
+// The circuit has a single input variable of numInputs wires and a single
+// output variable of numOutputs wires. Both the running time and the gate
+// count are exponential in numInputs, which is capped at MAX_SYNTH_INPUTS;
+// this is meant for test scaffolding on tiny functions only.
+func SynthesizeFromTruthTable(numInputs int, f func([]bool) []bool, numOutputs int) (*Circuit, error) {
+    table, err := tabulateFunction(numInputs, f, numOutputs)
+    if err != nil {
+        return nil, err
+    }
+
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(numInputs, numOutputs, 1, 1, []int{numInputs}, []int{numOutputs}); err != nil {
+        return nil, err
+    }
+
+    // Negated inputs and product terms are created lazily and shared
+    // between outputs
+    negated := make([]int, numInputs)
+    for i := range negated {
+        negated[i] = -1
+    }
+    products := make(map[int]int)
+
+    for o := 0; o < numOutputs; o++ {
+        // Collect the minterms for which this output is set
+        minterms := make([]int, 0)
+        for m := range table {
+            if table[m][o] {
+                minterms = append(minterms, m)
+            }
+        }
+
+        var outGate int
+        if len(minterms) == 0 || len(minterms) == len(table) {
+            // Constant output, don't bother building any logic
+            outGate = circ.addGate(GateCONST, len(minterms) != 0, nil)
+        } else {
+            outGate = -1
+            for _, m := range minterms {
+                term, ok := products[m]
+                if !ok {
+                    // AND together one literal per input
+                    term = -1
+                    for i := 0; i < numInputs; i++ {
+                        literal := circ.getInputGate(i)
+                        if (m >> i) & 1 == 0 {
+                            if negated[i] < 0 {
+                                negated[i] = circ.addGate(GateNOT, false, []int{literal})
+                            }
+                            literal = negated[i]
+                        }
+
+                        if term < 0 {
+                            term = literal
+                        } else {
+                            term = circ.addGate2(GateAND, term, literal)
+                        }
+                    }
+                    products[m] = term
+                }
+
+                // OR the product into the running sum
+                if outGate < 0 {
+                    outGate = term
+                } else {
+                    outGate = circ.addGate2(GateOR, outGate, term)
+                }
+            }
+        }
+
+        circ.connectOutputWire(outGate, o)
+    }
+
+    return circ, nil
+}
+
+// A node in a reduced ordered BDD. Nodes 0 and 1 are the false and true
+// terminals; every other node tests input wire v and continues to lo or hi.
+type bddNode struct {
+    v   int
+    lo  int
+    hi  int
+}
+
+// Build (or find) the reduced BDD node for table entries [start, start+span)
+// of output o. The top variable of the span is wire v, which selects between
+// the lower and upper halves of the range.
+func bddBuild(table [][]bool, o int, start int, span int, v int, nodes *[]bddNode, unique map[bddNode]int) int {
+    if span == 1 {
+        if table[start][o] {
+            return 1
+        }
+        return 0
+    }
+
+    lo := bddBuild(table, o, start, span/2, v-1, nodes, unique)
+    hi := bddBuild(table, o, start+span/2, span/2, v-1, nodes, unique)
+
+    // Reduction rule: skip tests whose branches agree
+    if lo == hi {
+        return lo
+    }
+
+    // Reduction rule: share structurally identical nodes
+    key := bddNode{v, lo, hi}
+    if id, ok := unique[key]; ok {
+        return id
+    }
+    *nodes = append(*nodes, key)
+    unique[key] = len(*nodes) - 1
+    return len(*nodes) - 1
+}
+
+// Build a circuit implementing f from a reduced ordered BDD of each of its
+// outputs, emitting one MUX gate per BDD node. The number of outputs is
+// taken from f's result. For structured functions this is usually far
+// smaller than SynthesizeFromTruthTable, but construction still enumerates
+// all 2^numInputs inputs, so numInputs is capped at MAX_SYNTH_INPUTS.
+func SynthesizeBDD(numInputs int, f func([]bool) []bool) (*Circuit, error) {
+    if numInputs < 1 || numInputs > MAX_SYNTH_INPUTS {
+        return nil, fmt.Errorf("numInputs must be between 1 and %d, got %d", MAX_SYNTH_INPUTS, numInputs)
+    }
+    numOutputs := len(f(make([]bool, numInputs)))
+
+    table, err := tabulateFunction(numInputs, f, numOutputs)
+    if err != nil {
+        return nil, err
+    }
+
+    // Build the BDDs for all outputs over a shared node table, testing
+    // the highest input wire at the root
+    nodes := []bddNode{{-1, 0, 0}, {-1, 1, 1}}
+    unique := make(map[bddNode]int)
+    roots := make([]int, numOutputs)
+    for o := 0; o < numOutputs; o++ {
+        roots[o] = bddBuild(table, o, 0, len(table), numInputs-1, &nodes, unique)
+    }
+
+    circ := &Circuit{}
+    if err := circ.initializeCircuit(numInputs, numOutputs, 1, 1, []int{numInputs}, []int{numOutputs}); err != nil {
+        return nil, err
+    }
+
+    // At most one gate per node, plus the two constants
+    circ.Reserve(len(nodes))
+
+    // Emit gates for each node. Nodes are created children-first, so a
+    // single forward pass sees every child before its parent.
+    gateOf := make([]int, len(nodes))
+    for id := range nodes {
+        n := nodes[id]
+        switch {
+        case id < 2:
+            gateOf[id] = -1 // terminals are emitted on demand below
+            continue
+        case n.lo == 0 && n.hi == 1:
+            gateOf[id] = circ.getInputGate(n.v)
+            continue
+        case n.lo == 1 && n.hi == 0:
+            gateOf[id] = circ.addGate(GateNOT, false, []int{circ.getInputGate(n.v)})
+            continue
+        }
+
+        for _, child := range []int{n.lo, n.hi} {
+            if child < 2 && gateOf[child] < 0 {
+                gateOf[child] = circ.addGate(GateCONST, child == 1, nil)
+            }
+        }
+        gateOf[id] = circ.addGate3(GateMUX, circ.getInputGate(n.v), gateOf[n.lo], gateOf[n.hi])
+    }
+
+    for o, root := range roots {
+        if root < 2 && gateOf[root] < 0 {
+            gateOf[root] = circ.addGate(GateCONST, root == 1, nil)
+        }
+        circ.connectOutputWire(gateOf[root], o)
+    }
+
+    return circ, nil
+}
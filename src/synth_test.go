@@ -0,0 +1,88 @@
+package toygarble
+
+import (
+    "slices"
+    "testing"
+)
+
+// Check that circ computes f on every input of n bits
+func checkImplements(t *testing.T, circ *Circuit, n int, f func([]bool) []bool) {
+    t.Helper()
+    if !circ.validCircuit() {
+        t.Fatal("circuit is invalid")
+    }
+    for m := 0; m < 1 << n; m++ {
+        in := make([]bool, n)
+        for i := range in {
+            in[i] = m >> i & 1 == 1
+        }
+        ok, out := circ.EvaluateCircuit(in)
+        if want := f(in); !ok || !slices.Equal(out, want) {
+            t.Fatalf("on %v: got %v, want %v", in, out, want)
+        }
+    }
+}
+
+// Parity, majority of the first three, and two constants
+func sampleFunction(in []bool) []bool {
+    parity := false
+    for _, b := range in {
+        parity = parity != b
+    }
+    majority := (in[0] && in[1]) || (in[0] && in[2]) || (in[1] && in[2])
+    return []bool{parity, majority, false, true}
+}
+
+func TestSynthesizeFromTruthTable(t *testing.T) {
+    for n := 3; n <= 6; n++ {
+        circ, err := SynthesizeFromTruthTable(n, sampleFunction, 4)
+        if err != nil {
+            t.Fatal(err)
+        }
+        checkImplements(t, circ, n, sampleFunction)
+    }
+}
+
+func TestSynthesizeFromTruthTableErrors(t *testing.T) {
+    if _, err := SynthesizeFromTruthTable(0, sampleFunction, 4); err == nil {
+        t.Error("no inputs accepted")
+    }
+    if _, err := SynthesizeFromTruthTable(MAX_SYNTH_INPUTS + 1, sampleFunction, 4); err == nil {
+        t.Error("too many inputs accepted")
+    }
+    if _, err := SynthesizeFromTruthTable(3, sampleFunction, 2); err == nil {
+        t.Error("wrong number of outputs accepted")
+    }
+}
+
+func TestSynthesizeBDD(t *testing.T) {
+    for n := 3; n <= 8; n++ {
+        circ, err := SynthesizeBDD(n, sampleFunction)
+        if err != nil {
+            t.Fatal(err)
+        }
+        checkImplements(t, circ, n, sampleFunction)
+    }
+}
+
+// Parity has a BDD of two nodes per variable, against the 2^(n-1)
+// product terms of a sum of products
+func TestSynthesizeBDDSmaller(t *testing.T) {
+    parity := func(in []bool) []bool {
+        return sampleFunction(in)[:1]
+    }
+    bdd, err := SynthesizeBDD(8, parity)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sop, err := SynthesizeFromTruthTable(8, parity, 1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bdd.GateCount() * 10 > sop.GateCount() {
+        t.Errorf("BDD circuit has %d gates, sum of products %d", bdd.GateCount(), sop.GateCount())
+    }
+    if _, err := SynthesizeBDD(MAX_SYNTH_INPUTS + 1, parity); err == nil {
+        t.Error("too many inputs accepted")
+    }
+}
@@ -0,0 +1,211 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Three-valued (0, 1, unknown) evaluation
+//
+
+type Ternary int
+
+const (
+    TernaryFalse    Ternary = 0
+    TernaryTrue     Ternary = 1
+    TernaryX        Ternary = 2
+)
+
+// Convert a bool into a definite ternary value
+func ternaryOf(b bool) Ternary {
+    if b {
+        return TernaryTrue
+    }
+    return TernaryFalse
+}
+
+// Evaluate the circuit where some inputs may be unknown (TernaryX). An
+// output comes out definite only if it has the same value for every
+// assignment of the unknown inputs; the converse doesn't hold, since e.g.
+// XOR(x, x) is reported as unknown.
+func (circ *Circuit) EvaluateTernary(inputs []Ternary) ([]Ternary, error) {
+    if len(inputs) != circ.NumInputWires {
+        return nil, fmt.Errorf("got %d inputs, circuit has %d input wires: %w", len(inputs), circ.NumInputWires, ErrWireCountMismatch)
+    }
+    if !circ.validCircuit() {
+        return nil, ErrInvalidCircuit
+    }
+    if err := circ.requireBoolean(); err != nil {
+        return nil, err
+    }
+
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, err
+    }
+
+    values := make([]Ternary, len(circ.Gates))
+    for i := 0; i < circ.NumInputWires; i++ {
+        values[circ.getInputGate(i)] = inputs[i]
+    }
+
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        if len(gate.InFrom) < min_input_wires[gate.GateType] || len(gate.InFrom) > max_input_wires[gate.GateType] {
+            return nil, fmt.Errorf("gate %d has %d input wires: %w", g, len(gate.InFrom), ErrInvalidGate)
+        }
+
+        in := make([]Ternary, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            in[j] = values[from]
+        }
+
+        switch gate.GateType {
+        case GateINPUT:
+            // Already set above
+
+        case GateOUTPUT, GateCOPY:
+            values[g] = in[0]
+
+        case GateCONST:
+            values[g] = ternaryOf(gate.ConstVal)
+
+        case GateAND, GateMULK:
+            values[g] = ternaryAnd(in[0], in[1])
+
+        case GateOR:
+            if in[0] == TernaryTrue || in[1] == TernaryTrue {
+                values[g] = TernaryTrue
+            } else if in[0] == TernaryFalse && in[1] == TernaryFalse {
+                values[g] = TernaryFalse
+            } else {
+                values[g] = TernaryX
+            }
+
+        case GateXOR, GateCNOT, GateADDK:
+            values[g] = ternaryXor(in[0], in[1])
+
+        case GateTOFFLI:
+            values[g] = ternaryXor(in[2], ternaryAnd(in[0], in[1]))
+
+        case GateMAJ:
+            // Definite once two inputs agree on a definite value
+            values[g] = TernaryX
+            for _, v := range []Ternary{TernaryFalse, TernaryTrue} {
+                count := 0
+                for _, x := range in {
+                    if x == v {
+                        count++
+                    }
+                }
+                if count >= 2 {
+                    values[g] = v
+                }
+            }
+
+        case GateNOT:
+            if in[0] == TernaryX {
+                values[g] = TernaryX
+            } else {
+                values[g] = ternaryOf(in[0] == TernaryFalse)
+            }
+
+        case GateMUX:
+            // An unknown select still gives a definite result if both
+            // data inputs agree
+            if in[0] == TernaryFalse {
+                values[g] = in[1]
+            } else if in[0] == TernaryTrue {
+                values[g] = in[2]
+            } else if in[1] == in[2] {
+                values[g] = in[1]
+            } else {
+                values[g] = TernaryX
+            }
+
+        case GateLUT:
+            if len(gate.TruthTable) != 1 << len(in) {
+                return nil, fmt.Errorf("LUT gate %d has a truth table of the wrong size: %w", g, ErrInvalidGate)
+            }
+            values[g] = ternaryLookup(gate.TruthTable, in)
+
+        default:
+            return nil, fmt.Errorf("unknown gate type %d for %d: %w", gate.GateType, g, ErrInvalidGate)
+        }
+    }
+
+    result := make([]Ternary, circ.NumOutputWires)
+    for i := range result {
+        result[i] = values[circ.getOutputGate(i)]
+    }
+    return result, nil
+}
+
+// AND of two ternary values: false if either is false
+func ternaryAnd(a, b Ternary) Ternary {
+    if a == TernaryFalse || b == TernaryFalse {
+        return TernaryFalse
+    } else if a == TernaryTrue && b == TernaryTrue {
+        return TernaryTrue
+    }
+    return TernaryX
+}
+
+// XOR of two ternary values: unknown if either is
+func ternaryXor(a, b Ternary) Ternary {
+    if a == TernaryX || b == TernaryX {
+        return TernaryX
+    }
+    return ternaryOf(a != b)
+}
+
+// Find the output wires whose value doesn't depend on the inputs at all,
+// mapped to their constant value. Such outputs usually indicate a degenerate
+// or buggy circuit. Detection is conservative, as described in EvaluateTernary.
+func (circ *Circuit) ConstantOutputs() map[int]bool {
+    inputs := make([]Ternary, circ.NumInputWires)
+    for i := range inputs {
+        inputs[i] = TernaryX
+    }
+
+    outputs, err := circ.EvaluateTernary(inputs)
+    if err != nil {
+        return nil
+    }
+
+    result := make(map[int]bool)
+    for i, v := range outputs {
+        if v != TernaryX {
+            result[i] = v == TernaryTrue
+        }
+    }
+    return result
+}
+
+// Look up a truth table entry with possibly unknown address bits. The result
+// is definite only if every entry matching the known bits agrees.
+func ternaryLookup(table []bool, in []Ternary) Ternary {
+    known := 0
+    address := 0
+    for j, v := range in {
+        if v != TernaryX {
+            known |= 1 << j
+            if v == TernaryTrue {
+                address |= 1 << j
+            }
+        }
+    }
+
+    result := TernaryX
+    for k := range table {
+        if k & known != address {
+            continue
+        }
+        if result == TernaryX {
+            result = ternaryOf(table[k])
+        } else if result != ternaryOf(table[k]) {
+            return TernaryX
+        }
+    }
+    return result
+}
@@ -0,0 +1,66 @@
+package toygarble
+
+import (
+    "errors"
+    "slices"
+    "testing"
+)
+
+func TestConstantOutputs(t *testing.T) {
+    // out0 = x & y, out1 = 1, out2 = x & !x & y, out3 = x ^ x
+    b := NewBuilder()
+    x := b.Input("x", 1)
+    y := b.Input("y", 1)
+    circ, err := b.Output("out",
+        b.And(x[0], y[0]),
+        b.Const(true),
+        b.And(b.And(x[0], b.Const(false)), y[0]),
+        b.Xor(x[0], x[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    got := circ.ConstantOutputs()
+    // XOR(x, x) is constant, but not provably so by ternary evaluation
+    want := map[int]bool{1: true, 2: false}
+    if len(got) != len(want) {
+        t.Fatalf("got %v, want %v", got, want)
+    }
+    for o, v := range want {
+        if c, ok := got[o]; !ok || c != v {
+            t.Errorf("output %d: got %v (%t), want %t", o, c, ok, v)
+        }
+    }
+}
+
+func TestEvaluateTernary(t *testing.T) {
+    // out = [x & y, x ^ y, MUX(x, y, y)]
+    b := NewBuilder()
+    x := b.Input("x", 1)
+    y := b.Input("y", 1)
+    circ, err := b.Output("out", b.And(x[0], y[0]), b.Xor(x[0], y[0]), b.Mux(x[0], y[0], y[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    X, T, F := TernaryX, TernaryTrue, TernaryFalse
+    cases := []struct {
+        in, want []Ternary
+    }{
+        {[]Ternary{X, F}, []Ternary{F, X, F}},
+        {[]Ternary{X, T}, []Ternary{X, X, T}},
+        {[]Ternary{T, X}, []Ternary{X, X, X}},
+        {[]Ternary{T, F}, []Ternary{F, T, F}},
+    }
+    for _, c := range cases {
+        out, err := circ.EvaluateTernary(c.in)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !slices.Equal(out, c.want) {
+            t.Errorf("on %v: got %v, want %v", c.in, out, c.want)
+        }
+    }
+
+    if _, err := circ.EvaluateTernary([]Ternary{X}); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("short input: got %v, want ErrWireCountMismatch", err)
+    }
+}
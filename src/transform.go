@@ -0,0 +1,429 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Transformations producing new circuits from existing ones
+//
+
+// Build a new circuit computing the given output wires of this one, with
+// the same input layout, wire domain and logger. Only the gates in the
+// outputs' cone are copied, renumbered in topological order, with their
+// source locations; groups and assertions are dropped.
+func (circ *Circuit) subCircuit(outputWires []int, numWiresPerOV []int) (*Circuit, error) {
+    order, err := circ.TopologicalOrder()
+    if err != nil {
+        return nil, err
+    }
+
+    roots := make([]int, len(outputWires))
+    for i, w := range outputWires {
+        if w < 0 || w >= circ.NumOutputWires {
+            return nil, fmt.Errorf("output wire %d out of range: %w", w, ErrOutOfRange)
+        }
+        roots[i] = circ.getOutputGate(w)
+    }
+    inCone := circ.cone(roots)
+
+    sub := &Circuit{Limits: circ.Limits, WireDomain: circ.WireDomain, Logger: circ.Logger}
+    err = sub.initializeCircuit(circ.NumInputWires, len(outputWires), circ.NumInputVars, len(numWiresPerOV),
+        append([]int(nil), circ.NumWiresIV...), numWiresPerOV)
+    if err != nil {
+        return nil, err
+    }
+    sub.InputVarNames = append([]string(nil), circ.InputVarNames...)
+    sub.InputParty = append([]int(nil), circ.InputParty...)
+
+    numInCone := 0
+    for g := range inCone {
+        if inCone[g] {
+            numInCone++
+        }
+    }
+    sub.Reserve(numInCone)
+
+    // Every input wire keeps its position, whether or not it's used
+    newIndex := make([]int, len(circ.Gates))
+    for w := 0; w < circ.NumInputWires; w++ {
+        newIndex[circ.getInputGate(w)] = sub.getInputGate(w)
+    }
+
+    for _, g := range order {
+        gate := &circ.Gates[g]
+        if !inCone[g] || gate.GateType == GateINPUT || gate.GateType == GateOUTPUT {
+            continue
+        }
+
+        inFrom := make([]int, len(gate.InFrom))
+        for j, from := range gate.InFrom {
+            inFrom[j] = newIndex[from]
+        }
+        newIndex[g] = sub.addGate(gate.GateType, gate.ConstVal, inFrom)
+        if newIndex[g] < 0 {
+            return nil, fmt.Errorf("could not copy gate %d", g)
+        }
+        sub.Gates[newIndex[g]].TruthTable = gate.TruthTable
+        if loc := circ.sourceLoc(g); loc != "" {
+            sub.SetGateSource(newIndex[g], loc)
+        }
+    }
+
+    for i, root := range roots {
+        driver, ok := circ.outputDriver(root)
+        if !ok {
+            return nil, fmt.Errorf("output wire %d is not connected: %w", outputWires[i], ErrInvalidCircuit)
+        }
+        sub.connectOutputWire(newIndex[driver], i)
+    }
+
+    return sub, nil
+}
+
+// Split the circuit into one sub-circuit per output wire, each containing
+// just the gates that output depends on. Gates shared between outputs are
+// duplicated. Every sub-circuit keeps the full input layout, so all of them
+// can be evaluated on the same input bits as the original. Returns nil if
+// the circuit is malformed.
+func (circ *Circuit) SplitByOutput() []*Circuit {
+    result := make([]*Circuit, circ.NumOutputWires)
+    for i := range result {
+        sub, err := circ.subCircuit([]int{i}, []int{1})
+        if err != nil {
+            return nil
+        }
+        result[i] = sub
+    }
+    return result
+}
+
+// Make a deep copy of the circuit, sharing no slices with the original
+func (circ *Circuit) Clone() *Circuit {
+    c := *circ
+    c.NumWiresIV = append([]int(nil), circ.NumWiresIV...)
+    c.NumWiresOV = append([]int(nil), circ.NumWiresOV...)
+    c.InputVarNames = append([]string(nil), circ.InputVarNames...)
+    c.OutputVarNames = append([]string(nil), circ.OutputVarNames...)
+    c.InputParty = append([]int(nil), circ.InputParty...)
+    if circ.InputGates != nil {
+        c.InputGates = append([]int(nil), circ.InputGates...)
+    }
+    if circ.OutputGates != nil {
+        c.OutputGates = append([]int(nil), circ.OutputGates...)
+    }
+    if circ.Groups != nil {
+        c.Groups = append([]GateGroup(nil), circ.Groups...)
+    }
+    if circ.Assertions != nil {
+        c.Assertions = append([]Assertion(nil), circ.Assertions...)
+    }
+    if circ.SourceLoc != nil {
+        c.SourceLoc = append([]string(nil), circ.SourceLoc...)
+    }
+    if circ.Limits != nil {
+        limits := *circ.Limits
+        c.Limits = &limits
+    }
+
+    c.Gates = make([]Gate, len(circ.Gates))
+    for i := range circ.Gates {
+        c.Gates[i] = circ.Gates[i]
+        c.Gates[i].InFrom = append([]int(nil), circ.Gates[i].InFrom...)
+        c.Gates[i].TruthTable = append([]bool(nil), circ.Gates[i].TruthTable...)
+    }
+    return &c
+}
+
+// The gate whose value an output gate passes on: the input of an OUTPUT
+// gate, or the gate itself if it was fused. Returns false for an
+// unconnected OUTPUT gate.
+func (circ *Circuit) outputDriver(outputGate int) (int, bool) {
+    gate := &circ.Gates[outputGate]
+    if gate.GateType != GateOUTPUT {
+        return outputGate, true
+    }
+    if len(gate.InFrom) != 1 {
+        return -1, false
+    }
+    return gate.InFrom[0], true
+}
+
+// Delete the marked gates, renumbering the rest (keeping their order) and
+// redirecting any reference to a deleted gate g to replacement[g]. The
+// circuit's own references to gates are updated to match. With no
+// replacements, assertions on deleted gates are dropped.
+func (circ *Circuit) compact(remove []bool, replacement []int) {
+    // keptBefore[g] is the number of gates kept before position g, which
+    // is g's new index if it is kept
+    newIndex := make([]int, len(circ.Gates))
+    keptBefore := make([]int, len(circ.Gates) + 1)
+    next := 0
+    for g := range circ.Gates {
+        keptBefore[g] = next
+        if !remove[g] {
+            newIndex[g] = next
+            next++
+        }
+    }
+    keptBefore[len(circ.Gates)] = next
+    resolve := func(g int) int {
+        for remove[g] {
+            g = replacement[g]
+        }
+        return newIndex[g]
+    }
+
+    var inputGates []int
+    if circ.InputGates != nil {
+        inputGates = make([]int, circ.NumInputWires)
+        for w := range inputGates {
+            inputGates[w] = resolve(circ.InputGates[w])
+        }
+    }
+    outputGates := make([]int, circ.NumOutputWires)
+    for i := range outputGates {
+        outputGates[i] = resolve(circ.getOutputGate(i))
+    }
+
+    gates := make([]Gate, 0, next)
+    for g := range circ.Gates {
+        if remove[g] {
+            continue
+        }
+        gate := circ.Gates[g]
+        for j, from := range gate.InFrom {
+            gate.InFrom[j] = resolve(from)
+        }
+        gates = append(gates, gate)
+    }
+
+    for i := range circ.Groups {
+        group := &circ.Groups[i]
+        group.Start = keptBefore[group.Start]
+        group.End = keptBefore[group.End]
+    }
+
+    assertions := circ.Assertions[:0]
+    for _, a := range circ.Assertions {
+        if remove[a.Gate] && replacement == nil {
+            continue
+        }
+        a.Gate = resolve(a.Gate)
+        assertions = append(assertions, a)
+    }
+
+    // Locations move with their gates; a deleted gate's is dropped
+    var sourceLoc []string
+    if circ.SourceLoc != nil {
+        sourceLoc = make([]string, 0, next)
+        for g, loc := range circ.SourceLoc {
+            if !remove[g] {
+                sourceLoc = append(sourceLoc, loc)
+            }
+        }
+    }
+
+    circ.Gates = gates
+    circ.InputGates = inputGates
+    circ.OutputGates = outputGates
+    circ.Assertions = assertions
+    circ.SourceLoc = sourceLoc
+}
+
+// Remove OUTPUT pass-through gates, recording their driving gate as the
+// output instead. A gate is only used as an output if it is a logic gate
+// (not an input) that doesn't already carry another output, so every
+// output still has its own computed wire. Evaluation is unchanged; the
+// gate numbering is not. Returns the number of gates removed.
+func (circ *Circuit) FuseOutputs() int {
+    if !circ.validCircuit() {
+        return 0
+    }
+
+    remove := make([]bool, len(circ.Gates))
+    replacement := make([]int, len(circ.Gates))
+    isOutput := make([]bool, len(circ.Gates))
+    for i := 0; i < circ.NumOutputWires; i++ {
+        isOutput[circ.getOutputGate(i)] = true
+    }
+
+    count := 0
+    for i := 0; i < circ.NumOutputWires; i++ {
+        o := circ.getOutputGate(i)
+        driver, ok := circ.outputDriver(o)
+        if !ok || driver == o || isOutput[driver] {
+            continue
+        }
+        if circ.Gates[driver].GateType == GateINPUT || circ.Gates[driver].GateType == GateOUTPUT {
+            continue
+        }
+        remove[o] = true
+        replacement[o] = driver
+        isOutput[driver] = true
+        count++
+    }
+
+    if count > 0 {
+        circ.compact(remove, replacement)
+    }
+    return count
+}
+
+// Limit every gate to driving at most maxFanOut gate inputs, for targets
+// that can't wire one gate to many: a gate with more consumers drives a
+// tree of COPY gates instead, each feeding up to maxFanOut of them. (A gate
+// reading the same wire twice counts twice, and an output wire taken
+// straight from a gate, as after FuseOutputs, counts as one more.) The
+// copies are appended at the end, so existing gates keep their numbers,
+// and evaluation is unchanged.
+// Returns the number of copies inserted, or -1 if maxFanOut is less than 2
+// or the circuit is invalid or hits its size limits, in which case it may
+// be only partly rewritten.
+func (circ *Circuit) MaterializeFanOut(maxFanOut int) int {
+    if maxFanOut < 2 || !circ.validCircuit() {
+        return -1
+    }
+
+    // Every gate input reading each gate, as (consumer, position) pairs,
+    // with gate -1 for output wire pos
+    type use struct{ gate, pos int }
+    uses := make([][]use, len(circ.Gates))
+    for i := range circ.Gates {
+        for j, from := range circ.Gates[i].InFrom {
+            uses[from] = append(uses[from], use{i, j})
+        }
+    }
+    for i := 0; i < circ.NumOutputWires; i++ {
+        if g := circ.getOutputGate(i); circ.Gates[g].GateType != GateOUTPUT {
+            uses[g] = append(uses[g], use{-1, i})
+        }
+    }
+
+    count := 0
+    for g := range uses {
+        // Hand each group of maxFanOut uses to a new copy, until few enough
+        // are left for g to drive itself
+        pending := uses[g]
+        for len(pending) > maxFanOut {
+            var next []use
+            for start := 0; start < len(pending); start += maxFanOut {
+                group := pending[start:min(start + maxFanOut, len(pending))]
+                if len(group) == 1 {
+                    next = append(next, group[0])
+                    continue
+                }
+                c := circ.addGate(GateCOPY, false, []int{g})
+                if c < 0 {
+                    return -1
+                }
+                for _, u := range group {
+                    if u.gate < 0 {
+                        circ.OutputGates[u.pos] = c
+                    } else {
+                        circ.Gates[u.gate].InFrom[u.pos] = c
+                    }
+                }
+                next = append(next, use{c, 0})
+                count++
+            }
+            pending = next
+        }
+    }
+    return count
+}
+
+// Reorder the input variables so that new variable i is the old variable
+// permutation[i], along with its wires, name and party. The circuit computes the
+// same function, but expects its inputs in the new order.
+func (circ *Circuit) RemapInputs(permutation []int) error {
+    if len(permutation) != circ.NumInputVars {
+        return fmt.Errorf("permutation has %d entries, circuit has %d input variables: %w", len(permutation), circ.NumInputVars, ErrWireCountMismatch)
+    }
+    used := make([]bool, circ.NumInputVars)
+    for _, v := range permutation {
+        if v < 0 || v >= circ.NumInputVars || used[v] {
+            return fmt.Errorf("permutation %v is not a bijection: %w", permutation, ErrOutOfRange)
+        }
+        used[v] = true
+    }
+    if !circ.validCircuit() {
+        return ErrInvalidCircuit
+    }
+
+    // The old input wires in their new order
+    firstWire := make([]int, circ.NumInputVars)
+    for v := 1; v < circ.NumInputVars; v++ {
+        firstWire[v] = firstWire[v-1] + circ.NumWiresIV[v-1]
+    }
+    wires := make([]int, 0, circ.NumInputWires)
+    for _, v := range permutation {
+        for j := 0; j < circ.NumWiresIV[v]; j++ {
+            wires = append(wires, firstWire[v] + j)
+        }
+    }
+
+    if circ.InputGates != nil {
+        // The mapping can just be reordered
+        inputGates := make([]int, len(wires))
+        for k, w := range wires {
+            inputGates[k] = circ.InputGates[w]
+        }
+        circ.InputGates = inputGates
+    } else {
+        // Input wire w is gate w, so moving wires means renumbering the
+        // input gates and every reference to them
+        newIndex := make([]int, len(wires))
+        for k, w := range wires {
+            newIndex[w] = k
+        }
+        for i := range circ.Gates {
+            for j, from := range circ.Gates[i].InFrom {
+                if from < circ.NumInputWires {
+                    circ.Gates[i].InFrom[j] = newIndex[from]
+                }
+            }
+        }
+        for i, g := range circ.OutputGates {
+            if g < circ.NumInputWires {
+                circ.OutputGates[i] = newIndex[g]
+            }
+        }
+        for i, a := range circ.Assertions {
+            if a.Gate < circ.NumInputWires {
+                circ.Assertions[i].Gate = newIndex[a.Gate]
+            }
+        }
+        if len(circ.SourceLoc) > 0 {
+            sourceLoc := append([]string(nil), circ.SourceLoc...)
+            for len(sourceLoc) < circ.NumInputWires {
+                sourceLoc = append(sourceLoc, "")
+            }
+            for k, w := range wires {
+                sourceLoc[k] = circ.sourceLoc(w)
+            }
+            circ.SourceLoc = sourceLoc
+        }
+    }
+
+    widths := make([]int, circ.NumInputVars)
+    for i, v := range permutation {
+        widths[i] = circ.NumWiresIV[v]
+    }
+    circ.NumWiresIV = widths
+    if len(circ.InputVarNames) == circ.NumInputVars {
+        names := make([]string, circ.NumInputVars)
+        for i, v := range permutation {
+            names[i] = circ.InputVarNames[v]
+        }
+        circ.InputVarNames = names
+    }
+    if len(circ.InputParty) == circ.NumInputVars {
+        parties := make([]int, circ.NumInputVars)
+        for i, v := range permutation {
+            parties[i] = circ.InputParty[v]
+        }
+        circ.InputParty = parties
+    }
+    return nil
+}
@@ -0,0 +1,252 @@
+package toygarble
+
+import (
+    "math/rand"
+    "slices"
+    "testing"
+)
+
+func TestFuseOutputsEvaluationUnchanged(t *testing.T) {
+    rng := rand.New(rand.NewSource(11))
+    for it := 0; it < 100; it++ {
+        circ, err := randomCircuit(rng, 5, 30, 4)
+        if err != nil {
+            t.Fatal(err)
+        }
+        fused := circ.Clone()
+        n := fused.FuseOutputs()
+        if len(fused.Gates) != len(circ.Gates) - n {
+            t.Errorf("circuit %d: removed %d gates, reported %d", it, len(circ.Gates) - len(fused.Gates), n)
+        }
+        checkSameFunction(t, circ, fused, 5)
+    }
+}
+
+// Passes that run after FuseOutputs have to treat outputs on logic gates
+// as uses
+func TestFuseOutputsThenBalance(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 4)
+    mid := b.Xor(x[0], x[1])
+    all := b.Xor(b.Xor(mid, x[2]), x[3])
+    circ, err := b.Output("mid", mid).Output("all", all).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    circ.FuseOutputs()
+    circ.BalanceXORTrees()
+    ok, out := circ.EvaluateCircuit([]bool{true, false, false, false})
+    if !ok || !slices.Equal(out, []bool{true, true}) {
+        t.Errorf("on input 1000: got %v, want [true true]", out)
+    }
+}
+
+func TestSplitByOutputKeepsWireDomain(t *testing.T) {
+    // Over mod 5, out0 = x + y and out1 = x * y
+    b := NewBuilder().WireDomain(5)
+    x := b.Input("x", 1)
+    y := b.Input("y", 1)
+    circ, err := b.Output("sum", b.AddK(x[0], y[0])).Output("product", b.MulK(x[0], y[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    parts := circ.SplitByOutput()
+    if len(parts) != 2 {
+        t.Fatalf("got %d sub-circuits, want 2", len(parts))
+    }
+    for i, want := range []int{2, 2} {
+        if parts[i].WireDomain != 5 {
+            t.Errorf("sub-circuit %d has wire domain %d", i, parts[i].WireDomain)
+        }
+        out, err := parts[i].EvaluateKary([]int{3, 4})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if out[0] != want {
+            t.Errorf("sub-circuit %d on [3 4]: got %d, want %d", i, out[0], want)
+        }
+    }
+}
+
+// The number of gate inputs and output wires reading each gate, as
+// MaterializeFanOut counts them
+func fanOutCounts(circ *Circuit) []int {
+    counts := make([]int, len(circ.Gates))
+    for i := range circ.Gates {
+        for _, from := range circ.Gates[i].InFrom {
+            counts[from]++
+        }
+    }
+    for i := 0; i < circ.NumOutputWires; i++ {
+        if g := circ.getOutputGate(i); circ.Gates[g].GateType != GateOUTPUT {
+            counts[g]++
+        }
+    }
+    return counts
+}
+
+func TestMaterializeFanOut(t *testing.T) {
+    rng := rand.New(rand.NewSource(199))
+    for it := 0; it < 100; it++ {
+        circ, err := randomCircuit(rng, 4, 40, 4)
+        if err != nil {
+            t.Fatal(err)
+        }
+        // Half the time, with the outputs read straight from logic gates
+        if it % 2 == 1 {
+            circ.FuseOutputs()
+        }
+        for _, maxFanOut := range []int{2, 3, 5} {
+            limited := circ.Clone()
+            n := limited.MaterializeFanOut(maxFanOut)
+            if n < 0 {
+                t.Fatalf("circuit %d: MaterializeFanOut(%d) failed", it, maxFanOut)
+            }
+            if len(limited.Gates) != len(circ.Gates) + n {
+                t.Errorf("circuit %d: added %d gates, reported %d", it, len(limited.Gates) - len(circ.Gates), n)
+            }
+            for g, count := range fanOutCounts(limited) {
+                if count > maxFanOut {
+                    t.Errorf("circuit %d: gate %d drives %d readers, limit %d", it, g, count, maxFanOut)
+                }
+            }
+            checkSameFunction(t, circ, limited, 4)
+        }
+    }
+
+    if BuildAdder(2).MaterializeFanOut(1) != -1 {
+        t.Error("fan-out limit of 1 accepted")
+    }
+}
+
+// An output fused onto a gate with other consumers has to be counted
+func TestMaterializeFanOutFusedOutput(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    a := b.And(x[0], x[1])
+    circ, err := b.Output("a", a).Output("n", b.Not(a)).Output("o", b.Or(a, x[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    circ.FuseOutputs()
+    limited := circ.Clone()
+    if n := limited.MaterializeFanOut(2); n != 1 {
+        t.Errorf("inserted %d copies, want 1", n)
+    }
+    for g, count := range fanOutCounts(limited) {
+        if count > 2 {
+            t.Errorf("gate %d drives %d readers", g, count)
+        }
+    }
+    checkSameFunction(t, circ, limited, 2)
+}
+
+func TestSplitByOutput(t *testing.T) {
+    rng := rand.New(rand.NewSource(112))
+    for it := 0; it < 50; it++ {
+        circ, err := randomCircuit(rng, 5, 40, 4)
+        if err != nil {
+            t.Fatal(err)
+        }
+        parts := circ.SplitByOutput()
+        if len(parts) != circ.NumOutputWires {
+            t.Fatalf("circuit %d: got %d sub-circuits for %d outputs", it, len(parts), circ.NumOutputWires)
+        }
+        for i, part := range parts {
+            if part.NumInputWires != circ.NumInputWires || part.NumOutputWires != 1 {
+                t.Fatalf("circuit %d output %d: layout %d -> %d", it, i, part.NumInputWires, part.NumOutputWires)
+            }
+            if part.GateCount() > circ.GateCount() {
+                t.Errorf("circuit %d output %d: %d gates, more than the original's %d", it, i, part.GateCount(), circ.GateCount())
+            }
+        }
+        for m := 0; m < 32; m++ {
+            in := make([]bool, 5)
+            for i := range in {
+                in[i] = m >> i & 1 == 1
+            }
+            _, full := circ.EvaluateCircuit(in)
+            for i, part := range parts {
+                if ok, out := part.EvaluateCircuit(in); !ok || out[0] != full[i] {
+                    t.Fatalf("circuit %d output %d on %v: got %v, want %t", it, i, in, out, full[i])
+                }
+            }
+        }
+    }
+}
+
+// A gate used by two outputs is duplicated into both sub-circuits, and
+// gates neither uses are left out
+func TestSplitByOutputCones(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    shared := b.And(x[0], x[1])
+    circ, err := b.Output("out", b.Not(shared), b.Xor(shared, x[2]), b.Or(x[1], x[2])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    parts := circ.SplitByOutput()
+    for i, want := range []int{2, 2, 1} {
+        if n := parts[i].Stats().NumGates; n != want {
+            t.Errorf("output %d: %d logic gates, want %d", i, n, want)
+        }
+    }
+}
+
+// Moving the old variables [x y z] to [z x y] means feeding each input
+// bit to the wire its variable now occupies
+func TestRemapInputs(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    y := b.Input("y", 1)
+    z := b.Input("z", 3)
+    circ, err := b.Output("out", b.And(x[1], y[0]), b.Xor(z[2], x[0]), b.Not(z[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // With and without an explicit InputGates mapping (pinned by declaring
+    // another variable w)
+    for _, pinned := range []bool{false, true} {
+        remapped := circ.Clone()
+        perm := []int{2, 0, 1}
+        if pinned {
+            remapped.DeclareInput(3, 1)
+            perm = []int{3, 2, 0, 1}
+        }
+        if err := remapped.RemapInputs(perm); err != nil {
+            t.Fatal(err)
+        }
+        wantNames := []string{"z", "x", "y"}
+        wantWidths := []int{3, 2, 1}
+        if pinned {
+            wantNames = append([]string{""}, wantNames...)
+            wantWidths = append([]int{1}, wantWidths...)
+        }
+        if !slices.Equal(remapped.NumWiresIV, wantWidths) || !slices.Equal(remapped.InputVarNames, wantNames) {
+            t.Errorf("pinned=%t: variables %v of widths %v", pinned, remapped.InputVarNames, remapped.NumWiresIV)
+        }
+
+        for m := 0; m < 64; m++ {
+            in := make([]bool, 6)
+            for i := range in {
+                in[i] = m >> i & 1 == 1
+            }
+            _, want := circ.EvaluateCircuit(in)
+            permuted := slices.Concat(in[3:6], in[0:2], in[2:3])
+            if pinned {
+                permuted = append([]bool{false}, permuted...)
+            }
+            ok, got := remapped.EvaluateCircuit(permuted)
+            if !ok || !slices.Equal(got, want) {
+                t.Fatalf("pinned=%t, input %06b: got %v, want %v", pinned, m, got, want)
+            }
+        }
+    }
+
+    for _, perm := range [][]int{{0, 0, 1}, {0, 1}, {0, 1, 3}, {-1, 0, 1}} {
+        if err := circ.Clone().RemapInputs(perm); err == nil {
+            t.Errorf("accepted permutation %v", perm)
+        }
+    }
+}
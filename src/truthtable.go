@@ -0,0 +1,270 @@
+package toygarble
+
+import (
+    "context"
+    "fmt"
+    "slices"
+)
+
+//
+// Exhaustive evaluation of small circuits
+//
+
+const (
+    // Widest input for which we'll enumerate every input combination. The
+    // cost of everything in this file is exponential in the input width.
+    MAX_TRUTH_TABLE_INPUTS  int = 20
+
+    // How many rows TruthTableProgress computes between progress reports
+    TRUTH_TABLE_PROGRESS_INTERVAL   int = 4096
+
+    // Widest input for which EquivalentUpToPermutation tries every input
+    // permutation: 8! orderings of a 2^8-row table
+    MAX_PERMUTATION_INPUTS  int = 8
+)
+
+// Evaluate the circuit on every input, returning one row of output bits
+// per input combination. Row m holds the outputs when input wire i is set
+// to bit i of m.
+func (circ *Circuit) TruthTable() ([][]bool, error) {
+    return circ.TruthTableProgress(context.Background(), nil)
+}
+
+// Like TruthTable, but gives up with ctx.Err() if ctx is cancelled, and
+// calls progress (if not nil) with the number of rows done out of the total
+// every TRUTH_TABLE_PROGRESS_INTERVAL rows and once more at the end
+func (circ *Circuit) TruthTableProgress(ctx context.Context, progress func(done, total int)) ([][]bool, error) {
+    if circ.NumInputWires > MAX_TRUTH_TABLE_INPUTS {
+        return nil, fmt.Errorf("circuit has %d input wires, truth tables are limited to %d: %w", circ.NumInputWires, MAX_TRUTH_TABLE_INPUTS, ErrLimitExceeded)
+    }
+
+    e, err := NewEvaluator(circ)
+    if err != nil {
+        return nil, err
+    }
+
+    table := make([][]bool, 1 << circ.NumInputWires)
+    in := make([]bool, circ.NumInputWires)
+    for m := range table {
+        for i := range in {
+            in[i] = (m >> i) & 1 == 1
+        }
+        if table[m], err = e.EvaluateContext(ctx, in); err != nil {
+            return nil, err
+        }
+        if progress != nil && (m + 1) % TRUTH_TABLE_PROGRESS_INTERVAL == 0 {
+            progress(m + 1, len(table))
+        }
+    }
+    if progress != nil && len(table) % TRUTH_TABLE_PROGRESS_INTERVAL != 0 {
+        progress(len(table), len(table))
+    }
+    return table, nil
+}
+
+// The algebraic normal form of an output wire: the monomials whose XOR
+// gives the output, each as a bitmask of the input wires it multiplies (so
+// 0 is the constant 1). The truth table is enumerated and Moebius
+// transformed, so the cost is exponential in the number of input wires,
+// which is capped at MAX_TRUTH_TABLE_INPUTS. The algebraic degree of the
+// output is the largest popcount among the monomials.
+func (circ *Circuit) AlgebraicNormalForm(outputWire int) ([]uint64, error) {
+    if outputWire < 0 || outputWire >= circ.NumOutputWires {
+        return nil, fmt.Errorf("output wire %d out of range (%d outputs): %w", outputWire, circ.NumOutputWires, ErrOutOfRange)
+    }
+    table, err := circ.TruthTable()
+    if err != nil {
+        return nil, err
+    }
+
+    column := make([]bool, len(table))
+    for m := range table {
+        column[m] = table[m][outputWire]
+    }
+    moebiusTransform(column)
+
+    monomials := make([]uint64, 0)
+    for m, coefficient := range column {
+        if coefficient {
+            monomials = append(monomials, uint64(m))
+        }
+    }
+    return monomials, nil
+}
+
+// How an output's function relates to the other outputs
+type OutputFunction struct {
+    // The lowest-numbered output computing the same function or its
+    // complement, possibly this output itself
+    Same        int
+
+    // Whether this output computes the complement of output Same
+    Complement  bool
+}
+
+// Compare the outputs' truth table columns, finding for each output the
+// first one that computes the same function or its complement. Outputs
+// that repeat or just invert another are redundant.
+func (circ *Circuit) OutputFunctions() ([]OutputFunction, error) {
+    table, err := circ.TruthTable()
+    if err != nil {
+        return nil, err
+    }
+
+    first := make(map[string]int)
+    result := make([]OutputFunction, circ.NumOutputWires)
+    column := make([]byte, len(table))
+    inverse := make([]byte, len(table))
+    for i := range result {
+        for m := range table {
+            if table[m][i] {
+                column[m], inverse[m] = 1, 0
+            } else {
+                column[m], inverse[m] = 0, 1
+            }
+        }
+        if j, ok := first[string(column)]; ok {
+            result[i] = OutputFunction{Same: j}
+        } else if j, ok := first[string(inverse)]; ok {
+            result[i] = OutputFunction{Same: j, Complement: true}
+        } else {
+            first[string(column)] = i
+            result[i] = OutputFunction{Same: i}
+        }
+    }
+    return result, nil
+}
+
+// The number of distinct boolean functions the outputs compute, counting a
+// function and its complement as different. Use OutputFunctions to see
+// which outputs coincide or are complementary.
+func (circ *Circuit) DistinctOutputFunctions() (int, error) {
+    functions, err := circ.OutputFunctions()
+    if err != nil {
+        return 0, err
+    }
+    distinct := make(map[OutputFunction]bool)
+    for _, f := range functions {
+        distinct[f] = true
+    }
+    return len(distinct), nil
+}
+
+// The truth table column of each output, one byte per row, for hashing
+func tableColumns(table [][]bool, numOutputs int) [][]byte {
+    columns := make([][]byte, numOutputs)
+    for j := range columns {
+        columns[j] = make([]byte, len(table))
+        for m := range table {
+            if table[m][j] {
+                columns[j][m] = 1
+            }
+        }
+    }
+    return columns
+}
+
+// Search for a reordering of the input and output wires under which other
+// computes the same function as circ: feeding circ's input wire i to
+// other's input wire inputPerm[i], circ's output wire j equals other's
+// output wire outputPerm[j]. Returns false (with no error) if there is no
+// such reordering, including when the wire counts differ.
+//
+// Every input permutation is tried, matching the output columns by hashing
+// for each, so the cost is n! * 2^n * m for n inputs and m outputs. The
+// search is limited to MAX_PERMUTATION_INPUTS input wires; a quick check
+// that the outputs have the same numbers of ones rules out most
+// inequivalent circuits first.
+func (circ *Circuit) EquivalentUpToPermutation(other *Circuit) (equal bool, inputPerm, outputPerm []int, err error) {
+    n := circ.NumInputWires
+    if n > MAX_PERMUTATION_INPUTS {
+        return false, nil, nil, fmt.Errorf("circuit has %d input wires, permutation search is limited to %d: %w", n, MAX_PERMUTATION_INPUTS, ErrLimitExceeded)
+    }
+    if other.NumInputWires != n || other.NumOutputWires != circ.NumOutputWires {
+        return false, nil, nil, nil
+    }
+    table, err := circ.TruthTable()
+    if err != nil {
+        return false, nil, nil, err
+    }
+    otherTable, err := other.TruthTable()
+    if err != nil {
+        return false, nil, nil, err
+    }
+
+    // Permuting wires doesn't change how often each output is set
+    want := tableColumns(table, circ.NumOutputWires)
+    weights := func(columns [][]byte) []int {
+        w := make([]int, len(columns))
+        for j, column := range columns {
+            for _, bit := range column {
+                w[j] += int(bit)
+            }
+        }
+        slices.Sort(w)
+        return w
+    }
+    if !slices.Equal(weights(want), weights(tableColumns(otherTable, other.NumOutputWires))) {
+        return false, nil, nil, nil
+    }
+
+    // Try the permutation in perm: reorder other's table to circ's row
+    // numbering and look for each of circ's columns among other's
+    got := make([][]byte, other.NumOutputWires)
+    for j := range got {
+        got[j] = make([]byte, len(table))
+    }
+    try := func(perm []int) []int {
+        for m := range table {
+            row := 0
+            for i, to := range perm {
+                row |= (m >> i & 1) << to
+            }
+            for j := range got {
+                got[j][m] = 0
+                if otherTable[row][j] {
+                    got[j][m] = 1
+                }
+            }
+        }
+        found := make(map[string][]int)
+        for k := len(got) - 1; k >= 0; k-- {
+            found[string(got[k])] = append(found[string(got[k])], k)
+        }
+        outputs := make([]int, len(want))
+        for j, column := range want {
+            ks := found[string(column)]
+            if len(ks) == 0 {
+                return nil
+            }
+            outputs[j] = ks[len(ks) - 1]
+            found[string(column)] = ks[:len(ks) - 1]
+        }
+        return outputs
+    }
+
+    // Generate the permutations by swapping each remaining wire into place
+    perm := make([]int, n)
+    for i := range perm {
+        perm[i] = i
+    }
+    var search func(k int) bool
+    search = func(k int) bool {
+        if k == n {
+            outputPerm = try(perm)
+            return outputPerm != nil
+        }
+        for i := k; i < n; i++ {
+            perm[k], perm[i] = perm[i], perm[k]
+            if search(k + 1) {
+                return true
+            }
+            perm[k], perm[i] = perm[i], perm[k]
+        }
+        return false
+    }
+    if !search(0) {
+        return false, nil, nil, nil
+    }
+    return true, perm, outputPerm, nil
+}
@@ -0,0 +1,247 @@
+package toygarble
+
+import (
+    "context"
+    "errors"
+    "math/bits"
+    "slices"
+    "testing"
+)
+
+// The largest number of inputs multiplied in any monomial
+func anfDegree(monomials []uint64) int {
+    degree := 0
+    for _, m := range monomials {
+        degree = max(degree, bits.OnesCount64(m))
+    }
+    return degree
+}
+
+func TestTruthTable(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 2)
+    circ, err := b.Output("out", b.And(x[0], x[1]), b.Not(x[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    table, err := circ.TruthTable()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := [][]bool{{false, true}, {false, false}, {false, true}, {true, false}}
+    if len(table) != len(want) {
+        t.Fatalf("%d rows, want %d", len(table), len(want))
+    }
+    for m := range want {
+        if !slices.Equal(table[m], want[m]) {
+            t.Errorf("row %d is %v, want %v", m, table[m], want[m])
+        }
+    }
+
+    wide := buildChain(t, GateXOR, MAX_TRUTH_TABLE_INPUTS + 1)
+    if _, err := wide.TruthTable(); !errors.Is(err, ErrLimitExceeded) {
+        t.Errorf("%d inputs: got %v", MAX_TRUTH_TABLE_INPUTS + 1, err)
+    }
+}
+
+func TestAlgebraicNormalForm(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    outs := []Wire{b.Xor(x[0], x[2]), b.And(x[1], x[2]), b.Or(x[0], x[1]), b.Not(x[1])}
+    circ, err := b.Output("out", outs...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    cases := []struct {
+        monomials   []uint64
+        degree      int
+    }{
+        {[]uint64{0b001, 0b100}, 1},            // x0 + x2
+        {[]uint64{0b110}, 2},                   // x1 x2
+        {[]uint64{0b001, 0b010, 0b011}, 2},     // x0 + x1 + x0 x1
+        {[]uint64{0b000, 0b010}, 1},            // 1 + x1
+    }
+    for i, c := range cases {
+        anf, err := circ.AlgebraicNormalForm(i)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !slices.Equal(anf, c.monomials) {
+            t.Errorf("output %d: ANF %b, want %b", i, anf, c.monomials)
+        }
+        if d := anfDegree(anf); d != c.degree {
+            t.Errorf("output %d: degree %d, want %d", i, d, c.degree)
+        }
+    }
+
+    for _, w := range []int{-1, 4} {
+        if _, err := circ.AlgebraicNormalForm(w); !errors.Is(err, ErrOutOfRange) {
+            t.Errorf("output wire %d: got %v", w, err)
+        }
+    }
+}
+
+// Two outputs computing the same AND count as one function, and the NAND
+// is flagged as its complement
+func TestOutputFunctions(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    and := b.And(x[0], x[1])
+    nand := b.Not(and)
+    circ, err := b.Output("out", and, b.And(x[1], x[0]), nand, b.Xor(x[2], x[2]), b.Not(nand)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    functions, err := circ.OutputFunctions()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []OutputFunction{{0, false}, {0, false}, {0, true}, {3, false}, {0, false}}
+    if !slices.Equal(functions, want) {
+        t.Errorf("got %v, want %v", functions, want)
+    }
+    // AND and its complement are different functions, as is constant 0
+    if n, err := circ.DistinctOutputFunctions(); err != nil || n != 3 {
+        t.Errorf("got %d distinct functions (%v), want 3", n, err)
+    }
+
+    b = NewBuilder()
+    x = b.Input("x", 2)
+    or := b.Or(x[0], x[1])
+    circ, err = b.Output("out", or, b.Copy(or)).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n, err := circ.DistinctOutputFunctions(); err != nil || n != 1 {
+        t.Errorf("identical outputs: got %d distinct functions (%v), want 1", n, err)
+    }
+}
+
+func TestTruthTableProgress(t *testing.T) {
+    var reports []int
+    table, err := BuildAdder(8).TruthTableProgress(context.Background(), func(done, total int) {
+        if total != 1 << 16 {
+            t.Errorf("progress total %d", total)
+        }
+        reports = append(reports, done)
+    })
+    if err != nil || len(table) != 1 << 16 {
+        t.Fatalf("got %d rows (%v)", len(table), err)
+    }
+    if len(reports) != 16 || reports[0] != TRUTH_TABLE_PROGRESS_INTERVAL || reports[15] != 1 << 16 {
+        t.Errorf("progress reports %v", reports)
+    }
+
+    // A table smaller than the interval still reports once, at the end
+    reports = nil
+    if _, err := BuildAdder(2).TruthTableProgress(context.Background(), func(done, total int) { reports = append(reports, done) }); err != nil {
+        t.Fatal(err)
+    }
+    if !slices.Equal(reports, []int{16}) {
+        t.Errorf("small table progress reports %v", reports)
+    }
+}
+
+// Cancelling from the progress callback stops the next row: nothing more
+// is reported, and the million-row table is abandoned
+func TestTruthTableProgressCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    var reports []int
+    _, err := BuildPopCount(MAX_TRUTH_TABLE_INPUTS).TruthTableProgress(ctx, func(done, total int) {
+        reports = append(reports, done)
+        if done >= 2 * TRUTH_TABLE_PROGRESS_INTERVAL {
+            cancel()
+        }
+    })
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("got %v, want context.Canceled", err)
+    }
+    if !slices.Equal(reports, []int{TRUTH_TABLE_PROGRESS_INTERVAL, 2 * TRUTH_TABLE_PROGRESS_INTERVAL}) {
+        t.Errorf("progress reports %v after cancelling", reports)
+    }
+}
+
+// Check that the permutations found really map one circuit onto the other
+func checkPermutation(t *testing.T, a, b *Circuit, inputPerm, outputPerm []int) {
+    t.Helper()
+    for m := 0; m < 1 << a.NumInputWires; m++ {
+        in := make([]bool, a.NumInputWires)
+        permuted := make([]bool, a.NumInputWires)
+        for i := range in {
+            in[i] = m >> i & 1 == 1
+            permuted[inputPerm[i]] = in[i]
+        }
+        _, outA := a.EvaluateCircuit(in)
+        _, outB := b.EvaluateCircuit(permuted)
+        for j := range outA {
+            if outA[j] != outB[outputPerm[j]] {
+                t.Fatalf("input %b: output %d differs", m, j)
+            }
+        }
+    }
+}
+
+// An adder taking its operands' bits interleaved and giving its sum most
+// significant bit first is the ordinary adder reordered
+func TestEquivalentUpToPermutation(t *testing.T) {
+    const width = 4
+    b := NewBuilder()
+    in := b.Input("xy", 2 * width)
+    x, y := make([]Wire, width), make([]Wire, width)
+    for i := 0; i < width; i++ {
+        x[i], y[i] = in[2 * i], in[2 * i + 1]
+    }
+    sum, _ := b.add(y, x, b.Const(false))
+    slices.Reverse(sum)
+    swapped, err := b.Output("sum", sum...).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    adder := BuildAdder(width)
+
+    equal, inputPerm, outputPerm, err := adder.EquivalentUpToPermutation(swapped)
+    if err != nil || !equal {
+        t.Fatalf("adders not equivalent (%v)", err)
+    }
+    checkPermutation(t, adder, swapped, inputPerm, outputPerm)
+    if !slices.Equal(outputPerm, []int{3, 2, 1, 0}) {
+        t.Errorf("output permutation %v", outputPerm)
+    }
+
+    if equal, _, _, err := adder.EquivalentUpToPermutation(BuildSubtractor(width)); err != nil || equal {
+        t.Errorf("adder equivalent to a subtractor (%v)", err)
+    }
+    if equal, _, _, err := adder.EquivalentUpToPermutation(BuildAdder(3)); err != nil || equal {
+        t.Errorf("adders of different widths equivalent (%v)", err)
+    }
+    wide := BuildAdder(MAX_PERMUTATION_INPUTS / 2 + 1)
+    if _, _, _, err := wide.EquivalentUpToPermutation(wide); !errors.Is(err, ErrLimitExceeded) {
+        t.Errorf("wide circuits: got %v, want ErrLimitExceeded", err)
+    }
+}
+
+// Inputs rotated and outputs swapped, with a NOT that fixes which input
+// goes where
+func TestEquivalentUpToPermutationUnique(t *testing.T) {
+    b := NewBuilder()
+    x := b.Input("x", 3)
+    circ, err := b.Output("out", b.And(x[0], b.Not(x[1])), b.Xor(x[2], x[0])).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    b = NewBuilder()
+    y := b.Input("y", 3)
+    other, err := b.Output("out", b.Xor(y[1], y[2]), b.And(y[2], b.Not(y[0]))).Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    equal, inputPerm, outputPerm, err := circ.EquivalentUpToPermutation(other)
+    if err != nil || !equal {
+        t.Fatalf("not equivalent (%v)", err)
+    }
+    if !slices.Equal(inputPerm, []int{2, 0, 1}) || !slices.Equal(outputPerm, []int{1, 0}) {
+        t.Errorf("got permutations %v and %v, want [2 0 1] and [1 0]", inputPerm, outputPerm)
+    }
+}
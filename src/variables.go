@@ -0,0 +1,173 @@
+package toygarble
+
+import (
+    "fmt"
+)
+
+//
+// Name-based access to input and output variables
+//
+
+// Give input variable i a name, for use with PadInputsByName
+func (circ *Circuit) SetInputVarName(i int, name string) error {
+    names, err := setVarName(circ.InputVarNames, circ.NumInputVars, i, name)
+    if err != nil {
+        return fmt.Errorf("input variable: %w", err)
+    }
+    circ.InputVarNames = names
+    return nil
+}
+
+// Give output variable i a name, for use with DecodeOutputsByName
+func (circ *Circuit) SetOutputVarName(i int, name string) error {
+    names, err := setVarName(circ.OutputVarNames, circ.NumOutputVars, i, name)
+    if err != nil {
+        return fmt.Errorf("output variable: %w", err)
+    }
+    circ.OutputVarNames = names
+    return nil
+}
+
+// Record which party supplies each input variable, one entry per variable,
+// each PARTY_GARBLER or PARTY_EVALUATOR. A nil slice clears the assignment.
+func (circ *Circuit) SetInputParty(parties []int) error {
+    if parties == nil {
+        circ.InputParty = nil
+        return nil
+    }
+    if len(parties) != circ.NumInputVars {
+        return fmt.Errorf("got %d parties for %d input variables: %w", len(parties), circ.NumInputVars, ErrWireCountMismatch)
+    }
+    for i, party := range parties {
+        if party != PARTY_GARBLER && party != PARTY_EVALUATOR {
+            return fmt.Errorf("input variable %d has unknown party %d: %w", i, party, ErrOutOfRange)
+        }
+    }
+    circ.InputParty = append([]int(nil), parties...)
+    return nil
+}
+
+// The input wires supplied by the given party, in order. With no parties
+// recorded, every input belongs to the garbler. Returns nil if the input
+// variables don't account for exactly the input wires, so the parties'
+// wires always partition the inputs.
+func (circ *Circuit) PartyInputWires(party int) []int {
+    if !validVarWidths(circ.NumWiresIV, circ.NumInputVars, circ.NumInputWires) {
+        return nil
+    }
+    var wires []int
+    w := 0
+    for v, width := range circ.NumWiresIV {
+        owner := PARTY_GARBLER
+        if len(circ.InputParty) == circ.NumInputVars {
+            owner = circ.InputParty[v]
+        }
+        for j := 0; j < width; j++ {
+            if owner == party {
+                wires = append(wires, w)
+            }
+            w++
+        }
+    }
+    return wires
+}
+
+// The input wires the garbler supplies, which it sends labels for directly
+func (circ *Circuit) GarblerInputWires() []int {
+    return circ.PartyInputWires(PARTY_GARBLER)
+}
+
+// The input wires the evaluator supplies, whose labels it fetches by
+// oblivious transfer, e.g. all in one OT extension batch
+func (circ *Circuit) EvaluatorInputWires() []int {
+    return circ.PartyInputWires(PARTY_EVALUATOR)
+}
+
+// Shared logic for naming a variable. The name table is allocated on first use.
+func setVarName(names []string, numVars int, i int, name string) ([]string, error) {
+    if i < 0 || i >= numVars {
+        return nil, fmt.Errorf("index %d out of range (%d variables): %w", i, numVars, ErrOutOfRange)
+    }
+    if name == "" {
+        return nil, fmt.Errorf("empty name for variable %d", i)
+    }
+    if len(names) != numVars {
+        names = make([]string, numVars)
+    }
+    for j := range names {
+        if j != i && names[j] == name {
+            return nil, fmt.Errorf("name %q already used by variable %d", name, j)
+        }
+    }
+
+    names[i] = name
+    return names, nil
+}
+
+// Like PadInputsToBoolArray, but takes the input buffers keyed by variable
+// name. Every input variable must be named and supplied exactly once.
+func (circ *Circuit) PadInputsByName(m map[string][]byte) ([]bool, error) {
+    if len(circ.InputVarNames) != circ.NumInputVars {
+        return nil, fmt.Errorf("input variables have not been named")
+    }
+
+    for i, name := range circ.InputVarNames {
+        if name == "" {
+            return nil, fmt.Errorf("input variable %d has no name", i)
+        }
+    }
+    for name := range m {
+        if circ.inputVarIndex(name) < 0 {
+            return nil, fmt.Errorf("unknown input variable %q", name)
+        }
+    }
+
+    inputBufs := make([][]byte, circ.NumInputVars)
+    for i, name := range circ.InputVarNames {
+        buf, ok := m[name]
+        if !ok {
+            return nil, fmt.Errorf("missing input variable %q", name)
+        }
+        inputBufs[i] = buf
+    }
+
+    result := circ.PadInputsToBoolArray(inputBufs)
+    if result == nil {
+        return nil, fmt.Errorf("input buffers don't fit the circuit's input variables")
+    }
+    return result, nil
+}
+
+// Like DecodeOutputVariables, but returns the output buffers keyed by
+// variable name. Every output variable must be named.
+func (circ *Circuit) DecodeOutputsByName(outWires []bool) (map[string][]byte, error) {
+    if len(circ.OutputVarNames) != circ.NumOutputVars {
+        return nil, fmt.Errorf("output variables have not been named")
+    }
+    for i, name := range circ.OutputVarNames {
+        if name == "" {
+            return nil, fmt.Errorf("output variable %d has no name", i)
+        }
+    }
+
+    outputBufs := circ.DecodeOutputVariables(outWires)
+    if outputBufs == nil {
+        return nil, fmt.Errorf("got %d output wires, expected %d: %w", len(outWires), circ.NumOutputWires, ErrWireCountMismatch)
+    }
+
+    result := make(map[string][]byte, circ.NumOutputVars)
+    for i, name := range circ.OutputVarNames {
+        result[name] = outputBufs[i]
+    }
+    return result, nil
+}
+
+// Find the input variable with the given name, or -1 if there is none
+func (circ *Circuit) inputVarIndex(name string) int {
+    for i, n := range circ.InputVarNames {
+        if n == name {
+            return i
+        }
+    }
+    return -1
+}
@@ -0,0 +1,174 @@
+package toygarble
+
+import (
+    "bytes"
+    "errors"
+    "slices"
+    "testing"
+)
+
+func TestInputsAndOutputsByName(t *testing.T) {
+    circ := BuildAdder(8)
+    in, err := circ.PadInputsByName(map[string][]byte{"y": {55}, "x": {200}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    ok, out := circ.EvaluateCircuit(in)
+    if !ok {
+        t.Fatal("evaluation failed")
+    }
+    result, err := circ.DecodeOutputsByName(out)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(result) != 1 || !bytes.Equal(result["sum"], []byte{255}) {
+        t.Errorf("got %v, want sum 255", result)
+    }
+
+    if _, err := circ.PadInputsByName(map[string][]byte{"x": {1}}); err == nil {
+        t.Error("missing input accepted")
+    }
+    if _, err := circ.PadInputsByName(map[string][]byte{"x": {1}, "y": {2}, "z": {3}}); err == nil {
+        t.Error("unknown input accepted")
+    }
+    if _, err := circ.PadInputsByName(map[string][]byte{"x": {1}, "y": {2, 3, 4}}); err == nil {
+        t.Error("oversized input accepted")
+    }
+    if _, err := circ.DecodeOutputsByName(out[:3]); err == nil {
+        t.Error("short output accepted")
+    }
+}
+
+func TestSetVarNames(t *testing.T) {
+    circ := BuildAdder(8)
+    circ.InputVarNames = nil
+    circ.OutputVarNames = nil
+    if _, err := circ.PadInputsByName(map[string][]byte{}); err == nil {
+        t.Error("unnamed inputs accepted")
+    }
+    if _, err := circ.DecodeOutputsByName(make([]bool, 8)); err == nil {
+        t.Error("unnamed outputs accepted")
+    }
+
+    if err := circ.SetInputVarName(0, "a"); err != nil {
+        t.Fatal(err)
+    }
+    // A partly named circuit still can't be used by name
+    if _, err := circ.PadInputsByName(map[string][]byte{"a": {1}}); err == nil {
+        t.Error("partly named inputs accepted")
+    }
+    if err := circ.SetInputVarName(1, "a"); err == nil {
+        t.Error("duplicate name accepted")
+    }
+    if err := circ.SetInputVarName(1, ""); err == nil {
+        t.Error("empty name accepted")
+    }
+    if err := circ.SetInputVarName(2, "c"); err == nil {
+        t.Error("nonexistent variable named")
+    }
+    if err := circ.SetInputVarName(1, "b"); err != nil {
+        t.Fatal(err)
+    }
+    if err := circ.SetOutputVarName(0, "s"); err != nil {
+        t.Fatal(err)
+    }
+
+    in, err := circ.PadInputsByName(map[string][]byte{"a": {3}, "b": {4}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, out := circ.EvaluateCircuit(in)
+    if result, err := circ.DecodeOutputsByName(out); err != nil || !bytes.Equal(result["s"], []byte{7}) {
+        t.Errorf("got %v (%v), want s 7", result, err)
+    }
+}
+
+// Only the evaluator's variables are delivered by OT, so its wires must be
+// exactly those of the variables assigned to it
+func TestInputParty(t *testing.T) {
+    circ := BuildAdder(2)
+    circ.DeclareInput(2, 1)
+    if wires := circ.PartyInputWires(PARTY_GARBLER); !slices.Equal(wires, []int{0, 1, 2, 3, 4}) {
+        t.Errorf("with no parties the garbler has wires %v", wires)
+    }
+    if wires := circ.PartyInputWires(PARTY_EVALUATOR); len(wires) != 0 {
+        t.Errorf("with no parties the evaluator has wires %v", wires)
+    }
+
+    if err := circ.SetInputParty([]int{PARTY_EVALUATOR, PARTY_GARBLER, PARTY_EVALUATOR}); err != nil {
+        t.Fatal(err)
+    }
+    if wires := circ.PartyInputWires(PARTY_GARBLER); !slices.Equal(wires, []int{2, 3}) {
+        t.Errorf("garbler has wires %v, want [2 3]", wires)
+    }
+    if wires := circ.PartyInputWires(PARTY_EVALUATOR); !slices.Equal(wires, []int{0, 1, 4}) {
+        t.Errorf("evaluator has wires %v, want [0 1 4]", wires)
+    }
+    if !circ.validCircuit() {
+        t.Error("circuit with parties is invalid")
+    }
+
+    // The assignment survives copying and serialization
+    if !slices.Equal(circ.Clone().InputParty, circ.InputParty) {
+        t.Error("Clone dropped the parties")
+    }
+    var buf bytes.Buffer
+    if err := circ.WriteBinary(&buf); err != nil {
+        t.Fatal(err)
+    }
+    read, err := ReadBinary(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !slices.Equal(read.InputParty, circ.InputParty) {
+        t.Errorf("read back parties %v", read.InputParty)
+    }
+
+    if err := circ.SetInputParty([]int{PARTY_GARBLER}); !errors.Is(err, ErrWireCountMismatch) {
+        t.Errorf("short assignment: %v", err)
+    }
+    if err := circ.SetInputParty([]int{0, 1, 2}); !errors.Is(err, ErrOutOfRange) {
+        t.Errorf("unknown party: %v", err)
+    }
+    circ.InputParty = []int{PARTY_GARBLER}
+    if circ.validCircuit() {
+        t.Error("circuit with a short party list is valid")
+    }
+    if err := circ.SetInputParty(nil); err != nil || circ.InputParty != nil {
+        t.Errorf("clearing the parties: %v", err)
+    }
+}
+
+// Each party owning one 8-bit variable of an adder supplies exactly that
+// variable's wires, and together they cover every input once
+func TestGarblerAndEvaluatorInputWires(t *testing.T) {
+    circ := BuildAdder(8)
+    if err := circ.SetInputParty([]int{PARTY_EVALUATOR, PARTY_GARBLER}); err != nil {
+        t.Fatal(err)
+    }
+    garbler, evaluator := circ.GarblerInputWires(), circ.EvaluatorInputWires()
+    wantGarbler, wantEvaluator := make([]int, 8), make([]int, 8)
+    for i := range wantGarbler {
+        wantEvaluator[i] = i
+        wantGarbler[i] = 8 + i
+    }
+    if !slices.Equal(garbler, wantGarbler) || !slices.Equal(evaluator, wantEvaluator) {
+        t.Errorf("garbler has %v and evaluator %v", garbler, evaluator)
+    }
+    all := slices.Concat(garbler, evaluator)
+    slices.Sort(all)
+    if len(all) != circ.NumInputWires {
+        t.Fatalf("parties have %d wires in all, want %d", len(all), circ.NumInputWires)
+    }
+    for w := range all {
+        if all[w] != w {
+            t.Fatalf("parties' wires %v don't partition the inputs", all)
+        }
+    }
+
+    // Widths that don't add up to the input wires can't be split
+    circ.NumWiresIV = []int{8, 7}
+    if circ.GarblerInputWires() != nil || circ.EvaluatorInputWires() != nil {
+        t.Error("split inputs with inconsistent variable widths")
+    }
+}